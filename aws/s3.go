@@ -66,3 +66,16 @@ func (c *S3Client) GetImage(bucketName string, key string) (io.ReadCloser, error
 
 	return result.Body, nil
 }
+
+// DeleteImage removes an image from the specified S3 bucket
+func (c *S3Client) DeleteImage(bucketName string, key string) error {
+	_, err := c.S3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %q from bucket %q, %w", key, bucketName, err)
+	}
+
+	return nil
+}
@@ -13,6 +13,12 @@ type Config struct {
 	BucketName string
 	AccessId   string
 	AcessKey   string
+
+	// how often alerts are generated, e.g. "15m"
+	AlertInterval string
+
+	// command rendering PDF floor plan backgrounds, pdftoppm unless set
+	PDFRenderer string
 }
 
 func LoadConfig() (*Config, error) {
@@ -27,6 +33,9 @@ func LoadConfig() (*Config, error) {
 		BucketName: os.Getenv("BUCKET"),
 		AccessId:   os.Getenv("AWS_ACCESS_KEY_ID"),
 		AcessKey:   os.Getenv("AWS_SECRET_ACCESS_KEY"),
+
+		AlertInterval: os.Getenv("ALERT_INTERVAL"),
+		PDFRenderer:   os.Getenv("PDF_RENDERER"),
 	}
 
 	return &config, nil
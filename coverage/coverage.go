@@ -0,0 +1,453 @@
+// Package coverage works out which parts of a floor are within reach of the
+// stations on it, on a grid of square cells.
+package coverage
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/aakash-tyagi/linmed/geo"
+)
+
+// maxCandidates bounds how many positions are tried for each suggested
+// station.
+const maxCandidates = 200
+
+// Source is a station covering everything within Radius of it.
+type Source struct {
+	Position geo.Point
+	Radius   float64
+}
+
+// Wall blocks walking between its ends.
+type Wall struct {
+	From, To geo.Point
+}
+
+// Door is an opening of the given width in whatever wall runs through its
+// position.
+type Door struct {
+	Position geo.Point
+	Width    float64
+}
+
+// Plan describes the floor, in floor plan units. Only the cells whose centre
+// lies in one of Areas are analysed, or all cells when there are none. With
+// Walking set, distances are measured around walls rather than straight.
+type Plan struct {
+	Width, Height float64
+	CellSize      float64
+	Areas         []geo.Polygon
+	Walls         []Wall
+	Doors         []Door
+	Walking       bool
+}
+
+// Suggestion is a position for an extra station and how many uncovered cells
+// it would cover.
+type Suggestion struct {
+	Position geo.Point
+	Cells    int
+}
+
+// Result is the outcome of an analysis. Cell counts are per area, in the
+// order of Plan.Areas, or a single entry for the whole floor.
+type Result struct {
+	CellSize  float64
+	Cells     []int
+	Covered   []int
+	Uncovered [][]geo.Polygon
+
+	Suggestions []Suggestion
+}
+
+// directions are the eight neighbours of a cell; the first four are the ones
+// blocked edges are worked out for, the rest mirror them.
+var directions = [8][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}, {-1, 0}, {0, -1}, {-1, -1}, {-1, 1}}
+
+type grid struct {
+	plan       Plan
+	cols, rows int
+
+	// area each cell belongs to, -1 when it is not analysed
+	area    []int
+	covered []bool
+
+	// blocked holds a bit per direction a wall stops walking in
+	blocked []uint8
+}
+
+// Analyse covers the plan from the sources and then suggests up to suggest
+// positions for extra stations of radius suggestRadius, each chosen to cover
+// as much as possible of what is left.
+func Analyse(plan Plan, sources []Source, suggest int, suggestRadius float64) Result {
+	g := newGrid(plan)
+
+	for _, source := range sources {
+		for _, cell := range g.reach(source) {
+			g.covered[cell] = true
+		}
+	}
+
+	areas := len(plan.Areas)
+	if areas == 0 {
+		areas = 1
+	}
+	result := Result{
+		CellSize:  plan.CellSize,
+		Cells:     make([]int, areas),
+		Covered:   make([]int, areas),
+		Uncovered: make([][]geo.Polygon, areas),
+	}
+	for cell, area := range g.area {
+		if area < 0 {
+			continue
+		}
+		result.Cells[area]++
+		if g.covered[cell] {
+			result.Covered[area]++
+		}
+	}
+	for area := range result.Uncovered {
+		result.Uncovered[area] = g.uncovered(area)
+	}
+
+	if suggestRadius > 0 {
+		for len(result.Suggestions) < suggest {
+			suggestion, reached := g.bestPosition(suggestRadius)
+			if suggestion.Cells == 0 {
+				break
+			}
+			for _, cell := range reached {
+				g.covered[cell] = true
+			}
+			result.Suggestions = append(result.Suggestions, suggestion)
+		}
+	}
+
+	return result
+}
+
+func newGrid(plan Plan) *grid {
+	g := &grid{
+		plan: plan,
+		cols: int(math.Ceil(plan.Width / plan.CellSize)),
+		rows: int(math.Ceil(plan.Height / plan.CellSize)),
+	}
+	g.area = make([]int, g.cols*g.rows)
+	g.covered = make([]bool, g.cols*g.rows)
+
+	for cell := range g.area {
+		g.area[cell] = -1
+		if len(plan.Areas) == 0 {
+			g.area[cell] = 0
+			continue
+		}
+		centre := g.centre(cell)
+		for i, area := range plan.Areas {
+			if area.Contains(centre) {
+				g.area[cell] = i
+				break
+			}
+		}
+	}
+
+	if plan.Walking {
+		g.blockWalls()
+	}
+
+	return g
+}
+
+func (g *grid) centre(cell int) geo.Point {
+	return geo.Point{
+		X: (float64(cell%g.cols) + 0.5) * g.plan.CellSize,
+		Y: (float64(cell/g.cols) + 0.5) * g.plan.CellSize,
+	}
+}
+
+// cellAt returns the cell a point is in, clamped to the grid.
+func (g *grid) cellAt(p geo.Point) int {
+	col := int(p.X / g.plan.CellSize)
+	row := int(p.Y / g.plan.CellSize)
+	col = max(0, min(col, g.cols-1))
+	row = max(0, min(row, g.rows-1))
+	return row*g.cols + col
+}
+
+// blockWalls marks the steps between cell centres that cross a wall, leaving
+// the openings doors make in them.
+func (g *grid) blockWalls() {
+	g.blocked = make([]uint8, g.cols*g.rows)
+
+	for _, wall := range g.plan.Walls {
+		for _, part := range g.openDoors(wall) {
+			minCol := int(math.Min(part.From.X, part.To.X)/g.plan.CellSize) - 1
+			maxCol := int(math.Max(part.From.X, part.To.X)/g.plan.CellSize) + 1
+			minRow := int(math.Min(part.From.Y, part.To.Y)/g.plan.CellSize) - 1
+			maxRow := int(math.Max(part.From.Y, part.To.Y)/g.plan.CellSize) + 1
+
+			for row := max(minRow, 0); row <= min(maxRow, g.rows-1); row++ {
+				for col := max(minCol, 0); col <= min(maxCol, g.cols-1); col++ {
+					cell := row*g.cols + col
+					for d := 0; d < 4; d++ {
+						next, ok := g.neighbour(cell, d)
+						if !ok {
+							continue
+						}
+						if geo.SegmentsIntersect(g.centre(cell), g.centre(next), part.From, part.To) {
+							g.blocked[cell] |= 1 << d
+							g.blocked[next] |= 1 << (d + 4)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// openDoors splits a wall into the parts left between the doors in it.
+func (g *grid) openDoors(wall Wall) []Wall {
+	length := geo.Distance(wall.From, wall.To)
+	if length == 0 {
+		return nil
+	}
+	dx, dy := (wall.To.X-wall.From.X)/length, (wall.To.Y-wall.From.Y)/length
+
+	type gap struct{ from, to float64 }
+	var gaps []gap
+	for _, door := range g.plan.Doors {
+		// position along the wall, and how far the door is off it
+		along := (door.Position.X-wall.From.X)*dx + (door.Position.Y-wall.From.Y)*dy
+		off := math.Abs((door.Position.X-wall.From.X)*dy - (door.Position.Y-wall.From.Y)*dx)
+		if off > g.plan.CellSize/2 || along < -door.Width/2 || along > length+door.Width/2 {
+			continue
+		}
+		gaps = append(gaps, gap{along - door.Width/2, along + door.Width/2})
+	}
+
+	at := func(t float64) geo.Point {
+		return geo.Point{X: wall.From.X + dx*t, Y: wall.From.Y + dy*t}
+	}
+
+	var parts []Wall
+	start := 0.0
+	for start < length {
+		end := length
+		for _, gp := range gaps {
+			if gp.from <= start && gp.to > start {
+				start = gp.to
+				end = -1
+				break
+			}
+			if gp.from > start && gp.from < end {
+				end = gp.from
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		parts = append(parts, Wall{From: at(start), To: at(end)})
+		start = end
+	}
+
+	return parts
+}
+
+// neighbour returns the cell next to a cell in a direction.
+func (g *grid) neighbour(cell, d int) (int, bool) {
+	col := cell%g.cols + directions[d][0]
+	row := cell/g.cols + directions[d][1]
+	if col < 0 || col >= g.cols || row < 0 || row >= g.rows {
+		return 0, false
+	}
+	return row*g.cols + col, true
+}
+
+// reach returns the cells a source covers.
+func (g *grid) reach(source Source) []int {
+	if source.Radius <= 0 {
+		return nil
+	}
+	if !g.plan.Walking {
+		return g.reachStraight(source)
+	}
+	return g.reachWalking(source)
+}
+
+func (g *grid) reachStraight(source Source) []int {
+	var cells []int
+
+	minCol := max(int((source.Position.X-source.Radius)/g.plan.CellSize), 0)
+	maxCol := min(int((source.Position.X+source.Radius)/g.plan.CellSize), g.cols-1)
+	minRow := max(int((source.Position.Y-source.Radius)/g.plan.CellSize), 0)
+	maxRow := min(int((source.Position.Y+source.Radius)/g.plan.CellSize), g.rows-1)
+
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			cell := row*g.cols + col
+			if geo.Distance(source.Position, g.centre(cell)) <= source.Radius {
+				cells = append(cells, cell)
+			}
+		}
+	}
+
+	return cells
+}
+
+// reachWalking walks out from the source's cell, cheapest first, until the
+// radius is used up.
+func (g *grid) reachWalking(source Source) []int {
+	start := g.cellAt(source.Position)
+	startDistance := geo.Distance(source.Position, g.centre(start))
+	if startDistance > source.Radius {
+		return nil
+	}
+
+	distance := map[int]float64{start: startDistance}
+	queue := &cellQueue{{cell: start, distance: startDistance}}
+	var cells []int
+
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(queuedCell)
+		if current.distance > distance[current.cell] {
+			continue
+		}
+		cells = append(cells, current.cell)
+
+		for d := range directions {
+			if g.blocked[current.cell]&(1<<d) != 0 {
+				continue
+			}
+			next, ok := g.neighbour(current.cell, d)
+			if !ok {
+				continue
+			}
+
+			step := g.plan.CellSize
+			if directions[d][0] != 0 && directions[d][1] != 0 {
+				step *= math.Sqrt2
+			}
+			nextDistance := current.distance + step
+			if nextDistance > source.Radius {
+				continue
+			}
+			if known, ok := distance[next]; ok && known <= nextDistance {
+				continue
+			}
+			distance[next] = nextDistance
+			heap.Push(queue, queuedCell{cell: next, distance: nextDistance})
+		}
+	}
+
+	return cells
+}
+
+// bestPosition tries uncovered cells as the position of a new station and
+// returns the one covering the most uncovered cells, with the cells it
+// reaches.
+func (g *grid) bestPosition(radius float64) (Suggestion, []int) {
+	var candidates []int
+	for cell, area := range g.area {
+		if area >= 0 && !g.covered[cell] {
+			candidates = append(candidates, cell)
+		}
+	}
+
+	stride := len(candidates)/maxCandidates + 1
+
+	var (
+		best    Suggestion
+		reached []int
+	)
+	for i := 0; i < len(candidates); i += stride {
+		position := g.centre(candidates[i])
+		cells := g.reach(Source{Position: position, Radius: radius})
+
+		gain := 0
+		for _, cell := range cells {
+			if g.area[cell] >= 0 && !g.covered[cell] {
+				gain++
+			}
+		}
+		if gain > best.Cells {
+			best = Suggestion{Position: position, Cells: gain}
+			reached = cells
+		}
+	}
+
+	return best, reached
+}
+
+// uncovered merges the uncovered cells of an area into rectangles: runs of
+// cells along each row, joined with identical runs on the rows below.
+func (g *grid) uncovered(area int) []geo.Polygon {
+	type run struct{ from, to, top int }
+
+	var polygons []geo.Polygon
+	rect := func(r run, bottom int) {
+		size := g.plan.CellSize
+		x0, x1 := float64(r.from)*size, math.Min(float64(r.to)*size, g.plan.Width)
+		y0, y1 := float64(r.top)*size, math.Min(float64(bottom)*size, g.plan.Height)
+		polygons = append(polygons, geo.Polygon{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}})
+	}
+
+	var open []run
+	for row := 0; row <= g.rows; row++ {
+		var runs []run
+		for col := 0; row < g.rows && col < g.cols; {
+			cell := row*g.cols + col
+			if g.area[cell] != area || g.covered[cell] {
+				col++
+				continue
+			}
+			from := col
+			for col < g.cols && g.area[row*g.cols+col] == area && !g.covered[row*g.cols+col] {
+				col++
+			}
+			runs = append(runs, run{from: from, to: col, top: row})
+		}
+
+		// runs matching one still open extend it; the open ones left end here
+		var next []run
+		for _, r := range runs {
+			extended := false
+			for i, o := range open {
+				if o.from == r.from && o.to == r.to {
+					next = append(next, o)
+					open = append(open[:i], open[i+1:]...)
+					extended = true
+					break
+				}
+			}
+			if !extended {
+				next = append(next, r)
+			}
+		}
+		for _, o := range open {
+			rect(o, row)
+		}
+		open = next
+	}
+
+	return polygons
+}
+
+type queuedCell struct {
+	cell     int
+	distance float64
+}
+
+type cellQueue []queuedCell
+
+func (q cellQueue) Len() int            { return len(q) }
+func (q cellQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q cellQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *cellQueue) Push(x interface{}) { *q = append(*q, x.(queuedCell)) }
+
+func (q *cellQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
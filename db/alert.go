@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// alertRules are the conditions the alert generator evaluates. Each rule
+// selects the alert type code, a dedup key unique to the condition, the
+// customer, station and device it concerns, and a message.
+var alertRules = []string{
+	// device_expired
+	`SELECT 'device_expired' AS code, 'device_expired:' || sp.id AS dedup_key,
+		s.customer_id, s.id AS station_id, sp.id AS station_product_id,
+		format('%s at station %s expired on %s', p.name, s.name, to_char(sp.expiry_date, 'YYYY-MM-DD')) AS message
+	FROM station_products sp
+	JOIN stations s ON s.id = sp.station_id
+	JOIN products p ON p.id = sp.product_id
+	WHERE sp.expiry_date < NOW()`,
+
+	// inspection_overdue
+	`SELECT 'inspection_overdue', 'inspection_overdue:' || sp.id,
+		s.customer_id, s.id, sp.id,
+		format('%s at station %s was due for inspection on %s', p.name, s.name, to_char(sp.inspection_date, 'YYYY-MM-DD'))
+	FROM station_products sp
+	JOIN stations s ON s.id = sp.station_id
+	JOIN products p ON p.id = sp.product_id
+	WHERE sp.inspection_date < NOW()`,
+
+	// component_low, once per component slot
+	`SELECT 'component_low', 'component_low:' || sp.id || ':1',
+		s.customer_id, s.id, sp.id,
+		format('%s in %s at station %s is at %s, minimum is %s', c.name, p.name, s.name, sp.child_product_1_qty, sp.child_product_1_min_qty)
+	FROM station_products sp
+	JOIN stations s ON s.id = sp.station_id
+	JOIN products p ON p.id = sp.product_id
+	JOIN products c ON c.id = sp.child_product_1_id
+	WHERE sp.child_product_1_qty < sp.child_product_1_min_qty`,
+
+	`SELECT 'component_low', 'component_low:' || sp.id || ':2',
+		s.customer_id, s.id, sp.id,
+		format('%s in %s at station %s is at %s, minimum is %s', c.name, p.name, s.name, sp.child_product_2_qty, sp.child_product_2_min_qty)
+	FROM station_products sp
+	JOIN stations s ON s.id = sp.station_id
+	JOIN products p ON p.id = sp.product_id
+	JOIN products c ON c.id = sp.child_product_2_id
+	WHERE sp.child_product_2_qty < sp.child_product_2_min_qty`,
+
+	// station_empty
+	`SELECT 'station_empty', 'station_empty:' || s.id,
+		s.customer_id, s.id, NULL::int,
+		format('Station %s has no devices', s.name)
+	FROM stations s
+	WHERE NOT EXISTS (SELECT 1 FROM station_products sp WHERE sp.station_id = s.id)`,
+}
+
+// GenerateAlerts evaluates every alert rule. New conditions raise an alert,
+// conditions that already have an open alert bump its occurrence count, and
+// open alerts whose condition has cleared are resolved automatically. A
+// condition whose alert was resolved by hand raises no new alert until it
+// has cleared at least once.
+func (db *Database) GenerateAlerts(ctx context.Context) (models.AlertRun, error) {
+	var run models.AlertRun
+
+	candidates := strings.Join(alertRules, "\n\tUNION ALL\n\t")
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return run, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`WITH candidates AS (
+		`+candidates+`
+		),
+		upserted AS (
+			INSERT INTO alerts (alert_type_id, dedup_key, severity, message, customer_id, station_id, station_product_id)
+			SELECT t.id, c.dedup_key, t.severity, c.message, c.customer_id, c.station_id, c.station_product_id
+			FROM candidates c
+			JOIN alert_types t ON t.code = c.code
+			WHERE NOT EXISTS (
+				SELECT 1 FROM alerts r
+				WHERE r.dedup_key = c.dedup_key AND r.status = 'resolved' AND r.condition_cleared_at IS NULL
+			)
+			ON CONFLICT (dedup_key) WHERE status <> 'resolved'
+			DO UPDATE SET message = EXCLUDED.message,
+				occurrences = alerts.occurrences + 1,
+				last_seen_at = NOW(),
+				updated_at = NOW()
+			RETURNING (xmax = 0) AS inserted
+		)
+		SELECT COUNT(*) FILTER (WHERE inserted), COUNT(*) FILTER (WHERE NOT inserted)
+		FROM upserted;`,
+	).Scan(&run.Raised, &run.Updated)
+	if err != nil {
+		return run, err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`WITH candidates AS (
+		`+candidates+`
+		)
+		UPDATE alerts
+		SET status = 'resolved', resolved_at = NOW(), resolution_note = 'condition cleared',
+			condition_cleared_at = NOW(), updated_at = NOW()
+		WHERE status <> 'resolved'
+		  AND NOT EXISTS (SELECT 1 FROM candidates c WHERE c.dedup_key = alerts.dedup_key);`,
+	)
+	if err != nil {
+		return run, err
+	}
+	run.Resolved = int(tag.RowsAffected())
+
+	// alerts resolved by hand while their condition held stay resolved until
+	// it clears; after that the condition raises a new alert if it returns
+	_, err = tx.Exec(ctx,
+		`WITH candidates AS (
+		`+candidates+`
+		)
+		UPDATE alerts
+		SET condition_cleared_at = NOW(), updated_at = NOW()
+		WHERE status = 'resolved' AND condition_cleared_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM candidates c WHERE c.dedup_key = alerts.dedup_key);`,
+	)
+	if err != nil {
+		return run, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return run, err
+	}
+
+	return run, nil
+}
+
+func (db *Database) GetAlertTypes(ctx context.Context) ([]models.AlertType, error) {
+	var alertTypes []models.AlertType
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, code, name, COALESCE(description, ''), severity
+		FROM alert_types
+		ORDER BY id;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alertType models.AlertType
+		if err := rows.Scan(&alertType.ID, &alertType.Code, &alertType.Name, &alertType.Description, &alertType.Severity); err != nil {
+			return nil, err
+		}
+		alertTypes = append(alertTypes, alertType)
+	}
+
+	return alertTypes, rows.Err()
+}
+
+const alertColumns = `a.id, a.alert_type_id, t.code, a.dedup_key, a.severity, a.message,
+		a.customer_id, a.station_id, a.station_product_id, a.status, a.occurrences,
+		a.first_seen_at, a.last_seen_at, a.acknowledged_at, a.acknowledged_by,
+		a.resolved_at, a.resolved_by, COALESCE(a.resolution_note, ''), a.condition_cleared_at,
+		a.created_at, a.updated_at, sf.facility_id, COALESCE(sf.facility_name, '')`
+
+// alertFrom joins an alert a to its type and to the facility of its station.
+const alertFrom = `FROM alerts a
+		JOIN alert_types t ON t.id = a.alert_type_id
+		LEFT JOIN station_facilities sf ON sf.station_id = a.station_id`
+
+func scanAlert(row pgx.Row) (models.Alert, error) {
+	var alert models.Alert
+
+	err := row.Scan(&alert.ID, &alert.AlertTypeID, &alert.AlertTypeCode, &alert.DedupKey, &alert.Severity, &alert.Message,
+		&alert.CustomerID, &alert.StationID, &alert.StationProductID, &alert.Status, &alert.Occurrences,
+		&alert.FirstSeenAt, &alert.LastSeenAt, &alert.AcknowledgedAt, &alert.AcknowledgedBy,
+		&alert.ResolvedAt, &alert.ResolvedBy, &alert.ResolutionNote, &alert.ConditionClearedAt,
+		&alert.CreatedAt, &alert.UpdatedAt,
+		&alert.FacilityID, &alert.FacilityName)
+
+	return alert, err
+}
+
+// GetAlerts returns alerts, worst first, narrowed by status, severity,
+// customer and the facility of their station.
+func (db *Database) GetAlerts(ctx context.Context, status, severity, customerID, facilityID string, page, limit int) ([]models.Alert, int, error) {
+	var (
+		alerts []models.Alert
+		total  int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		`+alertFrom+`
+		WHERE ($1::text IS NULL OR a.status = $1::text)
+		  AND ($2::text IS NULL OR a.severity = $2::text)
+		  AND ($3::int IS NULL OR a.customer_id = $3::int)
+		  AND ($4::int IS NULL OR sf.facility_id = $4::int);`,
+		nullIfEmpty(status), nullIfEmpty(severity), nullIfEmpty(customerID), nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total alerts count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+alertColumns+`
+		`+alertFrom+`
+		WHERE ($1::text IS NULL OR a.status = $1::text)
+		  AND ($2::text IS NULL OR a.severity = $2::text)
+		  AND ($3::int IS NULL OR a.customer_id = $3::int)
+		  AND ($4::int IS NULL OR sf.facility_id = $4::int)
+		ORDER BY CASE a.severity WHEN 'high' THEN 0 WHEN 'medium' THEN 1 ELSE 2 END, a.last_seen_at DESC
+		LIMIT $5 OFFSET $6;`,
+		nullIfEmpty(status), nullIfEmpty(severity), nullIfEmpty(customerID), nullIfEmpty(facilityID),
+		limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, total, rows.Err()
+}
+
+// AcknowledgeAlert marks an active alert as seen by a user. Acknowledging an
+// already acknowledged alert leaves it unchanged.
+func (db *Database) AcknowledgeAlert(ctx context.Context, id uint, action models.AlertAction) (models.Alert, error) {
+	return db.updateAlert(ctx, id,
+		`UPDATE alerts
+		SET status = 'acknowledged', acknowledged_at = NOW(), acknowledged_by = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'active';`,
+		action.UserID,
+	)
+}
+
+// ResolveAlert closes an alert, recording who resolved it and when. The
+// generator will not raise the condition again until it has cleared.
+func (db *Database) ResolveAlert(ctx context.Context, id uint, action models.AlertAction) (models.Alert, error) {
+	return db.updateAlert(ctx, id,
+		`UPDATE alerts
+		SET status = 'resolved', resolved_at = NOW(), resolved_by = $2, resolution_note = $3, updated_at = NOW()
+		WHERE id = $1 AND status <> 'resolved';`,
+		action.UserID, action.Note,
+	)
+}
+
+func (db *Database) updateAlert(ctx context.Context, id uint, query string, args ...interface{}) (models.Alert, error) {
+	alert, err := db.getAlert(ctx, id)
+	if err != nil {
+		return alert, err
+	}
+
+	if alert.Status == string(models.AlertResolved) {
+		return alert, ErrAlertResolved
+	}
+
+	if _, err := db.Conn.Exec(ctx, query, append([]interface{}{id}, args...)...); err != nil {
+		return alert, err
+	}
+
+	return db.getAlert(ctx, id)
+}
+
+func (db *Database) getAlert(ctx context.Context, id uint) (models.Alert, error) {
+	alert, err := scanAlert(db.Conn.QueryRow(ctx,
+		`SELECT `+alertColumns+`
+		`+alertFrom+`
+		WHERE a.id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return alert, ErrNotFound
+	}
+
+	return alert, err
+}
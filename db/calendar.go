@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// calendarFeedOwner matches the feed of a customer ($1) or of a user ($2).
+const calendarFeedOwner = `(($1::int IS NOT NULL AND customer_id = $1::int) OR ($2::int IS NOT NULL AND user_id = $2::int))`
+
+// calendarTaskFilter limits tasks to a customer's devices ($3) or to the
+// devices on a technician's open work orders ($4), and optionally to the
+// devices of a facility ($5).
+const calendarTaskFilter = `($3::int IS NULL OR s.customer_id = $3::int)
+		  AND ($4::int IS NULL OR sp.id IN (
+			SELECT wod.station_product_id
+			FROM work_order_devices wod
+			JOIN work_orders wo ON wo.id = wod.work_order_id
+			WHERE wo.assigned_to = $4::int AND wo.status NOT IN ('done', 'cancelled')
+		  ))
+		  AND ($5::int IS NULL OR sf.facility_id = $5::int)`
+
+const calendarTaskColumns = `sp.id, p.name, s.id, s.name, COALESCE(fp.name, ''), c.id, c.name, sp.version, sp.updated_at,
+		sf.facility_id, COALESCE(sf.facility_name, '')`
+
+// SetCalendarFeed gives a customer or a technician a new feed token. A feed
+// they already had is replaced, so its old URL stops working.
+func (db *Database) SetCalendarFeed(ctx context.Context, feed models.CalendarFeed) (models.CalendarFeed, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return feed, err
+	}
+	defer tx.Rollback(ctx)
+
+	if feed.CustomerID != nil {
+		var exists bool
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1);`, *feed.CustomerID).Scan(&exists)
+		if err != nil {
+			return feed, err
+		}
+		if !exists {
+			return feed, ErrCustomerNotFound
+		}
+	} else {
+		if err := checkActiveUser(ctx, tx, *feed.UserID); err != nil {
+			return feed, err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM calendar_feeds WHERE `+calendarFeedOwner+`;`,
+		feed.CustomerID, feed.UserID,
+	)
+	if err != nil {
+		return feed, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO calendar_feeds (token, customer_id, user_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at;`,
+		feed.Token, feed.CustomerID, feed.UserID,
+	).Scan(&feed.ID, &feed.CreatedAt)
+	if err != nil {
+		return feed, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return feed, err
+	}
+
+	return feed, nil
+}
+
+// GetOwnerCalendarFeed returns the feed of a customer or of a technician.
+func (db *Database) GetOwnerCalendarFeed(ctx context.Context, customerID, userID *uint) (models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT id, token, customer_id, user_id, created_at
+		FROM calendar_feeds
+		WHERE `+calendarFeedOwner+`;`,
+		customerID, userID,
+	).Scan(&feed.ID, &feed.Token, &feed.CustomerID, &feed.UserID, &feed.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return feed, ErrNotFound
+	}
+
+	return feed, err
+}
+
+// DeleteCalendarFeed revokes the feed of a customer or of a technician.
+func (db *Database) DeleteCalendarFeed(ctx context.Context, customerID, userID *uint) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM calendar_feeds WHERE `+calendarFeedOwner+`;`,
+		customerID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetCalendarFeed looks a feed up by its token and names it after its owner.
+func (db *Database) GetCalendarFeed(ctx context.Context, token string) (models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT f.id, f.token, f.customer_id, f.user_id, f.created_at,
+			COALESCE(c.name, NULLIF(TRIM(CONCAT(u.first_name, ' ', u.last_name)), ''), u.username)
+		FROM calendar_feeds f
+		LEFT JOIN customers c ON c.id = f.customer_id
+		LEFT JOIN users u ON u.id = f.user_id
+		WHERE f.token = $1 AND (f.user_id IS NULL OR u.is_active);`,
+		token,
+	).Scan(&feed.ID, &feed.Token, &feed.CustomerID, &feed.UserID, &feed.CreatedAt, &feed.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return feed, ErrNotFound
+	}
+
+	return feed, err
+}
+
+// GetCalendarTasks returns the expiry and inspection dates between from and
+// to of a customer's devices or of the devices on a technician's open work
+// orders, in date order, optionally only those of a facility. They are read
+// the same way as the dashboard's expiry and inspection tasks.
+func (db *Database) GetCalendarTasks(ctx context.Context, customerID, userID *uint, facilityID string, from, to time.Time) ([]models.CalendarTask, error) {
+	var tasks []models.CalendarTask
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT 'expiry', sp.expiry_date, `+calendarTaskColumns+`
+		`+deviceTaskJoins+`
+		LEFT JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		`+stationFacility+`
+		WHERE sp.expiry_date BETWEEN $1::timestamptz AND $2::timestamptz AND `+calendarTaskFilter+`
+		UNION ALL
+		SELECT 'inspection', sp.inspection_date, `+calendarTaskColumns+`
+		`+deviceTaskJoins+`
+		LEFT JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		`+stationFacility+`
+		WHERE sp.inspection_date BETWEEN $1::timestamptz AND $2::timestamptz AND `+calendarTaskFilter+`
+		ORDER BY 2, 3, 1;`,
+		from, to, customerID, userID, nullIfEmpty(facilityID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task models.CalendarTask
+		if err := rows.Scan(&task.Kind, &task.Date, &task.StationProductID, &task.ProductName, &task.StationID,
+			&task.StationName, &task.FloorPlanName, &task.CustomerID, &task.CustomerName, &task.Version,
+			&task.UpdatedAt, &task.FacilityID, &task.FacilityName); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
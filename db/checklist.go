@@ -0,0 +1,900 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// followUpDueDays is how long after a failed checklist its follow-up work
+// order falls due.
+const followUpDueDays = 7
+
+const checklistTemplateColumns = `id, name, COALESCE(description, ''), category_id, product_id, active, created_by,
+		created_at, updated_at`
+
+const checklistResultColumns = `r.id, r.template_id, r.template_name, r.station_product_id, r.station_id,
+		r.customer_id, r.work_order_id, r.submitted_by, r.submitted_at, r.passed, r.failed_items,
+		COALESCE(r.notes, ''), r.follow_up_work_order_id`
+
+const checklistResultFilter = `WHERE ($1::int IS NULL OR r.customer_id = $1::int)
+	  AND ($2::int IS NULL OR r.station_product_id = $2::int)
+	  AND ($3::int IS NULL OR r.template_id = $3::int)
+	  AND ($4::bool IS NULL OR r.passed = $4::bool)
+	  AND ($5::timestamptz IS NULL OR r.submitted_at >= $5::timestamptz)
+	  AND ($6::timestamptz IS NULL OR r.submitted_at < $6::timestamptz)
+	  AND ($7::int IS NULL OR EXISTS (
+		SELECT 1 FROM station_facilities sf WHERE sf.station_id = r.station_id AND sf.facility_id = $7::int))`
+
+func scanChecklistTemplate(row pgx.Row) (models.ChecklistTemplate, error) {
+	var t models.ChecklistTemplate
+
+	err := row.Scan(&t.ID, &t.Name, &t.Description, &t.CategoryID, &t.ProductID, &t.Active, &t.CreatedBy,
+		&t.CreatedAt, &t.UpdatedAt)
+
+	return t, err
+}
+
+func scanChecklistResult(row pgx.Row) (models.ChecklistResult, error) {
+	var r models.ChecklistResult
+
+	err := row.Scan(&r.ID, &r.TemplateID, &r.TemplateName, &r.StationProductID, &r.StationID, &r.CustomerID,
+		&r.WorkOrderID, &r.SubmittedBy, &r.SubmittedAt, &r.Passed, &r.FailedItems, &r.Notes,
+		&r.FollowUpWorkOrderID)
+
+	return r, err
+}
+
+// checkChecklistScope checks the category or product a template applies to exists.
+func checkChecklistScope(ctx context.Context, q queryer, t models.ChecklistTemplate) error {
+	var exists bool
+
+	if t.ProductID != nil {
+		err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1);`, *t.ProductID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrProductNotFound
+		}
+	}
+
+	if t.CategoryID != nil {
+		err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1);`, *t.CategoryID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCategoryNotFound
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) AddChecklistTemplate(ctx context.Context, t models.ChecklistTemplate) (uint, error) {
+	var id uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkChecklistScope(ctx, tx, t); err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO checklist_templates (
+		name,
+		description,
+		category_id,
+		product_id,
+		active,
+		created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id;`,
+		t.Name, t.Description, t.CategoryID, t.ProductID, t.Active, t.CreatedBy,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, item := range t.Items {
+		if _, err := insertChecklistItem(ctx, tx, id, i+1, item); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func insertChecklistItem(ctx context.Context, tx pgx.Tx, templateID uint, position int, item models.ChecklistItem) (uint, error) {
+	var id uint
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO checklist_items (
+		template_id,
+		position,
+		question,
+		item_type,
+		required,
+		min_value,
+		max_value,
+		unit,
+		creates_follow_up)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id;`,
+		templateID, position, item.Question, item.Type, item.Required, item.MinValue, item.MaxValue,
+		item.Unit, item.CreatesFollowUp,
+	).Scan(&id)
+
+	return id, err
+}
+
+func (db *Database) GetChecklistTemplate(ctx context.Context, id uint) (models.ChecklistTemplate, error) {
+	t, err := scanChecklistTemplate(db.Conn.QueryRow(ctx,
+		`SELECT `+checklistTemplateColumns+`
+		FROM checklist_templates
+		WHERE id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+
+	t.Items, err = getChecklistItems(ctx, db.Conn, id)
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// rowsQueryer is satisfied by both the pool and a transaction.
+type rowsQueryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func getChecklistItems(ctx context.Context, q rowsQueryer, templateID uint) ([]models.ChecklistItem, error) {
+	var items []models.ChecklistItem
+
+	rows, err := q.Query(ctx,
+		`SELECT id, template_id, position, question, item_type, required, min_value, max_value,
+		COALESCE(unit, ''), creates_follow_up
+		FROM checklist_items
+		WHERE template_id = $1
+		ORDER BY position, id;`,
+		templateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ChecklistItem
+		if err := rows.Scan(&item.ID, &item.TemplateID, &item.Position, &item.Question, &item.Type,
+			&item.Required, &item.MinValue, &item.MaxValue, &item.Unit, &item.CreatesFollowUp); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// GetChecklistTemplates lists templates without their items, optionally
+// narrowed to a category or product. Inactive templates are only listed
+// when includeInactive is set.
+func (db *Database) GetChecklistTemplates(ctx context.Context, categoryID, productID string, includeInactive bool) ([]models.ChecklistTemplate, error) {
+	var templates []models.ChecklistTemplate
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+checklistTemplateColumns+`
+		FROM checklist_templates
+		WHERE ($1::int IS NULL OR category_id = $1::int)
+		  AND ($2::int IS NULL OR product_id = $2::int)
+		  AND (active OR $3)
+		ORDER BY name, id;`,
+		nullIfEmpty(categoryID), nullIfEmpty(productID), includeInactive,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanChecklistTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// UpdateChecklistTemplate replaces a template and its items. Items carrying
+// the id of one of the template's items are updated in place, others are
+// added, and items left out are removed. Submitted results keep their copy
+// of the questions.
+func (db *Database) UpdateChecklistTemplate(ctx context.Context, id uint, t models.ChecklistTemplate) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkChecklistScope(ctx, tx, t); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE checklist_templates
+		SET name = $2, description = $3, category_id = $4, product_id = $5, active = $6, updated_at = NOW()
+		WHERE id = $1;`,
+		id, t.Name, t.Description, t.CategoryID, t.ProductID, t.Active,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	existing, err := getChecklistItems(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	onTemplate := map[uint]bool{}
+	for _, item := range existing {
+		onTemplate[item.ID] = true
+	}
+
+	var keep []uint
+	for i, item := range t.Items {
+		if !onTemplate[item.ID] {
+			itemID, err := insertChecklistItem(ctx, tx, id, i+1, item)
+			if err != nil {
+				return err
+			}
+			keep = append(keep, itemID)
+			continue
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE checklist_items
+			SET position = $2, question = $3, item_type = $4, required = $5, min_value = $6,
+				max_value = $7, unit = $8, creates_follow_up = $9
+			WHERE id = $1;`,
+			item.ID, i+1, item.Question, item.Type, item.Required, item.MinValue, item.MaxValue,
+			item.Unit, item.CreatesFollowUp,
+		)
+		if err != nil {
+			return err
+		}
+		keep = append(keep, item.ID)
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM checklist_items
+		WHERE template_id = $1 AND NOT (id = ANY($2::int[]));`,
+		id, keep,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteChecklistTemplate removes a template. Submitted results are kept.
+func (db *Database) DeleteChecklistTemplate(ctx context.Context, id uint) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM checklist_templates
+		WHERE id = $1;`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetDeviceChecklist returns the active template that applies to a device:
+// the newest template for its product, or else for its category.
+func (db *Database) GetDeviceChecklist(ctx context.Context, stationProductID uint) (models.ChecklistTemplate, error) {
+	var (
+		productID  uint
+		categoryID uint
+	)
+	err := db.Conn.QueryRow(ctx,
+		`SELECT sp.product_id, p.category_id
+		FROM station_products sp
+		JOIN products p ON p.id = sp.product_id
+		WHERE sp.id = $1;`,
+		stationProductID,
+	).Scan(&productID, &categoryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ChecklistTemplate{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ChecklistTemplate{}, err
+	}
+
+	templateID, err := resolveChecklistTemplate(ctx, db.Conn, productID, categoryID)
+	if err != nil {
+		return models.ChecklistTemplate{}, err
+	}
+
+	return db.GetChecklistTemplate(ctx, templateID)
+}
+
+func resolveChecklistTemplate(ctx context.Context, q queryer, productID, categoryID uint) (uint, error) {
+	var id uint
+
+	err := q.QueryRow(ctx,
+		`SELECT id
+		FROM checklist_templates
+		WHERE active AND (product_id = $1 OR category_id = $2)
+		ORDER BY product_id IS NULL, id DESC
+		LIMIT 1;`,
+		productID, categoryID,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNoChecklist
+	}
+
+	return id, err
+}
+
+// SubmitChecklist records a completed checklist for a device. When an item
+// fails the device is flagged as needing attention, and a follow-up work
+// order is opened if a failed item asks for one and the device is not
+// already on an open follow-up. A checklist without failures clears the flag.
+func (db *Database) SubmitChecklist(ctx context.Context, stationProductID uint, sub models.ChecklistSubmission) (models.ChecklistResult, error) {
+	result := models.ChecklistResult{
+		StationProductID: stationProductID,
+		WorkOrderID:      sub.WorkOrderID,
+		SubmittedBy:      &sub.SubmittedBy,
+		Notes:            sub.Notes,
+	}
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		stationName string
+		productID   uint
+		categoryID  uint
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT sp.station_id, s.customer_id, s.name, sp.product_id, p.category_id
+		FROM station_products sp
+		JOIN stations s ON s.id = sp.station_id
+		JOIN products p ON p.id = sp.product_id
+		WHERE sp.id = $1
+		FOR UPDATE OF sp;`,
+		stationProductID,
+	).Scan(&result.StationID, &result.CustomerID, &stationName, &productID, &categoryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, ErrNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if err := checkActiveUser(ctx, tx, sub.SubmittedBy); err != nil {
+		return result, err
+	}
+
+	var templateID uint
+	if sub.TemplateID == nil {
+		templateID, err = resolveChecklistTemplate(ctx, tx, productID, categoryID)
+		if err != nil {
+			return result, err
+		}
+	} else {
+		templateID = *sub.TemplateID
+
+		var applies bool
+		err = tx.QueryRow(ctx,
+			`SELECT COALESCE(product_id = $2, category_id = $3)
+			FROM checklist_templates
+			WHERE id = $1 AND active;`,
+			templateID, productID, categoryID,
+		).Scan(&applies)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return result, ErrNoChecklist
+		}
+		if err != nil {
+			return result, err
+		}
+		if !applies {
+			return result, ErrChecklistNotApplicable
+		}
+	}
+	result.TemplateID = &templateID
+
+	err = tx.QueryRow(ctx, `SELECT name FROM checklist_templates WHERE id = $1;`, templateID).Scan(&result.TemplateName)
+	if err != nil {
+		return result, err
+	}
+
+	if sub.WorkOrderID != nil {
+		var onWorkOrder bool
+		err = tx.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM work_order_devices
+				WHERE work_order_id = $1 AND station_product_id = $2
+			);`,
+			*sub.WorkOrderID, stationProductID,
+		).Scan(&onWorkOrder)
+		if err != nil {
+			return result, err
+		}
+		if !onWorkOrder {
+			return result, ErrDeviceNotOnWorkOrder
+		}
+	}
+
+	items, err := getChecklistItems(ctx, tx, templateID)
+	if err != nil {
+		return result, err
+	}
+
+	answers, err := evaluateChecklist(items, sub.Responses)
+	if err != nil {
+		return result, err
+	}
+	if err := checkPhotoKeys(ctx, tx, stationProductID, sub.WorkOrderID, answers); err != nil {
+		return result, err
+	}
+	result.Items = answers
+
+	var (
+		failed   []string
+		followUp bool
+	)
+	for _, answer := range answers {
+		if answer.Passed {
+			continue
+		}
+		failed = append(failed, answer.Question)
+		if itemCreatesFollowUp(items, answer.ItemID) {
+			followUp = true
+		}
+	}
+	result.FailedItems = len(failed)
+	result.Passed = len(failed) == 0
+
+	if followUp {
+		result.FollowUpWorkOrderID, err = openFollowUp(ctx, tx, result, stationName, failed)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO checklist_results (
+		template_id,
+		template_name,
+		station_product_id,
+		station_id,
+		customer_id,
+		work_order_id,
+		submitted_by,
+		passed,
+		failed_items,
+		notes,
+		follow_up_work_order_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, submitted_at;`,
+		result.TemplateID, result.TemplateName, result.StationProductID, result.StationID, result.CustomerID,
+		result.WorkOrderID, result.SubmittedBy, result.Passed, result.FailedItems, result.Notes,
+		result.FollowUpWorkOrderID,
+	).Scan(&result.ID, &result.SubmittedAt)
+	if err != nil {
+		return result, err
+	}
+
+	for _, answer := range answers {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO checklist_result_items (
+			result_id,
+			item_id,
+			position,
+			question,
+			item_type,
+			pass_value,
+			number_value,
+			text_value,
+			photo_keys,
+			passed,
+			comment)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`,
+			result.ID, answer.ItemID, answer.Position, answer.Question, answer.Type, answer.Pass,
+			answer.Number, answer.Text, nonNilStrings(answer.PhotoKeys), answer.Passed, answer.Comment,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// photos taken outside a work order are kept with the result they answer
+	var photoKeys []string
+	for _, answer := range answers {
+		photoKeys = append(photoKeys, answer.PhotoKeys...)
+	}
+	if len(photoKeys) > 0 {
+		_, err = tx.Exec(ctx,
+			`UPDATE evidence
+			SET checklist_result_id = $1
+			WHERE image_key = ANY($2::text[]) AND work_order_id IS NULL;`,
+			result.ID, photoKeys,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if result.Passed {
+		_, err = tx.Exec(ctx,
+			`UPDATE station_products
+			SET needs_attention = FALSE, attention_reason = NULL, updated_at = NOW()
+			WHERE id = $1 AND needs_attention;`,
+			stationProductID,
+		)
+	} else {
+		_, err = tx.Exec(ctx,
+			`UPDATE station_products
+			SET needs_attention = TRUE, attention_reason = $2, updated_at = NOW()
+			WHERE id = $1;`,
+			stationProductID, fmt.Sprintf("Failed %s: %s", result.TemplateName, strings.Join(failed, "; ")),
+		)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// evaluateChecklist checks the responses against the template items and
+// returns the answers in template order. Optional items left unanswered are
+// left out.
+func evaluateChecklist(items []models.ChecklistItem, responses []models.ChecklistResponse) ([]models.ChecklistResultItem, error) {
+	byItem := map[uint]models.ChecklistResponse{}
+	for _, response := range responses {
+		if _, ok := byItem[response.ItemID]; ok {
+			return nil, fmt.Errorf("%w: item %d is answered more than once", ErrInvalidChecklistResponse, response.ItemID)
+		}
+		byItem[response.ItemID] = response
+	}
+
+	var answers []models.ChecklistResultItem
+	for _, item := range items {
+		response, ok := byItem[item.ID]
+		delete(byItem, item.ID)
+
+		itemID := item.ID
+		answer := models.ChecklistResultItem{
+			ItemID:   &itemID,
+			Position: item.Position,
+			Question: item.Question,
+			Type:     item.Type,
+			Comment:  response.Comment,
+			Passed:   true,
+		}
+
+		var answered bool
+		switch models.ChecklistItemType(item.Type) {
+		case models.ChecklistPassFail:
+			answered = response.Pass != nil
+			if answered {
+				answer.Pass = response.Pass
+				answer.Passed = *response.Pass
+			}
+		case models.ChecklistNumber:
+			answered = response.Number != nil
+			if answered {
+				answer.Number = response.Number
+				answer.Passed = (item.MinValue == nil || *response.Number >= *item.MinValue) &&
+					(item.MaxValue == nil || *response.Number <= *item.MaxValue)
+			}
+		case models.ChecklistText:
+			answered = strings.TrimSpace(response.Text) != ""
+			answer.Text = response.Text
+		case models.ChecklistPhoto:
+			answered = len(response.PhotoKeys) > 0
+			answer.PhotoKeys = response.PhotoKeys
+		}
+
+		if !ok || !answered {
+			if item.Required {
+				return nil, fmt.Errorf("%w: item %d (%s) must be answered", ErrInvalidChecklistResponse, item.ID, item.Question)
+			}
+			continue
+		}
+
+		answers = append(answers, answer)
+	}
+
+	for itemID := range byItem {
+		return nil, fmt.Errorf("%w: item %d is not on this checklist", ErrInvalidChecklistResponse, itemID)
+	}
+
+	return answers, nil
+}
+
+// checkPhotoKeys makes sure every photo answered refers to photo evidence
+// of the device, or of the whole visit on the submission's work order. A
+// photo taken outside a work order can be answered in one checklist only.
+func checkPhotoKeys(ctx context.Context, tx pgx.Tx, stationProductID uint, workOrderID *uint, answers []models.ChecklistResultItem) error {
+	for _, answer := range answers {
+		if len(answer.PhotoKeys) == 0 {
+			continue
+		}
+
+		var unknown []string
+		err := tx.QueryRow(ctx,
+			`SELECT ARRAY(
+				SELECT k FROM unnest($1::text[]) k
+				WHERE NOT EXISTS (
+					SELECT 1 FROM evidence e
+					WHERE e.image_key = k AND e.type = 'photo'
+					  AND (e.station_product_id = $2
+					       OR (e.work_order_id = $3::int AND e.station_product_id IS NULL))
+					  AND (e.work_order_id IS NOT NULL OR e.checklist_result_id IS NULL)
+				)
+			);`,
+			answer.PhotoKeys, stationProductID, workOrderID,
+		).Scan(&unknown)
+		if err != nil {
+			return err
+		}
+		if len(unknown) > 0 {
+			return fmt.Errorf("%w: item %d (%s) refers to photo %q, which is not evidence of this device or is answered in another checklist",
+				ErrInvalidChecklistResponse, *answer.ItemID, answer.Question, unknown[0])
+		}
+	}
+	return nil
+}
+
+func itemCreatesFollowUp(items []models.ChecklistItem, itemID *uint) bool {
+	for _, item := range items {
+		if itemID != nil && item.ID == *itemID {
+			return item.CreatesFollowUp
+		}
+	}
+	return false
+}
+
+// openFollowUp returns the open follow-up work order the device is on,
+// creating one when there is none.
+func openFollowUp(ctx context.Context, tx pgx.Tx, result models.ChecklistResult, stationName string, failed []string) (*uint, error) {
+	var id uint
+
+	err := tx.QueryRow(ctx,
+		`SELECT wo.id
+		FROM work_orders wo
+		JOIN work_order_devices wod ON wod.work_order_id = wo.id
+		WHERE wod.station_product_id = $1
+		  AND wo.type = 'follow_up'
+		  AND wo.status NOT IN ('done', 'cancelled')
+		ORDER BY wo.id
+		LIMIT 1;`,
+		result.StationProductID,
+	).Scan(&id)
+	if err == nil {
+		return &id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	id, err = insertWorkOrder(ctx, tx, models.WorkOrder{
+		CustomerID:  result.CustomerID,
+		StationID:   result.StationID,
+		Type:        string(models.WorkOrderFollowUp),
+		Title:       workOrderTitle(string(models.WorkOrderFollowUp), stationName),
+		Description: fmt.Sprintf("Failed %s: %s", result.TemplateName, strings.Join(failed, "; ")),
+		Priority:    string(models.PriorityHigh),
+		DueDate:     time.Now().AddDate(0, 0, followUpDueDays),
+		CreatedBy:   result.SubmittedBy,
+		DeviceIDs:   []uint{result.StationProductID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+// nonNilStrings keeps a NOT NULL array column from receiving NULL.
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// GetChecklistResults lists submitted checklists, newest first, without
+// their answers. passed narrows to passed or failed checklists; from and to bound the submission time.
+func (db *Database) GetChecklistResults(ctx context.Context, customerID, stationProductID, templateID, facilityID string, passed *bool, from, to *time.Time, page, limit int) ([]models.ChecklistResult, int, error) {
+	var (
+		results []models.ChecklistResult
+		total   int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM checklist_results r
+		`+checklistResultFilter+`;`,
+		nullIfEmpty(customerID), nullIfEmpty(stationProductID), nullIfEmpty(templateID), passed,
+		from, to, nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total checklist results count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+checklistResultColumns+`
+		FROM checklist_results r
+		`+checklistResultFilter+`
+		ORDER BY r.submitted_at DESC, r.id DESC
+		LIMIT $8 OFFSET $9;`,
+		nullIfEmpty(customerID), nullIfEmpty(stationProductID), nullIfEmpty(templateID), passed,
+		from, to, nullIfEmpty(facilityID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result, err := scanChecklistResult(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
+
+	return results, total, rows.Err()
+}
+
+// GetChecklistResult returns a submitted checklist with its answers.
+func (db *Database) GetChecklistResult(ctx context.Context, id uint) (models.ChecklistResult, error) {
+	result, err := scanChecklistResult(db.Conn.QueryRow(ctx,
+		`SELECT `+checklistResultColumns+`
+		FROM checklist_results r
+		WHERE r.id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, ErrNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT item_id, position, question, item_type, pass_value, number_value, COALESCE(text_value, ''),
+		photo_keys, passed, COALESCE(comment, '')
+		FROM checklist_result_items
+		WHERE result_id = $1
+		ORDER BY position, id;`,
+		id,
+	)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ChecklistResultItem
+		if err := rows.Scan(&item.ItemID, &item.Position, &item.Question, &item.Type, &item.Pass, &item.Number,
+			&item.Text, &item.PhotoKeys, &item.Passed, &item.Comment); err != nil {
+			return result, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	result.Evidence, err = db.getChecklistEvidence(ctx, id)
+
+	return result, err
+}
+
+// GetChecklistReport summarises the results of a template: how often it
+// passed and, per current item, how often it failed and the spread of
+// numeric answers. customerID, facilityID, from and to narrow the results
+// counted.
+func (db *Database) GetChecklistReport(ctx context.Context, templateID uint, customerID, facilityID string, from, to *time.Time) (models.ChecklistReport, error) {
+	report := models.ChecklistReport{TemplateID: templateID}
+
+	err := db.Conn.QueryRow(ctx, `SELECT name FROM checklist_templates WHERE id = $1;`, templateID).Scan(&report.TemplateName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return report, ErrNotFound
+	}
+	if err != nil {
+		return report, err
+	}
+
+	err = db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE r.passed)
+		FROM checklist_results r
+		`+checklistResultFilter+`;`,
+		nullIfEmpty(customerID), nil, templateID, nil, from, to, nullIfEmpty(facilityID),
+	).Scan(&report.Submissions, &report.Passed)
+	if err != nil {
+		return report, err
+	}
+	if report.Submissions > 0 {
+		report.PassRate = float64(report.Passed) / float64(report.Submissions)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT ci.id, ci.position, ci.question, ci.item_type,
+			COUNT(ri.id), COUNT(ri.id) FILTER (WHERE NOT ri.passed),
+			AVG(ri.number_value), MIN(ri.number_value), MAX(ri.number_value)
+		FROM checklist_items ci
+		LEFT JOIN (checklist_result_items ri
+			JOIN checklist_results r ON r.id = ri.result_id
+				AND ($2::int IS NULL OR r.customer_id = $2::int)
+				AND ($3::timestamptz IS NULL OR r.submitted_at >= $3::timestamptz)
+				AND ($4::timestamptz IS NULL OR r.submitted_at < $4::timestamptz)
+				AND ($5::int IS NULL OR EXISTS (
+					SELECT 1 FROM station_facilities sf WHERE sf.station_id = r.station_id AND sf.facility_id = $5::int))
+		) ON ri.item_id = ci.id
+		WHERE ci.template_id = $1
+		GROUP BY ci.id
+		ORDER BY ci.position, ci.id;`,
+		templateID, nullIfEmpty(customerID), from, to, nullIfEmpty(facilityID),
+	)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ChecklistItemReport
+		if err := rows.Scan(&item.ItemID, &item.Position, &item.Question, &item.Type, &item.Answered, &item.Failed,
+			&item.AverageValue, &item.LowestValue, &item.HighestValue); err != nil {
+			return report, err
+		}
+		if item.Answered > 0 {
+			item.FailureRate = float64(item.Failed) / float64(item.Answered)
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	return report, rows.Err()
+}
@@ -7,15 +7,34 @@ import (
 	"github.com/aakash-tyagi/linmed/models"
 )
 
-func (db *Database) GetAllNumbers(ctx context.Context) (models.Dashboard, error) {
+// deviceTaskJoins reaches a device's station, customer and product; the
+// expiry and inspection tasks are read through it.
+const deviceTaskJoins = `FROM station_products sp
+		JOIN stations s ON s.id = sp.station_id
+		JOIN customers c ON c.id = s.customer_id
+		JOIN products p ON p.id = sp.product_id`
+
+// GetAllNumbers counts customers, stations, products and devices. For a
+// facility it counts its customer, its stations and devices, and the
+// products installed there.
+func (db *Database) GetAllNumbers(ctx context.Context, facilityID string) (models.Dashboard, error) {
 	var dashboard models.Dashboard
 
 	err := db.Conn.QueryRow(ctx,
 		`SELECT
-			(SELECT COUNT(*) FROM customers) as customer_count,
-			(SELECT COUNT(*) FROM stations) as station_count,
-			(SELECT COUNT(*) FROM products) as product_count,
-			(SELECT COUNT(*) FROM station_products) as station_product_count;`,
+			(SELECT COUNT(*) FROM customers c
+				WHERE $1::int IS NULL
+				   OR EXISTS (SELECT 1 FROM facilities f WHERE f.id = $1::int AND f.customer_id = c.id)) as customer_count,
+			(SELECT COUNT(*) FROM stations s `+stationFacility+`
+				WHERE $1::int IS NULL OR sf.facility_id = $1::int) as station_count,
+			(SELECT COUNT(*) FROM products p
+				WHERE $1::int IS NULL
+				   OR EXISTS (SELECT 1 FROM station_products sp
+						JOIN station_facilities sf ON sf.station_id = sp.station_id
+						WHERE sp.product_id = p.id AND sf.facility_id = $1::int)) as product_count,
+			(SELECT COUNT(*) FROM station_products sp JOIN stations s ON s.id = sp.station_id `+stationFacility+`
+				WHERE $1::int IS NULL OR sf.facility_id = $1::int) as station_product_count;`,
+		nullIfEmpty(facilityID),
 	).Scan(&dashboard.CustomerCount, &dashboard.StationCount, &dashboard.ProductCount, &dashboard.StationProductCount)
 	if err != nil {
 		return dashboard, err
@@ -24,33 +43,27 @@ func (db *Database) GetAllNumbers(ctx context.Context) (models.Dashboard, error)
 	return dashboard, nil
 }
 
-func (db *Database) GetExpiringProducts(ctx context.Context, startDate, endDate, customerId string, page, limit int) ([]models.StationProduct, int, error) {
+// GetExpiringProducts lists the devices expiring between startDate and
+// endDate, optionally only those of a customer or facility.
+func (db *Database) GetExpiringProducts(ctx context.Context, startDate, endDate, customerId, facilityId string, page, limit int) ([]models.StationProduct, int, error) {
 	// Calculate offset for pagination
 	offset := (page - 1) * limit
 
+	filter := `WHERE sp.expiry_date BETWEEN $1 AND $2
+			    AND ($3::int IS NULL OR c.id = $3::int)
+			    AND ($4::int IS NULL OR sf.facility_id = $4::int)`
+
 	// Base SQL query for fetching expiring products
 	query := `SELECT sp.id, sp.station_id, sp.product_id, sp.installation_date, sp.expiry_date, sp.inspection_date, sp.created_at, sp.updated_at,
 					 sp.child_product_1_id, sp.child_product_1_qty, sp.child_product_2_id, sp.child_product_2_qty,
-					 c.name AS customer_name, p.name AS product_name
-			  FROM station_products sp
-			  JOIN customers c ON sp.station_id = c.id
-			  JOIN products p ON sp.product_id = p.id
-			  WHERE sp.expiry_date BETWEEN $1 AND $2`
-
-	var args []interface{}
-	args = append(args, startDate, endDate)
-
-	// Add customer filter if customerId is provided
-	if customerId != "" {
-		query += " AND c.id = $3"
-		args = append(args, customerId)
-	}
-
-	query += fmt.Sprintf(" ORDER BY sp.expiry_date ASC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
-	args = append(args, limit, offset)
+					 c.name AS customer_name, p.name AS product_name, sf.facility_id, COALESCE(sf.facility_name, '')
+			  ` + deviceTaskJoins + `
+			  ` + stationFacility + `
+			  ` + filter + `
+			  ORDER BY sp.expiry_date ASC LIMIT $5 OFFSET $6`
 
 	// Use db.Conn instead of conn
-	rows, err := db.Conn.Query(ctx, query, args...)
+	rows, err := db.Conn.Query(ctx, query, startDate, endDate, nullIfEmpty(customerId), nullIfEmpty(facilityId), limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -76,6 +89,8 @@ func (db *Database) GetExpiringProducts(ctx context.Context, startDate, endDate,
 			&product.ChildProduct2Qty,
 			&product.CustomerName,
 			&product.ProductName,
+			&product.FacilityID,
+			&product.FacilityName,
 		); err != nil {
 			return nil, 0, err
 		}
@@ -88,20 +103,12 @@ func (db *Database) GetExpiringProducts(ctx context.Context, startDate, endDate,
 	}
 
 	// Total count query
-	countQuery := `SELECT COUNT(*) FROM station_products sp
-				   JOIN customers c ON sp.station_id = c.id
-				   WHERE sp.expiry_date BETWEEN $1 AND $2`
-
-	if customerId != "" {
-		countQuery += " AND c.id = $3"
-	}
+	countQuery := `SELECT COUNT(*) ` + deviceTaskJoins + `
+				   ` + stationFacility + `
+				   ` + filter
 
 	var totalCount int
-	if customerId != "" {
-		err = db.Conn.QueryRow(ctx, countQuery, startDate, endDate, customerId).Scan(&totalCount)
-	} else {
-		err = db.Conn.QueryRow(ctx, countQuery, startDate, endDate).Scan(&totalCount)
-	}
+	err = db.Conn.QueryRow(ctx, countQuery, startDate, endDate, nullIfEmpty(customerId), nullIfEmpty(facilityId)).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -110,29 +117,37 @@ func (db *Database) GetExpiringProducts(ctx context.Context, startDate, endDate,
 	return expiringProducts, totalCount, nil
 }
 
-func (db *Database) GetInspectionTasks(ctx context.Context, startDate, endDate string, page, limit int) ([]models.StationProduct, int, error) {
+// GetInspectionTasks lists the devices due for inspection between startDate
+// and endDate, optionally only those of a facility.
+func (db *Database) GetInspectionTasks(ctx context.Context, startDate, endDate, facilityId string, page, limit int) ([]models.StationProduct, int, error) {
 	var total int
 	var tasks []models.StationProduct
 
+	filter := `WHERE sp.inspection_date BETWEEN $1 AND $2
+		  AND ($3::int IS NULL OR sf.facility_id = $3::int)`
+
 	// Get total count
 	err := db.Conn.QueryRow(ctx, `
-		SELECT COUNT(*) 
-		FROM station_products 
-		WHERE inspection_date BETWEEN $1 AND $2`,
-		startDate, endDate).Scan(&total)
+		SELECT COUNT(*)
+		`+deviceTaskJoins+`
+		`+stationFacility+`
+		`+filter,
+		startDate, endDate, nullIfEmpty(facilityId)).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("count query failed: %v", err)
 	}
 
 	// Get paginated results
-	query := `SELECT id, station_id, product_id, installation_date, expiry_date, inspection_date, created_at, updated_at 
-			 FROM station_products 
-			 WHERE inspection_date BETWEEN $1 AND $2
-			 ORDER BY inspection_date ASC
-			 LIMIT $3 OFFSET $4`
+	query := `SELECT sp.id, sp.station_id, sp.product_id, sp.installation_date, sp.expiry_date, sp.inspection_date,
+				 sp.created_at, sp.updated_at, c.name, p.name, sf.facility_id, COALESCE(sf.facility_name, '')
+			 ` + deviceTaskJoins + `
+			 ` + stationFacility + `
+			 ` + filter + `
+			 ORDER BY sp.inspection_date ASC
+			 LIMIT $4 OFFSET $5`
 
 	offset := (page - 1) * limit
-	rows, err := db.Conn.Query(ctx, query, startDate, endDate, limit, offset)
+	rows, err := db.Conn.Query(ctx, query, startDate, endDate, nullIfEmpty(facilityId), limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("query execution failed: %v", err)
 	}
@@ -149,6 +164,10 @@ func (db *Database) GetInspectionTasks(ctx context.Context, startDate, endDate s
 			&task.InspectionDate,
 			&task.CreatedAt,
 			&task.UpdatedAt,
+			&task.CustomerName,
+			&task.ProductName,
+			&task.FacilityID,
+			&task.FacilityName,
 		)
 		if err != nil {
 			return nil, 0, err
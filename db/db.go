@@ -169,7 +169,760 @@ func (db *Database) CreateTabels(ctx context.Context) error {
 		`
 	ALTER TABLE station_products 
 		ADD COLUMN IF NOT EXISTS product_name VARCHAR(100),
-		ADD COLUMN IF NOT EXISTS customer_name VARCHAR(100);
+		ADD COLUMN IF NOT EXISTS customer_name VARCHAR(100),
+		ADD COLUMN IF NOT EXISTS child_product_1_min_qty INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS child_product_2_min_qty INT NOT NULL DEFAULT 0;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS station_product_moves (
+		 id SERIAL PRIMARY KEY,
+		 station_product_id INT NOT NULL REFERENCES station_products(id) ON DELETE CASCADE,
+		 from_station_id INT REFERENCES stations(id) ON DELETE SET NULL,
+		 to_station_id INT REFERENCES stations(id) ON DELETE SET NULL,
+		 from_floor_plan_id INT,
+		 to_floor_plan_id INT,
+		 from_customer_id INT,
+		 to_customer_id INT,
+		 moved_by INT REFERENCES users(id),
+		 reason TEXT NOT NULL,
+		 moved_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_station_product_moves_device ON station_product_moves (station_product_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS stock_locations (
+		 id SERIAL PRIMARY KEY,
+		 name VARCHAR(100) NOT NULL,
+		 location_type VARCHAR(20) NOT NULL,
+		 user_id INT REFERENCES users(id) ON DELETE SET NULL,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS stock_levels (
+		 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+		 location_id INT NOT NULL REFERENCES stock_locations(id) ON DELETE CASCADE,
+		 quantity INT NOT NULL DEFAULT 0,
+		 reorder_threshold INT NOT NULL DEFAULT 0,
+		 reorder_quantity INT NOT NULL DEFAULT 0,
+		 updated_at TIMESTAMP DEFAULT NOW(),
+		 PRIMARY KEY (product_id, location_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS stock_movements (
+		 id SERIAL PRIMARY KEY,
+		 product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+		 location_id INT NOT NULL REFERENCES stock_locations(id) ON DELETE CASCADE,
+		 quantity INT NOT NULL,
+		 movement_type VARCHAR(20) NOT NULL,
+		 counterpart_location_id INT REFERENCES stock_locations(id) ON DELETE SET NULL,
+		 station_product_id INT REFERENCES station_products(id) ON DELETE SET NULL,
+		 note TEXT,
+		 created_by INT REFERENCES users(id),
+		 created_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_stock_movements_product_location ON stock_movements (product_id, location_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS orders (
+		 id SERIAL PRIMARY KEY,
+		 customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+		 ordered_by INT REFERENCES users(id),
+		 status VARCHAR(20) NOT NULL DEFAULT 'draft',
+		 total_amount DECIMAL(12, 2) NOT NULL DEFAULT 0,
+		 stock_location_id INT REFERENCES stock_locations(id) ON DELETE SET NULL,
+		 notes TEXT,
+		 submitted_at TIMESTAMP,
+		 fulfilled_at TIMESTAMP,
+		 cancelled_at TIMESTAMP,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS order_items (
+		 id SERIAL PRIMARY KEY,
+		 order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+		 product_id INT NOT NULL REFERENCES products(id),
+		 quantity INT NOT NULL CHECK (quantity > 0),
+		 unit_price DECIMAL(10, 2) NOT NULL,
+		 line_total DECIMAL(12, 2) NOT NULL,
+		 station_product_id INT REFERENCES station_products(id) ON DELETE SET NULL,
+		 purpose VARCHAR(20)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_orders_customer ON orders (customer_id);
+	CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items (order_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS alert_types (
+		 id SERIAL PRIMARY KEY,
+		 code VARCHAR(50) NOT NULL UNIQUE,
+		 name VARCHAR(100) NOT NULL,
+		 description TEXT,
+		 severity VARCHAR(20) NOT NULL
+	);
+
+	INSERT INTO alert_types (code, name, description, severity) VALUES
+		('device_expired', 'Device expired', 'A device is past its expiry date', 'high'),
+		('inspection_overdue', 'Inspection overdue', 'A device is past its inspection date', 'medium'),
+		('component_low', 'Component below minimum', 'A device component is below its minimum quantity', 'medium'),
+		('station_empty', 'Station without devices', 'A station has no devices installed', 'low')
+	ON CONFLICT (code) DO NOTHING;
+
+	CREATE TABLE IF NOT EXISTS alerts (
+		 id SERIAL PRIMARY KEY,
+		 alert_type_id INT NOT NULL REFERENCES alert_types(id),
+		 dedup_key VARCHAR(200) NOT NULL,
+		 severity VARCHAR(20) NOT NULL,
+		 message TEXT NOT NULL,
+		 customer_id INT REFERENCES customers(id) ON DELETE CASCADE,
+		 station_id INT REFERENCES stations(id) ON DELETE CASCADE,
+		 station_product_id INT REFERENCES station_products(id) ON DELETE CASCADE,
+		 status VARCHAR(20) NOT NULL DEFAULT 'active',
+		 occurrences INT NOT NULL DEFAULT 1,
+		 first_seen_at TIMESTAMP DEFAULT NOW(),
+		 last_seen_at TIMESTAMP DEFAULT NOW(),
+		 acknowledged_at TIMESTAMP,
+		 acknowledged_by INT REFERENCES users(id),
+		 resolved_at TIMESTAMP,
+		 resolved_by INT REFERENCES users(id),
+		 resolution_note TEXT,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open_dedup ON alerts (dedup_key) WHERE status <> 'resolved';
+	CREATE INDEX IF NOT EXISTS idx_alerts_status ON alerts (status, severity);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS jobs (
+		 id BIGSERIAL PRIMARY KEY,
+		 kind VARCHAR(100) NOT NULL,
+		 payload JSONB NOT NULL DEFAULT '{}',
+		 status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		 attempts INT NOT NULL DEFAULT 0,
+		 max_attempts INT NOT NULL DEFAULT 5,
+		 run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		 unique_key VARCHAR(200),
+		 locked_by VARCHAR(200),
+		 locked_at TIMESTAMP,
+		 last_error TEXT,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW(),
+		 finished_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_jobs_pending ON jobs (run_at, id) WHERE status = 'pending';
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique_key ON jobs (unique_key) WHERE status IN ('pending', 'running');
+
+	CREATE TABLE IF NOT EXISTS job_schedules (
+		 name VARCHAR(100) PRIMARY KEY,
+		 cron VARCHAR(100) NOT NULL,
+		 kind VARCHAR(100) NOT NULL,
+		 payload JSONB NOT NULL DEFAULT '{}',
+		 next_run_at TIMESTAMP NOT NULL,
+		 last_run_at TIMESTAMP,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW()
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	ALTER TABLE products
+		ADD COLUMN IF NOT EXISTS service_interval_days INT,
+		ADD COLUMN IF NOT EXISTS lifetime_months INT;
+
+	CREATE TABLE IF NOT EXISTS work_orders (
+		 id SERIAL PRIMARY KEY,
+		 customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+		 station_id INT NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+		 type VARCHAR(20) NOT NULL,
+		 title VARCHAR(200) NOT NULL,
+		 description TEXT,
+		 priority VARCHAR(20) NOT NULL DEFAULT 'normal',
+		 status VARCHAR(20) NOT NULL DEFAULT 'open',
+		 assigned_to INT REFERENCES users(id) ON DELETE SET NULL,
+		 due_date TIMESTAMP NOT NULL,
+		 created_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 started_at TIMESTAMP,
+		 completed_at TIMESTAMP,
+		 completed_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 cancelled_at TIMESTAMP,
+		 notes TEXT,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_work_orders_assignee ON work_orders (assigned_to, status);
+	CREATE INDEX IF NOT EXISTS idx_work_orders_customer ON work_orders (customer_id, status);
+
+	CREATE TABLE IF NOT EXISTS work_order_devices (
+		 work_order_id INT NOT NULL REFERENCES work_orders(id) ON DELETE CASCADE,
+		 station_product_id INT NOT NULL REFERENCES station_products(id) ON DELETE CASCADE,
+		 PRIMARY KEY (work_order_id, station_product_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS service_records (
+		 id SERIAL PRIMARY KEY,
+		 station_product_id INT NOT NULL REFERENCES station_products(id) ON DELETE CASCADE,
+		 work_order_id INT REFERENCES work_orders(id) ON DELETE SET NULL,
+		 service_type VARCHAR(50) NOT NULL,
+		 service_date TIMESTAMP NOT NULL,
+		 performed_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 description TEXT,
+		 next_service_date TIMESTAMP,
+		 status VARCHAR(20) NOT NULL DEFAULT 'completed',
+		 created_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_service_records_device ON service_records (station_product_id, service_date);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS inspection_schedules (
+		 id SERIAL PRIMARY KEY,
+		 name VARCHAR(100) NOT NULL,
+		 customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+		 floor_plan_id INT REFERENCES floor_plans(id) ON DELETE CASCADE,
+		 station_id INT REFERENCES stations(id) ON DELETE CASCADE,
+		 rrule TEXT NOT NULL,
+		 starts_at TIMESTAMP NOT NULL,
+		 inspection_type VARCHAR(50) NOT NULL,
+		 description TEXT,
+		 horizon_days INT NOT NULL DEFAULT 30,
+		 updates_device_dates BOOLEAN NOT NULL DEFAULT FALSE,
+		 paused BOOLEAN NOT NULL DEFAULT FALSE,
+		 paused_at TIMESTAMP,
+		 created_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_inspection_schedules_customer ON inspection_schedules (customer_id);
+
+	CREATE TABLE IF NOT EXISTS inspection_schedule_exceptions (
+		 schedule_id INT NOT NULL REFERENCES inspection_schedules(id) ON DELETE CASCADE,
+		 occurrence_at TIMESTAMP NOT NULL,
+		 moved_to TIMESTAMP,
+		 reason TEXT,
+		 created_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 PRIMARY KEY (schedule_id, occurrence_at)
+	);
+
+	ALTER TABLE work_orders
+		ADD COLUMN IF NOT EXISTS schedule_id INT REFERENCES inspection_schedules(id) ON DELETE SET NULL,
+		ADD COLUMN IF NOT EXISTS occurrence_at TIMESTAMP;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_work_orders_occurrence ON work_orders (schedule_id, station_id, occurrence_at)
+		WHERE schedule_id IS NOT NULL AND status <> 'cancelled';
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	ALTER TABLE stations
+		ADD COLUMN IF NOT EXISTS location_x DOUBLE PRECISION,
+		ADD COLUMN IF NOT EXISTS location_y DOUBLE PRECISION;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS checklist_templates (
+		 id SERIAL PRIMARY KEY,
+		 name VARCHAR(100) NOT NULL,
+		 description TEXT,
+		 category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+		 product_id INT REFERENCES products(id) ON DELETE CASCADE,
+		 active BOOLEAN NOT NULL DEFAULT TRUE,
+		 created_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 updated_at TIMESTAMP DEFAULT NOW(),
+		 CHECK ((category_id IS NULL) <> (product_id IS NULL))
+	);
+
+	CREATE TABLE IF NOT EXISTS checklist_items (
+		 id SERIAL PRIMARY KEY,
+		 template_id INT NOT NULL REFERENCES checklist_templates(id) ON DELETE CASCADE,
+		 position INT NOT NULL,
+		 question TEXT NOT NULL,
+		 item_type VARCHAR(20) NOT NULL,
+		 required BOOLEAN NOT NULL DEFAULT TRUE,
+		 min_value DOUBLE PRECISION,
+		 max_value DOUBLE PRECISION,
+		 unit VARCHAR(20),
+		 creates_follow_up BOOLEAN NOT NULL DEFAULT FALSE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_checklist_items_template ON checklist_items (template_id, position);
+
+	CREATE TABLE IF NOT EXISTS checklist_results (
+		 id SERIAL PRIMARY KEY,
+		 template_id INT REFERENCES checklist_templates(id) ON DELETE SET NULL,
+		 template_name VARCHAR(100) NOT NULL,
+		 station_product_id INT NOT NULL REFERENCES station_products(id) ON DELETE CASCADE,
+		 station_id INT NOT NULL,
+		 customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+		 work_order_id INT REFERENCES work_orders(id) ON DELETE SET NULL,
+		 submitted_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 submitted_at TIMESTAMP DEFAULT NOW(),
+		 passed BOOLEAN NOT NULL,
+		 failed_items INT NOT NULL DEFAULT 0,
+		 notes TEXT,
+		 follow_up_work_order_id INT REFERENCES work_orders(id) ON DELETE SET NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_checklist_results_device ON checklist_results (station_product_id, submitted_at);
+	CREATE INDEX IF NOT EXISTS idx_checklist_results_template ON checklist_results (template_id, submitted_at);
+	CREATE INDEX IF NOT EXISTS idx_checklist_results_customer ON checklist_results (customer_id, submitted_at);
+
+	CREATE TABLE IF NOT EXISTS checklist_result_items (
+		 id SERIAL PRIMARY KEY,
+		 result_id INT NOT NULL REFERENCES checklist_results(id) ON DELETE CASCADE,
+		 item_id INT REFERENCES checklist_items(id) ON DELETE SET NULL,
+		 position INT NOT NULL,
+		 question TEXT NOT NULL,
+		 item_type VARCHAR(20) NOT NULL,
+		 pass_value BOOLEAN,
+		 number_value DOUBLE PRECISION,
+		 text_value TEXT,
+		 photo_keys TEXT[] NOT NULL DEFAULT '{}',
+		 passed BOOLEAN NOT NULL,
+		 comment TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_checklist_result_items_result ON checklist_result_items (result_id);
+	CREATE INDEX IF NOT EXISTS idx_checklist_result_items_item ON checklist_result_items (item_id);
+
+	ALTER TABLE station_products
+		ADD COLUMN IF NOT EXISTS needs_attention BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS attention_reason TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`
+	CREATE TABLE IF NOT EXISTS evidence (
+		 id SERIAL PRIMARY KEY,
+		 work_order_id INT REFERENCES work_orders(id) ON DELETE RESTRICT,
+		 station_product_id INT REFERENCES station_products(id) ON DELETE RESTRICT,
+		 checklist_result_id INT REFERENCES checklist_results(id) ON DELETE RESTRICT,
+		 type VARCHAR(20) NOT NULL,
+		 image_key VARCHAR(255) NOT NULL UNIQUE,
+		 content_type VARCHAR(50) NOT NULL,
+		 size BIGINT NOT NULL,
+		 sha256 VARCHAR(64) NOT NULL,
+		 signer_name VARCHAR(100),
+		 caption TEXT,
+		 captured_at TIMESTAMP,
+		 latitude DOUBLE PRECISION,
+		 longitude DOUBLE PRECISION,
+		 metadata_source VARCHAR(20),
+		 uploaded_by INT REFERENCES users(id) ON DELETE SET NULL,
+		 created_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_evidence_work_order ON evidence (work_order_id);
+	CREATE INDEX IF NOT EXISTS idx_evidence_station_product ON evidence (station_product_id);
+	CREATE INDEX IF NOT EXISTS idx_evidence_checklist_result ON evidence (checklist_result_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Offline sync: every synced row carries a version that is bumped on each
+	// update, and every change is logged per customer with the id of the
+	// transaction that made it, so pulls can resume from a snapshot.
+	_, err = db.Conn.Exec(ctx,
+		`
+	ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+	ALTER TABLE stations ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+	ALTER TABLE station_products ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+	ALTER TABLE work_orders ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+	CREATE TABLE IF NOT EXISTS sync_changes (
+		 seq BIGSERIAL PRIMARY KEY,
+		 txid BIGINT NOT NULL DEFAULT txid_current(),
+		 customer_id INT NOT NULL,
+		 entity VARCHAR(20) NOT NULL,
+		 entity_id INT NOT NULL,
+		 changed_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sync_changes_customer ON sync_changes (customer_id, txid);
+	CREATE INDEX IF NOT EXISTS idx_sync_changes_changed_at ON sync_changes (changed_at);
+
+	CREATE TABLE IF NOT EXISTS sync_mutations (
+		 customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+		 client_id VARCHAR(64) NOT NULL,
+		 entity VARCHAR(20) NOT NULL,
+		 entity_id INT NOT NULL,
+		 version INT NOT NULL,
+		 created_at TIMESTAMP DEFAULT NOW(),
+		 PRIMARY KEY (customer_id, client_id)
+	);
+
+	UPDATE station_products sp
+	SET customer_id = s.customer_id
+	FROM stations s
+	WHERE s.id = sp.station_id AND sp.customer_id IS DISTINCT FROM s.customer_id;
+
+	CREATE OR REPLACE FUNCTION sync_bump_version() RETURNS trigger AS $$
+	BEGIN
+		NEW.version := OLD.version + 1;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION sync_device_customer() RETURNS trigger AS $$
+	BEGIN
+		NEW.customer_id := (SELECT customer_id FROM stations WHERE id = NEW.station_id);
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION sync_log_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			INSERT INTO sync_changes (customer_id, entity, entity_id)
+			SELECT OLD.customer_id, TG_ARGV[0], OLD.id WHERE OLD.customer_id IS NOT NULL;
+			RETURN NULL;
+		END IF;
+
+		IF TG_OP = 'UPDATE' THEN
+			-- the previous customer needs to hear the row is gone
+			INSERT INTO sync_changes (customer_id, entity, entity_id)
+			SELECT OLD.customer_id, TG_ARGV[0], OLD.id
+			WHERE OLD.customer_id IS NOT NULL AND OLD.customer_id IS DISTINCT FROM NEW.customer_id;
+		END IF;
+
+		INSERT INTO sync_changes (customer_id, entity, entity_id)
+		SELECT NEW.customer_id, TG_ARGV[0], NEW.id WHERE NEW.customer_id IS NOT NULL;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION sync_log_work_order_devices() RETURNS trigger AS $$
+	DECLARE
+		changed_work_order INT;
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			changed_work_order := OLD.work_order_id;
+		ELSE
+			changed_work_order := NEW.work_order_id;
+		END IF;
+
+		INSERT INTO sync_changes (customer_id, entity, entity_id)
+		SELECT customer_id, 'work_order', id FROM work_orders WHERE id = changed_work_order;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS floor_plans_version ON floor_plans;
+	CREATE TRIGGER floor_plans_version BEFORE UPDATE ON floor_plans
+		FOR EACH ROW EXECUTE PROCEDURE sync_bump_version();
+	DROP TRIGGER IF EXISTS floor_plans_sync ON floor_plans;
+	CREATE TRIGGER floor_plans_sync AFTER INSERT OR UPDATE OR DELETE ON floor_plans
+		FOR EACH ROW EXECUTE PROCEDURE sync_log_change('floor_plan');
+
+	DROP TRIGGER IF EXISTS stations_version ON stations;
+	CREATE TRIGGER stations_version BEFORE UPDATE ON stations
+		FOR EACH ROW EXECUTE PROCEDURE sync_bump_version();
+	DROP TRIGGER IF EXISTS stations_sync ON stations;
+	CREATE TRIGGER stations_sync AFTER INSERT OR UPDATE OR DELETE ON stations
+		FOR EACH ROW EXECUTE PROCEDURE sync_log_change('station');
+
+	DROP TRIGGER IF EXISTS station_products_customer ON station_products;
+	CREATE TRIGGER station_products_customer BEFORE INSERT OR UPDATE OF station_id ON station_products
+		FOR EACH ROW EXECUTE PROCEDURE sync_device_customer();
+	DROP TRIGGER IF EXISTS station_products_version ON station_products;
+	CREATE TRIGGER station_products_version BEFORE UPDATE ON station_products
+		FOR EACH ROW EXECUTE PROCEDURE sync_bump_version();
+	DROP TRIGGER IF EXISTS station_products_sync ON station_products;
+	CREATE TRIGGER station_products_sync AFTER INSERT OR UPDATE OR DELETE ON station_products
+		FOR EACH ROW EXECUTE PROCEDURE sync_log_change('device');
+
+	DROP TRIGGER IF EXISTS work_orders_version ON work_orders;
+	CREATE TRIGGER work_orders_version BEFORE UPDATE ON work_orders
+		FOR EACH ROW EXECUTE PROCEDURE sync_bump_version();
+	DROP TRIGGER IF EXISTS work_orders_sync ON work_orders;
+	CREATE TRIGGER work_orders_sync AFTER INSERT OR UPDATE OR DELETE ON work_orders
+		FOR EACH ROW EXECUTE PROCEDURE sync_log_change('work_order');
+	DROP TRIGGER IF EXISTS work_order_devices_sync ON work_order_devices;
+	CREATE TRIGGER work_order_devices_sync AFTER INSERT OR DELETE ON work_order_devices
+		FOR EACH ROW EXECUTE PROCEDURE sync_log_work_order_devices();
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS calendar_feeds (
+			id SERIAL PRIMARY KEY,
+			token VARCHAR(64) UNIQUE NOT NULL,
+			customer_id INT REFERENCES customers(id) ON DELETE CASCADE,
+			user_id INT REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			CHECK ((customer_id IS NULL) <> (user_id IS NULL))
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS calendar_feeds_customer ON calendar_feeds (customer_id) WHERE customer_id IS NOT NULL;
+		CREATE UNIQUE INDEX IF NOT EXISTS calendar_feeds_user ON calendar_feeds (user_id) WHERE user_id IS NOT NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE service_records ADD COLUMN IF NOT EXISTS due_kind VARCHAR(20);
+		ALTER TABLE service_records ADD COLUMN IF NOT EXISTS due_date TIMESTAMP;
+
+		CREATE INDEX IF NOT EXISTS idx_service_records_due ON service_records (station_product_id, due_kind, due_date)
+			WHERE due_date IS NOT NULL;
+
+		CREATE TABLE IF NOT EXISTS sla_targets (
+			id SERIAL PRIMARY KEY,
+			customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+			kind VARCHAR(20) NOT NULL,
+			within_days INT NOT NULL,
+			target_percent NUMERIC(5, 2) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE (customer_id, kind)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE station_products ADD COLUMN IF NOT EXISTS inspection_due_date TIMESTAMP;
+		ALTER TABLE station_products ADD COLUMN IF NOT EXISTS expiry_due_date TIMESTAMP;
+
+		CREATE TABLE IF NOT EXISTS task_deferrals (
+			id SERIAL PRIMARY KEY,
+			station_product_id INT NOT NULL REFERENCES station_products(id) ON DELETE CASCADE,
+			kind VARCHAR(20) NOT NULL,
+			due_date TIMESTAMP NOT NULL,
+			task_date TIMESTAMP NOT NULL,
+			requested_date TIMESTAMP NOT NULL,
+			reason TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			requested_by INT REFERENCES users(id) ON DELETE SET NULL,
+			decided_by INT REFERENCES users(id) ON DELETE SET NULL,
+			decided_at TIMESTAMP,
+			decision_note TEXT,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_task_deferrals_device ON task_deferrals (station_product_id, kind);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_task_deferrals_pending ON task_deferrals (station_product_id, kind)
+			WHERE status = 'pending';
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS width DOUBLE PRECISION;
+		ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS height DOUBLE PRECISION;
+
+		ALTER TABLE stations ADD COLUMN IF NOT EXISTS rotation DOUBLE PRECISION;
+		ALTER TABLE stations ADD COLUMN IF NOT EXISTS zone VARCHAR(100);
+		ALTER TABLE stations ADD COLUMN IF NOT EXISTS room VARCHAR(100);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS background_key TEXT;
+		ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS background_type VARCHAR(50);
+		ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS background_page INT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS floor_plan_revisions (
+			id SERIAL PRIMARY KEY,
+			floor_plan_id INT NOT NULL REFERENCES floor_plans(id) ON DELETE CASCADE,
+			revision INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			layout TEXT NOT NULL DEFAULT '',
+			width DOUBLE PRECISION,
+			height DOUBLE PRECISION,
+			stations JSONB NOT NULL DEFAULT '[]',
+			rolled_back_from INT,
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE (floor_plan_id, revision)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS facilities (
+			id SERIAL PRIMARY KEY,
+			customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			facility_type VARCHAR(50),
+			address VARCHAR(255),
+			city VARCHAR(100),
+			state VARCHAR(100),
+			postal_code VARCHAR(20),
+			country VARCHAR(100),
+			contact_person VARCHAR(100),
+			contact_email VARCHAR(100),
+			contact_phone VARCHAR(15),
+			timezone VARCHAR(50) NOT NULL DEFAULT 'UTC',
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_facilities_customer ON facilities (customer_id);
+
+		CREATE TABLE IF NOT EXISTS buildings (
+			id SERIAL PRIMARY KEY,
+			facility_id INT NOT NULL REFERENCES facilities(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			code VARCHAR(20),
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_buildings_facility ON buildings (facility_id);
+
+		CREATE TABLE IF NOT EXISTS floors (
+			id SERIAL PRIMARY KEY,
+			building_id INT NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			level INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_floors_building ON floors (building_id);
+
+		ALTER TABLE floor_plans ADD COLUMN IF NOT EXISTS floor_id INT REFERENCES floors(id) ON DELETE SET NULL;
+		CREATE INDEX IF NOT EXISTS idx_floor_plans_floor ON floor_plans (floor_id);
+
+		CREATE OR REPLACE VIEW station_facilities AS
+		SELECT s.id AS station_id, f.id AS facility_id, f.name AS facility_name, b.id AS building_id,
+			fl.id AS floor_id
+		FROM stations s
+		JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		JOIN floors fl ON fl.id = fp.floor_id
+		JOIN buildings b ON b.id = fl.building_id
+		JOIN facilities f ON f.id = b.facility_id;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Station codes are the first 12 hex digits of a random UUID, drawn from
+	// the same secure source; existing stations get theirs as the column is
+	// added.
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE stations ADD COLUMN IF NOT EXISTS code VARCHAR(16) NOT NULL
+			DEFAULT upper(substr(replace(gen_random_uuid()::text, '-', ''), 1, 12));
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_stations_code ON stations (code);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS station_templates (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			station_type VARCHAR(50) NOT NULL,
+			description TEXT,
+			customer_id INT REFERENCES customers(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_station_templates_customer ON station_templates (customer_id);
+
+		CREATE TABLE IF NOT EXISTS station_template_devices (
+			id SERIAL PRIMARY KEY,
+			template_id INT NOT NULL REFERENCES station_templates(id) ON DELETE CASCADE,
+			position INT NOT NULL,
+			product_id INT NOT NULL REFERENCES products(id),
+			quantity INT NOT NULL DEFAULT 1,
+			child_product_1_id INT REFERENCES products(id),
+			child_product_1_qty INT NOT NULL DEFAULT 0,
+			child_product_1_min_qty INT NOT NULL DEFAULT 0,
+			child_product_2_id INT REFERENCES products(id),
+			child_product_2_qty INT NOT NULL DEFAULT 0,
+			child_product_2_min_qty INT NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_station_template_devices_template ON station_template_devices (template_id);
+
+		ALTER TABLE stations ADD COLUMN IF NOT EXISTS template_id INT REFERENCES station_templates(id) ON DELETE SET NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE stations ADD COLUMN IF NOT EXISTS layout_point_id VARCHAR(50);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_stations_layout_point ON stations (floor_plan_id, layout_point_id)
+			WHERE layout_point_id IS NOT NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// an alert resolved by hand holds back its condition until it clears
+	_, err = db.Conn.Exec(ctx, `
+		ALTER TABLE alerts ADD COLUMN IF NOT EXISTS condition_cleared_at TIMESTAMP;
+		UPDATE alerts SET condition_cleared_at = resolved_at
+		WHERE status = 'resolved' AND resolved_by IS NULL AND condition_cleared_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_alerts_uncleared ON alerts (dedup_key)
+			WHERE status = 'resolved' AND condition_cleared_at IS NULL;
 	`)
 	if err != nil {
 		return err
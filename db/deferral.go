@@ -0,0 +1,287 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const deferralColumns = `df.id, df.station_product_id, df.kind, df.due_date, df.task_date, df.requested_date,
+		df.reason, df.status, COALESCE(df.requested_by, 0), df.decided_by, df.decided_at,
+		COALESCE(df.decision_note, ''), df.created_at, df.updated_at, s.id, s.name, c.id, c.name, p.name,
+		sf.facility_id, COALESCE(sf.facility_name, '')`
+
+const deferralJoins = `FROM task_deferrals df
+		JOIN station_products sp ON sp.id = df.station_product_id
+		JOIN stations s ON s.id = sp.station_id
+		JOIN customers c ON c.id = s.customer_id
+		JOIN products p ON p.id = sp.product_id
+		` + stationFacility
+
+const deferralFilter = `WHERE s.customer_id = $1
+	  AND ($2::text IS NULL OR df.status = $2::text)
+	  AND ($3::text IS NULL OR df.kind = $3::text)
+	  AND ($4::int IS NULL OR sf.facility_id = $4::int)`
+
+func scanDeferral(row pgx.Row) (models.Deferral, error) {
+	var d models.Deferral
+
+	err := row.Scan(&d.ID, &d.StationProductID, &d.Kind, &d.DueDate, &d.TaskDate, &d.RequestedDate, &d.Reason,
+		&d.Status, &d.RequestedBy, &d.DecidedBy, &d.DecidedAt, &d.DecisionNote, &d.CreatedAt, &d.UpdatedAt,
+		&d.StationID, &d.StationName, &d.CustomerID, &d.CustomerName, &d.ProductName, &d.FacilityID, &d.FacilityName)
+
+	return d, err
+}
+
+// lockDeviceDate locks a device and returns its current task date of a kind
+// and the date its SLA is measured against.
+func lockDeviceDate(ctx context.Context, tx pgx.Tx, deviceID uint, kind string) (time.Time, time.Time, error) {
+	var taskDate, dueDate *time.Time
+
+	err := tx.QueryRow(ctx,
+		`SELECT
+			CASE WHEN $2 = 'inspection' THEN inspection_date ELSE expiry_date END,
+			CASE WHEN $2 = 'inspection' THEN COALESCE(inspection_due_date, inspection_date)
+			     ELSE COALESCE(expiry_due_date, expiry_date) END
+		FROM station_products
+		WHERE id = $1
+		FOR UPDATE;`,
+		deviceID, kind,
+	).Scan(&taskDate, &dueDate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if taskDate == nil || dueDate == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: device has no %s date", ErrInvalidDeferralDate, kind)
+	}
+
+	return *taskDate, *dueDate, nil
+}
+
+// RequestDeferral records a technician's request to move a device date. Only
+// one request per device date can await a decision at a time.
+func (db *Database) RequestDeferral(ctx context.Context, d models.Deferral) (uint, error) {
+	var id uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	taskDate, dueDate, err := lockDeviceDate(ctx, tx, d.StationProductID, d.Kind)
+	if err != nil {
+		return 0, err
+	}
+	if !d.RequestedDate.After(taskDate) {
+		return 0, ErrInvalidDeferralDate
+	}
+
+	if err := checkActiveUser(ctx, tx, d.RequestedBy); err != nil {
+		return 0, err
+	}
+
+	var pending bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM task_deferrals
+			WHERE station_product_id = $1 AND kind = $2 AND status = 'pending'
+		);`,
+		d.StationProductID, d.Kind,
+	).Scan(&pending)
+	if err != nil {
+		return 0, err
+	}
+	if pending {
+		return 0, ErrDeferralPending
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO task_deferrals (
+		station_product_id,
+		kind,
+		due_date,
+		task_date,
+		requested_date,
+		reason,
+		requested_by)
+		VALUES ($1, $2, $3::timestamptz, $4::timestamptz, $5::timestamptz, $6, $7)
+		RETURNING id;`,
+		d.StationProductID, d.Kind, dueDate, taskDate, d.RequestedDate, d.Reason, d.RequestedBy,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (db *Database) GetDeferral(ctx context.Context, id uint) (models.Deferral, error) {
+	d, err := scanDeferral(db.Conn.QueryRow(ctx,
+		`SELECT `+deferralColumns+`
+		`+deferralJoins+`
+		WHERE df.id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, ErrNotFound
+	}
+
+	return d, err
+}
+
+// GetDeferrals lists a customer's deferrals, newest first.
+func (db *Database) GetDeferrals(ctx context.Context, customerID uint, status, kind, facilityID string, page, limit int) ([]models.Deferral, int, error) {
+	var (
+		deferrals []models.Deferral
+		total     int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		`+deferralJoins+`
+		`+deferralFilter+`;`,
+		customerID, nullIfEmpty(status), nullIfEmpty(kind), nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total deferrals count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+deferralColumns+`
+		`+deferralJoins+`
+		`+deferralFilter+`
+		ORDER BY df.created_at DESC, df.id DESC
+		LIMIT $5 OFFSET $6;`,
+		customerID, nullIfEmpty(status), nullIfEmpty(kind), nullIfEmpty(facilityID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDeferral(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		deferrals = append(deferrals, d)
+	}
+
+	return deferrals, total, rows.Err()
+}
+
+// DecideDeferral approves or rejects a pending deferral. Approval moves the
+// device date to the requested one and keeps the date it was due on for the
+// SLA, so deferring the same date again still counts from the first one.
+func (db *Database) DecideDeferral(ctx context.Context, id uint, approve bool, decision models.DeferralDecision) (models.Deferral, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return models.Deferral{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		deviceID      uint
+		kind, status  string
+		taskDate      time.Time
+		requestedDate time.Time
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT station_product_id, kind, status, task_date, requested_date
+		FROM task_deferrals
+		WHERE id = $1
+		FOR UPDATE;`,
+		id,
+	).Scan(&deviceID, &kind, &status, &taskDate, &requestedDate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Deferral{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Deferral{}, err
+	}
+	if status != string(models.DeferralPending) {
+		return models.Deferral{}, ErrDeferralDecided
+	}
+
+	var role string
+	err = tx.QueryRow(ctx,
+		`SELECT role FROM users WHERE id = $1 AND is_active;`,
+		decision.DecidedBy,
+	).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Deferral{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.Deferral{}, err
+	}
+	if role != string(models.AdminUser) && role != string(models.ModeratorUser) {
+		return models.Deferral{}, ErrNotSupervisor
+	}
+
+	newStatus := models.DeferralRejected
+	if approve {
+		newStatus = models.DeferralApproved
+
+		current, _, err := lockDeviceDate(ctx, tx, deviceID, kind)
+		if err != nil {
+			return models.Deferral{}, err
+		}
+		if !current.Equal(taskDate) {
+			return models.Deferral{}, ErrDeferralOutdated
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE station_products
+			SET inspection_due_date = CASE WHEN $2 = 'inspection' THEN COALESCE(inspection_due_date, inspection_date)
+			                               ELSE inspection_due_date END,
+				inspection_date = CASE WHEN $2 = 'inspection' THEN $3::timestamptz ELSE inspection_date END,
+				expiry_due_date = CASE WHEN $2 = 'expiry' THEN COALESCE(expiry_due_date, expiry_date)
+			                           ELSE expiry_due_date END,
+				expiry_date = CASE WHEN $2 = 'expiry' THEN $3::timestamptz ELSE expiry_date END,
+				updated_at = NOW()
+			WHERE id = $1;`,
+			deviceID, kind, requestedDate,
+		)
+		if err != nil {
+			return models.Deferral{}, err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE task_deferrals
+		SET status = $2, decided_by = $3, decided_at = NOW(), decision_note = $4, updated_at = NOW()
+		WHERE id = $1;`,
+		id, string(newStatus), decision.DecidedBy, nullIfEmpty(decision.Note),
+	)
+	if err != nil {
+		return models.Deferral{}, err
+	}
+
+	d, err := scanDeferral(tx.QueryRow(ctx,
+		`SELECT `+deferralColumns+`
+		`+deferralJoins+`
+		WHERE df.id = $1;`,
+		id,
+	))
+	if err != nil {
+		return d, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
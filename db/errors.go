@@ -0,0 +1,151 @@
+package database
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrStationNotFound is returned when a referenced station does not exist.
+	ErrStationNotFound = errors.New("station not found")
+
+	// ErrSameStation is returned when a device is moved to the station it is already on.
+	ErrSameStation = errors.New("device is already on this station")
+
+	// ErrCrossCustomerMove is returned when a device would move to another
+	// customer's station without admin authorisation.
+	ErrCrossCustomerMove = errors.New("moving a device to another customer requires admin authorisation")
+
+	// ErrInsufficientStock is returned when an issue or transfer would take a
+	// stock level below zero.
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrProductNotFound is returned when a referenced product does not exist.
+	ErrProductNotFound = errors.New("product not found")
+
+	// ErrOrderNotEditable is returned when the items of a non-draft order are changed.
+	ErrOrderNotEditable = errors.New("only draft orders can be edited")
+
+	// ErrInvalidTransition is returned when a status change is not allowed
+	// from the current status.
+	ErrInvalidTransition = errors.New("invalid status transition")
+
+	// ErrEmptyOrder is returned when an order without items is submitted.
+	ErrEmptyOrder = errors.New("order has no items")
+
+	// ErrDeviceNotForCustomer is returned when a device belonging to another
+	// customer is referenced.
+	ErrDeviceNotForCustomer = errors.New("device does not belong to this customer")
+
+	// ErrAlertResolved is returned when a resolved alert is acknowledged or resolved again.
+	ErrAlertResolved = errors.New("alert is already resolved")
+
+	// ErrJobNotRetryable is returned when a job that is not dead or cancelled is retried.
+	ErrJobNotRetryable = errors.New("only dead or cancelled jobs can be retried")
+
+	// ErrJobNotCancellable is returned when a job that is not pending is cancelled.
+	ErrJobNotCancellable = errors.New("only pending jobs can be cancelled")
+
+	// ErrJobQueued is returned when a job is retried while another job with
+	// its unique key is already pending or running.
+	ErrJobQueued = errors.New("another job with the same unique key is already queued")
+
+	// ErrUserNotFound is returned when a referenced user does not exist or is inactive.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrDeviceNotOnStation is returned when a work order references a device
+	// installed on another station.
+	ErrDeviceNotOnStation = errors.New("device is not installed on this station")
+
+	// ErrDeviceNotOnWorkOrder is returned when a device that is not covered by
+	// the work order is referenced.
+	ErrDeviceNotOnWorkOrder = errors.New("device is not on this work order")
+
+	// ErrWorkOrderUnassigned is returned when an unassigned work order is
+	// moved to a status that needs an assignee.
+	ErrWorkOrderUnassigned = errors.New("work order has no assignee")
+
+	// ErrCustomerNotFound is returned when a referenced customer does not exist.
+	ErrCustomerNotFound = errors.New("customer not found")
+
+	// ErrFloorPlanNotFound is returned when a referenced floor plan does not
+	// exist or belongs to another customer.
+	ErrFloorPlanNotFound = errors.New("floor plan not found")
+
+	// ErrNoChecklist is returned when no active checklist template applies
+	// to a device.
+	ErrNoChecklist = errors.New("no checklist template applies to this device")
+
+	// ErrChecklistNotApplicable is returned when a checklist template for
+	// another product or category is submitted for a device.
+	ErrChecklistNotApplicable = errors.New("checklist template does not apply to this device")
+
+	// ErrInvalidChecklistResponse is returned when a checklist submission
+	// misses a required item or answers an item that is not on the template.
+	ErrInvalidChecklistResponse = errors.New("invalid checklist response")
+
+	// ErrCategoryNotFound is returned when a referenced category does not exist.
+	ErrCategoryNotFound = errors.New("category not found")
+
+	// ErrEvidenceLocked is returned when evidence is added to or removed
+	// from a work order that is done or cancelled, or removed from a
+	// submitted checklist.
+	ErrEvidenceLocked = errors.New("evidence cannot change once its work order is closed or its checklist submitted")
+
+	// ErrEvidenceKept is returned when deleting a station, device, product
+	// or work order would take evidence recorded against it with it.
+	ErrEvidenceKept = errors.New("evidence is recorded against this, so it cannot be deleted")
+
+	// ErrInvalidSyncToken is returned when a sync change token cannot be read.
+	ErrInvalidSyncToken = errors.New("invalid change token")
+
+	// ErrSyncTokenExpired is returned when the changes since a sync token
+	// have been pruned and the client has to pull a full snapshot.
+	ErrSyncTokenExpired = errors.New("change token expired, pull without a token for a full sync")
+
+	// ErrInvalidSyncMutation is returned when a pushed mutation is malformed.
+	ErrInvalidSyncMutation = errors.New("invalid sync mutation")
+
+	// ErrDeferralPending is returned when a deferral is requested for a
+	// device date that already has one awaiting a decision.
+	ErrDeferralPending = errors.New("a deferral is already pending for this date")
+
+	// ErrInvalidDeferralDate is returned when a deferral does not move the
+	// date later.
+	ErrInvalidDeferralDate = errors.New("requested date must be after the current date")
+
+	// ErrDeferralDecided is returned when a deferral that was already
+	// approved or rejected is decided again.
+	ErrDeferralDecided = errors.New("deferral has already been decided")
+
+	// ErrDeferralOutdated is returned when a deferral is approved after the
+	// device date it was requested for has changed.
+	ErrDeferralOutdated = errors.New("device date changed since the deferral was requested")
+
+	// ErrNotSupervisor is returned when a user who is not an admin or
+	// moderator decides a deferral.
+	ErrNotSupervisor = errors.New("deferrals can only be decided by a supervisor")
+
+	// ErrPositionOutOfBounds is returned when a station is placed outside
+	// the dimensions of its floor plan.
+	ErrPositionOutOfBounds = errors.New("position is outside the floor plan")
+
+	// ErrRevisionNotFound is returned when a floor plan has no revision with
+	// the requested number.
+	ErrRevisionNotFound = errors.New("floor plan revision not found")
+
+	// ErrFacilityNotFound, ErrBuildingNotFound and ErrFloorNotFound are
+	// returned when a referenced facility, building or floor does not exist
+	// or belongs to another customer.
+	ErrFacilityNotFound = errors.New("facility not found")
+	ErrBuildingNotFound = errors.New("building not found")
+	ErrFloorNotFound    = errors.New("floor not found")
+
+	// ErrStationTemplateNotFound is returned when a referenced station
+	// template does not exist or is not offered to the customer.
+	ErrStationTemplateNotFound = errors.New("station template not found")
+
+	// ErrNoLayout is returned when a floor plan without a layout is used
+	// where one is needed.
+	ErrNoLayout = errors.New("floor plan has no layout")
+)
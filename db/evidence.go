@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const evidenceColumns = `id, work_order_id, station_product_id, checklist_result_id, type, image_key, content_type, size, sha256,
+		COALESCE(signer_name, ''), COALESCE(caption, ''), captured_at, latitude, longitude,
+		COALESCE(metadata_source, ''), COALESCE(uploaded_by, 0), created_at`
+
+func scanEvidence(row pgx.Row) (models.Evidence, error) {
+	var e models.Evidence
+
+	err := row.Scan(&e.ID, &e.WorkOrderID, &e.StationProductID, &e.ChecklistResultID, &e.Type, &e.ImageKey, &e.ContentType, &e.Size,
+		&e.SHA256, &e.SignerName, &e.Caption, &e.CapturedAt, &e.Latitude, &e.Longitude, &e.MetadataSource,
+		&e.UploadedBy, &e.CreatedAt)
+
+	return e, err
+}
+
+// lockOpenWorkOrder locks a work order that evidence is changed on and
+// checks it is not yet closed.
+func lockOpenWorkOrder(ctx context.Context, tx pgx.Tx, id uint) error {
+	status, _, err := lockWorkOrder(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if status == models.WorkOrderDone || status == models.WorkOrderCancelled {
+		return ErrEvidenceLocked
+	}
+	return nil
+}
+
+// keptEvidence turns the foreign key violation raised when a delete would
+// take evidence with it into ErrEvidenceKept.
+func keptEvidence(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" && strings.HasPrefix(pgErr.ConstraintName, "evidence_") {
+		return ErrEvidenceKept
+	}
+	return err
+}
+
+// AddEvidence records an uploaded photo or signature against an open work
+// order, or a photo of a device for its next checklist. The work order is
+// locked so evidence cannot slip in while it is being completed.
+func (db *Database) AddEvidence(ctx context.Context, e models.Evidence) (uint, error) {
+	var id uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if e.WorkOrderID != nil {
+		if err := lockOpenWorkOrder(ctx, tx, *e.WorkOrderID); err != nil {
+			return 0, err
+		}
+	} else {
+		var exists bool
+		err = tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM station_products WHERE id = $1);`,
+			e.StationProductID,
+		).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrNotFound
+		}
+	}
+
+	if err := checkActiveUser(ctx, tx, e.UploadedBy); err != nil {
+		return 0, err
+	}
+
+	if e.WorkOrderID != nil && e.StationProductID != nil {
+		var onWorkOrder bool
+		err = tx.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM work_order_devices
+				WHERE work_order_id = $1 AND station_product_id = $2
+			);`,
+			*e.WorkOrderID, *e.StationProductID,
+		).Scan(&onWorkOrder)
+		if err != nil {
+			return 0, err
+		}
+		if !onWorkOrder {
+			return 0, ErrDeviceNotOnWorkOrder
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO evidence (
+		work_order_id,
+		station_product_id,
+		type,
+		image_key,
+		content_type,
+		size,
+		sha256,
+		signer_name,
+		caption,
+		captured_at,
+		latitude,
+		longitude,
+		metadata_source,
+		uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::timestamptz, $11, $12, $13, $14)
+		RETURNING id;`,
+		e.WorkOrderID, e.StationProductID, e.Type, e.ImageKey, e.ContentType, e.Size, e.SHA256,
+		e.SignerName, e.Caption, e.CapturedAt, e.Latitude, e.Longitude, nullIfEmpty(e.MetadataSource),
+		e.UploadedBy,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (db *Database) GetEvidence(ctx context.Context, id uint) (models.Evidence, error) {
+	e, err := scanEvidence(db.Conn.QueryRow(ctx,
+		`SELECT `+evidenceColumns+`
+		FROM evidence
+		WHERE id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e, ErrNotFound
+	}
+
+	return e, err
+}
+
+// GetWorkOrderEvidence returns the evidence of a work order in upload order.
+func (db *Database) GetWorkOrderEvidence(ctx context.Context, workOrderID uint) ([]models.Evidence, error) {
+	var evidence []models.Evidence
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+evidenceColumns+`
+		FROM evidence
+		WHERE work_order_id = $1
+		ORDER BY id;`,
+		workOrderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvidence(rows)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+
+	return evidence, rows.Err()
+}
+
+// getChecklistEvidence returns the evidence kept with a checklist result in
+// upload order.
+func (db *Database) getChecklistEvidence(ctx context.Context, resultID uint) ([]models.Evidence, error) {
+	var evidence []models.Evidence
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+evidenceColumns+`
+		FROM evidence
+		WHERE checklist_result_id = $1
+		ORDER BY id;`,
+		resultID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvidence(rows)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+
+	return evidence, rows.Err()
+}
+
+// getDeviceEvidence returns, by work order, the evidence that concerns a
+// device: the evidence taken of it and the evidence for the whole visit.
+func (db *Database) getDeviceEvidence(ctx context.Context, stationProductID uint) (map[uint][]models.Evidence, error) {
+	evidence := map[uint][]models.Evidence{}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+evidenceColumns+`
+		FROM evidence
+		WHERE work_order_id IN (
+			SELECT work_order_id FROM service_records
+			WHERE station_product_id = $1 AND work_order_id IS NOT NULL
+		)
+		  AND (station_product_id IS NULL OR station_product_id = $1)
+		ORDER BY id;`,
+		stationProductID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvidence(rows)
+		if err != nil {
+			return nil, err
+		}
+		evidence[*e.WorkOrderID] = append(evidence[*e.WorkOrderID], e)
+	}
+
+	return evidence, rows.Err()
+}
+
+// DeleteEvidence removes evidence from an open work order, or a device's
+// photo not yet answered in a checklist, and returns it so the stored image
+// can be removed too.
+func (db *Database) DeleteEvidence(ctx context.Context, id uint) (models.Evidence, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return models.Evidence{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	e, err := scanEvidence(tx.QueryRow(ctx,
+		`SELECT `+evidenceColumns+`
+		FROM evidence
+		WHERE id = $1
+		FOR UPDATE;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e, ErrNotFound
+	}
+	if err != nil {
+		return e, err
+	}
+
+	if e.ChecklistResultID != nil {
+		return e, ErrEvidenceLocked
+	}
+	if e.WorkOrderID != nil {
+		if err := lockOpenWorkOrder(ctx, tx, *e.WorkOrderID); err != nil {
+			return e, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM evidence WHERE id = $1;`, id)
+	if err != nil {
+		return e, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,395 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// stationFacility reaches the facility of a station s through the floor its
+// floor plan is drawn for, as sf.facility_id and sf.facility_name. Both are
+// NULL for stations whose floor plan is not on a floor.
+const stationFacility = `LEFT JOIN station_facilities sf ON sf.station_id = s.id`
+
+const facilityColumns = `id, customer_id, name, COALESCE(facility_type, ''), COALESCE(address, ''),
+		COALESCE(city, ''), COALESCE(state, ''), COALESCE(postal_code, ''), COALESCE(country, ''),
+		COALESCE(contact_person, ''), COALESCE(contact_email, ''), COALESCE(contact_phone, ''), timezone,
+		created_at, updated_at`
+
+func scanFacility(row pgx.Row) (models.Facility, error) {
+	var f models.Facility
+
+	err := row.Scan(&f.ID, &f.CustomerID, &f.Name, &f.FacilityType, &f.Address, &f.City, &f.State, &f.PostalCode,
+		&f.Country, &f.ContactPerson, &f.ContactEmail, &f.ContactPhone, &f.Timezone, &f.CreatedAt, &f.UpdatedAt)
+
+	return f, err
+}
+
+// checkFloor makes sure a floor is in a building of one of the customer's
+// facilities.
+func checkFloor(ctx context.Context, q queryer, customerID uint, floorID *uint) error {
+	if floorID == nil {
+		return nil
+	}
+
+	var exists bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1
+			FROM floors fl
+			JOIN buildings b ON b.id = fl.building_id
+			JOIN facilities f ON f.id = b.facility_id
+			WHERE fl.id = $1 AND f.customer_id = $2
+		);`,
+		*floorID, customerID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrFloorNotFound
+	}
+
+	return nil
+}
+
+func (db *Database) AddFacility(ctx context.Context, facility models.Facility) (uint, error) {
+	var id uint
+
+	err := db.Conn.QueryRow(ctx,
+		`INSERT INTO facilities (
+		customer_id,
+		name,
+		facility_type,
+		address,
+		city,
+		state,
+		postal_code,
+		country,
+		contact_person,
+		contact_email,
+		contact_phone,
+		timezone)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		WHERE EXISTS (SELECT 1 FROM customers WHERE id = $1)
+		RETURNING id;`,
+		facility.CustomerID, facility.Name, facility.FacilityType, facility.Address, facility.City, facility.State,
+		facility.PostalCode, facility.Country, facility.ContactPerson, facility.ContactEmail, facility.ContactPhone,
+		facility.Timezone,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrCustomerNotFound
+	}
+
+	return id, err
+}
+
+// GetFacility returns a customer's facility with its buildings, their floors
+// and the floor plans drawn for each floor.
+func (db *Database) GetFacility(ctx context.Context, customerID, facilityID uint) (models.Facility, error) {
+	facility, err := scanFacility(db.Conn.QueryRow(ctx,
+		`SELECT `+facilityColumns+`
+		FROM facilities
+		WHERE id = $1 AND customer_id = $2;`,
+		facilityID, customerID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return facility, ErrFacilityNotFound
+	}
+	if err != nil {
+		return facility, err
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT b.id, b.name, COALESCE(b.code, ''), b.created_at, b.updated_at,
+			fl.id, fl.name, fl.level, fl.created_at, fl.updated_at,
+			ARRAY(SELECT fp.id FROM floor_plans fp WHERE fp.floor_id = fl.id ORDER BY fp.id)
+		FROM buildings b
+		LEFT JOIN floors fl ON fl.building_id = b.id
+		WHERE b.facility_id = $1
+		ORDER BY b.name, b.id, fl.level, fl.id;`,
+		facilityID,
+	)
+	if err != nil {
+		return facility, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			building     models.Building
+			floorID      *uint
+			floorName    *string
+			floorLevel   *int
+			floorCreated *time.Time
+			floorUpdated *time.Time
+			floorPlanIDs []uint
+		)
+		if err := rows.Scan(&building.ID, &building.Name, &building.Code, &building.CreatedAt, &building.UpdatedAt,
+			&floorID, &floorName, &floorLevel, &floorCreated, &floorUpdated, &floorPlanIDs); err != nil {
+			return facility, err
+		}
+		building.FacilityID = facilityID
+
+		if n := len(facility.Buildings); n == 0 || facility.Buildings[n-1].ID != building.ID {
+			facility.Buildings = append(facility.Buildings, building)
+		}
+		if floorID == nil {
+			continue
+		}
+
+		b := &facility.Buildings[len(facility.Buildings)-1]
+		b.Floors = append(b.Floors, models.Floor{
+			ID:           *floorID,
+			BuildingID:   building.ID,
+			Name:         *floorName,
+			Level:        *floorLevel,
+			FloorPlanIDs: floorPlanIDs,
+			CreatedAt:    *floorCreated,
+			UpdatedAt:    *floorUpdated,
+		})
+	}
+
+	return facility, rows.Err()
+}
+
+func (db *Database) GetFacilities(ctx context.Context, customerID uint, page, limit int) ([]models.Facility, int, error) {
+	var (
+		facilities []models.Facility
+		total      int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM facilities
+		WHERE customer_id = $1;`,
+		customerID,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total facilities count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+facilityColumns+`
+		FROM facilities
+		WHERE customer_id = $1
+		ORDER BY name, id
+		LIMIT $2 OFFSET $3;`,
+		customerID, limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		facility, err := scanFacility(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		facilities = append(facilities, facility)
+	}
+
+	return facilities, total, rows.Err()
+}
+
+func (db *Database) UpdateFacility(ctx context.Context, customerID, facilityID uint, facility models.Facility) error {
+	tag, err := db.Conn.Exec(ctx,
+		`UPDATE facilities
+		SET name = $3, facility_type = $4, address = $5, city = $6, state = $7, postal_code = $8, country = $9,
+			contact_person = $10, contact_email = $11, contact_phone = $12, timezone = $13, updated_at = NOW()
+		WHERE id = $1 AND customer_id = $2;`,
+		facilityID, customerID, facility.Name, facility.FacilityType, facility.Address, facility.City,
+		facility.State, facility.PostalCode, facility.Country, facility.ContactPerson, facility.ContactEmail,
+		facility.ContactPhone, facility.Timezone,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFacilityNotFound
+	}
+
+	return nil
+}
+
+// DeleteFacility removes a facility with its buildings and floors. Floor
+// plans drawn for its floors are kept, no longer on a floor.
+func (db *Database) DeleteFacility(ctx context.Context, customerID, facilityID uint) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM facilities WHERE id = $1 AND customer_id = $2;`,
+		facilityID, customerID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFacilityNotFound
+	}
+
+	return nil
+}
+
+func (db *Database) AddBuilding(ctx context.Context, customerID uint, building models.Building) (uint, error) {
+	var id uint
+
+	err := db.Conn.QueryRow(ctx,
+		`INSERT INTO buildings (facility_id, name, code)
+		SELECT id, $3, $4
+		FROM facilities
+		WHERE id = $1 AND customer_id = $2
+		RETURNING id;`,
+		building.FacilityID, customerID, building.Name, building.Code,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrFacilityNotFound
+	}
+
+	return id, err
+}
+
+func (db *Database) UpdateBuilding(ctx context.Context, customerID uint, building models.Building) error {
+	tag, err := db.Conn.Exec(ctx,
+		`UPDATE buildings b
+		SET name = $4, code = $5, updated_at = NOW()
+		FROM facilities f
+		WHERE b.id = $1 AND b.facility_id = $2 AND f.id = b.facility_id AND f.customer_id = $3;`,
+		building.ID, building.FacilityID, customerID, building.Name, building.Code,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBuildingNotFound
+	}
+
+	return nil
+}
+
+// DeleteBuilding removes a building with its floors. Floor plans drawn for
+// its floors are kept, no longer on a floor.
+func (db *Database) DeleteBuilding(ctx context.Context, customerID, facilityID, buildingID uint) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM buildings b
+		USING facilities f
+		WHERE b.id = $1 AND b.facility_id = $2 AND f.id = b.facility_id AND f.customer_id = $3;`,
+		buildingID, facilityID, customerID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBuildingNotFound
+	}
+
+	return nil
+}
+
+func (db *Database) AddFloor(ctx context.Context, customerID, facilityID uint, floor models.Floor) (uint, error) {
+	var id uint
+
+	err := db.Conn.QueryRow(ctx,
+		`INSERT INTO floors (building_id, name, level)
+		SELECT b.id, $4, $5
+		FROM buildings b
+		JOIN facilities f ON f.id = b.facility_id
+		WHERE b.id = $1 AND b.facility_id = $2 AND f.customer_id = $3
+		RETURNING id;`,
+		floor.BuildingID, facilityID, customerID, floor.Name, floor.Level,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrBuildingNotFound
+	}
+
+	return id, err
+}
+
+func (db *Database) UpdateFloor(ctx context.Context, customerID, facilityID uint, floor models.Floor) error {
+	tag, err := db.Conn.Exec(ctx,
+		`UPDATE floors fl
+		SET name = $5, level = $6, updated_at = NOW()
+		FROM buildings b, facilities f
+		WHERE fl.id = $1 AND fl.building_id = $2 AND b.id = fl.building_id AND b.facility_id = $3
+		  AND f.id = b.facility_id AND f.customer_id = $4;`,
+		floor.ID, floor.BuildingID, facilityID, customerID, floor.Name, floor.Level,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFloorNotFound
+	}
+
+	return nil
+}
+
+// DeleteFloor removes a floor. Floor plans drawn for it are kept, no longer
+// on a floor.
+func (db *Database) DeleteFloor(ctx context.Context, customerID, facilityID, buildingID, floorID uint) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM floors fl
+		USING buildings b, facilities f
+		WHERE fl.id = $1 AND fl.building_id = $2 AND b.id = fl.building_id AND b.facility_id = $3
+		  AND f.id = b.facility_id AND f.customer_id = $4;`,
+		floorID, buildingID, facilityID, customerID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFloorNotFound
+	}
+
+	return nil
+}
+
+// GetFacilitySummaries returns the dashboard of each facility, optionally
+// only those of a customer or a single facility. Expiring devices expire
+// within models.StationExpiringDays.
+func (db *Database) GetFacilitySummaries(ctx context.Context, customerID, facilityID string) ([]models.FacilitySummary, error) {
+	var summaries []models.FacilitySummary
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT f.id, f.name, f.customer_id, f.timezone,
+			(SELECT COUNT(*) FROM floor_plans fp
+				JOIN floors fl ON fl.id = fp.floor_id
+				JOIN buildings b ON b.id = fl.building_id
+				WHERE b.facility_id = f.id),
+			COUNT(DISTINCT sf.station_id),
+			COUNT(sp.id),
+			COUNT(sp.id) FILTER (WHERE sp.expiry_date >= NOW() AND sp.expiry_date < NOW() + make_interval(days => $3)),
+			COUNT(sp.id) FILTER (WHERE sp.expiry_date < NOW() OR sp.inspection_date < NOW()),
+			COUNT(sp.id) FILTER (WHERE sp.needs_attention),
+			(SELECT COUNT(*) FROM work_orders wo
+				JOIN station_facilities wsf ON wsf.station_id = wo.station_id
+				WHERE wsf.facility_id = f.id AND wo.status NOT IN ('done', 'cancelled'))
+		FROM facilities f
+		LEFT JOIN station_facilities sf ON sf.facility_id = f.id
+		LEFT JOIN station_products sp ON sp.station_id = sf.station_id
+		WHERE ($1::int IS NULL OR f.customer_id = $1::int)
+		  AND ($2::int IS NULL OR f.id = $2::int)
+		GROUP BY f.id
+		ORDER BY f.name, f.id;`,
+		nullIfEmpty(customerID), nullIfEmpty(facilityID), models.StationExpiringDays,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.FacilitySummary
+		if err := rows.Scan(&s.FacilityID, &s.FacilityName, &s.CustomerID, &s.Timezone, &s.FloorPlanCount,
+			&s.StationCount, &s.DeviceCount, &s.ExpiringCount, &s.OverdueCount, &s.AttentionCount,
+			&s.OpenWorkOrders); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
@@ -2,41 +2,66 @@ package database
 
 import (
 	"context"
+	"errors"
 
 	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
 )
 
+// AddFloorPlan creates a floor plan and records it as its first revision.
 func (s *Database) AddFloorPlan(ctx context.Context, floorPlan models.FloorPlan) (int, error) {
 
 	var id int
 
-	err := s.Conn.QueryRow(ctx,
+	width, height := floorPlan.Extent()
+
+	tx, err := s.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkFloor(ctx, tx, floorPlan.CustomerID, floorPlan.FloorID); err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(ctx,
 		`INSERT INTO floor_plans (
 		name,
 		layout,
 		customer_id,
 		created_at,
-		updated_at)
-		VALUES ($1, $2, $3, $4, $5)
+		updated_at,
+		width,
+		height,
+		floor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id;`,
 		floorPlan.Name, floorPlan.Layout, floorPlan.CustomerID, floorPlan.CreatedAt, floorPlan.UpdatedAt,
+		width, height, floorPlan.FloorID,
 	).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 
-	return id, nil
+	if _, err := recordFloorPlanRevision(ctx, tx, uint(id), nil); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
 
 }
 func (s *Database) GetFloorPlan(ctx context.Context, id string) (models.FloorPlan, error) {
 	var floorPlan models.FloorPlan
 
 	err := s.Conn.QueryRow(ctx,
-		`SELECT id, name, layout, customer_id,created_at, updated_at
+		`SELECT id, name, layout, customer_id,created_at, updated_at, width, height,
+			COALESCE(background_type, ''), background_page, floor_id
 		FROM floor_plans
 		WHERE id = $1;`,
 		id,
-	).Scan(&floorPlan.ID, &floorPlan.Name, &floorPlan.Layout, &floorPlan.CustomerID, &floorPlan.CreatedAt, &floorPlan.UpdatedAt)
+	).Scan(&floorPlan.ID, &floorPlan.Name, &floorPlan.Layout, &floorPlan.CustomerID, &floorPlan.CreatedAt, &floorPlan.UpdatedAt,
+		&floorPlan.Width, &floorPlan.Height, &floorPlan.BackgroundType, &floorPlan.BackgroundPage, &floorPlan.FloorID)
 	if err != nil {
 		return floorPlan, err
 	}
@@ -45,33 +70,67 @@ func (s *Database) GetFloorPlan(ctx context.Context, id string) (models.FloorPla
 
 }
 
-func (s *Database) UpdateFloorPlan(ctx context.Context, ID string, floorPlan models.FloorPlan) error {
+// UpdateFloorPlan changes a customer's floor plan and records the change as
+// a new revision, which is returned. A new size may not leave any of its
+// stations off the plan.
+func (s *Database) UpdateFloorPlan(ctx context.Context, customerID, floorPlanID uint, floorPlan models.FloorPlan) (int, error) {
 
-	_, err := s.Conn.Exec(ctx,
+	tx, err := s.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockFloorPlan(ctx, tx, customerID, floorPlanID); err != nil {
+		return 0, err
+	}
+
+	if err := checkFloor(ctx, tx, customerID, floorPlan.FloorID); err != nil {
+		return 0, err
+	}
+
+	width, height := floorPlan.Extent()
+
+	_, err = tx.Exec(ctx,
 		`UPDATE floor_plans
-		SET name = $1, layout = $3
-		WHERE id = $4;`,
-		floorPlan.Name, floorPlan.Layout, ID,
+		SET name = $1, layout = $2, width = $3, height = $4, floor_id = $5, updated_at = NOW()
+		WHERE id = $6;`,
+		floorPlan.Name, floorPlan.Layout, width, height, floorPlan.FloorID, floorPlanID,
 	)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// update floor plan in customer
+	if err := checkFloorPlanStations(ctx, tx, floorPlanID, width, height); err != nil {
+		return 0, err
+	}
 
-	_, err = s.Conn.Exec(ctx,
-		`UPDATE customers
-		SET floor_plans = jsonb_set(
-			floor_plans::jsonb,
-			ARRAY[CAST($1 AS TEXT)],
-			$2::jsonb,
-			true
-		)
-		WHERE id = $3;`,
-		ID, floorPlan.CustomerID,
-	)
+	revision, err := recordFloorPlanRevision(ctx, tx, floorPlanID, nil)
+	if err != nil {
+		return 0, err
+	}
 
-	return nil
+	return revision, tx.Commit(ctx)
+}
+
+// GetCustomerFloorPlan returns a floor plan if it belongs to the customer.
+func (s *Database) GetCustomerFloorPlan(ctx context.Context, customerID, floorPlanID uint) (models.FloorPlan, error) {
+	var floorPlan models.FloorPlan
+
+	err := s.Conn.QueryRow(ctx,
+		`SELECT id, name, COALESCE(layout, ''), customer_id, created_at, updated_at, width, height,
+			COALESCE(background_key, ''), COALESCE(background_type, ''), background_page, floor_id
+		FROM floor_plans
+		WHERE id = $1 AND customer_id = $2;`,
+		floorPlanID, customerID,
+	).Scan(&floorPlan.ID, &floorPlan.Name, &floorPlan.Layout, &floorPlan.CustomerID, &floorPlan.CreatedAt,
+		&floorPlan.UpdatedAt, &floorPlan.Width, &floorPlan.Height, &floorPlan.BackgroundKey, &floorPlan.BackgroundType,
+		&floorPlan.BackgroundPage, &floorPlan.FloorID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return floorPlan, ErrFloorPlanNotFound
+	}
+
+	return floorPlan, err
 }
 
 func (s *Database) DeleteFloorPlan(ctx context.Context, id string) error {
@@ -101,16 +160,22 @@ func (s *Database) DeleteFloorPlan(ctx context.Context, id string) error {
 
 }
 
-func (s *Database) GetFloorPlans(ctx context.Context, customerId uint, page, limit int) ([]models.FloorPlan, int, error) {
+// GetFloorPlans lists a customer's floor plans, optionally only those of a
+// facility or a floor.
+func (s *Database) GetFloorPlans(ctx context.Context, customerId uint, facilityID, floorID string, page, limit int) ([]models.FloorPlan, int, error) {
 	var floorPlans []models.FloorPlan
 
 	rows, err := s.Conn.Query(ctx,
-		`SELECT id, name, layout, created_at, updated_at
-		FROM floor_plans
-		WHERE customer_id = $1
-		ORDER BY id
-		LIMIT $2 OFFSET $3;`,
-		customerId, limit, (page-1)*limit,
+		`SELECT fp.id, fp.name, fp.layout, fp.created_at, fp.updated_at, fp.width, fp.height, fp.floor_id
+		FROM floor_plans fp
+		LEFT JOIN floors fl ON fl.id = fp.floor_id
+		LEFT JOIN buildings b ON b.id = fl.building_id
+		WHERE fp.customer_id = $1
+		  AND ($2::int IS NULL OR b.facility_id = $2::int)
+		  AND ($3::int IS NULL OR fp.floor_id = $3::int)
+		ORDER BY fp.id
+		LIMIT $4 OFFSET $5;`,
+		customerId, nullIfEmpty(facilityID), nullIfEmpty(floorID), limit, (page-1)*limit,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -119,7 +184,8 @@ func (s *Database) GetFloorPlans(ctx context.Context, customerId uint, page, lim
 
 	for rows.Next() {
 		var floorPlan models.FloorPlan
-		if err := rows.Scan(&floorPlan.ID, &floorPlan.Name, &floorPlan.Layout, &floorPlan.CreatedAt, &floorPlan.UpdatedAt); err != nil {
+		if err := rows.Scan(&floorPlan.ID, &floorPlan.Name, &floorPlan.Layout, &floorPlan.CreatedAt, &floorPlan.UpdatedAt,
+			&floorPlan.Width, &floorPlan.Height, &floorPlan.FloorID); err != nil {
 			return nil, 0, err
 		}
 		floorPlan.CustomerID = customerId
@@ -129,3 +195,140 @@ func (s *Database) GetFloorPlans(ctx context.Context, customerId uint, page, lim
 	return floorPlans, len(floorPlans), nil
 
 }
+
+// SetFloorPlanBackground records a newly uploaded background, with the PDF
+// page it was rendered from if any, and returns the key of the one it
+// replaces, if any, so it can be removed from storage.
+func (s *Database) SetFloorPlanBackground(ctx context.Context, customerID, floorPlanID uint, key, contentType string, page *int) (string, error) {
+	var oldKey string
+
+	err := s.Conn.QueryRow(ctx,
+		`UPDATE floor_plans fp
+		SET background_key = $3, background_type = $4, background_page = $5, updated_at = NOW()
+		FROM (SELECT id, background_key FROM floor_plans WHERE id = $1 AND customer_id = $2 FOR UPDATE) old
+		WHERE fp.id = old.id
+		RETURNING COALESCE(old.background_key, '');`,
+		floorPlanID, customerID, nullIfEmpty(key), nullIfEmpty(contentType), page,
+	).Scan(&oldKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrFloorPlanNotFound
+	}
+
+	return oldKey, err
+}
+
+// GetStationMarkers returns the stations of a floor plan with the worst
+// status of their devices.
+func (s *Database) GetStationMarkers(ctx context.Context, floorPlanID uint) ([]models.StationMarker, error) {
+	var markers []models.StationMarker
+
+	rows, err := s.Conn.Query(ctx,
+		`SELECT s.id, s.name, s.location_x, s.location_y, s.rotation, COUNT(sp.id),
+			COALESCE(MAX(CASE
+				WHEN sp.expiry_date < NOW() THEN 5
+				WHEN sp.inspection_date < NOW() THEN 4
+				WHEN sp.needs_attention OR sp.child_product_1_qty < sp.child_product_1_min_qty
+					OR sp.child_product_2_qty < sp.child_product_2_min_qty THEN 3
+				WHEN sp.expiry_date < NOW() + make_interval(days => $2) THEN 2
+				ELSE 1
+			END), 0)
+		FROM stations s
+		LEFT JOIN station_products sp ON sp.station_id = s.id
+		WHERE s.floor_plan_id = $1
+		GROUP BY s.id
+		ORDER BY s.id;`,
+		floorPlanID, models.StationExpiringDays,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := []models.StationStatus{models.StationEmpty, models.StationOK, models.StationExpiring,
+		models.StationAttention, models.StationOverdue, models.StationExpired}
+
+	for rows.Next() {
+		var (
+			marker models.StationMarker
+			rank   int
+		)
+		if err := rows.Scan(&marker.ID, &marker.Name, &marker.LocationX, &marker.LocationY, &marker.Rotation,
+			&marker.Devices, &rank); err != nil {
+			return nil, err
+		}
+		marker.Status = statuses[rank]
+		markers = append(markers, marker)
+	}
+
+	return markers, rows.Err()
+}
+
+// GetCoverageStations returns the placed stations of a floor plan that have
+// devices, optionally only of a product or category, with the largest
+// coverage amount among those devices.
+func (s *Database) GetCoverageStations(ctx context.Context, floorPlanID uint, productID, categoryID string) ([]models.CoverageStation, error) {
+	var stations []models.CoverageStation
+
+	rows, err := s.Conn.Query(ctx,
+		`SELECT s.id, s.name, s.location_x, s.location_y, MAX(p.coverage_amount)::float8
+		FROM stations s
+		JOIN station_products sp ON sp.station_id = s.id
+		JOIN products p ON p.id = sp.product_id
+		WHERE s.floor_plan_id = $1 AND s.location_x IS NOT NULL AND s.location_y IS NOT NULL
+		  AND ($2::int IS NULL OR p.id = $2::int)
+		  AND ($3::int IS NULL OR p.category_id = $3::int)
+		GROUP BY s.id
+		ORDER BY s.id;`,
+		floorPlanID, nullIfEmpty(productID), nullIfEmpty(categoryID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var station models.CoverageStation
+		if err := rows.Scan(&station.ID, &station.Name, &station.LocationX, &station.LocationY,
+			&station.Radius); err != nil {
+			return nil, err
+		}
+		stations = append(stations, station)
+	}
+
+	return stations, rows.Err()
+}
+
+// GetSpatialStations returns the placed stations of a floor plan, optionally
+// only those with a device of a product or category.
+func (s *Database) GetSpatialStations(ctx context.Context, floorPlanID uint, productID, categoryID string) ([]models.SpatialStation, error) {
+	stations := []models.SpatialStation{}
+
+	rows, err := s.Conn.Query(ctx,
+		`SELECT s.id, s.name, s.code, s.location_x, s.location_y
+		FROM stations s
+		WHERE s.floor_plan_id = $1 AND s.location_x IS NOT NULL AND s.location_y IS NOT NULL
+		  AND (($2::int IS NULL AND $3::int IS NULL) OR EXISTS (
+			SELECT 1 FROM station_products sp
+			JOIN products p ON p.id = sp.product_id
+			WHERE sp.station_id = s.id
+			  AND ($2::int IS NULL OR p.id = $2::int)
+			  AND ($3::int IS NULL OR p.category_id = $3::int)))
+		ORDER BY s.id;`,
+		floorPlanID, nullIfEmpty(productID), nullIfEmpty(categoryID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var station models.SpatialStation
+		if err := rows.Scan(&station.ID, &station.Name, &station.Code, &station.LocationX,
+			&station.LocationY); err != nil {
+			return nil, err
+		}
+		stations = append(stations, station)
+	}
+
+	return stations, rows.Err()
+}
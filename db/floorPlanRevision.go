@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// recordFloorPlanRevision stores the floor plan as it is now, with the
+// positions of its stations, as its next revision. Callers hold a lock on the
+// floor plan row so revision numbers are handed out one at a time.
+func recordFloorPlanRevision(ctx context.Context, tx pgx.Tx, floorPlanID uint, rolledBackFrom *int) (int, error) {
+	var revision int
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO floor_plan_revisions (floor_plan_id, revision, name, layout, width, height, stations, rolled_back_from)
+		SELECT fp.id,
+			COALESCE((SELECT MAX(revision) FROM floor_plan_revisions WHERE floor_plan_id = fp.id), 0) + 1,
+			fp.name, COALESCE(fp.layout, ''), fp.width, fp.height,
+			COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'id', s.id, 'name', s.name, 'location_x', s.location_x, 'location_y', s.location_y,
+					'rotation', s.rotation, 'zone', s.zone, 'room', s.room) ORDER BY s.id)
+				FROM stations s
+				WHERE s.floor_plan_id = fp.id), '[]'::jsonb),
+			$2
+		FROM floor_plans fp
+		WHERE fp.id = $1
+		RETURNING revision;`,
+		floorPlanID, rolledBackFrom,
+	).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record floor plan revision: %w", err)
+	}
+
+	return revision, nil
+}
+
+// lockFloorPlan locks a customer's floor plan for a change and makes sure
+// its current state is kept as a revision first. Floor plans created before
+// revisions were kept get theirs on their first change.
+func lockFloorPlan(ctx context.Context, tx pgx.Tx, customerID, floorPlanID uint) error {
+	var recorded bool
+
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM floor_plan_revisions WHERE floor_plan_id = floor_plans.id)
+		FROM floor_plans
+		WHERE id = $1 AND customer_id = $2
+		FOR UPDATE;`,
+		floorPlanID, customerID,
+	).Scan(&recorded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFloorPlanNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if !recorded {
+		if _, err := recordFloorPlanRevision(ctx, tx, floorPlanID, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkFloorPlanStations makes sure no station of a floor plan lies outside
+// its size.
+func checkFloorPlanStations(ctx context.Context, tx pgx.Tx, floorPlanID uint, width, height *float64) error {
+	var outside int
+
+	err := tx.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM stations
+		WHERE floor_plan_id = $1
+		  AND (location_x > $2::float8 OR location_y > $3::float8);`,
+		floorPlanID, width, height,
+	).Scan(&outside)
+	if err != nil {
+		return err
+	}
+	if outside > 0 {
+		return fmt.Errorf("%w: %d stations would be off the floor plan", ErrPositionOutOfBounds, outside)
+	}
+
+	return nil
+}
+
+// GetFloorPlanRevisions returns the revisions of a floor plan, newest first,
+// without their layouts and stations.
+func (s *Database) GetFloorPlanRevisions(ctx context.Context, floorPlanID uint, page, limit int) ([]models.FloorPlanRevision, int, error) {
+	var (
+		revisions []models.FloorPlanRevision
+		total     int
+	)
+
+	err := s.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM floor_plan_revisions
+		WHERE floor_plan_id = $1;`,
+		floorPlanID,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total floor plan revisions count: %w", err)
+	}
+
+	rows, err := s.Conn.Query(ctx,
+		`SELECT id, floor_plan_id, revision, name, width, height, jsonb_array_length(stations),
+			rolled_back_from, created_at
+		FROM floor_plan_revisions
+		WHERE floor_plan_id = $1
+		ORDER BY revision DESC
+		LIMIT $2 OFFSET $3;`,
+		floorPlanID, limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision models.FloorPlanRevision
+		if err := rows.Scan(&revision.ID, &revision.FloorPlanID, &revision.Revision, &revision.Name, &revision.Width,
+			&revision.Height, &revision.StationCount, &revision.RolledBackFrom, &revision.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, total, rows.Err()
+}
+
+// GetFloorPlanRevision returns a revision of a floor plan with its layout
+// and stations.
+func (s *Database) GetFloorPlanRevision(ctx context.Context, floorPlanID uint, revision int) (models.FloorPlanRevision, error) {
+	var r models.FloorPlanRevision
+
+	err := s.Conn.QueryRow(ctx,
+		`SELECT id, floor_plan_id, revision, name, layout, width, height, stations, jsonb_array_length(stations),
+			rolled_back_from, created_at
+		FROM floor_plan_revisions
+		WHERE floor_plan_id = $1 AND revision = $2;`,
+		floorPlanID, revision,
+	).Scan(&r.ID, &r.FloorPlanID, &r.Revision, &r.Name, &r.Layout, &r.Width, &r.Height, &r.Stations,
+		&r.StationCount, &r.RolledBackFrom, &r.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r, ErrRevisionNotFound
+	}
+
+	return r, err
+}
+
+// RollbackFloorPlan restores a floor plan to an earlier revision: its name,
+// layout and size, and the positions of the stations still on it. Stations
+// added since keep their positions and must still fit on the plan. The
+// rollback is recorded as a new revision, which is returned.
+func (s *Database) RollbackFloorPlan(ctx context.Context, customerID, floorPlanID uint, revision int) (int, error) {
+
+	tx, err := s.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockFloorPlan(ctx, tx, customerID, floorPlanID); err != nil {
+		return 0, err
+	}
+
+	var width, height *float64
+	err = tx.QueryRow(ctx,
+		`UPDATE floor_plans fp
+		SET name = r.name, layout = r.layout, width = r.width, height = r.height, updated_at = NOW()
+		FROM floor_plan_revisions r
+		WHERE fp.id = $1 AND r.floor_plan_id = fp.id AND r.revision = $2
+		RETURNING fp.width, fp.height;`,
+		floorPlanID, revision,
+	).Scan(&width, &height)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrRevisionNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE stations s
+		SET location_x = old.location_x, location_y = old.location_y, rotation = old.rotation,
+			zone = old.zone, room = old.room, updated_at = NOW()
+		FROM floor_plan_revisions r,
+			jsonb_to_recordset(r.stations) AS old(id int, location_x float8, location_y float8, rotation float8,
+				zone text, room text)
+		WHERE r.floor_plan_id = $1 AND r.revision = $2
+		  AND s.id = old.id AND s.floor_plan_id = $1;`,
+		floorPlanID, revision,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore station positions: %w", err)
+	}
+
+	if err := checkFloorPlanStations(ctx, tx, floorPlanID, width, height); err != nil {
+		return 0, err
+	}
+
+	current, err := recordFloorPlanRevision(ctx, tx, floorPlanID, &revision)
+	if err != nil {
+		return 0, err
+	}
+
+	return current, tx.Commit(ctx)
+}
@@ -0,0 +1,527 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const inspectionScheduleColumns = `i.id, i.name, i.customer_id, i.floor_plan_id, i.station_id, i.rrule, i.starts_at,
+		i.inspection_type, COALESCE(i.description, ''), i.horizon_days, i.updates_device_dates, i.paused, i.paused_at,
+		i.created_by, i.created_at, i.updated_at, sf.facility_id, COALESCE(sf.facility_name, '')`
+
+// scheduleFacility reaches the facility of a schedule i through its floor
+// plan, or its station's, as sf.facility_id and sf.facility_name. Both are
+// NULL for customer-wide schedules and floor plans not on a floor.
+const scheduleFacility = `LEFT JOIN LATERAL (
+			SELECT f.id AS facility_id, f.name AS facility_name
+			FROM floor_plans fp
+			JOIN floors fl ON fl.id = fp.floor_id
+			JOIN buildings b ON b.id = fl.building_id
+			JOIN facilities f ON f.id = b.facility_id
+			WHERE fp.id = COALESCE(i.floor_plan_id, (SELECT floor_plan_id FROM stations WHERE id = i.station_id))
+		) sf ON true`
+
+func scanInspectionSchedule(row pgx.Row) (models.InspectionSchedule, error) {
+	var schedule models.InspectionSchedule
+
+	err := row.Scan(&schedule.ID, &schedule.Name, &schedule.CustomerID, &schedule.FloorPlanID, &schedule.StationID,
+		&schedule.RRule, &schedule.StartsAt, &schedule.InspectionType, &schedule.Description, &schedule.HorizonDays,
+		&schedule.UpdatesDeviceDates, &schedule.Paused, &schedule.PausedAt, &schedule.CreatedBy,
+		&schedule.CreatedAt, &schedule.UpdatedAt, &schedule.FacilityID, &schedule.FacilityName)
+
+	return schedule, err
+}
+
+// checkScheduleScope makes sure the floor plan and station a schedule is
+// attached to belong to its customer, and the station to the floor plan.
+func checkScheduleScope(ctx context.Context, q queryer, schedule models.InspectionSchedule) error {
+	var exists bool
+
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1);`, schedule.CustomerID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCustomerNotFound
+	}
+
+	if schedule.FloorPlanID != nil {
+		err := q.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM floor_plans WHERE id = $1 AND customer_id = $2);`,
+			*schedule.FloorPlanID, schedule.CustomerID,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrFloorPlanNotFound
+		}
+	}
+
+	if schedule.StationID != nil {
+		err := q.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM stations
+				WHERE id = $1 AND customer_id = $2 AND ($3::int IS NULL OR floor_plan_id = $3::int)
+			);`,
+			*schedule.StationID, schedule.CustomerID, schedule.FloorPlanID,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrStationNotFound
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) AddInspectionSchedule(ctx context.Context, schedule models.InspectionSchedule) (uint, error) {
+	var id uint
+
+	if err := checkScheduleScope(ctx, db.Conn, schedule); err != nil {
+		return 0, err
+	}
+
+	if schedule.HorizonDays == 0 {
+		schedule.HorizonDays = 30
+	}
+
+	err := db.Conn.QueryRow(ctx,
+		`INSERT INTO inspection_schedules (
+		name,
+		customer_id,
+		floor_plan_id,
+		station_id,
+		rrule,
+		starts_at,
+		inspection_type,
+		description,
+		horizon_days,
+		updates_device_dates,
+		created_by)
+		VALUES ($1, $2, $3, $4, $5, $6::timestamptz, $7, $8, $9, $10, $11)
+		RETURNING id;`,
+		schedule.Name, schedule.CustomerID, schedule.FloorPlanID, schedule.StationID, schedule.RRule,
+		schedule.StartsAt, schedule.InspectionType, schedule.Description, schedule.HorizonDays,
+		schedule.UpdatesDeviceDates, schedule.CreatedBy,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (db *Database) GetInspectionSchedule(ctx context.Context, id uint) (models.InspectionSchedule, error) {
+	schedule, err := scanInspectionSchedule(db.Conn.QueryRow(ctx,
+		`SELECT `+inspectionScheduleColumns+`
+		FROM inspection_schedules i
+		`+scheduleFacility+`
+		WHERE i.id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return schedule, ErrNotFound
+	}
+	if err != nil {
+		return schedule, err
+	}
+
+	exceptions, err := db.getScheduleExceptions(ctx, []uint{id})
+	if err != nil {
+		return schedule, err
+	}
+	schedule.Exceptions = exceptions[id]
+
+	return schedule, nil
+}
+
+// GetInspectionSchedules returns a customer's schedules. With a facilityID
+// only the schedules of that facility's floor plans and stations are
+// returned, along with the customer-wide ones that cover it too.
+func (db *Database) GetInspectionSchedules(ctx context.Context, customerID, facilityID string, page, limit int) ([]models.InspectionSchedule, int, error) {
+	var (
+		schedules []models.InspectionSchedule
+		total     int
+	)
+
+	filter := `WHERE i.customer_id = $1
+		  AND ($2::int IS NULL OR sf.facility_id = $2::int
+		       OR (i.floor_plan_id IS NULL AND i.station_id IS NULL))`
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM inspection_schedules i
+		`+scheduleFacility+`
+		`+filter+`;`,
+		customerID, nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total inspection schedules count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+inspectionScheduleColumns+`
+		FROM inspection_schedules i
+		`+scheduleFacility+`
+		`+filter+`
+		ORDER BY i.name, i.id
+		LIMIT $3 OFFSET $4;`,
+		customerID, nullIfEmpty(facilityID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		schedule, err := scanInspectionSchedule(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, total, rows.Err()
+}
+
+// GetActiveInspectionSchedules returns the schedules that are not paused with
+// their exceptions, or only the given schedule when id is set.
+func (db *Database) GetActiveInspectionSchedules(ctx context.Context, id *uint) ([]models.InspectionSchedule, error) {
+	var schedules []models.InspectionSchedule
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+inspectionScheduleColumns+`
+		FROM inspection_schedules i
+		`+scheduleFacility+`
+		WHERE NOT i.paused AND ($1::int IS NULL OR i.id = $1::int)
+		ORDER BY i.id;`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		schedule, err := scanInspectionSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+		ids = append(ids, schedule.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	exceptions, err := db.getScheduleExceptions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		schedules[i].Exceptions = exceptions[schedules[i].ID]
+	}
+
+	return schedules, nil
+}
+
+func (db *Database) getScheduleExceptions(ctx context.Context, scheduleIDs []uint) (map[uint][]models.ScheduleException, error) {
+	exceptions := map[uint][]models.ScheduleException{}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT schedule_id, occurrence_at, moved_to, COALESCE(reason, ''), created_by, created_at
+		FROM inspection_schedule_exceptions
+		WHERE schedule_id = ANY($1)
+		ORDER BY schedule_id, occurrence_at;`,
+		scheduleIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var exception models.ScheduleException
+		if err := rows.Scan(&exception.ScheduleID, &exception.OccurrenceAt, &exception.MovedTo, &exception.Reason,
+			&exception.CreatedBy, &exception.CreatedAt); err != nil {
+			return nil, err
+		}
+		exceptions[exception.ScheduleID] = append(exceptions[exception.ScheduleID], exception)
+	}
+
+	return exceptions, rows.Err()
+}
+
+// UpdateInspectionSchedule replaces a schedule's definition. Future work
+// orders that nobody has picked up yet are removed so they are materialised
+// again from the new definition.
+func (db *Database) UpdateInspectionSchedule(ctx context.Context, id uint, schedule models.InspectionSchedule) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`SELECT customer_id FROM inspection_schedules WHERE id = $1 FOR UPDATE;`,
+		id,
+	).Scan(&schedule.CustomerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := checkScheduleScope(ctx, tx, schedule); err != nil {
+		return err
+	}
+
+	if schedule.HorizonDays == 0 {
+		schedule.HorizonDays = 30
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE inspection_schedules
+		SET name = $2, floor_plan_id = $3, station_id = $4, rrule = $5, starts_at = $6::timestamptz,
+			inspection_type = $7, description = $8, horizon_days = $9, updates_device_dates = $10,
+			updated_at = NOW()
+		WHERE id = $1;`,
+		id, schedule.Name, schedule.FloorPlanID, schedule.StationID, schedule.RRule, schedule.StartsAt,
+		schedule.InspectionType, schedule.Description, schedule.HorizonDays, schedule.UpdatesDeviceDates,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteUnstartedOccurrences(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteInspectionSchedule removes a schedule and its unstarted future work
+// orders. Work orders already picked up or done are kept.
+func (db *Database) DeleteInspectionSchedule(ctx context.Context, id uint) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := deleteUnstartedOccurrences(ctx, tx, id); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM inspection_schedules WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetInspectionSchedulePaused pauses or resumes a schedule. Pausing removes
+// the unstarted future work orders; resuming lets the next materialisation
+// create them again from now on.
+func (db *Database) SetInspectionSchedulePaused(ctx context.Context, id uint, paused bool) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE inspection_schedules
+		SET paused = $2, paused_at = CASE WHEN $2 THEN NOW() ELSE NULL END, updated_at = NOW()
+		WHERE id = $1;`,
+		id, paused,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if paused {
+		if err := deleteUnstartedOccurrences(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// deleteUnstartedOccurrences removes the open future work orders of a
+// schedule, except those evidence was already recorded on, which are kept.
+func deleteUnstartedOccurrences(ctx context.Context, tx pgx.Tx, scheduleID uint) error {
+	_, err := tx.Exec(ctx,
+		`DELETE FROM work_orders w
+		WHERE w.schedule_id = $1 AND w.status = 'open' AND w.due_date > NOW()
+		  AND NOT EXISTS (SELECT 1 FROM evidence e WHERE e.work_order_id = w.id);`,
+		scheduleID,
+	)
+	return err
+}
+
+// AddScheduleException skips or moves one occurrence of a schedule. Work
+// orders already materialised for it are cancelled or moved with it.
+func (db *Database) AddScheduleException(ctx context.Context, exception models.ScheduleException) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO inspection_schedule_exceptions (schedule_id, occurrence_at, moved_to, reason, created_by)
+		VALUES ($1, $2::timestamptz, $3::timestamptz, $4, $5)
+		ON CONFLICT (schedule_id, occurrence_at)
+		DO UPDATE SET moved_to = EXCLUDED.moved_to, reason = EXCLUDED.reason, created_by = EXCLUDED.created_by;`,
+		exception.ScheduleID, exception.OccurrenceAt, exception.MovedTo, exception.Reason, exception.CreatedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	if exception.MovedTo != nil {
+		_, err = tx.Exec(ctx,
+			`UPDATE work_orders
+			SET due_date = $3::timestamptz, updated_at = NOW()
+			WHERE schedule_id = $1 AND occurrence_at = $2::timestamptz AND status NOT IN ('done', 'cancelled');`,
+			exception.ScheduleID, exception.OccurrenceAt, *exception.MovedTo,
+		)
+	} else {
+		_, err = tx.Exec(ctx,
+			`UPDATE work_orders
+			SET status = 'cancelled', cancelled_at = NOW(), updated_at = NOW()
+			WHERE schedule_id = $1 AND occurrence_at = $2::timestamptz AND status NOT IN ('done', 'cancelled');`,
+			exception.ScheduleID, exception.OccurrenceAt,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteScheduleException restores an occurrence. A moved occurrence's work
+// orders go back to the original date; a skipped one is materialised again.
+func (db *Database) DeleteScheduleException(ctx context.Context, scheduleID uint, occurrenceAt time.Time) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM inspection_schedule_exceptions
+		WHERE schedule_id = $1 AND occurrence_at = $2::timestamptz;`,
+		scheduleID, occurrenceAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE work_orders
+		SET due_date = occurrence_at, updated_at = NOW()
+		WHERE schedule_id = $1 AND occurrence_at = $2::timestamptz AND status NOT IN ('done', 'cancelled');`,
+		scheduleID, occurrenceAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MaterialiseInspectionSchedule creates an inspection work order for every
+// station in the schedule's scope and every occurrence that is not skipped,
+// covering the devices installed on the station. Occurrences that already
+// have a work order are left alone, so it is safe to run repeatedly.
+func (db *Database) MaterialiseInspectionSchedule(ctx context.Context, schedule models.InspectionSchedule, occurrences []models.ScheduleOccurrence) (int, error) {
+	var created []uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, occurrence := range occurrences {
+		if occurrence.Status == string(models.OccurrenceSkipped) {
+			continue
+		}
+
+		rows, err := tx.Query(ctx,
+			`INSERT INTO work_orders (customer_id, station_id, type, title, description, priority, status,
+				due_date, schedule_id, occurrence_at)
+			SELECT s.customer_id, s.id, 'inspection', $5::text || ' at ' || s.name, $6::text, 'normal', 'open',
+				$7::timestamptz, $1::int, $8::timestamptz
+			FROM stations s
+			WHERE s.customer_id = $2
+			  AND ($3::int IS NULL OR s.floor_plan_id = $3::int)
+			  AND ($4::int IS NULL OR s.id = $4::int)
+			ON CONFLICT (schedule_id, station_id, occurrence_at) WHERE schedule_id IS NOT NULL AND status <> 'cancelled'
+			DO NOTHING
+			RETURNING id;`,
+			schedule.ID, schedule.CustomerID, schedule.FloorPlanID, schedule.StationID, schedule.Name,
+			schedule.Description, occurrence.Date, occurrence.OccurrenceAt,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		for rows.Next() {
+			var id uint
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			created = append(created, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(created) > 0 {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO work_order_devices (work_order_id, station_product_id)
+			SELECT wo.id, sp.id
+			FROM work_orders wo
+			JOIN station_products sp ON sp.station_id = wo.station_id
+			WHERE wo.id = ANY($1);`,
+			created,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(created), nil
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, run_at, unique_key,
+		locked_by, locked_at, COALESCE(last_error, ''), created_at, updated_at, finished_at`
+
+func scanJob(row pgx.Row) (models.Job, error) {
+	var job models.Job
+
+	err := row.Scan(&job.ID, &job.Kind, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&job.UniqueKey, &job.LockedBy, &job.LockedAt, &job.LastError, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+
+	return job, err
+}
+
+// EnqueueJob inserts a pending job. When the job has a unique key and a
+// pending or running job with the same key already exists, nothing is
+// inserted and the existing job's id is returned with created set to false.
+func (db *Database) EnqueueJob(ctx context.Context, job models.Job) (int64, bool, error) {
+	return enqueueJob(ctx, db.Conn, job)
+}
+
+// queryer is satisfied by both the pool and a transaction.
+type queryer interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func enqueueJob(ctx context.Context, q queryer, job models.Job) (int64, bool, error) {
+	var id int64
+
+	if len(job.Payload) == 0 {
+		job.Payload = []byte("{}")
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 5
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+
+	err := q.QueryRow(ctx,
+		`INSERT INTO jobs (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4::timestamptz, $5)
+		ON CONFLICT (unique_key) WHERE status IN ('pending', 'running') DO NOTHING
+		RETURNING id;`,
+		job.Kind, job.Payload, job.MaxAttempts, job.RunAt, job.UniqueKey,
+	).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, err
+	}
+
+	err = q.QueryRow(ctx,
+		`SELECT id FROM jobs WHERE unique_key = $1 AND status IN ('pending', 'running');`,
+		job.UniqueKey,
+	).Scan(&id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return id, false, nil
+}
+
+// ClaimJobs locks up to limit due pending jobs of the given kinds for a
+// worker. SKIP LOCKED lets several replicas claim concurrently without
+// handing the same job out twice.
+func (db *Database) ClaimJobs(ctx context.Context, workerID string, kinds []string, limit int) ([]models.Job, error) {
+	var jobs []models.Job
+
+	rows, err := db.Conn.Query(ctx,
+		`UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_by = $1, locked_at = NOW(), updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND run_at <= NOW() AND kind = ANY($2)
+			ORDER BY run_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns+`;`,
+		workerID, kinds, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// CompleteJob marks a job claimed by workerID as succeeded.
+func (db *Database) CompleteJob(ctx context.Context, id int64, workerID string) error {
+	_, err := db.Conn.Exec(ctx,
+		`UPDATE jobs
+		SET status = 'succeeded', locked_by = NULL, locked_at = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running';`,
+		id, workerID,
+	)
+	return err
+}
+
+// FailJob records a failed attempt. The job is retried after the backoff
+// when it has attempts left, otherwise it is dead-lettered.
+func (db *Database) FailJob(ctx context.Context, id int64, workerID, message string, backoff time.Duration) error {
+	_, err := db.Conn.Exec(ctx,
+		`UPDATE jobs
+		SET status = CASE WHEN attempts < max_attempts THEN 'pending' ELSE 'dead' END,
+			run_at = CASE WHEN attempts < max_attempts THEN NOW() + make_interval(secs => $3) ELSE run_at END,
+			finished_at = CASE WHEN attempts < max_attempts THEN NULL ELSE NOW() END,
+			last_error = $4, locked_by = NULL, locked_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running';`,
+		id, workerID, backoff.Seconds(), message,
+	)
+	return err
+}
+
+// ReleaseStaleJobs hands back jobs whose worker has held them longer than
+// timeout, which happens when a replica dies mid-job.
+func (db *Database) ReleaseStaleJobs(ctx context.Context, timeout time.Duration) (int, error) {
+	tag, err := db.Conn.Exec(ctx,
+		`UPDATE jobs
+		SET status = CASE WHEN attempts < max_attempts THEN 'pending' ELSE 'dead' END,
+			finished_at = CASE WHEN attempts < max_attempts THEN NULL ELSE NOW() END,
+			last_error = 'worker lock expired', locked_by = NULL, locked_at = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1);`,
+		timeout.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (db *Database) GetJob(ctx context.Context, id int64) (models.Job, error) {
+	job, err := scanJob(db.Conn.QueryRow(ctx,
+		`SELECT `+jobColumns+`
+		FROM jobs
+		WHERE id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return job, ErrNotFound
+	}
+
+	return job, err
+}
+
+func (db *Database) GetJobs(ctx context.Context, status, kind string, page, limit int) ([]models.Job, int, error) {
+	var (
+		jobs  []models.Job
+		total int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM jobs
+		WHERE ($1::text IS NULL OR status = $1::text)
+		  AND ($2::text IS NULL OR kind = $2::text);`,
+		nullIfEmpty(status), nullIfEmpty(kind),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total jobs count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+jobColumns+`
+		FROM jobs
+		WHERE ($1::text IS NULL OR status = $1::text)
+		  AND ($2::text IS NULL OR kind = $2::text)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4;`,
+		nullIfEmpty(status), nullIfEmpty(kind), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, total, rows.Err()
+}
+
+// RetryJob puts a dead or cancelled job back in the queue with a fresh set of
+// attempts. A job whose unique key is already queued again cannot be retried.
+func (db *Database) RetryJob(ctx context.Context, id int64) error {
+	tag, err := db.Conn.Exec(ctx,
+		`UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), finished_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('dead', 'cancelled');`,
+		id,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_jobs_unique_key" {
+		return ErrJobQueued
+	}
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		if _, err := db.GetJob(ctx, id); err != nil {
+			return err
+		}
+		return ErrJobNotRetryable
+	}
+
+	return nil
+}
+
+// CancelJob cancels a job that has not started yet.
+func (db *Database) CancelJob(ctx context.Context, id int64) error {
+	tag, err := db.Conn.Exec(ctx,
+		`UPDATE jobs
+		SET status = 'cancelled', finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'pending';`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		if _, err := db.GetJob(ctx, id); err != nil {
+			return err
+		}
+		return ErrJobNotCancellable
+	}
+
+	return nil
+}
+
+// UpsertJobSchedule registers a schedule. The next run is only reset when the
+// cron expression changes, so restarting the server does not skip or repeat runs.
+func (db *Database) UpsertJobSchedule(ctx context.Context, schedule models.JobSchedule) error {
+	if len(schedule.Payload) == 0 {
+		schedule.Payload = []byte("{}")
+	}
+
+	_, err := db.Conn.Exec(ctx,
+		`INSERT INTO job_schedules (name, cron, kind, payload, next_run_at)
+		VALUES ($1, $2, $3, $4, $5::timestamptz)
+		ON CONFLICT (name) DO UPDATE
+		SET next_run_at = CASE WHEN job_schedules.cron <> EXCLUDED.cron THEN EXCLUDED.next_run_at ELSE job_schedules.next_run_at END,
+			cron = EXCLUDED.cron,
+			kind = EXCLUDED.kind,
+			payload = EXCLUDED.payload,
+			updated_at = NOW();`,
+		schedule.Name, schedule.Cron, schedule.Kind, schedule.Payload, schedule.NextRunAt,
+	)
+	return err
+}
+
+// FireDueSchedules enqueues a job for every schedule that is due and moves the
+// schedule on to its next run, as computed by next. Schedules are locked with
+// SKIP LOCKED so only one replica fires each run.
+func (db *Database) FireDueSchedules(ctx context.Context, next func(cron string, after time.Time) (time.Time, error)) (int, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT name, cron, kind, payload, next_run_at
+		FROM job_schedules
+		WHERE next_run_at <= NOW()
+		FOR UPDATE SKIP LOCKED;`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []models.JobSchedule
+	for rows.Next() {
+		var schedule models.JobSchedule
+		if err := rows.Scan(&schedule.Name, &schedule.Cron, &schedule.Kind, &schedule.Payload, &schedule.NextRunAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, schedule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, schedule := range due {
+		uniqueKey := fmt.Sprintf("schedule:%s", schedule.Name)
+		if _, _, err := enqueueJob(ctx, tx, models.Job{
+			Kind:      schedule.Kind,
+			Payload:   schedule.Payload,
+			UniqueKey: &uniqueKey,
+		}); err != nil {
+			return 0, err
+		}
+
+		// missed runs are collapsed into one, the next run is counted from now
+		nextRunAt, err := next(schedule.Cron, now)
+		if err != nil {
+			return 0, fmt.Errorf("schedule %s: %w", schedule.Name, err)
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE job_schedules
+			SET next_run_at = $2::timestamptz, last_run_at = NOW(), updated_at = NOW()
+			WHERE name = $1;`,
+			schedule.Name, nextRunAt,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(due), nil
+}
+
+func (db *Database) GetJobSchedules(ctx context.Context) ([]models.JobSchedule, error) {
+	var schedules []models.JobSchedule
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT name, cron, kind, payload, next_run_at, last_run_at, created_at, updated_at
+		FROM job_schedules
+		ORDER BY name;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schedule models.JobSchedule
+		if err := rows.Scan(&schedule.Name, &schedule.Cron, &schedule.Kind, &schedule.Payload,
+			&schedule.NextRunAt, &schedule.LastRunAt, &schedule.CreatedAt, &schedule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ReconcileLayout creates, moves and renames the stations of a customer's
+// floor plan to match the station markers of its layout, all or nothing,
+// and records a floor plan revision when anything changed. On a dry run it
+// only returns the plan. Stations without a marker are reported as orphans
+// and left alone.
+func (db *Database) ReconcileLayout(ctx context.Context, customerID, floorPlanID uint, req models.ReconcileLayout) (models.LayoutReconciliation, error) {
+	var plan models.LayoutReconciliation
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return plan, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockFloorPlan(ctx, tx, customerID, floorPlanID); err != nil {
+		return plan, err
+	}
+
+	var layoutText string
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(layout, '') FROM floor_plans WHERE id = $1;`,
+		floorPlanID,
+	).Scan(&layoutText)
+	if err != nil {
+		return plan, err
+	}
+	if layoutText == "" {
+		return plan, ErrNoLayout
+	}
+	layout, err := models.ParseLayout(layoutText)
+	if err != nil {
+		return plan, err
+	}
+
+	stations, err := getLayoutStations(ctx, tx, floorPlanID)
+	if err != nil {
+		return plan, err
+	}
+
+	plan = models.PlanLayoutStations(floorPlanID, layout, stations)
+	plan.DryRun = req.DryRun
+
+	// a position off the floor plan or a template the customer cannot use
+	// fails the dry run as well
+	if err := checkMarkerPositions(ctx, tx, floorPlanID, plan.Created); err != nil {
+		return plan, err
+	}
+	if err := checkMarkerPositions(ctx, tx, floorPlanID, plan.Updated); err != nil {
+		return plan, err
+	}
+	for _, change := range plan.Created {
+		if change.TemplateID == nil {
+			continue
+		}
+		var offered bool
+		err := tx.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM station_templates WHERE id = $1 AND (customer_id IS NULL OR customer_id = $2));`,
+			*change.TemplateID, customerID,
+		).Scan(&offered)
+		if err != nil {
+			return plan, err
+		}
+		if !offered {
+			return plan, fmt.Errorf("marker %s: %w", change.MarkerID, ErrStationTemplateNotFound)
+		}
+	}
+
+	if req.DryRun || len(plan.Created)+len(plan.Updated) == 0 {
+		return plan, nil
+	}
+
+	installedDate := time.Now()
+	if req.InstalledDate != nil {
+		installedDate = *req.InstalledDate
+	}
+
+	for i, change := range plan.Created {
+		x, y := change.Position.X, change.Position.Y
+
+		if change.TemplateID != nil {
+			station, err := provisionStation(ctx, tx, customerID, floorPlanID, models.ProvisionStation{
+				TemplateID:      *change.TemplateID,
+				Name:            change.Name,
+				InstalledDate:   installedDate,
+				LocationX:       &x,
+				LocationY:       &y,
+				Zone:            change.Zone,
+				Room:            change.Room,
+				StockLocationID: req.StockLocationID,
+			})
+			if err != nil {
+				return plan, fmt.Errorf("marker %s: %w", change.MarkerID, err)
+			}
+			_, err = tx.Exec(ctx,
+				`UPDATE stations SET layout_point_id = $2 WHERE id = $1;`,
+				station.StationID, change.MarkerID,
+			)
+			if err != nil {
+				return plan, err
+			}
+			plan.Created[i].StationID = station.StationID
+			plan.Created[i].Code = station.Code
+			plan.Created[i].DeviceIDs = station.DeviceIDs
+			continue
+		}
+
+		err = tx.QueryRow(ctx,
+			`INSERT INTO stations (name, description, customer_id, floor_plan_id, location_x, location_y, zone, room,
+				layout_point_id)
+			VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, code;`,
+			change.Name, customerID, floorPlanID, x, y, nullIfEmpty(change.Zone), nullIfEmpty(change.Room),
+			change.MarkerID,
+		).Scan(&plan.Created[i].StationID, &plan.Created[i].Code)
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	for _, change := range plan.Updated {
+		x, y := change.Position.X, change.Position.Y
+
+		// a moved station takes the room and zone it was moved into
+		_, err := tx.Exec(ctx,
+			`UPDATE stations
+			SET name = $2, location_x = $3, location_y = $4, layout_point_id = $5,
+				room = CASE WHEN $6 THEN COALESCE($7, room) ELSE room END,
+				zone = CASE WHEN $6 THEN COALESCE($8, zone) ELSE zone END,
+				updated_at = NOW()
+			WHERE id = $1;`,
+			change.StationID, change.Name, x, y, change.MarkerID, hasChange(change, models.MarkerMoved),
+			nullIfEmpty(change.Room), nullIfEmpty(change.Zone),
+		)
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	revision, err := recordFloorPlanRevision(ctx, tx, floorPlanID, nil)
+	if err != nil {
+		return plan, err
+	}
+	plan.Revision = &revision
+
+	return plan, tx.Commit(ctx)
+}
+
+// checkMarkerPositions checks the stations of markers would stand on the
+// floor plan.
+func checkMarkerPositions(ctx context.Context, tx pgx.Tx, floorPlanID uint, changes []models.MarkerStation) error {
+	for _, change := range changes {
+		x, y := change.Position.X, change.Position.Y
+		if err := checkStationPosition(ctx, tx, &floorPlanID, &x, &y); err != nil {
+			return fmt.Errorf("marker %s: %w", change.MarkerID, err)
+		}
+	}
+	return nil
+}
+
+func hasChange(change models.MarkerStation, kind string) bool {
+	for _, c := range change.Changes {
+		if c == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// getLayoutStations returns the stations of a floor plan as matched against
+// its layout markers.
+func getLayoutStations(ctx context.Context, tx pgx.Tx, floorPlanID uint) ([]models.Station, error) {
+	var stations []models.Station
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, name, code, location_x, location_y, template_id, COALESCE(layout_point_id, '')
+		FROM stations
+		WHERE floor_plan_id = $1
+		ORDER BY id
+		FOR UPDATE;`,
+		floorPlanID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var station models.Station
+		if err := rows.Scan(&station.ID, &station.Name, &station.Code, &station.LocationX, &station.LocationY,
+			&station.TemplateID, &station.LayoutPointID); err != nil {
+			return nil, err
+		}
+		stations = append(stations, station)
+	}
+
+	return stations, rows.Err()
+}
@@ -0,0 +1,396 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// AddOrder creates a draft order with its items, pricing every line from the
+// product's current price.
+func (db *Database) AddOrder(ctx context.Context, order models.Order) (uint, error) {
+
+	var id uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO orders (
+		customer_id,
+		ordered_by,
+		status,
+		stock_location_id,
+		notes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id;`,
+		order.CustomerID, order.OrderedBy, string(models.OrderDraft), order.StockLocationID, order.Notes,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range order.Items {
+		if _, err := insertOrderItem(ctx, tx, id, order.CustomerID, item); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := updateOrderTotal(ctx, tx, id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (db *Database) GetOrder(ctx context.Context, id uint) (models.Order, error) {
+	var order models.Order
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT o.id, o.customer_id, c.name, o.ordered_by, o.status, o.total_amount, o.stock_location_id,
+		COALESCE(o.notes, ''), o.submitted_at, o.fulfilled_at, o.cancelled_at, o.created_at, o.updated_at
+		FROM orders o
+		JOIN customers c ON c.id = o.customer_id
+		WHERE o.id = $1;`,
+		id,
+	).Scan(&order.ID, &order.CustomerID, &order.CustomerName, &order.OrderedBy, &order.Status, &order.TotalAmount,
+		&order.StockLocationID, &order.Notes, &order.SubmittedAt, &order.FulfilledAt, &order.CancelledAt,
+		&order.CreatedAt, &order.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return order, ErrNotFound
+	}
+	if err != nil {
+		return order, err
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT oi.id, oi.order_id, oi.product_id, p.name, oi.quantity, oi.unit_price, oi.line_total,
+		oi.station_product_id, COALESCE(oi.purpose, '')
+		FROM order_items oi
+		JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.id;`,
+		id,
+	)
+	if err != nil {
+		return order, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.Quantity,
+			&item.UnitPrice, &item.LineTotal, &item.StationProductID, &item.Purpose); err != nil {
+			return order, err
+		}
+		order.Items = append(order.Items, item)
+	}
+
+	return order, rows.Err()
+}
+
+func (db *Database) GetOrders(ctx context.Context, customerID, status string, page, limit int) ([]models.Order, int, error) {
+	var (
+		orders []models.Order
+		total  int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM orders
+		WHERE ($1::int IS NULL OR customer_id = $1::int)
+		  AND ($2::text IS NULL OR status = $2::text);`,
+		nullIfEmpty(customerID), nullIfEmpty(status),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total orders count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT o.id, o.customer_id, c.name, o.ordered_by, o.status, o.total_amount, o.stock_location_id,
+		COALESCE(o.notes, ''), o.submitted_at, o.fulfilled_at, o.cancelled_at, o.created_at, o.updated_at
+		FROM orders o
+		JOIN customers c ON c.id = o.customer_id
+		WHERE ($1::int IS NULL OR o.customer_id = $1::int)
+		  AND ($2::text IS NULL OR o.status = $2::text)
+		ORDER BY o.created_at DESC, o.id DESC
+		LIMIT $3 OFFSET $4;`,
+		nullIfEmpty(customerID), nullIfEmpty(status), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.ID, &order.CustomerID, &order.CustomerName, &order.OrderedBy, &order.Status,
+			&order.TotalAmount, &order.StockLocationID, &order.Notes, &order.SubmittedAt, &order.FulfilledAt,
+			&order.CancelledAt, &order.CreatedAt, &order.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, total, rows.Err()
+}
+
+// AddOrderItem adds a line to a draft order and recalculates its total.
+func (db *Database) AddOrderItem(ctx context.Context, orderID uint, item models.OrderItem) (uint, error) {
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	status, customerID, err := lockOrder(ctx, tx, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	if models.OrderStatus(status) != models.OrderDraft {
+		return 0, ErrOrderNotEditable
+	}
+
+	id, err := insertOrderItem(ctx, tx, orderID, customerID, item)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := updateOrderTotal(ctx, tx, orderID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteOrderItem removes a line from a draft order and recalculates its total.
+func (db *Database) DeleteOrderItem(ctx context.Context, orderID, itemID uint) error {
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	status, _, err := lockOrder(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if models.OrderStatus(status) != models.OrderDraft {
+		return ErrOrderNotEditable
+	}
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM order_items
+		WHERE id = $1 AND order_id = $2;`,
+		itemID, orderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err := updateOrderTotal(ctx, tx, orderID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateOrderStatus moves an order to a new status. Fulfilling an order with a
+// stock location receives its items into that location.
+func (db *Database) UpdateOrderStatus(ctx context.Context, id uint, update models.OrderStatusUpdate) error {
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	status, _, err := lockOrder(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	next := models.OrderStatus(update.Status)
+	if !models.OrderStatus(status).CanTransition(next) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, status, next)
+	}
+
+	switch next {
+	case models.OrderSubmitted:
+		var items int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM order_items WHERE order_id = $1;`, id).Scan(&items); err != nil {
+			return err
+		}
+		if items == 0 {
+			return ErrEmptyOrder
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE orders SET status = $1, submitted_at = NOW(), updated_at = NOW() WHERE id = $2;`,
+			string(next), id,
+		)
+	case models.OrderFulfilled:
+		if err := receiveOrderStock(ctx, tx, id, update.UpdatedBy); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE orders SET status = $1, fulfilled_at = NOW(), updated_at = NOW() WHERE id = $2;`,
+			string(next), id,
+		)
+	case models.OrderCancelled:
+		_, err = tx.Exec(ctx,
+			`UPDATE orders SET status = $1, cancelled_at = NOW(), updated_at = NOW() WHERE id = $2;`,
+			string(next), id,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockOrder locks an order row for the rest of the transaction and returns its
+// status and customer.
+func lockOrder(ctx context.Context, tx pgx.Tx, id uint) (string, uint, error) {
+	var (
+		status     string
+		customerID uint
+	)
+
+	err := tx.QueryRow(ctx,
+		`SELECT status, customer_id FROM orders WHERE id = $1 FOR UPDATE;`,
+		id,
+	).Scan(&status, &customerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, ErrNotFound
+	}
+
+	return status, customerID, err
+}
+
+// insertOrderItem adds a line priced at the product's current price. A linked
+// device must belong to the order's customer.
+func insertOrderItem(ctx context.Context, tx pgx.Tx, orderID, customerID uint, item models.OrderItem) (uint, error) {
+	var id uint
+
+	if item.StationProductID != nil {
+		var deviceCustomerID uint
+		err := tx.QueryRow(ctx,
+			`SELECT s.customer_id
+			FROM station_products sp
+			JOIN stations s ON s.id = sp.station_id
+			WHERE sp.id = $1;`,
+			*item.StationProductID,
+		).Scan(&deviceCustomerID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%w: device %d not found", ErrDeviceNotForCustomer, *item.StationProductID)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if deviceCustomerID != customerID {
+			return 0, fmt.Errorf("%w: device %d", ErrDeviceNotForCustomer, *item.StationProductID)
+		}
+	}
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO order_items (order_id, product_id, quantity, unit_price, line_total, station_product_id, purpose)
+		SELECT $1, p.id, $3, p.price, p.price * $3, $4, NULLIF($5, '')
+		FROM products p
+		WHERE p.id = $2
+		RETURNING id;`,
+		orderID, item.ProductID, item.Quantity, item.StationProductID, item.Purpose,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %d", ErrProductNotFound, item.ProductID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func updateOrderTotal(ctx context.Context, tx pgx.Tx, id uint) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE orders
+		SET total_amount = (SELECT COALESCE(SUM(line_total), 0) FROM order_items WHERE order_id = $1),
+			updated_at = NOW()
+		WHERE id = $1;`,
+		id,
+	)
+	return err
+}
+
+// receiveOrderStock books a receipt for every line of an order that has a
+// stock location. Orders without one are delivered straight to site.
+func receiveOrderStock(ctx context.Context, tx pgx.Tx, id uint, receivedBy *uint) error {
+	var locationID *uint
+
+	if err := tx.QueryRow(ctx, `SELECT stock_location_id FROM orders WHERE id = $1;`, id).Scan(&locationID); err != nil {
+		return err
+	}
+
+	if locationID == nil {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT product_id, quantity FROM order_items WHERE order_id = $1 ORDER BY id;`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	var receipts []models.StockMovement
+	for rows.Next() {
+		receipt := models.StockMovement{
+			LocationID:   *locationID,
+			MovementType: string(models.StockReceipt),
+			Note:         fmt.Sprintf("order #%d", id),
+			CreatedBy:    receivedBy,
+		}
+		if err := rows.Scan(&receipt.ProductID, &receipt.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		receipts = append(receipts, receipt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, receipt := range receipts {
+		if _, err := applyStockMovement(ctx, tx, receipt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
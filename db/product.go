@@ -106,8 +106,9 @@ func (db *Database) AddProduct(ctx context.Context, product models.Product) (uin
 	var id uint
 
 	err := db.Conn.QueryRow(ctx,
-		`INSERT INTO products (name, category_id, price, description, image_url, parent_id, coverage_amount, age_limit, children)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`INSERT INTO products (name, category_id, price, description, image_url, parent_id, coverage_amount, age_limit, children,
+			service_interval_days, lifetime_months)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id;`,
 		product.Name,
 		product.CategoryID,
@@ -118,6 +119,8 @@ func (db *Database) AddProduct(ctx context.Context, product models.Product) (uin
 		product.CoverageAmount,
 		product.AgeLimit,
 		product.Children,
+		product.ServiceIntervalDays,
+		product.LifetimeMonths,
 	).Scan(&id)
 
 	if err != nil {
@@ -133,20 +136,22 @@ func (db *Database) GetProduct(ctx context.Context, id string) (models.Product,
 
 	// Fetch the main product (parent)
 	err := db.Conn.QueryRow(ctx,
-		`SELECT id, name, category_id,price, description, image_url, parent_id, coverage_amount, age_limit, created_at, updated_at
+		`SELECT id, name, category_id,price, description, image_url, parent_id, coverage_amount, age_limit,
+		service_interval_days, lifetime_months, created_at, updated_at
 		FROM products
 		WHERE id = $1;`,
 		id,
 	).Scan(&product.ID, &product.Name, &product.CategoryID, &product.Price, &product.Description,
 		&product.ImageURL, &product.ParentID, &product.CoverageAmount, &product.AgeLimit,
-		&product.CreatedAt, &product.UpdatedAt)
+		&product.ServiceIntervalDays, &product.LifetimeMonths, &product.CreatedAt, &product.UpdatedAt)
 	if err != nil {
 		return product, err
 	}
 
 	// Fetch the children (products that have the current product as their parent)
 	rows, err := db.Conn.Query(ctx,
-		`SELECT id, name, category_id,price, description, image_url, parent_id, coverage_amount, age_limit, created_at, updated_at
+		`SELECT id, name, category_id,price, description, image_url, parent_id, coverage_amount, age_limit,
+		service_interval_days, lifetime_months, created_at, updated_at
 		FROM products
 		WHERE parent_id = $1;`,
 		product.ID,
@@ -160,7 +165,7 @@ func (db *Database) GetProduct(ctx context.Context, id string) (models.Product,
 		var child models.Product
 		err := rows.Scan(&child.ID, &child.Name, &child.CategoryID, &child.Price, &child.Description,
 			&child.ImageURL, &child.ParentID, &child.CoverageAmount, &child.AgeLimit,
-			&child.CreatedAt, &child.UpdatedAt)
+			&child.ServiceIntervalDays, &child.LifetimeMonths, &child.CreatedAt, &child.UpdatedAt)
 		if err != nil {
 			return product, err
 		}
@@ -184,7 +189,7 @@ func (db *Database) GetProducts(ctx context.Context, page, limit int) ([]models.
 	rows, err := db.Conn.Query(ctx,
 		`SELECT p.id, p.name, p.category_id, c.name as category_name, p.price, p.description, 
                 p.image_url, p.parent_id, p.coverage_amount, p.age_limit, 
-                p.created_at, p.updated_at
+                p.service_interval_days, p.lifetime_months, p.created_at, p.updated_at
 		 FROM products p
 		 LEFT JOIN categories c ON p.category_id = c.id
 		 ORDER BY p.id
@@ -203,7 +208,7 @@ func (db *Database) GetProducts(ctx context.Context, page, limit int) ([]models.
 		var parentID sql.NullInt64
 
 		if err := rows.Scan(&p.ID, &p.Name, &p.CategoryID, &p.CategoryName, &p.Price, &p.Description,
-			&p.ImageURL, &parentID, &p.CoverageAmount, &p.AgeLimit, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			&p.ImageURL, &parentID, &p.CoverageAmount, &p.AgeLimit, &p.ServiceIntervalDays, &p.LifetimeMonths, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, 0, err
 		}
 
@@ -286,8 +291,9 @@ func (db *Database) UpdateProduct(ctx context.Context, product models.Product) e
 
 	_, err := db.Conn.Exec(ctx,
 		`UPDATE products
-		SET name = $1, category_id = $2, price = $3, description = $4, image_url = $5, parent_id = $6, coverage_amount = $7, age_limit = $8, children = $9
-		WHERE id = $10;`,
+		SET name = $1, category_id = $2, price = $3, description = $4, image_url = $5, parent_id = $6, coverage_amount = $7, age_limit = $8, children = $9,
+			service_interval_days = $10, lifetime_months = $11
+		WHERE id = $12;`,
 		product.Name,
 		product.CategoryID,
 		product.Price,
@@ -297,6 +303,8 @@ func (db *Database) UpdateProduct(ctx context.Context, product models.Product) e
 		product.CoverageAmount,
 		product.AgeLimit,
 		product.Children,
+		product.ServiceIntervalDays,
+		product.LifetimeMonths,
 		product.ID,
 	)
 	if err != nil {
@@ -314,7 +322,7 @@ func (db *Database) DeleteProduct(ctx context.Context, id string) error {
 		id,
 	)
 	if err != nil {
-		return err
+		return keptEvidence(err)
 	}
 
 	return nil
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+
+	"github.com/aakash-tyagi/linmed/models"
+)
+
+// GetReplenishmentSuggestions aggregates what has to be bought to cover the
+// next horizonDays: one replacement for every device expiring in that window,
+// the components those devices hold, and the top-up of every component below
+// its minimum. Demand is netted against stock on hand, either across all
+// locations or at a single location, and may be limited to the devices of a
+// customer or facility.
+func (db *Database) GetReplenishmentSuggestions(ctx context.Context, horizonDays int, customerID, locationID, facilityID string) ([]models.ReplenishmentSuggestion, error) {
+	var suggestions []models.ReplenishmentSuggestion
+
+	rows, err := db.Conn.Query(ctx,
+		`WITH devices AS (
+			SELECT sp.*, sp.expiry_date <= NOW() + make_interval(days => $1) AS expiring
+			FROM station_products sp
+			JOIN stations s ON s.id = sp.station_id
+			`+stationFacility+`
+			WHERE ($2::int IS NULL OR s.customer_id = $2::int)
+			  AND ($4::int IS NULL OR sf.facility_id = $4::int)
+		),
+		demand AS (
+			SELECT product_id, 1 AS device_qty, 0 AS component_qty
+			FROM devices
+			WHERE expiring
+
+			UNION ALL
+
+			SELECT child_product_1_id, 0,
+				CASE WHEN expiring THEN GREATEST(child_product_1_qty, child_product_1_min_qty)
+				     ELSE child_product_1_min_qty - child_product_1_qty END
+			FROM devices
+			WHERE child_product_1_id IS NOT NULL
+			  AND (expiring OR child_product_1_qty < child_product_1_min_qty)
+
+			UNION ALL
+
+			SELECT child_product_2_id, 0,
+				CASE WHEN expiring THEN GREATEST(child_product_2_qty, child_product_2_min_qty)
+				     ELSE child_product_2_min_qty - child_product_2_qty END
+			FROM devices
+			WHERE child_product_2_id IS NOT NULL
+			  AND (expiring OR child_product_2_qty < child_product_2_min_qty)
+		),
+		stock AS (
+			SELECT product_id, SUM(quantity)::int AS on_hand
+			FROM stock_levels
+			WHERE ($3::int IS NULL OR location_id = $3::int)
+			GROUP BY product_id
+		)
+		SELECT p.id, p.name, SUM(d.device_qty)::int, SUM(d.component_qty)::int,
+			st.on_hand, p.price
+		FROM demand d
+		JOIN products p ON p.id = d.product_id
+		LEFT JOIN stock st ON st.product_id = d.product_id
+		GROUP BY p.id, p.name, p.price, st.on_hand
+		HAVING SUM(d.device_qty + d.component_qty) > 0
+		ORDER BY p.name;`,
+		horizonDays, nullIfEmpty(customerID), nullIfEmpty(locationID), nullIfEmpty(facilityID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var suggestion models.ReplenishmentSuggestion
+		if err := rows.Scan(&suggestion.ProductID, &suggestion.ProductName, &suggestion.ExpiringDevices,
+			&suggestion.ComponentsToRefill, &suggestion.StockOnHand, &suggestion.UnitPrice); err != nil {
+			return nil, err
+		}
+
+		suggestion.RequiredQuantity = suggestion.ExpiringDevices + suggestion.ComponentsToRefill
+		suggestion.SuggestedQuantity = suggestion.RequiredQuantity
+		if suggestion.StockOnHand != nil && *suggestion.StockOnHand > 0 {
+			suggestion.SuggestedQuantity -= *suggestion.StockOnHand
+			if suggestion.SuggestedQuantity < 0 {
+				suggestion.SuggestedQuantity = 0
+			}
+		}
+		suggestion.EstimatedCost = float64(suggestion.SuggestedQuantity) * suggestion.UnitPrice
+
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions, rows.Err()
+}
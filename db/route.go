@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aakash-tyagi/linmed/models"
+)
+
+// GetRouteStops returns the stations to visit for a customer, grouped by
+// facility and floor plan, with the devices to service at each. Without
+// deviceIDs every device due within dueWithinDays is included; with a
+// facilityID only the stations of that facility are. Devices expiring within the
+// window are to be replaced, the others inspected. Stops are not ordered.
+func (db *Database) GetRouteStops(ctx context.Context, customerID uint, deviceIDs []uint, dueWithinDays int, facilityID *uint) ([]models.FloorRoute, error) {
+	var floors []models.FloorRoute
+
+	if len(deviceIDs) > 0 {
+		var count int
+		err := db.Conn.QueryRow(ctx,
+			`SELECT COUNT(*)
+			FROM station_products sp
+			JOIN stations s ON s.id = sp.station_id
+			WHERE sp.id = ANY($1) AND s.customer_id = $2;`,
+			deviceIDs, customerID,
+		).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count != len(uniqueIDs(deviceIDs)) {
+			return nil, ErrDeviceNotForCustomer
+		}
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT s.floor_plan_id, COALESCE(fp.name, ''), s.id, s.name, s.location_x, s.location_y,
+			sp.id, p.name,
+			CASE WHEN sp.expiry_date <= NOW() + make_interval(days => $3) THEN 'replacement' ELSE 'inspection' END,
+			CASE WHEN sp.expiry_date <= NOW() + make_interval(days => $3) THEN sp.expiry_date ELSE sp.inspection_date END,
+			sf.facility_id, COALESCE(sf.facility_name, '')
+		FROM station_products sp
+		JOIN stations s ON s.id = sp.station_id
+		JOIN products p ON p.id = sp.product_id
+		LEFT JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		`+stationFacility+`
+		WHERE s.customer_id = $1
+		  AND (CASE WHEN cardinality($2::int[]) > 0 THEN sp.id = ANY($2::int[])
+		       ELSE sp.expiry_date <= NOW() + make_interval(days => $3)
+		         OR sp.inspection_date <= NOW() + make_interval(days => $3) END)
+		  AND ($4::int IS NULL OR sf.facility_id = $4::int)
+		ORDER BY sf.facility_id NULLS LAST, s.floor_plan_id NULLS LAST, s.id, sp.id;`,
+		customerID, deviceIDs, dueWithinDays, facilityID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch route stops: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			floor  models.FloorRoute
+			stop   models.RouteStop
+			device models.RouteDevice
+		)
+		if err := rows.Scan(&floor.FloorPlanID, &floor.FloorPlanName, &stop.StationID, &stop.StationName,
+			&stop.LocationX, &stop.LocationY, &device.StationProductID, &device.ProductName, &device.Task,
+			&device.DueDate, &floor.FacilityID, &floor.FacilityName); err != nil {
+			return nil, err
+		}
+
+		// rows arrive grouped by floor plan and station
+		if n := len(floors); n == 0 || !sameFloorPlan(floors[n-1].FloorPlanID, floor.FloorPlanID) {
+			floors = append(floors, floor)
+		}
+		current := &floors[len(floors)-1]
+
+		if n := len(current.Stops); n == 0 || current.Stops[n-1].StationID != stop.StationID {
+			current.Stops = append(current.Stops, stop)
+		}
+		last := &current.Stops[len(current.Stops)-1]
+		last.Devices = append(last.Devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return floors, db.setRouteScales(ctx, floors)
+}
+
+// setRouteScales sets the scale of each floor whose floor plan has a valid
+// layout, so its route can be measured in metres.
+func (db *Database) setRouteScales(ctx context.Context, floors []models.FloorRoute) error {
+	var ids []uint
+	for _, floor := range floors {
+		if floor.FloorPlanID != nil {
+			ids = append(ids, *floor.FloorPlanID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, layout FROM floor_plans WHERE id = ANY($1) AND layout IS NOT NULL AND layout <> '';`,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	scales := map[uint]float64{}
+	for rows.Next() {
+		var (
+			id         uint
+			layoutText string
+		)
+		if err := rows.Scan(&id, &layoutText); err != nil {
+			return err
+		}
+		if layout, err := models.ParseLayout(layoutText); err == nil {
+			scales[id] = layout.Scale
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range floors {
+		if floors[i].FloorPlanID != nil {
+			floors[i].Scale = scales[*floors[i].FloorPlanID]
+		}
+	}
+	return nil
+}
+
+func sameFloorPlan(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetStationScan resolves a scanned station code to the station with its
+// devices, its open work orders and its overdue inspections and expiries.
+// Codes match regardless of case and surrounding space.
+func (db *Database) GetStationScan(ctx context.Context, code string) (models.StationScan, error) {
+	var scan models.StationScan
+
+	station := &scan.Station
+	err := db.Conn.QueryRow(ctx,
+		`SELECT s.id, s.name, COALESCE(s.description, ''), s.customer_id, s.floor_plan_id, s.created_at,
+			s.updated_at, s.location_x, s.location_y, s.rotation, COALESCE(s.zone, ''), COALESCE(s.room, ''),
+			s.code, c.name, COALESCE(fp.name, ''), sf.facility_id, COALESCE(sf.facility_name, '')
+		FROM stations s
+		JOIN customers c ON c.id = s.customer_id
+		LEFT JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		`+stationFacility+`
+		WHERE s.code = $1;`,
+		strings.ToUpper(strings.TrimSpace(code)),
+	).Scan(&station.ID, &station.Name, &station.Description, &station.CustomerID, &station.FloorPlanID,
+		&station.CreatedAt, &station.UpdatedAt, &station.LocationX, &station.LocationY, &station.Rotation,
+		&station.Zone, &station.Room, &station.Code, &scan.CustomerName, &scan.FloorPlanName, &scan.FacilityID,
+		&scan.FacilityName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return scan, ErrStationNotFound
+	}
+	if err != nil {
+		return scan, err
+	}
+
+	if scan.Devices, err = db.getStationDevices(ctx, station.ID); err != nil {
+		return scan, err
+	}
+	if scan.WorkOrders, err = db.getOpenStationWorkOrders(ctx, station.ID); err != nil {
+		return scan, err
+	}
+	if scan.OverdueTasks, err = db.getStationOverdueTasks(ctx, station.ID); err != nil {
+		return scan, err
+	}
+
+	return scan, nil
+}
+
+func (db *Database) getStationDevices(ctx context.Context, stationID uint) ([]models.StationProduct, error) {
+	devices := []models.StationProduct{}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT sp.id, sp.station_id, sp.product_id, p.name, sp.installation_date, sp.expiry_date,
+			sp.inspection_date, sp.child_product_1_id, sp.child_product_1_qty, sp.child_product_2_id,
+			sp.child_product_2_qty, sp.child_product_1_min_qty, sp.child_product_2_min_qty,
+			sp.needs_attention, COALESCE(sp.attention_reason, ''), sp.created_at, sp.updated_at
+		FROM station_products sp
+		JOIN products p ON p.id = sp.product_id
+		WHERE sp.station_id = $1
+		ORDER BY sp.id;`,
+		stationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var device models.StationProduct
+		if err := rows.Scan(&device.ID, &device.StationID, &device.ProductID, &device.ProductName,
+			&device.InstalledDate, &device.ExpiryDate, &device.InspectionDate, &device.ChildProduct1ID,
+			&device.ChildProduct1Qty, &device.ChildProduct2ID, &device.ChildProduct2Qty,
+			&device.ChildProduct1MinQty, &device.ChildProduct2MinQty, &device.NeedsAttention,
+			&device.AttentionReason, &device.CreatedAt, &device.UpdatedAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
+
+// getOpenStationWorkOrders lists the work orders of a station still to be
+// done, in the order GetWorkOrders lists them.
+func (db *Database) getOpenStationWorkOrders(ctx context.Context, stationID uint) ([]models.WorkOrder, error) {
+	workOrders := []models.WorkOrder{}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+workOrderColumns+`
+		`+workOrderJoins+`
+		`+workOrderFilter+`
+		ORDER BY wo.due_date,
+			CASE wo.priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'normal' THEN 2 ELSE 3 END,
+			wo.id;`,
+		nil, stationID, nil, nil, nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		wo, err := scanWorkOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		workOrders = append(workOrders, wo)
+	}
+
+	return workOrders, rows.Err()
+}
+
+func (db *Database) getStationOverdueTasks(ctx context.Context, stationID uint) ([]models.OverdueTask, error) {
+	tasks := []models.OverdueTask{}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT d.kind, d.due_date, CURRENT_DATE - d.due_date::date, sp.id, p.name, s.id, s.name,
+			COALESCE(fp.name, ''), c.id, c.name, sf.facility_id, COALESCE(sf.facility_name, '')
+		`+deviceTaskJoins+`
+		LEFT JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		`+stationFacility+`
+		`+deviceDueDates+`
+		WHERE d.due_date < NOW() AND `+dueDateOutstanding+`
+		  AND s.id = $1
+		ORDER BY d.due_date, sp.id, d.kind;`,
+		stationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task models.OverdueTask
+		if err := rows.Scan(&task.Kind, &task.DueDate, &task.DaysOverdue, &task.StationProductID,
+			&task.ProductName, &task.StationID, &task.StationName, &task.FloorPlanName, &task.CustomerID,
+			&task.CustomerName, &task.FacilityID, &task.FacilityName); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetStationLabels returns what the labels of a floor plan's stations show,
+// by room and name so that the printed sheets follow a walk round the floor.
+func (db *Database) GetStationLabels(ctx context.Context, floorPlanID uint) ([]models.StationLabel, error) {
+	var labels []models.StationLabel
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, name, code, COALESCE(room, ''), COALESCE(zone, '')
+		FROM stations
+		WHERE floor_plan_id = $1
+		ORDER BY room NULLS LAST, name, id;`,
+		floorPlanID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var label models.StationLabel
+		if err := rows.Scan(&label.ID, &label.Name, &label.Code, &label.Room, &label.Zone); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+
+	return labels, rows.Err()
+}
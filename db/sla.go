@@ -0,0 +1,359 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// deviceDueDates gives a row per date a device (sp) falls due on, as d.kind
+// and d.due_date. d.sla_due_date is the date before any approved deferral,
+// which the SLA is measured against.
+const deviceDueDates = `CROSS JOIN LATERAL (VALUES
+			('inspection', sp.inspection_date, COALESCE(sp.inspection_due_date, sp.inspection_date)),
+			('expiry', sp.expiry_date, COALESCE(sp.expiry_due_date, sp.expiry_date))
+		) AS d(kind, due_date, sla_due_date)`
+
+// dueDateOutstanding holds while no completed service satisfied a device's
+// due date d.
+const dueDateOutstanding = `d.due_date IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM service_records sr
+			WHERE sr.station_product_id = sp.id AND sr.due_kind = d.kind AND sr.due_date = d.sla_due_date
+			  AND sr.status = 'completed'
+		)`
+
+// slaItems rates every date a device fell due on against its customer's SLA
+// target: the dates a service satisfied, with the first such service, and
+// the devices' current dates that are still outstanding. The deadline is the
+// last day the work counts as on time.
+const slaItems = `SELECT due.kind, due.due_date, due.serviced_at, (due.due_date::date + t.within_days) AS deadline,
+		t.within_days, sp.id AS station_product_id, p.name AS product_name, s.id AS station_id,
+		s.name AS station_name, c.id AS customer_id, c.name AS customer_name, sf.facility_id,
+		COALESCE(sf.facility_name, '') AS facility_name,
+		CASE
+			WHEN due.serviced_at::date <= due.due_date::date + t.within_days THEN 'met'
+			WHEN due.serviced_at IS NOT NULL OR CURRENT_DATE > due.due_date::date + t.within_days THEN 'breached'
+			ELSE 'pending'
+		END AS outcome
+	FROM (
+		SELECT station_product_id, due_kind AS kind, due_date, MIN(service_date) AS serviced_at
+		FROM service_records
+		WHERE due_date IS NOT NULL AND status = 'completed'
+		GROUP BY station_product_id, due_kind, due_date
+		UNION ALL
+		SELECT sp.id, d.kind, d.sla_due_date, NULL::timestamp
+		FROM station_products sp
+		` + deviceDueDates + `
+		WHERE ` + dueDateOutstanding + `
+	) due
+	JOIN station_products sp ON sp.id = due.station_product_id
+	JOIN stations s ON s.id = sp.station_id
+	JOIN customers c ON c.id = s.customer_id
+	JOIN products p ON p.id = sp.product_id
+	` + stationFacility + `
+	JOIN sla_targets t ON t.customer_id = c.id AND t.kind = due.kind`
+
+const overdueTaskFilter = `WHERE d.due_date < NOW() AND ` + dueDateOutstanding + `
+	  AND ($1::int IS NULL OR s.customer_id = $1::int)
+	  AND ($2::text IS NULL OR d.kind = $2::text)
+	  AND ($3::int IS NULL OR sf.facility_id = $3::int)`
+
+const slaBreachFilter = `WHERE i.outcome = 'breached'
+	  AND ($1::int IS NULL OR i.customer_id = $1::int)
+	  AND ($2::text IS NULL OR i.kind = $2::text)
+	  AND ($3::timestamptz IS NULL OR i.due_date >= $3::timestamptz)
+	  AND ($4::timestamptz IS NULL OR i.due_date < $4::timestamptz)
+	  AND ($5::int IS NULL OR i.facility_id = $5::int)`
+
+// GetOverdueTasks lists the devices whose inspection or expiry date has
+// passed without being serviced, longest overdue first.
+func (db *Database) GetOverdueTasks(ctx context.Context, customerID, kind, facilityID string, page, limit int) ([]models.OverdueTask, int, error) {
+	var (
+		tasks []models.OverdueTask
+		total int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		`+deviceTaskJoins+`
+		`+stationFacility+`
+		`+deviceDueDates+`
+		`+overdueTaskFilter+`;`,
+		nullIfEmpty(customerID), nullIfEmpty(kind), nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total overdue tasks count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT d.kind, d.due_date, CURRENT_DATE - d.due_date::date, sp.id, p.name, s.id, s.name,
+			COALESCE(fp.name, ''), c.id, c.name, sf.facility_id, COALESCE(sf.facility_name, '')
+		`+deviceTaskJoins+`
+		LEFT JOIN floor_plans fp ON fp.id = s.floor_plan_id
+		`+stationFacility+`
+		`+deviceDueDates+`
+		`+overdueTaskFilter+`
+		ORDER BY d.due_date, sp.id, d.kind
+		LIMIT $4 OFFSET $5;`,
+		nullIfEmpty(customerID), nullIfEmpty(kind), nullIfEmpty(facilityID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task models.OverdueTask
+		if err := rows.Scan(&task.Kind, &task.DueDate, &task.DaysOverdue, &task.StationProductID,
+			&task.ProductName, &task.StationID, &task.StationName, &task.FloorPlanName, &task.CustomerID,
+			&task.CustomerName, &task.FacilityID, &task.FacilityName); err != nil {
+			return nil, 0, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, total, rows.Err()
+}
+
+// SetSLATarget creates a customer's SLA target for a kind of due date or
+// replaces the existing one.
+func (db *Database) SetSLATarget(ctx context.Context, target models.SLATarget) (models.SLATarget, error) {
+	err := db.Conn.QueryRow(ctx,
+		`INSERT INTO sla_targets (customer_id, kind, within_days, target_percent)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM customers WHERE id = $1)
+		ON CONFLICT (customer_id, kind) DO UPDATE
+		SET within_days = EXCLUDED.within_days, target_percent = EXCLUDED.target_percent, updated_at = NOW()
+		RETURNING id, created_at, updated_at;`,
+		target.CustomerID, target.Kind, target.WithinDays, target.TargetPercent,
+	).Scan(&target.ID, &target.CreatedAt, &target.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return target, ErrCustomerNotFound
+	}
+
+	return target, err
+}
+
+func (db *Database) GetSLATargets(ctx context.Context, customerID uint) ([]models.SLATarget, error) {
+	var targets []models.SLATarget
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, customer_id, kind, within_days, target_percent, created_at, updated_at
+		FROM sla_targets
+		WHERE customer_id = $1
+		ORDER BY kind;`,
+		customerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.SLATarget
+		if err := rows.Scan(&t.ID, &t.CustomerID, &t.Kind, &t.WithinDays, &t.TargetPercent, &t.CreatedAt,
+			&t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	return targets, rows.Err()
+}
+
+func (db *Database) DeleteSLATarget(ctx context.Context, customerID uint, kind string) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM sla_targets WHERE customer_id = $1 AND kind = $2;`,
+		customerID, kind,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetSLACompliance reports, for each of a customer's SLA targets, how the
+// dates falling due between from and to fared, per week or month. A
+// facility narrows it to the dates of that facility's devices.
+func (db *Database) GetSLACompliance(ctx context.Context, customerID uint, facilityID *uint, from, to time.Time, interval string) ([]models.SLACompliance, error) {
+	var exists bool
+	err := db.Conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1);`, customerID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrCustomerNotFound
+	}
+
+	if facilityID != nil {
+		err := db.Conn.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM facilities WHERE id = $1 AND customer_id = $2);`,
+			*facilityID, customerID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrFacilityNotFound
+		}
+	}
+
+	targets, err := db.GetSLATargets(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var compliance []models.SLACompliance
+	for _, target := range targets {
+		c := models.SLACompliance{Target: target}
+
+		rows, err := db.Conn.Query(ctx,
+			`SELECT p.start, p.start + ('1 ' || $3)::interval,
+				COUNT(i.kind),
+				COUNT(*) FILTER (WHERE i.outcome = 'met'),
+				COUNT(*) FILTER (WHERE i.outcome = 'breached'),
+				COUNT(*) FILTER (WHERE i.outcome = 'pending')
+			FROM generate_series(date_trunc($3, $1::timestamptz), $2::timestamptz - interval '1 second',
+				('1 ' || $3)::interval) AS p(start)
+			LEFT JOIN (`+slaItems+`) i
+				ON i.customer_id = $4 AND i.kind = $5 AND ($6::int IS NULL OR i.facility_id = $6::int)
+				AND i.due_date >= GREATEST(p.start, $1::timestamptz)
+				AND i.due_date < LEAST(p.start + ('1 ' || $3)::interval, $2::timestamptz)
+			GROUP BY p.start
+			ORDER BY p.start;`,
+			from, to, interval, customerID, target.Kind, facilityID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var period models.SLAPeriod
+			if err := rows.Scan(&period.Start, &period.End, &period.Due, &period.Met, &period.Breached,
+				&period.Pending); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			rateSLAPeriod(&period, target.TargetPercent)
+			c.Periods = append(c.Periods, period)
+
+			c.Overall.Due += period.Due
+			c.Overall.Met += period.Met
+			c.Overall.Breached += period.Breached
+			c.Overall.Pending += period.Pending
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		c.Overall.Start, c.Overall.End = from, to
+		rateSLAPeriod(&c.Overall, target.TargetPercent)
+		compliance = append(compliance, c)
+	}
+
+	return compliance, nil
+}
+
+// GetFacilitySLACompliance reports a customer's SLA compliance at each of
+// its facilities.
+func (db *Database) GetFacilitySLACompliance(ctx context.Context, customerID uint, from, to time.Time, interval string) ([]models.FacilitySLACompliance, error) {
+	var compliance []models.FacilitySLACompliance
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, name FROM facilities WHERE customer_id = $1 ORDER BY name, id;`,
+		customerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c models.FacilitySLACompliance
+		if err := rows.Scan(&c.FacilityID, &c.FacilityName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		compliance = append(compliance, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range compliance {
+		compliance[i].Compliance, err = db.GetSLACompliance(ctx, customerID, &compliance[i].FacilityID, from, to, interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return compliance, nil
+}
+
+// rateSLAPeriod works out the share of decided due dates that were met.
+func rateSLAPeriod(period *models.SLAPeriod, targetPercent float64) {
+	decided := period.Met + period.Breached
+	if decided == 0 {
+		return
+	}
+
+	percent := math.Round(float64(period.Met)/float64(decided)*10000) / 100
+	meets := percent >= targetPercent
+	period.CompliancePercent, period.MeetsTarget = &percent, &meets
+}
+
+// GetSLABreaches lists the due dates serviced late or still outstanding past
+// their deadline, outstanding ones first.
+func (db *Database) GetSLABreaches(ctx context.Context, customerID, kind, facilityID string, from, to *time.Time, page, limit int) ([]models.SLABreach, int, error) {
+	var (
+		breaches []models.SLABreach
+		total    int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM (`+slaItems+`) i
+		`+slaBreachFilter+`;`,
+		nullIfEmpty(customerID), nullIfEmpty(kind), from, to, nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total sla breaches count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT i.kind, i.due_date, i.deadline, i.serviced_at,
+			COALESCE(i.serviced_at::date, CURRENT_DATE) - i.deadline, i.within_days, i.station_product_id,
+			i.product_name, i.station_id, i.station_name, i.customer_id, i.customer_name, i.facility_id,
+			i.facility_name
+		FROM (`+slaItems+`) i
+		`+slaBreachFilter+`
+		ORDER BY i.serviced_at IS NOT NULL, i.due_date, i.station_product_id
+		LIMIT $6 OFFSET $7;`,
+		nullIfEmpty(customerID), nullIfEmpty(kind), from, to, nullIfEmpty(facilityID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b models.SLABreach
+		if err := rows.Scan(&b.Kind, &b.DueDate, &b.Deadline, &b.ServicedAt, &b.DaysLate, &b.WithinDays,
+			&b.StationProductID, &b.ProductName, &b.StationID, &b.StationName, &b.CustomerID,
+			&b.CustomerName, &b.FacilityID, &b.FacilityName); err != nil {
+			return nil, 0, err
+		}
+		breaches = append(breaches, b)
+	}
+
+	return breaches, total, rows.Err()
+}
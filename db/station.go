@@ -2,15 +2,49 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
 )
 
+// checkStationPosition checks a station position lies on its floor plan.
+// Floor plans without dimensions take any position.
+func checkStationPosition(ctx context.Context, q queryer, floorPlanID *uint, x, y *float64) error {
+	if floorPlanID == nil || (x == nil && y == nil) {
+		return nil
+	}
+
+	var width, height *float64
+	err := q.QueryRow(ctx,
+		`SELECT width, height FROM floor_plans WHERE id = $1;`,
+		*floorPlanID,
+	).Scan(&width, &height)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFloorPlanNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if x != nil && width != nil && *x > *width {
+		return fmt.Errorf("%w: x %g is beyond the floor plan width %g", ErrPositionOutOfBounds, *x, *width)
+	}
+	if y != nil && height != nil && *y > *height {
+		return fmt.Errorf("%w: y %g is beyond the floor plan height %g", ErrPositionOutOfBounds, *y, *height)
+	}
+	return nil
+}
+
 func (db *Database) AddStation(ctx context.Context, station models.Station) (int, error) {
 
 	var id int
 
+	if err := checkStationPosition(ctx, db.Conn, station.FloorPlanID, station.LocationX, station.LocationY); err != nil {
+		return 0, err
+	}
+
 	err := db.Conn.QueryRow(ctx,
 		`INSERT INTO stations (
 		name,
@@ -18,10 +52,16 @@ func (db *Database) AddStation(ctx context.Context, station models.Station) (int
 		customer_id,
 		floor_plan_id,
 		created_at,
-		updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		updated_at,
+		location_x,
+		location_y,
+		rotation,
+		zone,
+		room)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id;`,
 		station.Name, station.Description, station.CustomerID, station.FloorPlanID, station.CreatedAt, station.UpdatedAt,
+		station.LocationX, station.LocationY, station.Rotation, nullIfEmpty(station.Zone), nullIfEmpty(station.Room),
 	).Scan(&id)
 	if err != nil {
 		return 0, err
@@ -34,11 +74,15 @@ func (db *Database) GetStation(ctx context.Context, id string) (models.Station,
 	var station models.Station
 
 	err := db.Conn.QueryRow(ctx,
-		`SELECT id, name, description, customer_id, floor_plan_id, created_at, updated_at
+		`SELECT id, name, description, customer_id, floor_plan_id, created_at, updated_at, location_x, location_y,
+			rotation, COALESCE(zone, ''), COALESCE(room, ''), code, template_id,
+			COALESCE(layout_point_id, '')
 		FROM stations
 		WHERE id = $1;`,
 		id,
-	).Scan(&station.ID, &station.Name, &station.Description, &station.CustomerID, &station.FloorPlanID, &station.CreatedAt, &station.UpdatedAt)
+	).Scan(&station.ID, &station.Name, &station.Description, &station.CustomerID, &station.FloorPlanID, &station.CreatedAt, &station.UpdatedAt,
+		&station.LocationX, &station.LocationY, &station.Rotation, &station.Zone, &station.Room, &station.Code, &station.TemplateID,
+		&station.LayoutPointID)
 	if err != nil {
 		return station, err
 	}
@@ -46,19 +90,88 @@ func (db *Database) GetStation(ctx context.Context, id string) (models.Station,
 	return station, nil
 }
 
+// UpdateStation changes a station. The position, rotation, zone and room
+// keep their value when left out.
 func (db *Database) UpdateStation(ctx context.Context, ID string, station models.Station) error {
 
-	_, err := db.Conn.Exec(ctx,
-		`UPDATE stations
-		SET name = $1, description = $2
-		WHERE id = $3;`,
-		station.Name, station.Description, ID,
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		floorPlanID *uint
+		x, y        *float64
 	)
+	err = tx.QueryRow(ctx,
+		`UPDATE stations
+		SET name = $1, description = $2,
+			location_x = COALESCE($4, location_x), location_y = COALESCE($5, location_y),
+			rotation = COALESCE($6, rotation), zone = COALESCE($7, zone), room = COALESCE($8, room)
+		WHERE id = $3
+		RETURNING floor_plan_id, location_x, location_y;`,
+		station.Name, station.Description, ID, station.LocationX, station.LocationY, station.Rotation,
+		nullIfEmpty(station.Zone), nullIfEmpty(station.Room),
+	).Scan(&floorPlanID, &x, &y)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrStationNotFound
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := checkStationPosition(ctx, tx, floorPlanID, x, y); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RepositionStations moves stations of a customer's floor plan in one go.
+// Every station has to be on the floor plan, and a position that does not
+// fit on it rejects the whole batch.
+func (db *Database) RepositionStations(ctx context.Context, customerID, floorPlanID uint, positions []models.StationPosition) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM floor_plans WHERE id = $1 AND customer_id = $2);`,
+		floorPlanID, customerID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrFloorPlanNotFound
+	}
+
+	for i, position := range positions {
+		tag, err := tx.Exec(ctx,
+			`UPDATE stations
+			SET location_x = $4, location_y = $5, rotation = COALESCE($6, rotation),
+				zone = COALESCE($7, zone), room = COALESCE($8, room), updated_at = NOW()
+			WHERE id = $1 AND floor_plan_id = $2 AND customer_id = $3;`,
+			position.StationID, floorPlanID, customerID, position.LocationX, position.LocationY, position.Rotation,
+			position.Zone, position.Room,
+		)
+		if err != nil {
+			return fmt.Errorf("positions[%d]: %w", i, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("positions[%d]: %w: %d is not on this floor plan", i, ErrStationNotFound, position.StationID)
+		}
+
+		if err := checkStationPosition(ctx, tx, &floorPlanID, position.LocationX, position.LocationY); err != nil {
+			return fmt.Errorf("positions[%d]: %w", i, err)
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (db *Database) DeleteStation(ctx context.Context, ID string) error {
@@ -69,7 +182,7 @@ func (db *Database) DeleteStation(ctx context.Context, ID string) error {
 		ID,
 	)
 	if err != nil {
-		return err
+		return keptEvidence(err)
 	}
 
 	return nil
@@ -95,7 +208,9 @@ func (db *Database) GetStations(ctx context.Context, page, limit int, floorPlanI
 
 	// Query to fetch stations with pagination
 	stationsQuery := `
-		SELECT id, name, description, customer_id, floor_plan_id, created_at, updated_at
+		SELECT id, name, description, customer_id, floor_plan_id, created_at, updated_at, location_x, location_y,
+			rotation, COALESCE(zone, ''), COALESCE(room, ''), code, template_id,
+			COALESCE(layout_point_id, '')
 		FROM stations
 		WHERE ($1::int IS NULL OR floor_plan_id = $1::int) 
 		  AND ($2::int IS NULL OR customer_id = $2::int)
@@ -111,7 +226,9 @@ func (db *Database) GetStations(ctx context.Context, page, limit int, floorPlanI
 	// Scan rows into the stations slice
 	for rows.Next() {
 		var station models.Station
-		if err := rows.Scan(&station.ID, &station.Name, &station.Description, &station.CustomerID, &station.FloorPlanID, &station.CreatedAt, &station.UpdatedAt); err != nil {
+		if err := rows.Scan(&station.ID, &station.Name, &station.Description, &station.CustomerID, &station.FloorPlanID, &station.CreatedAt, &station.UpdatedAt,
+			&station.LocationX, &station.LocationY, &station.Rotation, &station.Zone, &station.Room, &station.Code, &station.TemplateID,
+			&station.LayoutPointID); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan station row: %w", err)
 		}
 		stations = append(stations, station)
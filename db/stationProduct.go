@@ -2,15 +2,38 @@ package database
 
 import (
 	"context"
+	"errors"
 
 	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
 )
 
 func (db *Database) AddStationProduct(ctx context.Context, stationProduct models.StationProduct) (int, error) {
 
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	id, err := addStationProduct(ctx, tx, stationProduct)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// addStationProduct installs a device within a transaction: the device row,
+// the installation service record and the components issued from stock.
+func addStationProduct(ctx context.Context, tx pgx.Tx, stationProduct models.StationProduct) (int, error) {
 	var id int
 
-	err := db.Conn.QueryRow(ctx,
+	err := tx.QueryRow(ctx,
 		`INSERT INTO station_products (
 		station_id,
 		product_id,
@@ -24,8 +47,10 @@ func (db *Database) AddStationProduct(ctx context.Context, stationProduct models
 		created_at,
 		updated_at,
 		product_name,
-		customer_name)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11,$12,$13)
+		customer_name,
+		child_product_1_min_qty,
+		child_product_2_min_qty)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11,$12,$13, $14, $15)
 		RETURNING id;`,
 		stationProduct.StationID, stationProduct.ProductID,
 		stationProduct.InstalledDate, stationProduct.ExpiryDate,
@@ -36,14 +61,47 @@ func (db *Database) AddStationProduct(ctx context.Context, stationProduct models
 		stationProduct.UpdatedAt,
 		stationProduct.ProductName,
 		stationProduct.CustomerName,
+		stationProduct.ChildProduct1MinQty,
+		stationProduct.ChildProduct2MinQty,
 	).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 
+	// start the device's service history with its installation
+	_, err = insertServiceRecord(ctx, tx, models.ServiceRecord{
+		StationProductID: uint(id),
+		ServiceType:      "installation",
+		ServiceDate:      stationProduct.InstalledDate,
+		NextServiceDate:  &stationProduct.InspectionDate,
+		Status:           "completed",
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// issue the installed components from stock
+	if stationProduct.StockLocationID != nil {
+		deviceID := uint(id)
+		if err := issueStock(ctx, tx, *stationProduct.StockLocationID, stationProduct.ChildProduct1ID, derefInt(stationProduct.ChildProduct1Qty), deviceID, nil, "device installation"); err != nil {
+			return 0, err
+		}
+		if err := issueStock(ctx, tx, *stationProduct.StockLocationID, stationProduct.ChildProduct2ID, derefInt(stationProduct.ChildProduct2Qty), deviceID, nil, "device installation"); err != nil {
+			return 0, err
+		}
+	}
+
 	return id, nil
 }
 
+// Helper function to read an optional quantity
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
 func (db *Database) GetStationProductById(ctx context.Context, id string) (models.StationProduct, error) {
 	var stationProduct models.StationProduct
 
@@ -53,7 +111,10 @@ func (db *Database) GetStationProductById(ctx context.Context, id string) (model
 		child_product_1_qty,
 		child_product_2_id,
 		child_product_1_qty,
-		created_at, updated_at
+		child_product_1_min_qty,
+		child_product_2_min_qty,
+		created_at, updated_at,
+		needs_attention, COALESCE(attention_reason, '')
 		FROM station_products
 		WHERE id = $1;`,
 		id,
@@ -62,7 +123,10 @@ func (db *Database) GetStationProductById(ctx context.Context, id string) (model
 		&stationProduct.ChildProduct1Qty,
 		&stationProduct.ChildProduct2ID,
 		&stationProduct.ChildProduct2Qty,
-		&stationProduct.CreatedAt, &stationProduct.UpdatedAt)
+		&stationProduct.ChildProduct1MinQty,
+		&stationProduct.ChildProduct2MinQty,
+		&stationProduct.CreatedAt, &stationProduct.UpdatedAt,
+		&stationProduct.NeedsAttention, &stationProduct.AttentionReason)
 	if err != nil {
 		return stationProduct, err
 	}
@@ -70,21 +134,31 @@ func (db *Database) GetStationProductById(ctx context.Context, id string) (model
 	return stationProduct, nil
 }
 
+// UpdateStationProduct replaces a device. A date it changes drops the
+// deadline an approved deferral kept for it, so SLAs are measured against
+// the new date.
 func (db *Database) UpdateStationProduct(ctx context.Context, ID string, stationProduct models.StationProduct) error {
 
 	_, err := db.Conn.Exec(ctx,
 		`UPDATE station_products
-		SET station_id = $1, product_id = $2, installation_date = $3, expiry_date = $4, inspection_date = $5
+		SET station_id = $1, product_id = $2, installation_date = $3, expiry_date = $4, inspection_date = $5,
+		expiry_due_date = CASE WHEN expiry_date IS DISTINCT FROM $4 THEN NULL ELSE expiry_due_date END,
+		inspection_due_date = CASE WHEN inspection_date IS DISTINCT FROM $5 THEN NULL ELSE inspection_due_date END,
 		child_product_1_id = $6,
 		child_product_1_qty = $7,
 		child_product_2_id = $8,
-		child_product_1_qty = $9,
-		WHERE id = $10;`,
+		child_product_2_qty = $9,
+		child_product_1_min_qty = $10,
+		child_product_2_min_qty = $11,
+		updated_at = NOW()
+		WHERE id = $12;`,
 		stationProduct.StationID, stationProduct.ProductID, stationProduct.InstalledDate, stationProduct.ExpiryDate, stationProduct.InspectionDate,
-		stationProduct.ChildProduct1,
+		stationProduct.ChildProduct1ID,
 		stationProduct.ChildProduct1Qty,
 		stationProduct.ChildProduct2ID,
 		stationProduct.ChildProduct2Qty,
+		stationProduct.ChildProduct1MinQty,
+		stationProduct.ChildProduct2MinQty,
 		ID,
 	)
 	if err != nil {
@@ -102,7 +176,7 @@ func (db *Database) DeleteStationProduct(ctx context.Context, ID string) error {
 		ID,
 	)
 	if err != nil {
-		return err
+		return keptEvidence(err)
 	}
 
 	return nil
@@ -117,8 +191,11 @@ func (db *Database) GetStationProducts(ctx context.Context, page, limit int, cus
 		child_product_1_qty,
 		child_product_2_id,
 		child_product_1_qty,
+		child_product_1_min_qty,
+		child_product_2_min_qty,
 		created_at, updated_at,
-		product_name, customer_name
+		product_name, customer_name,
+		needs_attention, COALESCE(attention_reason, '')
 		FROM station_products
 		WHERE station_id = $1
 		ORDER BY id
@@ -139,8 +216,11 @@ func (db *Database) GetStationProducts(ctx context.Context, page, limit int, cus
 			&stationProduct.ChildProduct1Qty,
 			&stationProduct.ChildProduct2ID,
 			&stationProduct.ChildProduct2Qty,
+			&stationProduct.ChildProduct1MinQty,
+			&stationProduct.ChildProduct2MinQty,
 			&stationProduct.CreatedAt, &stationProduct.UpdatedAt,
-			&stationProduct.ProductName, &stationProduct.CustomerName); err != nil {
+			&stationProduct.ProductName, &stationProduct.CustomerName,
+			&stationProduct.NeedsAttention, &stationProduct.AttentionReason); err != nil {
 			return nil, 0, err
 		}
 		stationProducts = append(stationProducts, stationProduct)
@@ -149,3 +229,141 @@ func (db *Database) GetStationProducts(ctx context.Context, page, limit int, cus
 	return stationProducts, len(stationProducts), nil
 
 }
+
+// MoveStationProduct reassigns a device to another station and records the
+// move. The device row is updated in place so its id, and everything that
+// references it, is preserved.
+func (db *Database) MoveStationProduct(ctx context.Context, id uint, req models.MoveStationProductRequest) (models.StationProductMove, error) {
+	move := models.StationProductMove{
+		StationProductID: id,
+		ToStationID:      req.ToStationID,
+		MovedBy:          req.MovedBy,
+		Reason:           req.Reason,
+	}
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return move, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the device so concurrent moves are serialised
+	err = tx.QueryRow(ctx,
+		`SELECT sp.station_id, s.floor_plan_id, s.customer_id
+		FROM station_products sp
+		JOIN stations s ON s.id = sp.station_id
+		WHERE sp.id = $1
+		FOR UPDATE OF sp;`,
+		id,
+	).Scan(&move.FromStationID, &move.FromFloorPlanID, &move.FromCustomerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return move, ErrNotFound
+	}
+	if err != nil {
+		return move, err
+	}
+
+	if move.FromStationID == req.ToStationID {
+		return move, ErrSameStation
+	}
+
+	var customerName string
+	err = tx.QueryRow(ctx,
+		`SELECT s.floor_plan_id, s.customer_id, c.name
+		FROM stations s
+		JOIN customers c ON c.id = s.customer_id
+		WHERE s.id = $1;`,
+		req.ToStationID,
+	).Scan(&move.ToFloorPlanID, &move.ToCustomerID, &customerName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return move, ErrStationNotFound
+	}
+	if err != nil {
+		return move, err
+	}
+
+	if move.FromCustomerID != move.ToCustomerID {
+		if !req.AllowCrossCustomer {
+			return move, ErrCrossCustomerMove
+		}
+
+		var role string
+		err = tx.QueryRow(ctx,
+			`SELECT role FROM users WHERE id = $1 AND is_active;`,
+			req.MovedBy,
+		).Scan(&role)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return move, err
+		}
+		if role != string(models.AdminUser) {
+			return move, ErrCrossCustomerMove
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE station_products
+		SET station_id = $1, customer_id = $2, customer_name = $3, updated_at = NOW()
+		WHERE id = $4;`,
+		req.ToStationID, move.ToCustomerID, customerName, id,
+	)
+	if err != nil {
+		return move, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO station_product_moves (
+		station_product_id,
+		from_station_id,
+		to_station_id,
+		from_floor_plan_id,
+		to_floor_plan_id,
+		from_customer_id,
+		to_customer_id,
+		moved_by,
+		reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, moved_at;`,
+		id, move.FromStationID, move.ToStationID, move.FromFloorPlanID, move.ToFloorPlanID,
+		move.FromCustomerID, move.ToCustomerID, move.MovedBy, move.Reason,
+	).Scan(&move.ID, &move.MovedAt)
+	if err != nil {
+		return move, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return move, err
+	}
+
+	return move, nil
+}
+
+// GetStationProductMoves returns the move history of a device, newest first.
+func (db *Database) GetStationProductMoves(ctx context.Context, id uint) ([]models.StationProductMove, error) {
+	var moves []models.StationProductMove
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, station_product_id, COALESCE(from_station_id, 0), COALESCE(to_station_id, 0),
+		from_floor_plan_id, to_floor_plan_id, from_customer_id, to_customer_id,
+		COALESCE(moved_by, 0), reason, moved_at
+		FROM station_product_moves
+		WHERE station_product_id = $1
+		ORDER BY moved_at DESC, id DESC;`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var move models.StationProductMove
+		if err := rows.Scan(&move.ID, &move.StationProductID, &move.FromStationID, &move.ToStationID,
+			&move.FromFloorPlanID, &move.ToFloorPlanID, &move.FromCustomerID, &move.ToCustomerID,
+			&move.MovedBy, &move.Reason, &move.MovedAt); err != nil {
+			return nil, err
+		}
+		moves = append(moves, move)
+	}
+
+	return moves, rows.Err()
+}
@@ -0,0 +1,383 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const stationTemplateColumns = `id, name, station_type, COALESCE(description, ''), customer_id, created_at, updated_at`
+
+func scanStationTemplate(row pgx.Row) (models.StationTemplate, error) {
+	var t models.StationTemplate
+
+	err := row.Scan(&t.ID, &t.Name, &t.StationType, &t.Description, &t.CustomerID, &t.CreatedAt, &t.UpdatedAt)
+
+	return t, err
+}
+
+// checkStationTemplate checks the customer and the products a template
+// refers to exist.
+func checkStationTemplate(ctx context.Context, q queryer, t models.StationTemplate) error {
+	if t.CustomerID != nil {
+		var exists bool
+		err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1);`, *t.CustomerID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCustomerNotFound
+		}
+	}
+
+	var productIDs []uint
+	for _, device := range t.Devices {
+		productIDs = append(productIDs, device.ProductID)
+		if device.ChildProduct1ID != nil {
+			productIDs = append(productIDs, *device.ChildProduct1ID)
+		}
+		if device.ChildProduct2ID != nil {
+			productIDs = append(productIDs, *device.ChildProduct2ID)
+		}
+	}
+
+	var found int
+	err := q.QueryRow(ctx,
+		`SELECT COUNT(*) FROM products WHERE id = ANY($1::int[]);`,
+		productIDs,
+	).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(uniqueIDs(productIDs)) {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+func (db *Database) AddStationTemplate(ctx context.Context, t models.StationTemplate) (uint, error) {
+	var id uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkStationTemplate(ctx, tx, t); err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO station_templates (name, station_type, description, customer_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id;`,
+		t.Name, t.StationType, t.Description, t.CustomerID,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertStationTemplateDevices(ctx, tx, id, t.Devices); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func insertStationTemplateDevices(ctx context.Context, tx pgx.Tx, templateID uint, devices []models.StationTemplateDevice) error {
+	for i, device := range devices {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO station_template_devices (
+			template_id,
+			position,
+			product_id,
+			quantity,
+			child_product_1_id,
+			child_product_1_qty,
+			child_product_1_min_qty,
+			child_product_2_id,
+			child_product_2_qty,
+			child_product_2_min_qty)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`,
+			templateID, i+1, device.ProductID, device.Quantity, device.ChildProduct1ID, device.ChildProduct1Qty,
+			device.ChildProduct1MinQty, device.ChildProduct2ID, device.ChildProduct2Qty, device.ChildProduct2MinQty,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetStationTemplate returns a template with its devices.
+func (db *Database) GetStationTemplate(ctx context.Context, id uint) (models.StationTemplate, error) {
+	t, err := scanStationTemplate(db.Conn.QueryRow(ctx,
+		`SELECT `+stationTemplateColumns+`
+		FROM station_templates
+		WHERE id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrStationTemplateNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+
+	devices, err := getStationTemplateDevices(ctx, db.Conn, id)
+	if err != nil {
+		return t, err
+	}
+	for _, device := range devices {
+		t.Devices = append(t.Devices, device.StationTemplateDevice)
+	}
+
+	return t, nil
+}
+
+// templateDevice is a template device with the service interval and
+// lifetime of its product, from which installed devices get their dates.
+type templateDevice struct {
+	models.StationTemplateDevice
+	serviceIntervalDays *int
+	lifetimeMonths      *int
+}
+
+func getStationTemplateDevices(ctx context.Context, q rowsQueryer, templateID uint) ([]templateDevice, error) {
+	var devices []templateDevice
+
+	rows, err := q.Query(ctx,
+		`SELECT d.id, d.template_id, d.product_id, p.name, d.quantity, d.child_product_1_id,
+			d.child_product_1_qty, d.child_product_1_min_qty, d.child_product_2_id, d.child_product_2_qty,
+			d.child_product_2_min_qty, p.service_interval_days, p.lifetime_months
+		FROM station_template_devices d
+		JOIN products p ON p.id = d.product_id
+		WHERE d.template_id = $1
+		ORDER BY d.position, d.id;`,
+		templateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d templateDevice
+		if err := rows.Scan(&d.ID, &d.TemplateID, &d.ProductID, &d.ProductName, &d.Quantity, &d.ChildProduct1ID,
+			&d.ChildProduct1Qty, &d.ChildProduct1MinQty, &d.ChildProduct2ID, &d.ChildProduct2Qty,
+			&d.ChildProduct2MinQty, &d.serviceIntervalDays, &d.lifetimeMonths); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
+
+// GetStationTemplates lists templates without their devices, optionally
+// only those offered to a customer, which includes the shared ones, or of a
+// station type.
+func (db *Database) GetStationTemplates(ctx context.Context, customerID, stationType string) ([]models.StationTemplate, error) {
+	var templates []models.StationTemplate
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+stationTemplateColumns+`
+		FROM station_templates
+		WHERE ($1::int IS NULL OR customer_id IS NULL OR customer_id = $1::int)
+		  AND ($2::text IS NULL OR station_type = $2::text)
+		ORDER BY station_type, name, id;`,
+		nullIfEmpty(customerID), nullIfEmpty(stationType),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanStationTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// UpdateStationTemplate replaces a template and its devices. Stations
+// already provisioned from it keep the devices they were given.
+func (db *Database) UpdateStationTemplate(ctx context.Context, id uint, t models.StationTemplate) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkStationTemplate(ctx, tx, t); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE station_templates
+		SET name = $2, station_type = $3, description = $4, customer_id = $5, updated_at = NOW()
+		WHERE id = $1;`,
+		id, t.Name, t.StationType, t.Description, t.CustomerID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStationTemplateNotFound
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM station_template_devices WHERE template_id = $1;`, id); err != nil {
+		return err
+	}
+	if err := insertStationTemplateDevices(ctx, tx, id, t.Devices); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteStationTemplate removes a template. Stations provisioned from it
+// are kept.
+func (db *Database) DeleteStationTemplate(ctx context.Context, id uint) error {
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM station_templates
+		WHERE id = $1;`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStationTemplateNotFound
+	}
+
+	return nil
+}
+
+// ProvisionStation creates a station on a customer's floor plan from a
+// template and installs the template's devices, all or nothing.
+func (db *Database) ProvisionStation(ctx context.Context, customerID, floorPlanID uint, req models.ProvisionStation) (models.ProvisionedStation, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return models.ProvisionedStation{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM floor_plans WHERE id = $1 AND customer_id = $2);`,
+		floorPlanID, customerID,
+	).Scan(&exists)
+	if err != nil {
+		return models.ProvisionedStation{}, err
+	}
+	if !exists {
+		return models.ProvisionedStation{}, ErrFloorPlanNotFound
+	}
+
+	station, err := provisionStation(ctx, tx, customerID, floorPlanID, req)
+	if err != nil {
+		return station, err
+	}
+
+	return station, tx.Commit(ctx)
+}
+
+// provisionStation creates a station from a template on a floor plan known
+// to be the customer's, within a transaction. Each device's inspection and
+// expiry dates follow from the installation date by its product's service
+// interval and lifetime, as when a work order services it.
+func provisionStation(ctx context.Context, tx pgx.Tx, customerID, floorPlanID uint, req models.ProvisionStation) (models.ProvisionedStation, error) {
+	var (
+		station      models.ProvisionedStation
+		description  *string
+		customerName string
+	)
+
+	err := tx.QueryRow(ctx,
+		`SELECT t.description, c.name
+		FROM station_templates t, customers c
+		WHERE t.id = $1 AND c.id = $2 AND (t.customer_id IS NULL OR t.customer_id = c.id);`,
+		req.TemplateID, customerID,
+	).Scan(&description, &customerName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return station, ErrStationTemplateNotFound
+	}
+	if err != nil {
+		return station, err
+	}
+	if req.Description == "" && description != nil {
+		req.Description = *description
+	}
+
+	if err := checkStationPosition(ctx, tx, &floorPlanID, req.LocationX, req.LocationY); err != nil {
+		return station, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO stations (name, description, customer_id, floor_plan_id, location_x, location_y, rotation,
+			zone, room, template_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, code;`,
+		req.Name, req.Description, customerID, floorPlanID, req.LocationX, req.LocationY, req.Rotation,
+		nullIfEmpty(req.Zone), nullIfEmpty(req.Room), req.TemplateID,
+	).Scan(&station.StationID, &station.Code)
+	if err != nil {
+		return station, err
+	}
+
+	devices, err := getStationTemplateDevices(ctx, tx, req.TemplateID)
+	if err != nil {
+		return station, err
+	}
+
+	for _, device := range devices {
+		dates := workOrderDevice{
+			serviceIntervalDays: device.serviceIntervalDays,
+			lifetimeMonths:      device.lifetimeMonths,
+		}
+		child1Qty, child2Qty := device.ChildProduct1Qty, device.ChildProduct2Qty
+		now := time.Now()
+
+		for i := 0; i < device.Quantity; i++ {
+			id, err := addStationProduct(ctx, tx, models.StationProduct{
+				StationID:           station.StationID,
+				ProductID:           device.ProductID,
+				InstalledDate:       req.InstalledDate,
+				ExpiryDate:          dates.nextExpiry(req.InstalledDate),
+				InspectionDate:      dates.nextInspection(req.InstalledDate),
+				ChildProduct1ID:     device.ChildProduct1ID,
+				ChildProduct1Qty:    &child1Qty,
+				ChildProduct2ID:     device.ChildProduct2ID,
+				ChildProduct2Qty:    &child2Qty,
+				ChildProduct1MinQty: device.ChildProduct1MinQty,
+				ChildProduct2MinQty: device.ChildProduct2MinQty,
+				ProductName:         device.ProductName,
+				CustomerName:        customerName,
+				StockLocationID:     req.StockLocationID,
+				CreatedAt:           now,
+				UpdatedAt:           now,
+			})
+			if err != nil {
+				return station, err
+			}
+			station.DeviceIDs = append(station.DeviceIDs, uint(id))
+		}
+	}
+
+	return station, nil
+}
@@ -0,0 +1,392 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Database) AddStockLocation(ctx context.Context, location models.StockLocation) (int, error) {
+
+	var id int
+
+	err := db.Conn.QueryRow(ctx,
+		`INSERT INTO stock_locations (
+		name,
+		location_type,
+		user_id)
+		VALUES ($1, $2, $3)
+		RETURNING id;`,
+		location.Name, location.Type, location.UserID,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (db *Database) GetStockLocations(ctx context.Context) ([]models.StockLocation, error) {
+	var locations []models.StockLocation
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, name, location_type, user_id, created_at, updated_at
+		FROM stock_locations
+		ORDER BY id;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var location models.StockLocation
+		if err := rows.Scan(&location.ID, &location.Name, &location.Type, &location.UserID, &location.CreatedAt, &location.UpdatedAt); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+// RecordStockMovement posts a receipt, issue, transfer or adjustment to the
+// ledger and updates the stock levels it touches. Transfers produce two
+// ledger entries, one per location.
+func (db *Database) RecordStockMovement(ctx context.Context, req models.StockMovementRequest) ([]models.StockMovement, error) {
+	var movements []models.StockMovement
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	base := models.StockMovement{
+		ProductID:        req.ProductID,
+		LocationID:       req.LocationID,
+		StationProductID: req.StationProductID,
+		Note:             req.Note,
+		CreatedBy:        req.CreatedBy,
+	}
+
+	switch models.StockMovementType(req.Type) {
+	case models.StockReceipt, models.StockAdjustment:
+		base.MovementType = req.Type
+		base.Quantity = req.Quantity
+		movements = append(movements, base)
+	case models.StockIssue:
+		base.MovementType = req.Type
+		base.Quantity = -req.Quantity
+		movements = append(movements, base)
+	case models.StockTransfer:
+		out := base
+		out.MovementType = string(models.StockTransferOut)
+		out.Quantity = -req.Quantity
+		out.CounterpartLocationID = req.ToLocationID
+
+		in := base
+		in.MovementType = string(models.StockTransferIn)
+		in.Quantity = req.Quantity
+		in.LocationID = *req.ToLocationID
+		in.CounterpartLocationID = &req.LocationID
+
+		// touch the levels in location order so opposing transfers cannot deadlock
+		if in.LocationID < out.LocationID {
+			movements = append(movements, in, out)
+		} else {
+			movements = append(movements, out, in)
+		}
+	default:
+		return nil, fmt.Errorf("unknown stock movement type %q", req.Type)
+	}
+
+	for i := range movements {
+		if movements[i], err = applyStockMovement(ctx, tx, movements[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+// applyStockMovement updates the stock level for the movement and appends it
+// to the ledger. It refuses to take a level below zero.
+func applyStockMovement(ctx context.Context, tx pgx.Tx, movement models.StockMovement) (models.StockMovement, error) {
+	var balance int
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO stock_levels (product_id, location_id, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, location_id)
+		DO UPDATE SET quantity = stock_levels.quantity + EXCLUDED.quantity, updated_at = NOW()
+		RETURNING quantity;`,
+		movement.ProductID, movement.LocationID, movement.Quantity,
+	).Scan(&balance)
+	if err != nil {
+		return movement, err
+	}
+
+	if balance < 0 {
+		return movement, fmt.Errorf("%w: product %d at location %d is short by %d",
+			ErrInsufficientStock, movement.ProductID, movement.LocationID, -balance)
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO stock_movements (
+		product_id,
+		location_id,
+		quantity,
+		movement_type,
+		counterpart_location_id,
+		station_product_id,
+		note,
+		created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at;`,
+		movement.ProductID, movement.LocationID, movement.Quantity, movement.MovementType,
+		movement.CounterpartLocationID, movement.StationProductID, movement.Note, movement.CreatedBy,
+	).Scan(&movement.ID, &movement.CreatedAt)
+	if err != nil {
+		return movement, err
+	}
+
+	return movement, nil
+}
+
+// issueStock takes quantity of a product out of a location on behalf of a
+// device. It is a no-op when there is nothing to issue.
+func issueStock(ctx context.Context, tx pgx.Tx, locationID uint, productID *uint, quantity int, stationProductID uint, createdBy *uint, note string) error {
+	if productID == nil || quantity <= 0 {
+		return nil
+	}
+
+	_, err := applyStockMovement(ctx, tx, models.StockMovement{
+		ProductID:        *productID,
+		LocationID:       locationID,
+		Quantity:         -quantity,
+		MovementType:     string(models.StockIssue),
+		StationProductID: &stationProductID,
+		Note:             note,
+		CreatedBy:        createdBy,
+	})
+
+	return err
+}
+
+func (db *Database) SetStockThreshold(ctx context.Context, locationID, productID uint, threshold models.StockThreshold) error {
+
+	_, err := db.Conn.Exec(ctx,
+		`INSERT INTO stock_levels (product_id, location_id, reorder_threshold, reorder_quantity)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (product_id, location_id)
+		DO UPDATE SET reorder_threshold = EXCLUDED.reorder_threshold,
+			reorder_quantity = EXCLUDED.reorder_quantity,
+			updated_at = NOW();`,
+		productID, locationID, threshold.ReorderThreshold, threshold.ReorderQuantity,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *Database) GetStockLevels(ctx context.Context, locationID, productID string, page, limit int) ([]models.StockLevel, int, error) {
+	var (
+		levels []models.StockLevel
+		total  int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM stock_levels
+		WHERE ($1::int IS NULL OR location_id = $1::int)
+		  AND ($2::int IS NULL OR product_id = $2::int);`,
+		nullIfEmpty(locationID), nullIfEmpty(productID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total stock levels count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT sl.product_id, p.name, sl.location_id, l.name, sl.quantity,
+		sl.reorder_threshold, sl.reorder_quantity, sl.updated_at
+		FROM stock_levels sl
+		JOIN products p ON p.id = sl.product_id
+		JOIN stock_locations l ON l.id = sl.location_id
+		WHERE ($1::int IS NULL OR sl.location_id = $1::int)
+		  AND ($2::int IS NULL OR sl.product_id = $2::int)
+		ORDER BY l.name, p.name
+		LIMIT $3 OFFSET $4;`,
+		nullIfEmpty(locationID), nullIfEmpty(productID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var level models.StockLevel
+		if err := rows.Scan(&level.ProductID, &level.ProductName, &level.LocationID, &level.LocationName,
+			&level.Quantity, &level.ReorderThreshold, &level.ReorderQuantity, &level.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, total, rows.Err()
+}
+
+func (db *Database) GetStockMovements(ctx context.Context, locationID, productID string, page, limit int) ([]models.StockMovement, int, error) {
+	var (
+		movements []models.StockMovement
+		total     int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM stock_movements
+		WHERE ($1::int IS NULL OR location_id = $1::int)
+		  AND ($2::int IS NULL OR product_id = $2::int);`,
+		nullIfEmpty(locationID), nullIfEmpty(productID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total stock movements count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, product_id, location_id, quantity, movement_type, counterpart_location_id,
+		station_product_id, COALESCE(note, ''), created_by, created_at
+		FROM stock_movements
+		WHERE ($1::int IS NULL OR location_id = $1::int)
+		  AND ($2::int IS NULL OR product_id = $2::int)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4;`,
+		nullIfEmpty(locationID), nullIfEmpty(productID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movement models.StockMovement
+		if err := rows.Scan(&movement.ID, &movement.ProductID, &movement.LocationID, &movement.Quantity,
+			&movement.MovementType, &movement.CounterpartLocationID, &movement.StationProductID,
+			&movement.Note, &movement.CreatedBy, &movement.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		movements = append(movements, movement)
+	}
+
+	return movements, total, rows.Err()
+}
+
+// GetLowStock lists stock levels that have a reorder threshold and have
+// fallen to or below it.
+func (db *Database) GetLowStock(ctx context.Context, locationID string) ([]models.LowStockItem, error) {
+	var items []models.LowStockItem
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT sl.product_id, p.name, sl.location_id, l.name, sl.quantity,
+		sl.reorder_threshold, sl.reorder_quantity, sl.updated_at
+		FROM stock_levels sl
+		JOIN products p ON p.id = sl.product_id
+		JOIN stock_locations l ON l.id = sl.location_id
+		WHERE sl.reorder_threshold > 0
+		  AND sl.quantity <= sl.reorder_threshold
+		  AND ($1::int IS NULL OR sl.location_id = $1::int)
+		ORDER BY (sl.reorder_threshold - sl.quantity) DESC, p.name;`,
+		nullIfEmpty(locationID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.LowStockItem
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.LocationID, &item.LocationName,
+			&item.Quantity, &item.ReorderThreshold, &item.ReorderQuantity, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		item.Shortfall = item.ReorderThreshold - item.Quantity
+		item.SuggestedQuantity = item.ReorderQuantity
+		if item.SuggestedQuantity < item.Shortfall {
+			item.SuggestedQuantity = item.Shortfall
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// RefillStationProduct adds component quantities to a device, issuing them
+// from stock when a location is given.
+func (db *Database) RefillStationProduct(ctx context.Context, id uint, req models.RefillRequest) (models.StationProduct, error) {
+	var stationProduct models.StationProduct
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return stationProduct, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`UPDATE station_products
+		SET child_product_1_qty = child_product_1_qty + $1,
+			child_product_2_qty = child_product_2_qty + $2,
+			updated_at = NOW()
+		WHERE id = $3
+		RETURNING id, station_id, product_id, installation_date, expiry_date, inspection_date,
+		child_product_1_id, child_product_1_qty, child_product_2_id, child_product_2_qty,
+		created_at, updated_at;`,
+		req.ChildProduct1Qty, req.ChildProduct2Qty, id,
+	).Scan(&stationProduct.ID, &stationProduct.StationID, &stationProduct.ProductID,
+		&stationProduct.InstalledDate, &stationProduct.ExpiryDate, &stationProduct.InspectionDate,
+		&stationProduct.ChildProduct1ID, &stationProduct.ChildProduct1Qty,
+		&stationProduct.ChildProduct2ID, &stationProduct.ChildProduct2Qty,
+		&stationProduct.CreatedAt, &stationProduct.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return stationProduct, ErrNotFound
+	}
+	if err != nil {
+		return stationProduct, err
+	}
+
+	if req.StockLocationID != nil {
+		note := req.Note
+		if note == "" {
+			note = "device refill"
+		}
+		if err := issueStock(ctx, tx, *req.StockLocationID, stationProduct.ChildProduct1ID, req.ChildProduct1Qty, id, req.PerformedBy, note); err != nil {
+			return stationProduct, err
+		}
+		if err := issueStock(ctx, tx, *req.StockLocationID, stationProduct.ChildProduct2ID, req.ChildProduct2Qty, id, req.PerformedBy, note); err != nil {
+			return stationProduct, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return stationProduct, err
+	}
+
+	return stationProduct, nil
+}
+
+// nullIfEmpty turns an empty optional filter into a SQL NULL.
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
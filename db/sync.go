@@ -0,0 +1,866 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/go-playground/validator"
+	"github.com/jackc/pgx/v5"
+)
+
+// SyncRetention is how long sync changes and pushed mutation ids are kept.
+// Tokens older than that can no longer be resumed.
+const SyncRetention = 90 * 24 * time.Hour
+
+// syncCursor is what a change token holds. Since is the snapshot xmin of the
+// previous sync: every change made by a transaction from Since on may not
+// have been seen yet. While a delta is paged, Until is the xmin the final
+// page hands out and After is the last entity already sent.
+type syncCursor struct {
+	Since       int64  `json:"s"`
+	Until       int64  `json:"u,omitempty"`
+	AfterEntity string `json:"ae,omitempty"`
+	AfterID     uint   `json:"ai,omitempty"`
+	IssuedAt    int64  `json:"t"`
+}
+
+func encodeSyncToken(c syncCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSyncToken(token string) (syncCursor, error) {
+	var c syncCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidSyncToken
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.IssuedAt == 0 {
+		return c, ErrInvalidSyncToken
+	}
+
+	return c, nil
+}
+
+const syncFloorPlanQuery = `SELECT id, name, COALESCE(layout, ''), customer_id, created_at, updated_at, version,
+		width, height
+		FROM floor_plans
+		WHERE customer_id = $1 AND ($2::int[] IS NULL OR id = ANY($2::int[]))
+		ORDER BY id;`
+
+const syncStationQuery = `SELECT id, name, COALESCE(description, ''), customer_id, floor_plan_id, created_at, updated_at,
+		location_x, location_y, version, rotation, COALESCE(zone, ''), COALESCE(room, ''), code
+		FROM stations
+		WHERE customer_id = $1 AND ($2::int[] IS NULL OR id = ANY($2::int[]))
+		ORDER BY id;`
+
+const syncDeviceQuery = `SELECT sp.id, sp.station_id, sp.product_id, p.name, sp.installation_date, sp.expiry_date,
+		sp.inspection_date, sp.child_product_1_id, sp.child_product_1_qty, sp.child_product_2_id,
+		sp.child_product_2_qty, sp.child_product_1_min_qty, sp.child_product_2_min_qty,
+		sp.needs_attention, COALESCE(sp.attention_reason, ''), sp.created_at, sp.updated_at, sp.version
+		FROM station_products sp
+		JOIN stations s ON s.id = sp.station_id
+		JOIN products p ON p.id = sp.product_id
+		WHERE s.customer_id = $1 AND ($2::int[] IS NULL OR sp.id = ANY($2::int[]))
+		ORDER BY sp.id;`
+
+const syncWorkOrderQuery = `SELECT ` + workOrderColumns + `, wo.version,
+		ARRAY(SELECT station_product_id FROM work_order_devices WHERE work_order_id = wo.id ORDER BY station_product_id)
+		` + workOrderJoins + `
+		WHERE wo.customer_id = $1 AND wo.status NOT IN ('done', 'cancelled')
+		  AND ($2::int[] IS NULL OR wo.id = ANY($2::int[]))
+		ORDER BY wo.id;`
+
+// syncEntities holds the entities of a pull. Without ids every entity of the
+// customer is loaded.
+func loadSyncEntities(ctx context.Context, q rowsQueryer, customerID uint, ids map[string][]uint, all bool, pull *models.SyncPull) error {
+	load := func(entity string) ([]uint, bool) {
+		if all {
+			return nil, true
+		}
+		return ids[entity], len(ids[entity]) > 0
+	}
+
+	if entityIDs, ok := load(models.SyncFloorPlan); ok {
+		rows, err := q.Query(ctx, syncFloorPlanQuery, customerID, entityIDs)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var fp models.FloorPlan
+			if err := rows.Scan(&fp.ID, &fp.Name, &fp.Layout, &fp.CustomerID, &fp.CreatedAt, &fp.UpdatedAt,
+				&fp.Version, &fp.Width, &fp.Height); err != nil {
+				rows.Close()
+				return err
+			}
+			pull.FloorPlans = append(pull.FloorPlans, fp)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if entityIDs, ok := load(models.SyncStation); ok {
+		rows, err := q.Query(ctx, syncStationQuery, customerID, entityIDs)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var st models.Station
+			if err := rows.Scan(&st.ID, &st.Name, &st.Description, &st.CustomerID, &st.FloorPlanID, &st.CreatedAt,
+				&st.UpdatedAt, &st.LocationX, &st.LocationY, &st.Version, &st.Rotation, &st.Zone, &st.Room, &st.Code); err != nil {
+				rows.Close()
+				return err
+			}
+			pull.Stations = append(pull.Stations, st)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if entityIDs, ok := load(models.SyncDevice); ok {
+		rows, err := q.Query(ctx, syncDeviceQuery, customerID, entityIDs)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var sp models.StationProduct
+			if err := rows.Scan(&sp.ID, &sp.StationID, &sp.ProductID, &sp.ProductName, &sp.InstalledDate,
+				&sp.ExpiryDate, &sp.InspectionDate, &sp.ChildProduct1ID, &sp.ChildProduct1Qty, &sp.ChildProduct2ID,
+				&sp.ChildProduct2Qty, &sp.ChildProduct1MinQty, &sp.ChildProduct2MinQty, &sp.NeedsAttention,
+				&sp.AttentionReason, &sp.CreatedAt, &sp.UpdatedAt, &sp.Version); err != nil {
+				rows.Close()
+				return err
+			}
+			pull.Devices = append(pull.Devices, sp)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if entityIDs, ok := load(models.SyncWorkOrder); ok {
+		rows, err := q.Query(ctx, syncWorkOrderQuery, customerID, entityIDs)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var wo models.WorkOrder
+			if err := rows.Scan(&wo.ID, &wo.CustomerID, &wo.CustomerName, &wo.StationID, &wo.StationName, &wo.Type,
+				&wo.Title, &wo.Description, &wo.Priority, &wo.Status, &wo.AssignedTo, &wo.DueDate, &wo.CreatedBy,
+				&wo.StartedAt, &wo.CompletedAt, &wo.CompletedBy, &wo.CancelledAt, &wo.Notes, &wo.CreatedAt,
+				&wo.UpdatedAt, &wo.FacilityID, &wo.FacilityName, &wo.Version, &wo.DeviceIDs); err != nil {
+				rows.Close()
+				return err
+			}
+			pull.WorkOrders = append(pull.WorkOrders, wo)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PullChanges returns a customer's data for the technician app: a full
+// snapshot without a token, otherwise what changed since the token was
+// issued, at most limit entities at a time. Entities are read from a single
+// snapshot, and the token handed out resumes from that snapshot so changes
+// committed while the pull ran are picked up next time; the same entity may
+// be sent twice, never missed.
+func (db *Database) PullChanges(ctx context.Context, customerID uint, token string, limit int) (models.SyncPull, error) {
+	var (
+		pull   models.SyncPull
+		cursor syncCursor
+		err    error
+	)
+
+	if token != "" {
+		cursor, err = decodeSyncToken(token)
+		if err != nil {
+			return pull, err
+		}
+		// leave a day for transactions that were running when it was issued
+		if time.Since(time.Unix(cursor.IssuedAt, 0)) > SyncRetention-24*time.Hour {
+			return pull, ErrSyncTokenExpired
+		}
+	}
+
+	tx, err := db.Conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return pull, err
+	}
+	defer tx.Rollback(ctx)
+
+	var xmin int64
+	err = tx.QueryRow(ctx, `SELECT txid_snapshot_xmin(txid_current_snapshot()), NOW();`).Scan(&xmin, &pull.ServerTime)
+	if err != nil {
+		return pull, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1);`, customerID).Scan(&exists)
+	if err != nil {
+		return pull, err
+	}
+	if !exists {
+		return pull, ErrCustomerNotFound
+	}
+
+	if token == "" {
+		pull.Full = true
+		if err := loadSyncEntities(ctx, tx, customerID, nil, true, &pull); err != nil {
+			return pull, err
+		}
+		pull.Token = encodeSyncToken(syncCursor{Since: xmin, IssuedAt: time.Now().Unix()})
+		return pull, nil
+	}
+
+	until := cursor.Until
+	if until == 0 {
+		until = xmin
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT DISTINCT entity, entity_id
+		FROM sync_changes
+		WHERE customer_id = $1 AND txid >= $2
+		  AND (entity, entity_id) > ($3::text, $4::int)
+		ORDER BY entity, entity_id
+		LIMIT $5;`,
+		customerID, cursor.Since, cursor.AfterEntity, cursor.AfterID, limit,
+	)
+	if err != nil {
+		return pull, err
+	}
+
+	var (
+		changed  = map[string][]uint{}
+		count    int
+		lastKind string
+		lastID   uint
+	)
+	for rows.Next() {
+		if err := rows.Scan(&lastKind, &lastID); err != nil {
+			rows.Close()
+			return pull, err
+		}
+		changed[lastKind] = append(changed[lastKind], lastID)
+		count++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return pull, err
+	}
+
+	if err := loadSyncEntities(ctx, tx, customerID, changed, false, &pull); err != nil {
+		return pull, err
+	}
+	pull.Tombstones = syncTombstones(changed, &pull)
+
+	if count == limit {
+		pull.HasMore = true
+		pull.Token = encodeSyncToken(syncCursor{
+			Since:       cursor.Since,
+			Until:       until,
+			AfterEntity: lastKind,
+			AfterID:     lastID,
+			IssuedAt:    cursor.IssuedAt,
+		})
+	} else {
+		pull.Token = encodeSyncToken(syncCursor{Since: until, IssuedAt: time.Now().Unix()})
+	}
+
+	return pull, nil
+}
+
+// syncTombstones lists the changed entities that were not found for the
+// customer: deleted, moved to another customer, or work orders that closed.
+func syncTombstones(changed map[string][]uint, pull *models.SyncPull) []models.SyncTombstone {
+	found := map[string]map[uint]bool{
+		models.SyncFloorPlan: {},
+		models.SyncStation:   {},
+		models.SyncDevice:    {},
+		models.SyncWorkOrder: {},
+	}
+	for _, fp := range pull.FloorPlans {
+		found[models.SyncFloorPlan][fp.ID] = true
+	}
+	for _, st := range pull.Stations {
+		found[models.SyncStation][st.ID] = true
+	}
+	for _, sp := range pull.Devices {
+		found[models.SyncDevice][sp.ID] = true
+	}
+	for _, wo := range pull.WorkOrders {
+		found[models.SyncWorkOrder][wo.ID] = true
+	}
+
+	var tombstones []models.SyncTombstone
+	for _, entity := range []string{models.SyncFloorPlan, models.SyncStation, models.SyncDevice, models.SyncWorkOrder} {
+		for _, id := range changed[entity] {
+			if !found[entity][id] {
+				tombstones = append(tombstones, models.SyncTombstone{Entity: entity, ID: id})
+			}
+		}
+	}
+
+	return tombstones
+}
+
+// errSyncConflict and errSyncGone stop a mutation that lost against the
+// server; they become its resolution rather than an error.
+var (
+	errSyncConflict = errors.New("sync conflict")
+	errSyncGone     = errors.New("entity no longer exists")
+)
+
+// PushChanges applies a batch of offline mutations for a customer, each in
+// its own transaction and in order, and returns a resolution per mutation.
+// Only failures of the database itself are returned as an error; mutations
+// committed before it stay applied and are recognised when pushed again.
+func (db *Database) PushChanges(ctx context.Context, customerID uint, push models.SyncPush) (models.SyncPushResult, error) {
+	var result models.SyncPushResult
+
+	var exists bool
+	err := db.Conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1);`, customerID).Scan(&exists)
+	if err != nil {
+		return result, err
+	}
+	if !exists {
+		return result, ErrCustomerNotFound
+	}
+
+	if err := checkActiveUser(ctx, db.Conn, push.UserID); err != nil {
+		return result, err
+	}
+
+	for _, mutation := range push.Mutations {
+		res, err := db.applyMutation(ctx, customerID, push.UserID, mutation)
+		if err != nil {
+			return result, fmt.Errorf("mutation %s: %w", mutation.ClientID, err)
+		}
+		result.Results = append(result.Results, res)
+	}
+
+	return result, nil
+}
+
+func (db *Database) applyMutation(ctx context.Context, customerID, userID uint, m models.SyncMutation) (models.SyncMutationResult, error) {
+	result := models.SyncMutationResult{ClientID: m.ClientID, Entity: m.Entity}
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`SELECT entity_id, version
+		FROM sync_mutations
+		WHERE customer_id = $1 AND client_id = $2;`,
+		customerID, m.ClientID,
+	).Scan(&result.ID, &result.Version)
+	if err == nil {
+		result.Resolution = models.SyncApplied
+		result.Replayed = true
+		return result, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return result, err
+	}
+
+	var (
+		id      uint
+		version int
+	)
+	switch {
+	case m.Entity == models.SyncStation && m.Op == "create":
+		id, version, err = syncCreateStation(ctx, tx, customerID, m)
+	case m.Entity == models.SyncStation && m.Op == "update":
+		id, version, err = syncUpdateStation(ctx, tx, customerID, m)
+	case m.Entity == models.SyncDevice && m.Op == "create":
+		id, version, err = syncCreateDevice(ctx, tx, customerID, m)
+	case m.Entity == models.SyncDevice && m.Op == "update":
+		id, version, err = syncUpdateDevice(ctx, tx, customerID, m)
+	case (m.Entity == models.SyncStation || m.Entity == models.SyncDevice) && m.Op == "delete":
+		id, err = syncDelete(ctx, tx, customerID, m)
+	case m.Entity == models.SyncWorkOrder && m.Op == "update":
+		id, version, err = syncUpdateWorkOrder(ctx, tx, customerID, m)
+	case m.Entity == models.SyncWorkOrder && m.Op == "complete":
+		id, version, err = syncCompleteWorkOrder(ctx, tx, customerID, userID, m)
+	default:
+		err = fmt.Errorf("%w: %s cannot be applied to a %s", ErrInvalidSyncMutation, m.Op, m.Entity)
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errSyncConflict):
+		result.ID = *m.ID
+		result.Resolution = models.SyncServerWins
+		result.Server, err = loadSyncEntity(ctx, tx, customerID, m.Entity, *m.ID)
+		return result, err
+	case errors.Is(err, errSyncGone):
+		result.ID = *m.ID
+		result.Resolution = models.SyncTombstoned
+		return result, nil
+	case isSyncRejection(err):
+		result.Resolution = models.SyncRejected
+		result.Error = err.Error()
+		return result, nil
+	default:
+		return result, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO sync_mutations (customer_id, client_id, entity, entity_id, version)
+		VALUES ($1, $2, $3, $4, $5);`,
+		customerID, m.ClientID, m.Entity, id, version,
+	)
+	if err != nil {
+		return result, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, err
+	}
+
+	result.ID = id
+	result.Version = version
+	result.Resolution = models.SyncApplied
+
+	return result, nil
+}
+
+// isSyncRejection reports whether a mutation failed because of what it asked
+// for rather than because of the database.
+func isSyncRejection(err error) bool {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return true
+	}
+
+	for _, rejection := range []error{
+		ErrInvalidSyncMutation, ErrInvalidTransition, ErrWorkOrderUnassigned, ErrUserNotFound,
+		ErrDeviceNotOnWorkOrder, ErrInsufficientStock, ErrFloorPlanNotFound, ErrStationNotFound,
+		ErrProductNotFound, ErrPositionOutOfBounds, ErrEvidenceKept,
+	} {
+		if errors.Is(err, rejection) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSyncEntity returns the server copy of an entity for a conflict.
+func loadSyncEntity(ctx context.Context, tx pgx.Tx, customerID uint, entity string, id uint) (interface{}, error) {
+	var pull models.SyncPull
+	if err := loadSyncEntities(ctx, tx, customerID, map[string][]uint{entity: {id}}, false, &pull); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(pull.Stations) > 0:
+		return pull.Stations[0], nil
+	case len(pull.Devices) > 0:
+		return pull.Devices[0], nil
+	case len(pull.WorkOrders) > 0:
+		return pull.WorkOrders[0], nil
+	}
+	return nil, nil
+}
+
+const syncLockStation = `SELECT version FROM stations WHERE id = $1 AND customer_id = $2 FOR UPDATE;`
+
+const syncLockDevice = `SELECT sp.version
+		FROM station_products sp
+		JOIN stations s ON s.id = sp.station_id
+		WHERE sp.id = $1 AND s.customer_id = $2
+		FOR UPDATE OF sp;`
+
+const syncLockWorkOrder = `SELECT version
+		FROM work_orders
+		WHERE id = $1 AND customer_id = $2 AND status NOT IN ('done', 'cancelled')
+		FOR UPDATE;`
+
+// lockSyncEntity locks the entity a mutation changes and checks the client
+// made the change against the current version.
+func lockSyncEntity(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, error) {
+	if m.ID == nil {
+		return 0, fmt.Errorf("%w: id is required to %s a %s", ErrInvalidSyncMutation, m.Op, m.Entity)
+	}
+
+	query := map[string]string{
+		models.SyncStation:   syncLockStation,
+		models.SyncDevice:    syncLockDevice,
+		models.SyncWorkOrder: syncLockWorkOrder,
+	}[m.Entity]
+
+	var version int
+	err := tx.QueryRow(ctx, query, *m.ID, customerID).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errSyncGone
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if version != m.BaseVersion {
+		return 0, errSyncConflict
+	}
+
+	return *m.ID, nil
+}
+
+// decodeSyncData reads and validates the data of a mutation.
+func decodeSyncData(m models.SyncMutation, data interface{ Validate() error }) error {
+	if len(m.Data) == 0 {
+		return fmt.Errorf("%w: data is required", ErrInvalidSyncMutation)
+	}
+	if err := json.Unmarshal(m.Data, data); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSyncMutation, err)
+	}
+	return data.Validate()
+}
+
+func checkSyncFloorPlan(ctx context.Context, tx pgx.Tx, customerID uint, floorPlanID *uint) error {
+	if floorPlanID == nil {
+		return nil
+	}
+
+	var exists bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM floor_plans WHERE id = $1 AND customer_id = $2);`,
+		*floorPlanID, customerID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrFloorPlanNotFound
+	}
+	return nil
+}
+
+func syncCreateStation(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, int, error) {
+	var data models.SyncStationData
+	if err := decodeSyncData(m, &data); err != nil {
+		return 0, 0, err
+	}
+	if data.Name == nil {
+		return 0, 0, fmt.Errorf("%w: name is required", ErrInvalidSyncMutation)
+	}
+	if err := checkSyncFloorPlan(ctx, tx, customerID, data.FloorPlanID); err != nil {
+		return 0, 0, err
+	}
+	if err := checkStationPosition(ctx, tx, data.FloorPlanID, data.LocationX, data.LocationY); err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		id      uint
+		version int
+	)
+	err := tx.QueryRow(ctx,
+		`INSERT INTO stations (name, description, customer_id, floor_plan_id, location_x, location_y, rotation,
+			zone, room)
+		VALUES ($1, COALESCE($2, ''), $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, version;`,
+		*data.Name, data.Description, customerID, data.FloorPlanID, data.LocationX, data.LocationY, data.Rotation,
+		data.Zone, data.Room,
+	).Scan(&id, &version)
+
+	return id, version, err
+}
+
+func syncUpdateStation(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, int, error) {
+	id, err := lockSyncEntity(ctx, tx, customerID, m)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var data models.SyncStationData
+	if err := decodeSyncData(m, &data); err != nil {
+		return 0, 0, err
+	}
+	if err := checkSyncFloorPlan(ctx, tx, customerID, data.FloorPlanID); err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		version     int
+		floorPlanID *uint
+		x, y        *float64
+	)
+	err = tx.QueryRow(ctx,
+		`UPDATE stations
+		SET name = COALESCE($2, name), description = COALESCE($3, description),
+			floor_plan_id = COALESCE($4, floor_plan_id),
+			location_x = COALESCE($5, location_x), location_y = COALESCE($6, location_y),
+			rotation = COALESCE($7, rotation), zone = COALESCE($8, zone), room = COALESCE($9, room),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING version, floor_plan_id, location_x, location_y;`,
+		id, data.Name, data.Description, data.FloorPlanID, data.LocationX, data.LocationY, data.Rotation,
+		data.Zone, data.Room,
+	).Scan(&version, &floorPlanID, &x, &y)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := checkStationPosition(ctx, tx, floorPlanID, x, y); err != nil {
+		return 0, 0, err
+	}
+
+	return id, version, nil
+}
+
+func syncCreateDevice(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, int, error) {
+	var data models.SyncDeviceData
+	if err := decodeSyncData(m, &data); err != nil {
+		return 0, 0, err
+	}
+
+	if data.StationID == nil && data.StationClientID != "" {
+		var stationID uint
+		err := tx.QueryRow(ctx,
+			`SELECT entity_id FROM sync_mutations
+			WHERE customer_id = $1 AND client_id = $2 AND entity = 'station';`,
+			customerID, data.StationClientID,
+		).Scan(&stationID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, ErrStationNotFound
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		data.StationID = &stationID
+	}
+
+	if data.StationID == nil || data.ProductID == nil || data.InstalledDate == nil || data.ExpiryDate == nil ||
+		data.InspectionDate == nil {
+		return 0, 0, fmt.Errorf("%w: station, product, installed, expiry and inspection dates are required",
+			ErrInvalidSyncMutation)
+	}
+
+	device := models.StationProduct{
+		StationID:           *data.StationID,
+		ProductID:           *data.ProductID,
+		InstalledDate:       *data.InstalledDate,
+		ExpiryDate:          *data.ExpiryDate,
+		InspectionDate:      *data.InspectionDate,
+		ChildProduct1ID:     data.ChildProduct1ID,
+		ChildProduct1Qty:    data.ChildProduct1Qty,
+		ChildProduct2ID:     data.ChildProduct2ID,
+		ChildProduct2Qty:    data.ChildProduct2Qty,
+		ChildProduct1MinQty: derefInt(data.ChildProduct1MinQty),
+		ChildProduct2MinQty: derefInt(data.ChildProduct2MinQty),
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+	if device.ChildProduct1Qty == nil {
+		device.ChildProduct1Qty = new(int)
+	}
+	if device.ChildProduct2Qty == nil {
+		device.ChildProduct2Qty = new(int)
+	}
+	if !device.ExpiryDate.After(device.InstalledDate) {
+		return 0, 0, fmt.Errorf("%w: expiry date must be after the installed date", ErrInvalidSyncMutation)
+	}
+
+	err := tx.QueryRow(ctx,
+		`SELECT c.name
+		FROM stations s
+		JOIN customers c ON c.id = s.customer_id
+		WHERE s.id = $1 AND s.customer_id = $2;`,
+		device.StationID, customerID,
+	).Scan(&device.CustomerName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrStationNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = tx.QueryRow(ctx, `SELECT name FROM products WHERE id = $1;`, device.ProductID).Scan(&device.ProductName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	id, err := addStationProduct(ctx, tx, device)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint(id), 1, nil
+}
+
+func syncUpdateDevice(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, int, error) {
+	id, err := lockSyncEntity(ctx, tx, customerID, m)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var data models.SyncDeviceData
+	if err := decodeSyncData(m, &data); err != nil {
+		return 0, 0, err
+	}
+	if data.StationID != nil || data.StationClientID != "" || data.ProductID != nil {
+		return 0, 0, fmt.Errorf("%w: a device's station and product cannot be changed through sync",
+			ErrInvalidSyncMutation)
+	}
+
+	// a changed date drops the deadline a deferral kept for the old one
+	var (
+		version                int
+		installedAt, expiresAt *time.Time
+	)
+	err = tx.QueryRow(ctx,
+		`UPDATE station_products
+		SET installation_date = COALESCE($2::timestamptz, installation_date),
+			expiry_date = COALESCE($3::timestamptz, expiry_date),
+			inspection_date = COALESCE($4::timestamptz, inspection_date),
+			expiry_due_date = CASE WHEN $3::timestamptz IS DISTINCT FROM expiry_date AND $3::timestamptz IS NOT NULL
+			                       THEN NULL ELSE expiry_due_date END,
+			inspection_due_date = CASE WHEN $4::timestamptz IS DISTINCT FROM inspection_date AND $4::timestamptz IS NOT NULL
+			                           THEN NULL ELSE inspection_due_date END,
+			child_product_1_id = COALESCE($5, child_product_1_id),
+			child_product_1_qty = COALESCE($6, child_product_1_qty),
+			child_product_2_id = COALESCE($7, child_product_2_id),
+			child_product_2_qty = COALESCE($8, child_product_2_qty),
+			child_product_1_min_qty = COALESCE($9, child_product_1_min_qty),
+			child_product_2_min_qty = COALESCE($10, child_product_2_min_qty),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING version, installation_date, expiry_date;`,
+		id, data.InstalledDate, data.ExpiryDate, data.InspectionDate, data.ChildProduct1ID, data.ChildProduct1Qty,
+		data.ChildProduct2ID, data.ChildProduct2Qty, data.ChildProduct1MinQty, data.ChildProduct2MinQty,
+	).Scan(&version, &installedAt, &expiresAt)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// either date may come alone, so check the pair as stored
+	if installedAt != nil && expiresAt != nil && !expiresAt.After(*installedAt) {
+		return 0, 0, fmt.Errorf("%w: expiry date must be after the installed date", ErrInvalidSyncMutation)
+	}
+
+	return id, version, nil
+}
+
+// syncDelete deletes a station, with its devices, or a single device.
+func syncDelete(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, error) {
+	id, err := lockSyncEntity(ctx, tx, customerID, m)
+	if err != nil {
+		return 0, err
+	}
+
+	if m.Entity == models.SyncStation {
+		_, err = tx.Exec(ctx, `DELETE FROM stations WHERE id = $1;`, id)
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM station_products WHERE id = $1;`, id)
+	}
+
+	return id, keptEvidence(err)
+}
+
+func syncUpdateWorkOrder(ctx context.Context, tx pgx.Tx, customerID uint, m models.SyncMutation) (uint, int, error) {
+	id, err := lockSyncEntity(ctx, tx, customerID, m)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var data models.SyncWorkOrderData
+	if err := decodeSyncData(m, &data); err != nil {
+		return 0, 0, err
+	}
+
+	if data.Status != nil {
+		if err := updateWorkOrderStatus(ctx, tx, id, models.WorkOrderStatus(*data.Status)); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if data.Notes != nil {
+		_, err = tx.Exec(ctx,
+			`UPDATE work_orders SET notes = $2, updated_at = NOW() WHERE id = $1;`,
+			id, *data.Notes,
+		)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var version int
+	err = tx.QueryRow(ctx, `SELECT version FROM work_orders WHERE id = $1;`, id).Scan(&version)
+
+	return id, version, err
+}
+
+func syncCompleteWorkOrder(ctx context.Context, tx pgx.Tx, customerID, userID uint, m models.SyncMutation) (uint, int, error) {
+	id, err := lockSyncEntity(ctx, tx, customerID, m)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	req := models.CompleteWorkOrderRequest{CompletedBy: userID}
+	if len(m.Data) > 0 {
+		if err := json.Unmarshal(m.Data, &req); err != nil {
+			return 0, 0, fmt.Errorf("%w: %v", ErrInvalidSyncMutation, err)
+		}
+	}
+	if req.CompletedBy == 0 {
+		req.CompletedBy = userID
+	}
+	if err := req.Validate(); err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := completeWorkOrder(ctx, tx, id, req); err != nil {
+		return 0, 0, err
+	}
+
+	var version int
+	err = tx.QueryRow(ctx, `SELECT version FROM work_orders WHERE id = $1;`, id).Scan(&version)
+
+	return id, version, err
+}
+
+// PruneSyncChanges removes sync changes and pushed mutation ids older than
+// the retention period.
+func (db *Database) PruneSyncChanges(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-SyncRetention)
+
+	tag, err := db.Conn.Exec(ctx,
+		`DELETE FROM sync_changes WHERE changed_at < $1::timestamptz;`,
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`DELETE FROM sync_mutations WHERE created_at < $1::timestamptz;`,
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
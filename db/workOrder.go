@@ -0,0 +1,838 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// defaultInspectionIntervalDays is used when a product has no service interval.
+	defaultInspectionIntervalDays = 365
+
+	// defaultLifetimeMonths is used when a product has no lifetime and the
+	// device's previous lifetime is unknown.
+	defaultLifetimeMonths = 12
+)
+
+const workOrderColumns = `wo.id, wo.customer_id, c.name, wo.station_id, s.name, wo.type, wo.title,
+		COALESCE(wo.description, ''), wo.priority, wo.status, wo.assigned_to, wo.due_date, wo.created_by,
+		wo.started_at, wo.completed_at, wo.completed_by, wo.cancelled_at, COALESCE(wo.notes, ''),
+		wo.created_at, wo.updated_at, sf.facility_id, COALESCE(sf.facility_name, '')`
+
+const workOrderJoins = `FROM work_orders wo
+		JOIN customers c ON c.id = wo.customer_id
+		JOIN stations s ON s.id = wo.station_id
+		` + stationFacility
+
+const workOrderFilter = `WHERE ($1::int IS NULL OR wo.customer_id = $1::int)
+	  AND ($2::int IS NULL OR wo.station_id = $2::int)
+	  AND ($3::int IS NULL OR wo.assigned_to = $3::int)
+	  AND CASE WHEN $4::text IS NULL THEN wo.status NOT IN ('done', 'cancelled')
+	           WHEN $4::text = 'all' THEN TRUE
+	           ELSE wo.status = $4::text END
+	  AND ($5::int IS NULL OR sf.facility_id = $5::int)`
+
+func scanWorkOrder(row pgx.Row) (models.WorkOrder, error) {
+	var wo models.WorkOrder
+
+	err := row.Scan(&wo.ID, &wo.CustomerID, &wo.CustomerName, &wo.StationID, &wo.StationName, &wo.Type,
+		&wo.Title, &wo.Description, &wo.Priority, &wo.Status, &wo.AssignedTo, &wo.DueDate, &wo.CreatedBy,
+		&wo.StartedAt, &wo.CompletedAt, &wo.CompletedBy, &wo.CancelledAt, &wo.Notes, &wo.CreatedAt, &wo.UpdatedAt,
+		&wo.FacilityID, &wo.FacilityName)
+
+	return wo, err
+}
+
+// AddWorkOrder creates a work order for devices on a single station. The work
+// order starts as assigned when it has an assignee, otherwise as open.
+func (db *Database) AddWorkOrder(ctx context.Context, wo models.WorkOrder) (uint, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var stationName string
+	err = tx.QueryRow(ctx,
+		`SELECT customer_id, name FROM stations WHERE id = $1;`,
+		wo.StationID,
+	).Scan(&wo.CustomerID, &stationName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrStationNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var onStation int
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM station_products WHERE id = ANY($1) AND station_id = $2;`,
+		wo.DeviceIDs, wo.StationID,
+	).Scan(&onStation)
+	if err != nil {
+		return 0, err
+	}
+	if onStation != len(uniqueIDs(wo.DeviceIDs)) {
+		return 0, ErrDeviceNotOnStation
+	}
+
+	if wo.AssignedTo != nil {
+		if err := checkActiveUser(ctx, tx, *wo.AssignedTo); err != nil {
+			return 0, err
+		}
+	}
+
+	if wo.Title == "" {
+		wo.Title = workOrderTitle(wo.Type, stationName)
+	}
+
+	id, err := insertWorkOrder(ctx, tx, wo)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func insertWorkOrder(ctx context.Context, tx pgx.Tx, wo models.WorkOrder) (uint, error) {
+	var id uint
+
+	status := models.WorkOrderOpen
+	if wo.AssignedTo != nil {
+		status = models.WorkOrderAssigned
+	}
+	if wo.Priority == "" {
+		wo.Priority = string(models.PriorityNormal)
+	}
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO work_orders (
+		customer_id,
+		station_id,
+		type,
+		title,
+		description,
+		priority,
+		status,
+		assigned_to,
+		due_date,
+		created_by,
+		notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::timestamptz, $10, $11)
+		RETURNING id;`,
+		wo.CustomerID, wo.StationID, wo.Type, wo.Title, wo.Description, wo.Priority, string(status),
+		wo.AssignedTo, wo.DueDate, wo.CreatedBy, wo.Notes,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO work_order_devices (work_order_id, station_product_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING;`,
+		id, wo.DeviceIDs,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GenerateWorkOrders creates work orders for every device whose inspection or
+// expiry falls due within the requested window and that is not already on an
+// open work order. Devices are grouped into one work order per station and
+// type, due on the earliest device date. A device due for replacement is not
+// also scheduled for inspection.
+func (db *Database) GenerateWorkOrders(ctx context.Context, req models.GenerateWorkOrdersRequest) ([]uint, error) {
+	var ids []uint
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// serialise generation so concurrent runs do not create duplicates
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('work_orders.generate'));`); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx,
+		`WITH due AS (
+			SELECT sp.id, sp.station_id, s.customer_id, s.name AS station_name,
+				CASE WHEN sp.expiry_date <= NOW() + make_interval(days => $1) THEN 'replacement' ELSE 'inspection' END AS type,
+				CASE WHEN sp.expiry_date <= NOW() + make_interval(days => $1) THEN sp.expiry_date ELSE sp.inspection_date END AS due_date
+			FROM station_products sp
+			JOIN stations s ON s.id = sp.station_id
+			WHERE ($2::int IS NULL OR s.customer_id = $2::int)
+			  AND (sp.expiry_date <= NOW() + make_interval(days => $1)
+			    OR sp.inspection_date <= NOW() + make_interval(days => $1))
+		)
+		SELECT d.id, d.station_id, d.customer_id, d.station_name, d.type, d.due_date
+		FROM due d
+		WHERE ($3::text IS NULL OR d.type = $3::text)
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM work_order_devices wod
+			JOIN work_orders wo ON wo.id = wod.work_order_id
+			WHERE wod.station_product_id = d.id
+			  AND wo.type = d.type
+			  AND wo.schedule_id IS NULL
+			  AND wo.status NOT IN ('done', 'cancelled')
+		  )
+		ORDER BY d.station_id, d.type, d.due_date;`,
+		req.DueWithinDays, req.CustomerID, nullIfEmpty(req.Type),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		wo          models.WorkOrder
+		stationName string
+	}
+
+	var groups []*group
+	byKey := map[string]*group{}
+	for rows.Next() {
+		var (
+			deviceID, stationID, customerID uint
+			stationName, woType             string
+			dueDate                         time.Time
+		)
+		if err := rows.Scan(&deviceID, &stationID, &customerID, &stationName, &woType, &dueDate); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%d:%s", stationID, woType)
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{
+				wo: models.WorkOrder{
+					CustomerID: customerID,
+					StationID:  stationID,
+					Type:       woType,
+					DueDate:    dueDate,
+					CreatedBy:  req.CreatedBy,
+				},
+				stationName: stationName,
+			}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.wo.DeviceIDs = append(g.wo.DeviceIDs, deviceID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, g := range groups {
+		g.wo.Title = workOrderTitle(g.wo.Type, g.stationName)
+		g.wo.Priority = string(workOrderPriority(g.wo.DueDate, now))
+
+		id, err := insertWorkOrder(ctx, tx, g.wo)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// workOrderPriority is urgent when the work is overdue and high when it is due
+// within a week.
+func workOrderPriority(due, now time.Time) models.WorkOrderPriority {
+	switch {
+	case due.Before(now):
+		return models.PriorityUrgent
+	case due.Before(now.AddDate(0, 0, 7)):
+		return models.PriorityHigh
+	default:
+		return models.PriorityNormal
+	}
+}
+
+func workOrderTitle(woType, stationName string) string {
+	switch woType {
+	case string(models.WorkOrderReplacement):
+		return "Replace devices at " + stationName
+	case string(models.WorkOrderFollowUp):
+		return "Follow up on devices at " + stationName
+	default:
+		return "Inspect devices at " + stationName
+	}
+}
+
+func (db *Database) GetWorkOrder(ctx context.Context, id uint) (models.WorkOrder, error) {
+	wo, err := scanWorkOrder(db.Conn.QueryRow(ctx,
+		`SELECT `+workOrderColumns+`
+		`+workOrderJoins+`
+		WHERE wo.id = $1;`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return wo, ErrNotFound
+	}
+	if err != nil {
+		return wo, err
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT sp.id, sp.product_id, p.name, sp.expiry_date, sp.inspection_date
+		FROM work_order_devices wod
+		JOIN station_products sp ON sp.id = wod.station_product_id
+		JOIN products p ON p.id = sp.product_id
+		WHERE wod.work_order_id = $1
+		ORDER BY sp.id;`,
+		id,
+	)
+	if err != nil {
+		return wo, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var device models.WorkOrderDevice
+		if err := rows.Scan(&device.StationProductID, &device.ProductID, &device.ProductName,
+			&device.ExpiryDate, &device.InspectionDate); err != nil {
+			return wo, err
+		}
+		wo.Devices = append(wo.Devices, device)
+		wo.DeviceIDs = append(wo.DeviceIDs, device.StationProductID)
+	}
+	if err := rows.Err(); err != nil {
+		return wo, err
+	}
+
+	wo.Evidence, err = db.GetWorkOrderEvidence(ctx, id)
+	if err != nil {
+		return wo, err
+	}
+
+	return wo, nil
+}
+
+// GetWorkOrders lists work orders by due date and priority. An empty status
+// lists the work orders that are still to be done, "all" lists every status.
+func (db *Database) GetWorkOrders(ctx context.Context, customerID, stationID, assignedTo, status, facilityID string, page, limit int) ([]models.WorkOrder, int, error) {
+	var (
+		workOrders []models.WorkOrder
+		total      int
+	)
+
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM work_orders wo
+		LEFT JOIN station_facilities sf ON sf.station_id = wo.station_id
+		`+workOrderFilter+`;`,
+		nullIfEmpty(customerID), nullIfEmpty(stationID), nullIfEmpty(assignedTo), nullIfEmpty(status),
+		nullIfEmpty(facilityID),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get total work orders count: %w", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+workOrderColumns+`
+		`+workOrderJoins+`
+		`+workOrderFilter+`
+		ORDER BY wo.due_date,
+			CASE wo.priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'normal' THEN 2 ELSE 3 END,
+			wo.id
+		LIMIT $6 OFFSET $7;`,
+		nullIfEmpty(customerID), nullIfEmpty(stationID), nullIfEmpty(assignedTo), nullIfEmpty(status),
+		nullIfEmpty(facilityID), limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		wo, err := scanWorkOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		workOrders = append(workOrders, wo)
+	}
+
+	return workOrders, total, rows.Err()
+}
+
+// AssignWorkOrder assigns a work order to a user. An open work order becomes
+// assigned; one already assigned or in progress keeps its status.
+func (db *Database) AssignWorkOrder(ctx context.Context, id, userID uint) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	status, _, err := lockWorkOrder(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if status == models.WorkOrderDone || status == models.WorkOrderCancelled {
+		return ErrInvalidTransition
+	}
+
+	if err := checkActiveUser(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if status == models.WorkOrderOpen {
+		status = models.WorkOrderAssigned
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE work_orders
+		SET assigned_to = $2, status = $3, updated_at = NOW()
+		WHERE id = $1;`,
+		id, userID, string(status),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateWorkOrderStatus moves a work order to another status. Moving it back
+// to open unassigns it; completing it goes through CompleteWorkOrder.
+func (db *Database) UpdateWorkOrderStatus(ctx context.Context, id uint, to models.WorkOrderStatus) error {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := updateWorkOrderStatus(ctx, tx, id, to); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func updateWorkOrderStatus(ctx context.Context, tx pgx.Tx, id uint, to models.WorkOrderStatus) error {
+	status, assignedTo, err := lockWorkOrder(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if to == models.WorkOrderDone || !status.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+
+	if (to == models.WorkOrderAssigned || to == models.WorkOrderInProgress) && assignedTo == nil {
+		return ErrWorkOrderUnassigned
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE work_orders
+		SET status = $2,
+			assigned_to = CASE WHEN $2 = 'open' THEN NULL ELSE assigned_to END,
+			started_at = CASE WHEN $2 = 'in_progress' THEN COALESCE(started_at, NOW()) ELSE started_at END,
+			cancelled_at = CASE WHEN $2 = 'cancelled' THEN NOW() ELSE cancelled_at END,
+			updated_at = NOW()
+		WHERE id = $1;`,
+		id, string(to),
+	)
+
+	return err
+}
+
+// CompleteWorkOrder closes an assigned or in-progress work order. Every device
+// on it gets a service record and its dates advanced: an inspection moves the
+// next inspection date on by the product's service interval, a replacement
+// also restarts the installation and expiry dates, and a follow-up clears the
+// needs-attention flag instead. Replacement devices and their components are
+// issued from stock when a stock location is given.
+func (db *Database) CompleteWorkOrder(ctx context.Context, id uint, req models.CompleteWorkOrderRequest) ([]models.ServiceRecord, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	records, err := completeWorkOrder(ctx, tx, id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func completeWorkOrder(ctx context.Context, tx pgx.Tx, id uint, req models.CompleteWorkOrderRequest) ([]models.ServiceRecord, error) {
+	var records []models.ServiceRecord
+
+	status, _, err := lockWorkOrder(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// an assigned work order can be completed without being started first
+	if status != models.WorkOrderAssigned && !status.CanTransition(models.WorkOrderDone) {
+		return nil, ErrInvalidTransition
+	}
+
+	if err := checkActiveUser(ctx, tx, req.CompletedBy); err != nil {
+		return nil, err
+	}
+
+	// work orders from an inspection schedule only move device dates when the
+	// schedule says so; a visual check does not replace the full inspection.
+	// A follow-up repairs the device and leaves its dates alone.
+	var (
+		woType       string
+		advanceDates bool
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT wo.type, COALESCE(isch.updates_device_dates, wo.schedule_id IS NULL) AND wo.type <> 'follow_up'
+		FROM work_orders wo
+		LEFT JOIN inspection_schedules isch ON isch.id = wo.schedule_id
+		WHERE wo.id = $1;`,
+		id,
+	).Scan(&woType, &advanceDates)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceDate := time.Now()
+	if req.ServiceDate != nil {
+		serviceDate = *req.ServiceDate
+	}
+
+	overrides := map[uint]models.CompleteWorkOrderDevice{}
+	for _, device := range req.Devices {
+		overrides[device.StationProductID] = device
+	}
+
+	devices, err := lockWorkOrderDevices(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	onWorkOrder := map[uint]bool{}
+	for _, device := range devices {
+		onWorkOrder[device.id] = true
+	}
+	for deviceID := range overrides {
+		if !onWorkOrder[deviceID] {
+			return nil, ErrDeviceNotOnWorkOrder
+		}
+	}
+
+	for _, device := range devices {
+		override := overrides[device.id]
+
+		record := models.ServiceRecord{
+			StationProductID: device.id,
+			WorkOrderID:      &id,
+			ServiceType:      woType,
+			ServiceDate:      serviceDate,
+			PerformedBy:      &req.CompletedBy,
+			Description:      override.Notes,
+			Status:           "completed",
+		}
+		if record.Description == "" {
+			record.Description = req.Notes
+		}
+
+		nextInspection := device.nextInspection(serviceDate)
+		if override.NextInspectionDate != nil {
+			nextInspection = *override.NextInspectionDate
+		}
+
+		if woType == string(models.WorkOrderFollowUp) {
+			record.ServiceType = "maintenance"
+
+			_, err = tx.Exec(ctx,
+				`UPDATE station_products
+				SET needs_attention = FALSE, attention_reason = NULL, updated_at = NOW()
+				WHERE id = $1;`,
+				device.id,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !advanceDates {
+			// keep the device dates, only record the service
+		} else if woType == string(models.WorkOrderReplacement) {
+			record.NextServiceDate = &nextInspection
+			record.DueKind, record.DueDate = models.DueExpiry, device.expiryDueDate
+
+			expiry := device.nextExpiry(serviceDate)
+			if override.ExpiryDate != nil {
+				expiry = *override.ExpiryDate
+			}
+
+			_, err = tx.Exec(ctx,
+				`UPDATE station_products
+				SET installation_date = $2::timestamptz, expiry_date = $3::timestamptz,
+					inspection_date = $4::timestamptz, expiry_due_date = NULL, inspection_due_date = NULL,
+					updated_at = NOW()
+				WHERE id = $1;`,
+				device.id, serviceDate, expiry, nextInspection,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			if override.StockLocationID != nil {
+				productID := device.productID
+				note := fmt.Sprintf("work order %d", id)
+				if err := issueStock(ctx, tx, *override.StockLocationID, &productID, 1, device.id, &req.CompletedBy, note); err != nil {
+					return nil, err
+				}
+				if err := issueStock(ctx, tx, *override.StockLocationID, device.child1ID, device.child1Qty, device.id, &req.CompletedBy, note); err != nil {
+					return nil, err
+				}
+				if err := issueStock(ctx, tx, *override.StockLocationID, device.child2ID, device.child2Qty, device.id, &req.CompletedBy, note); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			record.NextServiceDate = &nextInspection
+			record.DueKind, record.DueDate = models.DueInspection, device.inspectionDueDate
+
+			_, err = tx.Exec(ctx,
+				`UPDATE station_products
+				SET inspection_date = $2::timestamptz, inspection_due_date = NULL, updated_at = NOW()
+				WHERE id = $1;`,
+				device.id, nextInspection,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		record.ID, err = insertServiceRecord(ctx, tx, record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE work_orders
+		SET status = 'done', completed_at = NOW(), completed_by = $2,
+			started_at = COALESCE(started_at, NOW()),
+			notes = CASE WHEN $3 = '' THEN notes ELSE $3 END,
+			updated_at = NOW()
+		WHERE id = $1;`,
+		id, req.CompletedBy, req.Notes,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// workOrderDevice is a device being closed out by CompleteWorkOrder.
+type workOrderDevice struct {
+	id                  uint
+	productID           uint
+	installedDate       *time.Time
+	expiryDate          *time.Time
+	child1ID, child2ID  *uint
+	child1Qty           int
+	child2Qty           int
+	serviceIntervalDays *int
+	lifetimeMonths      *int
+
+	// the dates before any approved deferral
+	inspectionDueDate *time.Time
+	expiryDueDate     *time.Time
+}
+
+func (d workOrderDevice) nextInspection(serviceDate time.Time) time.Time {
+	days := defaultInspectionIntervalDays
+	if d.serviceIntervalDays != nil {
+		days = *d.serviceIntervalDays
+	}
+	return serviceDate.AddDate(0, 0, days)
+}
+
+// nextExpiry uses the product lifetime, falling back to the lifetime the
+// replaced device had.
+func (d workOrderDevice) nextExpiry(serviceDate time.Time) time.Time {
+	if d.lifetimeMonths != nil {
+		return serviceDate.AddDate(0, *d.lifetimeMonths, 0)
+	}
+	if d.installedDate != nil && d.expiryDate != nil && d.expiryDate.After(*d.installedDate) {
+		return serviceDate.Add(d.expiryDate.Sub(*d.installedDate))
+	}
+	return serviceDate.AddDate(0, defaultLifetimeMonths, 0)
+}
+
+func lockWorkOrderDevices(ctx context.Context, tx pgx.Tx, workOrderID uint) ([]workOrderDevice, error) {
+	var devices []workOrderDevice
+
+	rows, err := tx.Query(ctx,
+		`SELECT sp.id, sp.product_id, sp.installation_date, sp.expiry_date,
+		sp.child_product_1_id, sp.child_product_1_qty, sp.child_product_2_id, sp.child_product_2_qty,
+		p.service_interval_days, p.lifetime_months, COALESCE(sp.inspection_due_date, sp.inspection_date),
+		COALESCE(sp.expiry_due_date, sp.expiry_date)
+		FROM work_order_devices wod
+		JOIN station_products sp ON sp.id = wod.station_product_id
+		JOIN products p ON p.id = sp.product_id
+		WHERE wod.work_order_id = $1
+		ORDER BY sp.id
+		FOR UPDATE OF sp;`,
+		workOrderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d workOrderDevice
+		if err := rows.Scan(&d.id, &d.productID, &d.installedDate, &d.expiryDate, &d.child1ID, &d.child1Qty,
+			&d.child2ID, &d.child2Qty, &d.serviceIntervalDays, &d.lifetimeMonths, &d.inspectionDueDate,
+			&d.expiryDueDate); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
+
+func insertServiceRecord(ctx context.Context, tx pgx.Tx, record models.ServiceRecord) (uint, error) {
+	var id uint
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO service_records (
+		station_product_id,
+		work_order_id,
+		service_type,
+		service_date,
+		performed_by,
+		description,
+		next_service_date,
+		status,
+		due_kind,
+		due_date)
+		VALUES ($1, $2, $3, $4::timestamptz, $5, $6, $7::timestamptz, $8, $9, $10::timestamptz)
+		RETURNING id;`,
+		record.StationProductID, record.WorkOrderID, record.ServiceType, record.ServiceDate,
+		record.PerformedBy, record.Description, record.NextServiceDate, record.Status,
+		nullIfEmpty(record.DueKind), record.DueDate,
+	).Scan(&id)
+
+	return id, err
+}
+
+// GetServiceRecords returns the service history of a device, newest first,
+// with the evidence from each record's work order.
+func (db *Database) GetServiceRecords(ctx context.Context, stationProductID uint) ([]models.ServiceRecord, error) {
+	var records []models.ServiceRecord
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id, station_product_id, work_order_id, service_type, service_date, performed_by,
+		COALESCE(description, ''), next_service_date, status, created_at, COALESCE(due_kind, ''), due_date
+		FROM service_records
+		WHERE station_product_id = $1
+		ORDER BY service_date DESC, id DESC;`,
+		stationProductID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.ServiceRecord
+		if err := rows.Scan(&record.ID, &record.StationProductID, &record.WorkOrderID, &record.ServiceType,
+			&record.ServiceDate, &record.PerformedBy, &record.Description, &record.NextServiceDate,
+			&record.Status, &record.CreatedAt, &record.DueKind, &record.DueDate); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	evidence, err := db.getDeviceEvidence(ctx, stationProductID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].WorkOrderID != nil {
+			records[i].Evidence = evidence[*records[i].WorkOrderID]
+		}
+	}
+
+	return records, nil
+}
+
+func lockWorkOrder(ctx context.Context, tx pgx.Tx, id uint) (models.WorkOrderStatus, *uint, error) {
+	var (
+		status     string
+		assignedTo *uint
+	)
+
+	err := tx.QueryRow(ctx,
+		`SELECT status, assigned_to FROM work_orders WHERE id = $1 FOR UPDATE;`,
+		id,
+	).Scan(&status, &assignedTo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, ErrNotFound
+	}
+
+	return models.WorkOrderStatus(status), assignedTo, err
+}
+
+func checkActiveUser(ctx context.Context, q queryer, userID uint) error {
+	var exists bool
+
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND is_active);`,
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return seen
+}
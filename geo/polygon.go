@@ -0,0 +1,101 @@
+package geo
+
+import "math"
+
+// Polygon is an area given by its corners in order; the last corner connects
+// back to the first.
+type Polygon []Point
+
+// Contains reports whether p lies inside the polygon or on its edge.
+func (pg Polygon) Contains(p Point) bool {
+	inside := false
+
+	for i, j := 0, len(pg)-1; i < len(pg); j, i = i, i+1 {
+		a, b := pg[j], pg[i]
+		if onSegment(a, b, p) {
+			return true
+		}
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < a.X+(p.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// Area is the area enclosed by the polygon, in square floor plan units.
+func (pg Polygon) Area() float64 {
+	var sum float64
+	for i, j := 0, len(pg)-1; i < len(pg); j, i = i, i+1 {
+		sum += pg[j].X*pg[i].Y - pg[i].X*pg[j].Y
+	}
+	return math.Abs(sum) / 2
+}
+
+// Centroid is the centre of mass of the area the polygon encloses, or the
+// average of its corners when it encloses none.
+func (pg Polygon) Centroid() Point {
+	var c Point
+	if len(pg) == 0 {
+		return c
+	}
+
+	var sum float64
+	for i, j := 0, len(pg)-1; i < len(pg); j, i = i, i+1 {
+		f := pg[j].X*pg[i].Y - pg[i].X*pg[j].Y
+		sum += f
+		c.X += (pg[j].X + pg[i].X) * f
+		c.Y += (pg[j].Y + pg[i].Y) * f
+	}
+	if sum == 0 {
+		c = Point{}
+		for _, p := range pg {
+			c.X += p.X / float64(len(pg))
+			c.Y += p.Y / float64(len(pg))
+		}
+		return c
+	}
+
+	return Point{X: c.X / (3 * sum), Y: c.Y / (3 * sum)}
+}
+
+// SelfIntersects reports whether two edges that do not share a corner cross
+// or touch.
+func (pg Polygon) SelfIntersects() bool {
+	n := len(pg)
+	for i := 0; i < n; i++ {
+		for j := i + 2; j < n; j++ {
+			if i == 0 && j == n-1 {
+				continue
+			}
+			if SegmentsIntersect(pg[i], pg[(i+1)%n], pg[j], pg[(j+1)%n]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SegmentsIntersect reports whether the segments ab and cd cross or touch.
+func SegmentsIntersect(a, b, c, d Point) bool {
+	d1, d2 := cross(c, d, a), cross(c, d, b)
+	d3, d4 := cross(a, b, c), cross(a, b, d)
+
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	return onSegment(c, d, a) || onSegment(c, d, b) || onSegment(a, b, c) || onSegment(a, b, d)
+}
+
+// cross is the z component of (b-a) x (p-a): positive when p is left of ab.
+func cross(a, b, p Point) float64 {
+	return (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+}
+
+// onSegment reports whether p lies on the segment ab.
+func onSegment(a, b, p Point) bool {
+	return cross(a, b, p) == 0 &&
+		math.Min(a.X, b.X) <= p.X && p.X <= math.Max(a.X, b.X) &&
+		math.Min(a.Y, b.Y) <= p.Y && p.Y <= math.Max(a.Y, b.Y)
+}
@@ -0,0 +1,150 @@
+// Package geo holds the plane geometry used on floor plans.
+package geo
+
+import "math"
+
+// Point is a position on a floor plan, in floor plan units.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Distance is the straight-line distance between two points.
+func Distance(a, b Point) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// maxExhaustiveStarts bounds how many points are tried as the start of the
+// route; beyond it only the first point is used.
+const maxExhaustiveStarts = 200
+
+// Route orders points into a short open walking path and returns the visiting
+// order as indexes into points, with the path length. Without a start point
+// the route may begin anywhere; with one it begins nearest to it and the
+// walk from start to the first point is included in the length.
+//
+// The route is built nearest-neighbour first and then improved with 2-opt,
+// which is close to optimal for the few dozen stations found on a floor.
+func Route(start *Point, points []Point) ([]int, float64) {
+	if len(points) == 0 {
+		return nil, 0
+	}
+
+	var best []int
+	bestLength := math.Inf(1)
+
+	starts := []int{nearest(start, points)}
+	if start == nil && len(points) <= maxExhaustiveStarts {
+		starts = starts[:0]
+		for i := range points {
+			starts = append(starts, i)
+		}
+	}
+
+	for _, first := range starts {
+		order := nearestNeighbour(first, points)
+		if length := pathLength(start, points, order); length < bestLength {
+			best, bestLength = order, length
+		}
+	}
+
+	twoOpt(start, points, best)
+
+	return best, pathLength(start, points, best)
+}
+
+// nearest returns the index of the point closest to p, or 0 without p.
+func nearest(p *Point, points []Point) int {
+	if p == nil {
+		return 0
+	}
+
+	best := 0
+	for i := range points {
+		if Distance(*p, points[i]) < Distance(*p, points[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func nearestNeighbour(first int, points []Point) []int {
+	visited := make([]bool, len(points))
+	order := make([]int, 0, len(points))
+
+	current := first
+	for {
+		visited[current] = true
+		order = append(order, current)
+		if len(order) == len(points) {
+			return order
+		}
+
+		next, nextDistance := -1, math.Inf(1)
+		for i := range points {
+			if visited[i] {
+				continue
+			}
+			if d := Distance(points[current], points[i]); d < nextDistance {
+				next, nextDistance = i, d
+			}
+		}
+		current = next
+	}
+}
+
+// twoOpt reverses segments of the route while that shortens it. With a start
+// point the first stop may change too; the start itself stays fixed.
+func twoOpt(start *Point, points []Point, order []int) {
+	at := func(i int) (Point, bool) {
+		if i < 0 {
+			if start == nil {
+				return Point{}, false
+			}
+			return *start, true
+		}
+		return points[order[i]], true
+	}
+
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(order)-1; i++ {
+			prev, hasPrev := at(i - 1)
+			for j := i + 1; j < len(order); j++ {
+				// reversing order[i..j] replaces the edges prev-i and j-next
+				// with prev-j and i-next
+				var before, after float64
+				if hasPrev {
+					before += Distance(prev, points[order[i]])
+					after += Distance(prev, points[order[j]])
+				}
+				if j+1 < len(order) {
+					next := points[order[j+1]]
+					before += Distance(points[order[j]], next)
+					after += Distance(points[order[i]], next)
+				}
+
+				if after < before-1e-9 {
+					for l, r := i, j; l < r; l, r = l+1, r-1 {
+						order[l], order[r] = order[r], order[l]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+}
+
+func pathLength(start *Point, points []Point, order []int) float64 {
+	var length float64
+	for i := range order {
+		if i == 0 {
+			if start != nil {
+				length += Distance(*start, points[order[0]])
+			}
+			continue
+		}
+		length += Distance(points[order[i-1]], points[order[i]])
+	}
+	return length
+}
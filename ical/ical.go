@@ -0,0 +1,119 @@
+// Package ical writes iCalendar (RFC 5545) feeds of all-day events.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is an all-day event. UID identifies the event across regenerations
+// of the feed, so calendar clients move an event when its date changes
+// instead of adding a new one; Sequence must grow whenever it is changed.
+type Event struct {
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	Location    string
+	Categories  []string
+	Sequence    int
+	Modified    time.Time
+}
+
+// Calendar is a named feed of events.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+const (
+	dateFormat = "20060102"
+	timeFormat = "20060102T150405Z"
+
+	// lines longer than this many octets are folded
+	maxLineLength = 75
+)
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// Write writes the calendar as an iCalendar stream.
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//linmed//Inspection Calendar//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escape(cal.Name))
+	}
+	// ask clients to refresh every few hours
+	line("REFRESH-INTERVAL;VALUE=DURATION", "PT4H")
+	line("X-PUBLISHED-TTL", "PT4H")
+
+	for _, event := range cal.Events {
+		date := time.Date(event.Date.Year(), event.Date.Month(), event.Date.Day(), 0, 0, 0, 0, time.UTC)
+
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", event.Modified.UTC().Format(timeFormat))
+		line("LAST-MODIFIED", event.Modified.UTC().Format(timeFormat))
+		line("SEQUENCE", strconv.Itoa(event.Sequence))
+		line("DTSTART;VALUE=DATE", date.Format(dateFormat))
+		line("DTEND;VALUE=DATE", date.AddDate(0, 0, 1).Format(dateFormat))
+		line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION", escape(event.Location))
+		}
+		if len(event.Categories) > 0 {
+			categories := make([]string, len(event.Categories))
+			for i, category := range event.Categories {
+				categories[i] = escape(category)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	return bw.Flush()
+}
+
+func escape(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// writeLine writes a content line terminated by CRLF, folding it so no line
+// is longer than 75 octets without splitting a UTF-8 character.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
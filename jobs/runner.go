@@ -0,0 +1,323 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultPollInterval = 2 * time.Second
+	defaultJobTimeout   = 10 * time.Minute
+	defaultMaxAttempts  = 5
+	defaultShutdownWait = 30 * time.Second
+
+	minBackoff = 30 * time.Second
+	maxBackoff = time.Hour
+)
+
+// Handler runs a single job. Returning an error schedules a retry, or
+// dead-letters the job once it has used all its attempts.
+type Handler func(ctx context.Context, job models.Job) error
+
+// EnqueueOptions control when and how often a job runs.
+type EnqueueOptions struct {
+	RunAt       time.Time
+	MaxAttempts int
+	// UniqueKey stops a second job with the same key being queued while
+	// the first one is pending or running
+	UniqueKey string
+}
+
+// Runner executes jobs from the jobs table in-process. Every replica runs its
+// own Runner; jobs are claimed with SKIP LOCKED so each job runs once.
+type Runner struct {
+	db       *database.Database
+	logger   *log.Logger
+	workerID string
+
+	handlers  map[string]Handler
+	schedules []models.JobSchedule
+
+	workers      int
+	pollInterval time.Duration
+	jobTimeout   time.Duration
+
+	cancel    context.CancelFunc
+	jobCtx    context.Context
+	jobCancel context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func NewRunner(db *database.Database, logger *log.Logger) *Runner {
+	hostname, _ := os.Hostname()
+
+	return &Runner{
+		db:           db,
+		logger:       logger,
+		workerID:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		handlers:     map[string]Handler{},
+		workers:      defaultWorkers,
+		pollInterval: defaultPollInterval,
+		jobTimeout:   defaultJobTimeout,
+	}
+}
+
+// Register sets the handler for a kind of job. Only registered kinds are
+// claimed, so replicas running older code leave unknown jobs alone.
+func (r *Runner) Register(kind string, handler Handler) {
+	r.handlers[kind] = handler
+}
+
+// Schedule enqueues a job of kind every time spec fires. spec is a standard
+// five-field cron expression or a descriptor such as "@daily" or "@every 15m".
+// Schedules are written to the database when the runner starts.
+func (r *Runner) Schedule(name, spec, kind string, payload interface{}) error {
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return fmt.Errorf("invalid schedule %s: %w", name, err)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	r.schedules = append(r.schedules, models.JobSchedule{
+		Name:    name,
+		Cron:    spec,
+		Kind:    kind,
+		Payload: data,
+	})
+
+	return nil
+}
+
+// Enqueue queues a job. It returns the id of the new job, or of the existing
+// job when one with the same unique key is already queued.
+func (r *Runner) Enqueue(ctx context.Context, kind string, payload interface{}, opts EnqueueOptions) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	job := models.Job{
+		Kind:        kind,
+		Payload:     data,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt,
+	}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+
+	id, _, err := r.db.EnqueueJob(ctx, job)
+	return id, err
+}
+
+// Start writes the schedules and starts the workers, the scheduler and the
+// stale lock reaper. They run until Stop is called or ctx is cancelled.
+func (r *Runner) Start(ctx context.Context) error {
+	now := time.Now()
+	for _, schedule := range r.schedules {
+		next, err := nextRun(schedule.Cron, now)
+		if err != nil {
+			return err
+		}
+		schedule.NextRunAt = next
+
+		if err := r.db.UpsertJobSchedule(ctx, schedule); err != nil {
+			return fmt.Errorf("failed to save schedule %s: %w", schedule.Name, err)
+		}
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	// jobs get their own context so a shutdown lets in-flight jobs finish
+	r.jobCtx, r.jobCancel = context.WithCancel(context.Background())
+
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx, kinds)
+	}
+
+	r.wg.Add(2)
+	go r.every(ctx, time.Minute/4, r.fireSchedules)
+	go r.every(ctx, time.Minute, r.releaseStale)
+
+	r.logger.WithField("worker", r.workerID).Info("Job runner started")
+
+	return nil
+}
+
+// Stop stops claiming new jobs and waits for running ones to finish. Jobs
+// still running after the shutdown wait are cancelled and will be retried.
+func (r *Runner) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(defaultShutdownWait):
+		r.logger.Warn("Job runner shutdown timed out, cancelling running jobs")
+		r.jobCancel()
+		<-done
+	}
+	r.jobCancel()
+
+	r.logger.Info("Job runner stopped")
+}
+
+func (r *Runner) work(ctx context.Context, kinds []string) {
+	defer r.wg.Done()
+
+	if len(kinds) == 0 {
+		return
+	}
+
+	for {
+		jobs, err := r.db.ClaimJobs(ctx, r.workerID, kinds, 1)
+		if err != nil && ctx.Err() == nil {
+			r.logger.WithError(err).Error("Failed to claim jobs")
+		}
+
+		for _, job := range jobs {
+			r.run(job)
+		}
+
+		if len(jobs) > 0 {
+			continue
+		}
+
+		// spread polling out so replicas do not hit the table in lockstep
+		wait := r.pollInterval + time.Duration(rand.Int63n(int64(r.pollInterval)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *Runner) run(job models.Job) {
+	logger := r.logger.WithField("job", job.ID).WithField("kind", job.Kind).WithField("attempt", job.Attempts)
+
+	ctx, cancel := context.WithTimeout(r.jobCtx, r.jobTimeout)
+	defer cancel()
+
+	err := r.call(ctx, job)
+
+	// record the outcome even if the runner is shutting down
+	ctx, cancelRecord := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelRecord()
+
+	if err == nil {
+		if err := r.db.CompleteJob(ctx, job.ID, r.workerID); err != nil {
+			logger.WithError(err).Error("Failed to mark job as succeeded")
+		}
+		return
+	}
+
+	logger.WithError(err).Warn("Job failed")
+	if err := r.db.FailJob(ctx, job.ID, r.workerID, err.Error(), backoff(job.Attempts)); err != nil {
+		logger.WithError(err).Error("Failed to record job failure")
+	}
+}
+
+// call runs the handler, turning a panic into an error.
+func (r *Runner) call(ctx context.Context, job models.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	handler, ok := r.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for %s", job.Kind)
+	}
+
+	return handler(ctx, job)
+}
+
+func (r *Runner) fireSchedules(ctx context.Context) {
+	if _, err := r.db.FireDueSchedules(ctx, nextRun); err != nil && ctx.Err() == nil {
+		r.logger.WithError(err).Error("Failed to fire job schedules")
+	}
+}
+
+func (r *Runner) releaseStale(ctx context.Context) {
+	// allow a margin over the job timeout before assuming the worker is gone
+	released, err := r.db.ReleaseStaleJobs(ctx, r.jobTimeout+5*time.Minute)
+	if err != nil && ctx.Err() == nil {
+		r.logger.WithError(err).Error("Failed to release stale jobs")
+		return
+	}
+
+	if released > 0 {
+		r.logger.WithField("released", released).Warn("Released jobs from expired worker locks")
+	}
+}
+
+// every calls fn now and then on every interval until ctx is cancelled.
+func (r *Runner) every(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextRun returns the first time spec fires after the given time.
+func nextRun(spec string, after time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return schedule.Next(after), nil
+}
+
+// backoff doubles the retry delay with every attempt, with some jitter so
+// failing jobs do not retry in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay/4)+1))
+}
@@ -0,0 +1,42 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+)
+
+// ErrUnsupportedBackground is returned for floor plan backgrounds that are
+// not a PNG, JPEG, SVG or PDF.
+var ErrUnsupportedBackground = errors.New("background must be a PNG, JPEG, SVG or PDF")
+
+// DetectBackground returns the content type and file extension of a floor
+// plan background. SVGs are recognised by their root element, since they
+// sniff as plain XML or text.
+func DetectBackground(data []byte) (string, string, error) {
+	if contentType, ext, err := DetectImage(data); err == nil {
+		return contentType, ext, nil
+	}
+
+	contentType := http.DetectContentType(data)
+	switch {
+	case contentType == "application/pdf":
+		return contentType, "pdf", nil
+	case isSVG(data):
+		return "image/svg+xml", "svg", nil
+	}
+	return "", "", ErrUnsupportedBackground
+}
+
+// isSVG looks for an svg root element near the start of an XML document.
+func isSVG(data []byte) bool {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	head = bytes.TrimLeft(head, "\xef\xbb\xbf \t\r\n")
+	if !bytes.HasPrefix(head, []byte("<")) {
+		return false
+	}
+	return bytes.Contains(head, []byte("<svg"))
+}
@@ -0,0 +1,75 @@
+// Package media inspects uploaded images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrUnsupportedImage is returned for uploads that are not JPEG or PNG images.
+var ErrUnsupportedImage = errors.New("image must be a JPEG or PNG")
+
+// imageExtensions maps the supported content types to a file extension.
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+}
+
+// Metadata is what an image says about where and when it was taken. Fields
+// are nil when the image does not carry them.
+type Metadata struct {
+	TakenAt   *time.Time
+	Latitude  *float64
+	Longitude *float64
+}
+
+// DetectImage returns the content type and file extension of an image,
+// sniffed from its content rather than trusted from the upload.
+func DetectImage(data []byte) (string, string, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return "", "", ErrUnsupportedImage
+	}
+	return contentType, ext, nil
+}
+
+// ImageMetadata reads the capture time and GPS position from the EXIF data
+// of an image. Images without EXIF data, such as most PNGs, give empty
+// metadata rather than an error.
+func ImageMetadata(data []byte) Metadata {
+	var meta Metadata
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return meta
+	}
+
+	if taken, err := x.DateTime(); err == nil && !taken.IsZero() {
+		meta.TakenAt = &taken
+	}
+
+	if lat, long, err := x.LatLong(); err == nil && validPosition(lat, long) {
+		meta.Latitude = &lat
+		meta.Longitude = &long
+	}
+
+	return meta
+}
+
+// validPosition rejects the out-of-range and 0,0 positions cameras write
+// when they have no GPS fix.
+func validPosition(lat, long float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(long) {
+		return false
+	}
+	if lat == 0 && long == 0 {
+		return false
+	}
+	return lat >= -90 && lat <= 90 && long >= -180 && long <= 180
+}
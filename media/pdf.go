@@ -0,0 +1,57 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pdfPagePixels is the length of the longer side of a rendered PDF page.
+	pdfPagePixels = 4096
+
+	// pdfRenderTimeout bounds how long rendering a single page may take.
+	pdfRenderTimeout = 30 * time.Second
+)
+
+// ErrPDFRenderer is returned when the PDF renderer cannot be run.
+var ErrPDFRenderer = errors.New("PDF backgrounds cannot be rendered on this server")
+
+// ErrPDFPage is returned when the requested page of a PDF cannot be
+// rendered, usually because the PDF has fewer pages or is damaged.
+var ErrPDFPage = errors.New("PDF page cannot be rendered")
+
+// RenderPDFPage renders one page of a PDF, counted from 1, as a PNG using
+// pdftoppm from poppler-utils, or the compatible command given as tool.
+func RenderPDFPage(ctx context.Context, tool string, data []byte, page int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, pdfRenderTimeout)
+	defer cancel()
+
+	n := strconv.Itoa(page)
+	cmd := exec.CommandContext(ctx, tool, "-f", n, "-l", n, "-singlefile", "-png",
+		"-scale-to", strconv.Itoa(pdfPagePixels), "-")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%w: %s", ErrPDFPage, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("%w: %v", ErrPDFRenderer, err)
+	}
+
+	if http.DetectContentType(stdout.Bytes()) != "image/png" {
+		return nil, fmt.Errorf("%w: no image was produced", ErrPDFPage)
+	}
+
+	return stdout.Bytes(), nil
+}
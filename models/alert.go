@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+type AlertSeverity string
+
+const (
+	AlertHigh   AlertSeverity = "high"
+	AlertMedium AlertSeverity = "medium"
+	AlertLow    AlertSeverity = "low"
+)
+
+type AlertStatus string
+
+const (
+	AlertActive       AlertStatus = "active"
+	AlertAcknowledged AlertStatus = "acknowledged"
+	AlertResolved     AlertStatus = "resolved"
+)
+
+// AlertType is a rule the alert generator evaluates, e.g. device_expired.
+type AlertType struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code        string `gorm:"size:50;not null;unique" json:"code"`
+	Name        string `gorm:"size:100;not null" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+	Severity    string `gorm:"size:20;not null" json:"severity"`
+}
+
+// Alert is raised by the alert generator. DedupKey identifies the condition
+// that raised it, so a condition that persists across runs keeps a single
+// open alert instead of raising a new one each time. ConditionClearedAt is
+// when the generator last found the condition gone; an alert resolved by
+// hand before then keeps its condition from raising a new alert.
+type Alert struct {
+	ID                 uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AlertTypeID        uint       `gorm:"index;not null" json:"alert_type_id"`
+	AlertTypeCode      string     `gorm:"-" json:"alert_type"`
+	DedupKey           string     `gorm:"size:200;not null" json:"dedup_key"`
+	Severity           string     `gorm:"size:20;not null" json:"severity"`
+	Message            string     `gorm:"type:text;not null" json:"message"`
+	CustomerID         *uint      `gorm:"index" json:"customer_id"`
+	StationID          *uint      `gorm:"index" json:"station_id"`
+	StationProductID   *uint      `gorm:"index" json:"station_product_id"`
+	Status             string     `gorm:"size:20;not null;default:'active'" json:"status"`
+	Occurrences        int        `gorm:"not null;default:1" json:"occurrences"`
+	FirstSeenAt        time.Time  `json:"first_seen_at"`
+	LastSeenAt         time.Time  `json:"last_seen_at"`
+	AcknowledgedAt     *time.Time `json:"acknowledged_at"`
+	AcknowledgedBy     *uint      `json:"acknowledged_by"`
+	ResolvedAt         *time.Time `json:"resolved_at"`
+	ResolvedBy         *uint      `json:"resolved_by"`
+	ResolutionNote     string     `gorm:"type:text" json:"resolution_note"`
+	ConditionClearedAt *time.Time `json:"condition_cleared_at"`
+	CreatedAt          time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Facility of the alert's station, when its floor plan is on a floor
+	FacilityID   *uint  `gorm:"-" json:"facility_id,omitempty"`
+	FacilityName string `gorm:"-" json:"facility_name,omitempty"`
+}
+
+// AlertAction is the body of an acknowledge or resolve request.
+type AlertAction struct {
+	UserID uint   `json:"user_id" validate:"required"`
+	Note   string `json:"note" validate:"omitempty"`
+}
+
+func (a *AlertAction) Validate() error {
+	return validate.Struct(a)
+}
+
+// AlertRun summarises one pass of the alert generator.
+type AlertRun struct {
+	Raised   int `json:"raised"`
+	Updated  int `json:"updated"`
+	Resolved int `json:"resolved"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Kinds of calendar task.
+const (
+	CalendarExpiry     = DueExpiry
+	CalendarInspection = DueInspection
+)
+
+// CalendarFeed is a secret-token iCalendar feed of the upcoming inspections
+// and expiries of either a customer's devices or the devices on a
+// technician's open work orders. Anyone holding the token can read the feed,
+// so rotating it revokes the old URL.
+type CalendarFeed struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Token      string    `gorm:"size:64;uniqueIndex;not null" json:"token"`
+	CustomerID *uint     `gorm:"index" json:"customer_id,omitempty"`
+	UserID     *uint     `gorm:"index" json:"user_id,omitempty"`
+	Name       string    `gorm:"-" json:"name"`
+	URL        string    `gorm:"-" json:"url"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// CalendarTask is a device's expiry or inspection date, the data the
+// dashboard task lists and calendar feeds are built from.
+type CalendarTask struct {
+	Kind             string    `json:"kind"`
+	Date             time.Time `json:"date"`
+	StationProductID uint      `json:"station_product_id"`
+	ProductName      string    `json:"product_name"`
+	StationID        uint      `json:"station_id"`
+	StationName      string    `json:"station_name"`
+	FloorPlanName    string    `json:"floor_plan_name"`
+	CustomerID       uint      `json:"customer_id"`
+	CustomerName     string    `json:"customer_name"`
+	Version          int       `json:"version"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Facility of the device's station, when its floor plan is on a floor
+	FacilityID   *uint  `json:"facility_id,omitempty"`
+	FacilityName string `json:"facility_name,omitempty"`
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type ChecklistItemType string
+
+const (
+	ChecklistPassFail ChecklistItemType = "pass_fail"
+	ChecklistNumber   ChecklistItemType = "number"
+	ChecklistText     ChecklistItemType = "text"
+	ChecklistPhoto    ChecklistItemType = "photo"
+)
+
+// ChecklistTemplate is the list of checks a technician works through when
+// inspecting a device. A template applies either to a single product or to
+// every product in a category; a product template takes precedence.
+type ChecklistTemplate struct {
+	ID          uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string          `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	Description string          `gorm:"type:text" json:"description" validate:"omitempty"`
+	CategoryID  *uint           `gorm:"index" json:"category_id" validate:"omitempty"`
+	ProductID   *uint           `gorm:"index" json:"product_id" validate:"omitempty"`
+	Active      bool            `gorm:"not null;default:true" json:"active"`
+	CreatedBy   *uint           `json:"created_by" validate:"omitempty"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+	Items       []ChecklistItem `gorm:"-" json:"items" validate:"required,min=1,dive"`
+}
+
+func (ct *ChecklistTemplate) Validate() error {
+	if err := validate.Struct(ct); err != nil {
+		return err
+	}
+	if (ct.CategoryID == nil) == (ct.ProductID == nil) {
+		return errors.New("exactly one of category_id and product_id must be set")
+	}
+	for _, item := range ct.Items {
+		if item.MinValue != nil && item.MaxValue != nil && *item.MinValue > *item.MaxValue {
+			return errors.New("min_value must not be greater than max_value")
+		}
+	}
+	return nil
+}
+
+// ChecklistItem is a single check. A pass/fail item fails when answered
+// false and a number item when it falls outside MinValue and MaxValue. Text
+// and photo items record evidence and never fail, but a required photo item
+// must have at least one photo. A failed item with CreatesFollowUp opens a
+// follow-up work order for the device.
+type ChecklistItem struct {
+	ID              uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID      uint     `gorm:"index;not null" json:"template_id"`
+	Position        int      `gorm:"not null" json:"position"`
+	Question        string   `gorm:"type:text;not null" json:"question" validate:"required"`
+	Type            string   `gorm:"size:20;not null" json:"type" validate:"required,oneof=pass_fail number text photo"`
+	Required        bool     `gorm:"not null;default:true" json:"required"`
+	MinValue        *float64 `json:"min_value" validate:"omitempty"`
+	MaxValue        *float64 `json:"max_value" validate:"omitempty"`
+	Unit            string   `gorm:"size:20" json:"unit" validate:"omitempty,max=20"`
+	CreatesFollowUp bool     `gorm:"not null;default:false" json:"creates_follow_up"`
+}
+
+// ChecklistSubmission is a completed checklist for a device. Without a
+// TemplateID the template for the device's product, or else its category,
+// is used.
+type ChecklistSubmission struct {
+	TemplateID  *uint               `json:"template_id" validate:"omitempty"`
+	WorkOrderID *uint               `json:"work_order_id" validate:"omitempty"`
+	SubmittedBy uint                `json:"submitted_by" validate:"required"`
+	Notes       string              `json:"notes" validate:"omitempty"`
+	Responses   []ChecklistResponse `json:"responses" validate:"required,min=1,dive"`
+}
+
+func (cs *ChecklistSubmission) Validate() error {
+	return validate.Struct(cs)
+}
+
+// ChecklistResponse answers a checklist item. Only the field matching the
+// item type is used. PhotoKeys are the image keys of photo evidence already
+// uploaded of the device or to the submission's work order.
+type ChecklistResponse struct {
+	ItemID    uint     `json:"item_id" validate:"required"`
+	Pass      *bool    `json:"pass" validate:"omitempty"`
+	Number    *float64 `json:"number" validate:"omitempty"`
+	Text      string   `json:"text" validate:"omitempty"`
+	PhotoKeys []string `json:"photo_keys" validate:"omitempty"`
+	Comment   string   `json:"comment" validate:"omitempty"`
+}
+
+// ChecklistResult is a submitted checklist. The template name and questions
+// are copied so results still read correctly after the template changes.
+// Evidence is the device's own photos answered in it, which are kept with
+// the result.
+type ChecklistResult struct {
+	ID                  uint                  `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID          *uint                 `gorm:"index" json:"template_id"`
+	TemplateName        string                `gorm:"size:100;not null" json:"template_name"`
+	StationProductID    uint                  `gorm:"index;not null" json:"station_product_id"`
+	StationID           uint                  `gorm:"index;not null" json:"station_id"`
+	CustomerID          uint                  `gorm:"index;not null" json:"customer_id"`
+	WorkOrderID         *uint                 `gorm:"index" json:"work_order_id"`
+	SubmittedBy         *uint                 `json:"submitted_by"`
+	SubmittedAt         time.Time             `json:"submitted_at"`
+	Passed              bool                  `gorm:"not null" json:"passed"`
+	FailedItems         int                   `gorm:"not null" json:"failed_items"`
+	Notes               string                `gorm:"type:text" json:"notes"`
+	FollowUpWorkOrderID *uint                 `json:"follow_up_work_order_id"`
+	Items               []ChecklistResultItem `gorm:"-" json:"items,omitempty"`
+	Evidence            []Evidence            `gorm:"-" json:"evidence,omitempty"`
+}
+
+// ChecklistResultItem is the answer to a single item of a submitted checklist.
+type ChecklistResultItem struct {
+	ItemID    *uint    `json:"item_id"`
+	Position  int      `json:"position"`
+	Question  string   `json:"question"`
+	Type      string   `json:"type"`
+	Pass      *bool    `json:"pass,omitempty"`
+	Number    *float64 `json:"number,omitempty"`
+	Text      string   `json:"text,omitempty"`
+	PhotoKeys []string `json:"photo_keys,omitempty"`
+	Passed    bool     `json:"passed"`
+	Comment   string   `json:"comment,omitempty"`
+}
+
+// ChecklistItemReport summarises the answers to one item of a template.
+type ChecklistItemReport struct {
+	ItemID       uint     `json:"item_id"`
+	Position     int      `json:"position"`
+	Question     string   `json:"question"`
+	Type         string   `json:"type"`
+	Answered     int      `json:"answered"`
+	Failed       int      `json:"failed"`
+	FailureRate  float64  `json:"failure_rate"`
+	AverageValue *float64 `json:"average_value,omitempty"`
+	LowestValue  *float64 `json:"lowest_value,omitempty"`
+	HighestValue *float64 `json:"highest_value,omitempty"`
+}
+
+// ChecklistReport summarises the submitted results of a template.
+type ChecklistReport struct {
+	TemplateID   uint                  `json:"template_id"`
+	TemplateName string                `json:"template_name"`
+	Submissions  int                   `json:"submissions"`
+	Passed       int                   `json:"passed"`
+	PassRate     float64               `json:"pass_rate"`
+	Items        []ChecklistItemReport `json:"items"`
+}
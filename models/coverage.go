@@ -0,0 +1,57 @@
+package models
+
+import "github.com/aakash-tyagi/linmed/geo"
+
+const (
+	CoverageStraight = "straight"
+	CoverageWalking  = "walking"
+)
+
+// CoverageStation is a station counted in a coverage analysis. Radius is the
+// largest coverage amount of its devices, in metres, and nil when none of
+// them has one.
+type CoverageStation struct {
+	ID        uint     `json:"id"`
+	Name      string   `json:"name"`
+	LocationX float64  `json:"location_x"`
+	LocationY float64  `json:"location_y"`
+	Radius    *float64 `json:"radius"`
+}
+
+// CoverageArea is how much of a room, or of the whole floor when the layout
+// has no rooms, is covered. Areas are in square metres; uncovered polygons
+// are in floor plan units.
+type CoverageArea struct {
+	RoomID          string        `json:"room_id,omitempty"`
+	Name            string        `json:"name"`
+	Area            float64       `json:"area"`
+	Covered         float64       `json:"covered"`
+	CoveragePercent float64       `json:"coverage_percent"`
+	Uncovered       []geo.Polygon `json:"uncovered"`
+}
+
+// CoverageSuggestion is a position for an extra station and the area, in
+// square metres, it would cover that nothing covers yet.
+type CoverageSuggestion struct {
+	Position geo.Point `json:"position"`
+	RoomID   string    `json:"room_id,omitempty"`
+	Gain     float64   `json:"gain"`
+}
+
+// CoverageAnalysis says which parts of a floor plan are out of reach of its
+// stations. Mode is straight-line or walking distance around walls;
+// Resolution is the size in metres of the grid cells the floor is divided
+// into, and Distance the required distance when it overrides the devices'
+// coverage amounts.
+type CoverageAnalysis struct {
+	FloorPlanID     uint                 `json:"floor_plan_id"`
+	Mode            string               `json:"mode"`
+	Resolution      float64              `json:"resolution"`
+	Distance        *float64             `json:"distance"`
+	Area            float64              `json:"area"`
+	Covered         float64              `json:"covered"`
+	CoveragePercent float64              `json:"coverage_percent"`
+	Rooms           []CoverageArea       `json:"rooms"`
+	Suggestions     []CoverageSuggestion `json:"suggestions"`
+	Stations        []CoverageStation    `json:"stations"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+type DeferralStatus string
+
+const (
+	DeferralPending  DeferralStatus = "pending"
+	DeferralApproved DeferralStatus = "approved"
+	DeferralRejected DeferralStatus = "rejected"
+)
+
+// Deferral is a technician's request to move a device's inspection, or its
+// replacement by moving the expiry date, to a later date. A supervisor
+// approves or rejects it. Approval moves the task date; DueDate stays the
+// date the SLA is measured against until the device is serviced.
+type Deferral struct {
+	ID               uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	StationProductID uint           `gorm:"index;not null" json:"station_product_id"`
+	Kind             string         `gorm:"size:20;not null" json:"kind" validate:"required,oneof=inspection expiry"`
+	DueDate          time.Time      `json:"due_date"`
+	TaskDate         time.Time      `json:"task_date"`
+	RequestedDate    time.Time      `gorm:"not null" json:"requested_date" validate:"required"`
+	Reason           string         `gorm:"type:text;not null" json:"reason" validate:"required,max=500"`
+	Status           DeferralStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	RequestedBy      uint           `gorm:"not null" json:"requested_by" validate:"required"`
+	DecidedBy        *uint          `json:"decided_by"`
+	DecidedAt        *time.Time     `json:"decided_at"`
+	DecisionNote     string         `gorm:"type:text" json:"decision_note"`
+	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+
+	StationID    uint   `gorm:"-" json:"station_id"`
+	StationName  string `gorm:"-" json:"station_name"`
+	CustomerID   uint   `gorm:"-" json:"customer_id"`
+	CustomerName string `gorm:"-" json:"customer_name"`
+	ProductName  string `gorm:"-" json:"product_name"`
+
+	// Facility of the device's station, when its floor plan is on a floor
+	FacilityID   *uint  `gorm:"-" json:"facility_id,omitempty"`
+	FacilityName string `gorm:"-" json:"facility_name,omitempty"`
+}
+
+func (d *Deferral) Validate() error {
+	return validate.Struct(d)
+}
+
+// DeferralDecision is a supervisor approving or rejecting a deferral.
+type DeferralDecision struct {
+	DecidedBy uint   `json:"decided_by" validate:"required"`
+	Note      string `json:"note" validate:"omitempty,max=500"`
+}
+
+func (d *DeferralDecision) Validate() error {
+	return validate.Struct(d)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type EvidenceType string
+
+const (
+	EvidencePhoto     EvidenceType = "photo"
+	EvidenceSignature EvidenceType = "signature"
+)
+
+// Evidence is a photo or signature proving a work order was carried out,
+// optionally for a single device on it, or a photo of a device taken for a
+// checklist inspection outside any work order. Evidence can only be added or
+// removed while the work order is open, or until the checklist it is
+// answered in is submitted; after that it is fixed and kept. SHA256 is the
+// checksum of the stored image.
+//
+// CapturedAt, Latitude and Longitude come from the image's EXIF data, or
+// from the uploading app when the image has none; MetadataSource says which.
+type Evidence struct {
+	ID                uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	WorkOrderID       *uint      `gorm:"index" json:"work_order_id"`
+	StationProductID  *uint      `gorm:"index" json:"station_product_id" validate:"omitempty"`
+	ChecklistResultID *uint      `gorm:"index" json:"checklist_result_id"`
+	Type              string     `gorm:"size:20;not null" json:"type" validate:"required,oneof=photo signature"`
+	ImageKey          string     `gorm:"size:255;not null" json:"image_key"`
+	ContentType       string     `gorm:"size:50;not null" json:"content_type"`
+	Size              int64      `gorm:"not null" json:"size"`
+	SHA256            string     `gorm:"size:64;not null" json:"sha256"`
+	SignerName        string     `gorm:"size:100" json:"signer_name" validate:"omitempty,max=100"`
+	Caption           string     `gorm:"type:text" json:"caption" validate:"omitempty"`
+	CapturedAt        *time.Time `json:"captured_at" validate:"omitempty"`
+	Latitude          *float64   `json:"latitude" validate:"omitempty,gte=-90,lte=90"`
+	Longitude         *float64   `json:"longitude" validate:"omitempty,gte=-180,lte=180"`
+	MetadataSource    string     `gorm:"size:20" json:"metadata_source,omitempty"`
+	UploadedBy        uint       `json:"uploaded_by" validate:"required"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (e *Evidence) Validate() error {
+	if err := validate.Struct(e); err != nil {
+		return err
+	}
+	if e.WorkOrderID == nil && e.StationProductID == nil {
+		return errors.New("evidence needs a work order or a device")
+	}
+	if e.Type == string(EvidenceSignature) && e.SignerName == "" {
+		return errors.New("signer_name is required for signatures")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Facility is a site of a customer, such as a hospital, made up of
+// buildings with floors. Timezone is an IANA zone name, e.g.
+// "Europe/London", used for the site's local dates.
+type Facility struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID    uint       `gorm:"index;not null" json:"customer_id"`
+	Name          string     `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	FacilityType  string     `gorm:"size:50" json:"facility_type" validate:"omitempty,max=50"`
+	Address       string     `gorm:"size:255" json:"address" validate:"omitempty,max=255"`
+	City          string     `gorm:"size:100" json:"city" validate:"omitempty,max=100"`
+	State         string     `gorm:"size:100" json:"state" validate:"omitempty,max=100"`
+	PostalCode    string     `gorm:"size:20" json:"postal_code" validate:"omitempty,max=20"`
+	Country       string     `gorm:"size:100" json:"country" validate:"omitempty,max=100"`
+	ContactPerson string     `gorm:"size:100" json:"contact_person" validate:"omitempty,max=100"`
+	ContactEmail  string     `gorm:"size:100" json:"contact_email" validate:"omitempty,email"`
+	ContactPhone  string     `gorm:"size:15" json:"contact_phone" validate:"omitempty,e164"`
+	Timezone      string     `gorm:"size:50;not null;default:'UTC'" json:"timezone" validate:"omitempty,max=50"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	Buildings     []Building `gorm:"foreignKey:FacilityID;constraint:OnDelete:CASCADE" json:"buildings,omitempty"`
+}
+
+// Validate checks the facility and that its timezone is known, defaulting
+// it to UTC.
+func (f *Facility) Validate() error {
+	if err := validate.Struct(f); err != nil {
+		return err
+	}
+
+	if f.Timezone == "" {
+		f.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(f.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", f.Timezone)
+	}
+
+	return nil
+}
+
+// Building is a building of a facility.
+type Building struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FacilityID uint      `gorm:"index;not null" json:"facility_id"`
+	Name       string    `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	Code       string    `gorm:"size:20" json:"code" validate:"omitempty,max=20"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	Floors     []Floor   `gorm:"foreignKey:BuildingID;constraint:OnDelete:CASCADE" json:"floors,omitempty"`
+}
+
+func (b *Building) Validate() error {
+	return validate.Struct(b)
+}
+
+// Floor is a floor of a building. Level orders the floors of a building,
+// with 0 for the ground floor and negative levels below it. Floor plans are
+// drawn for a floor.
+type Floor struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	BuildingID   uint      `gorm:"index;not null" json:"building_id"`
+	Name         string    `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	Level        int       `gorm:"not null;default:0" json:"level" validate:"gte=-20,lte=200"`
+	FloorPlanIDs []uint    `gorm:"-" json:"floor_plan_ids"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (f *Floor) Validate() error {
+	return validate.Struct(f)
+}
+
+// FacilitySummary is the dashboard of one facility.
+type FacilitySummary struct {
+	FacilityID     uint   `json:"facility_id"`
+	FacilityName   string `json:"facility_name"`
+	CustomerID     uint   `json:"customer_id"`
+	Timezone       string `json:"timezone"`
+	FloorPlanCount uint   `json:"floor_plan_count"`
+	StationCount   uint   `json:"station_count"`
+	DeviceCount    uint   `json:"device_count"`
+	ExpiringCount  uint   `json:"expiring_count"`
+	OverdueCount   uint   `json:"overdue_count"`
+	AttentionCount uint   `json:"attention_count"`
+	OpenWorkOrders uint   `json:"open_work_orders"`
+}
+
+// FacilitySLACompliance is a customer's SLA compliance at one facility.
+type FacilitySLACompliance struct {
+	FacilityID   uint            `json:"facility_id"`
+	FacilityName string          `json:"facility_name"`
+	Compliance   []SLACompliance `json:"compliance"`
+}
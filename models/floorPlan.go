@@ -5,13 +5,81 @@ import "time"
 type FloorPlan struct {
 	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name       string    `gorm:"size:100;not null" json:"name"`
-	Layout     string    `gorm:"type:text" json:"layout"` // JSON or other format for layout data
+	Layout     string    `gorm:"type:text" json:"layout"` // JSON layout, see Layout
 	CustomerID uint      `gorm:"index" json:"customer_id"`
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 	Stations   []Station `gorm:"foreignKey:FloorPlanID;constraint:OnDelete:CASCADE;OnUpdate:CASCADE" json:"stations"`
+
+	// Incremented on every change; used to detect sync conflicts
+	Version int `gorm:"not null;default:1" json:"version,omitempty"`
+
+	// Size of the plan in floor plan units; station positions must lie
+	// within it when set
+	Width  *float64 `json:"width" validate:"omitempty,gt=0"`
+	Height *float64 `json:"height" validate:"omitempty,gt=0"`
+
+	// Uploaded background image stored in S3; for a PDF, the page that was
+	// rendered into it
+	BackgroundKey  string `json:"-"`
+	BackgroundType string `json:"background_type,omitempty"`
+	BackgroundPage *int   `json:"background_page,omitempty"`
+
+	// Floor of a facility building the plan is drawn for
+	FloorID *uint `gorm:"index" json:"floor_id" validate:"omitempty"`
 }
 
 func (f *FloorPlan) Validate() error {
-	return validate.Struct(f)
+	if err := validate.Struct(f); err != nil {
+		return err
+	}
+	if f.Layout == "" {
+		return nil
+	}
+
+	_, err := ParseLayout(f.Layout)
+	return err
+}
+
+type StationStatus string
+
+// Station statuses from worst to best; a station takes the worst status of
+// its devices.
+const (
+	StationExpired   StationStatus = "expired"
+	StationOverdue   StationStatus = "overdue"
+	StationAttention StationStatus = "attention"
+	StationExpiring  StationStatus = "expiring"
+	StationOK        StationStatus = "ok"
+	StationEmpty     StationStatus = "empty"
+)
+
+// StationExpiringDays is how soon a device has to expire for its station to
+// count as expiring.
+const StationExpiringDays = 30
+
+// StationMarker is a station as drawn on a floor plan.
+type StationMarker struct {
+	ID        uint          `json:"id"`
+	Name      string        `json:"name"`
+	LocationX *float64      `json:"location_x"`
+	LocationY *float64      `json:"location_y"`
+	Rotation  *float64      `json:"rotation"`
+	Devices   int           `json:"devices"`
+	Status    StationStatus `json:"status"`
+}
+
+// Extent is the size of the floor plan in floor plan units: that of its
+// layout when it has one, otherwise Width and Height.
+func (f *FloorPlan) Extent() (*float64, *float64) {
+	if f.Layout == "" {
+		return f.Width, f.Height
+	}
+
+	layout, err := ParseLayout(f.Layout)
+	if err != nil {
+		return f.Width, f.Height
+	}
+	width, height := layout.Extent()
+	return &width, &height
 }
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// FloorPlanRevision is a floor plan as it was after a change, with where its
+// stations were at the time. Revisions are numbered from 1 per floor plan; a
+// rollback is recorded as a new revision that copies an older one.
+type FloorPlanRevision struct {
+	ID             uint              `json:"id"`
+	FloorPlanID    uint              `json:"floor_plan_id"`
+	Revision       int               `json:"revision"`
+	Name           string            `json:"name"`
+	Layout         string            `json:"layout,omitempty"`
+	Width          *float64          `json:"width"`
+	Height         *float64          `json:"height"`
+	Stations       []RevisionStation `json:"stations,omitempty"`
+	StationCount   int               `json:"station_count"`
+	RolledBackFrom *int              `json:"rolled_back_from"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// RevisionStation is a station as recorded in a floor plan revision.
+type RevisionStation struct {
+	ID        uint     `json:"id"`
+	Name      string   `json:"name"`
+	LocationX *float64 `json:"location_x"`
+	LocationY *float64 `json:"location_y"`
+	Rotation  *float64 `json:"rotation"`
+	Zone      string   `json:"zone,omitempty"`
+	Room      string   `json:"room,omitempty"`
+}
+
+// AreaChange is a room or zone that exists in both revisions but changed.
+type AreaChange struct {
+	ID   string     `json:"id"`
+	From LayoutArea `json:"from"`
+	To   LayoutArea `json:"to"`
+}
+
+// StationMove is a station found at different positions in two revisions.
+// Distance is in floor plan units, and nil when either position is unknown.
+type StationMove struct {
+	ID       uint            `json:"id"`
+	Name     string          `json:"name"`
+	From     RevisionStation `json:"from"`
+	To       RevisionStation `json:"to"`
+	Distance *float64        `json:"distance"`
+}
+
+// AreaDiff lists the rooms or zones added, removed and changed.
+type AreaDiff struct {
+	Added   []LayoutArea `json:"added"`
+	Removed []LayoutArea `json:"removed"`
+	Changed []AreaChange `json:"changed"`
+}
+
+// StationDiff lists the stations added to, removed from and moved on a
+// floor plan.
+type StationDiff struct {
+	Added   []RevisionStation `json:"added"`
+	Removed []RevisionStation `json:"removed"`
+	Moved   []StationMove     `json:"moved"`
+}
+
+// FloorPlanDiff is what changed from one revision to another.
+type FloorPlanDiff struct {
+	FloorPlanID   uint        `json:"floor_plan_id"`
+	From          int         `json:"from"`
+	To            int         `json:"to"`
+	NameChanged   bool        `json:"name_changed"`
+	LayoutChanged bool        `json:"layout_changed"`
+	Rooms         AreaDiff    `json:"rooms"`
+	Zones         AreaDiff    `json:"zones"`
+	Stations      StationDiff `json:"stations"`
+}
+
+// DiffRevisions compares two revisions of a floor plan. Layouts that do not
+// match the layout schema count as having no rooms or zones.
+func DiffRevisions(from, to FloorPlanRevision) FloorPlanDiff {
+	diff := FloorPlanDiff{
+		FloorPlanID:   to.FloorPlanID,
+		From:          from.Revision,
+		To:            to.Revision,
+		NameChanged:   from.Name != to.Name,
+		LayoutChanged: from.Layout != to.Layout,
+	}
+
+	var fromLayout, toLayout Layout
+	if layout, err := ParseLayout(from.Layout); err == nil {
+		fromLayout = *layout
+	}
+	if layout, err := ParseLayout(to.Layout); err == nil {
+		toLayout = *layout
+	}
+	diff.Rooms = diffAreas(fromLayout.Rooms, toLayout.Rooms)
+	diff.Zones = diffAreas(fromLayout.Zones, toLayout.Zones)
+
+	diff.Stations = StationDiff{Added: []RevisionStation{}, Removed: []RevisionStation{}, Moved: []StationMove{}}
+	before := map[uint]RevisionStation{}
+	for _, station := range from.Stations {
+		before[station.ID] = station
+	}
+	after := map[uint]bool{}
+	for _, station := range to.Stations {
+		after[station.ID] = true
+
+		old, ok := before[station.ID]
+		if !ok {
+			diff.Stations.Added = append(diff.Stations.Added, station)
+			continue
+		}
+		if samePosition(old.LocationX, station.LocationX) && samePosition(old.LocationY, station.LocationY) {
+			continue
+		}
+
+		move := StationMove{ID: station.ID, Name: station.Name, From: old, To: station}
+		if old.LocationX != nil && old.LocationY != nil && station.LocationX != nil && station.LocationY != nil {
+			distance := math.Hypot(*station.LocationX-*old.LocationX, *station.LocationY-*old.LocationY)
+			move.Distance = &distance
+		}
+		diff.Stations.Moved = append(diff.Stations.Moved, move)
+	}
+	for _, station := range from.Stations {
+		if !after[station.ID] {
+			diff.Stations.Removed = append(diff.Stations.Removed, station)
+		}
+	}
+
+	return diff
+}
+
+func diffAreas(from, to []LayoutArea) AreaDiff {
+	diff := AreaDiff{Added: []LayoutArea{}, Removed: []LayoutArea{}, Changed: []AreaChange{}}
+
+	before := map[string]LayoutArea{}
+	for _, area := range from {
+		before[area.ID] = area
+	}
+	after := map[string]bool{}
+	for _, area := range to {
+		after[area.ID] = true
+
+		old, ok := before[area.ID]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, area)
+		case old.Name != area.Name || !samePolygon(old, area):
+			diff.Changed = append(diff.Changed, AreaChange{ID: area.ID, From: old, To: area})
+		}
+	}
+	for _, area := range from {
+		if !after[area.ID] {
+			diff.Removed = append(diff.Removed, area)
+		}
+	}
+
+	return diff
+}
+
+func samePolygon(a, b LayoutArea) bool {
+	if len(a.Polygon) != len(b.Polygon) {
+		return false
+	}
+	for i := range a.Polygon {
+		if a.Polygon[i] != b.Polygon[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func samePosition(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
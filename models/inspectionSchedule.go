@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// InspectionSchedule is a contracted inspection that recurs regardless of
+// product intervals, such as a monthly visual check. It applies to every
+// station of the customer, narrowed to a floor plan or a single station when
+// those are set. RRule is an RFC 5545 recurrence rule without DTSTART, e.g.
+// "FREQ=MONTHLY;BYMONTHDAY=1" or "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO".
+//
+// Occurrences are materialised as inspection work orders HorizonDays ahead.
+// UpdatesDeviceDates makes completing those work orders advance the device
+// inspection dates, as a full inspection would.
+type InspectionSchedule struct {
+	ID                 uint                `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name               string              `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	CustomerID         uint                `gorm:"index;not null" json:"customer_id"`
+	FloorPlanID        *uint               `gorm:"index" json:"floor_plan_id" validate:"omitempty"`
+	StationID          *uint               `gorm:"index" json:"station_id" validate:"omitempty"`
+	RRule              string              `gorm:"type:text;not null" json:"rrule" validate:"required"`
+	StartsAt           time.Time           `gorm:"not null" json:"starts_at" validate:"required"`
+	InspectionType     string              `gorm:"size:50;not null" json:"inspection_type" validate:"required,max=50"`
+	Description        string              `gorm:"type:text" json:"description" validate:"omitempty"`
+	HorizonDays        int                 `gorm:"not null;default:30" json:"horizon_days" validate:"omitempty,gte=1,lte=366"`
+	UpdatesDeviceDates bool                `gorm:"not null;default:false" json:"updates_device_dates"`
+	Paused             bool                `gorm:"not null;default:false" json:"paused"`
+	PausedAt           *time.Time          `json:"paused_at"`
+	CreatedBy          *uint               `json:"created_by" validate:"omitempty"`
+	CreatedAt          time.Time           `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time           `gorm:"autoUpdateTime" json:"updated_at"`
+	Exceptions         []ScheduleException `gorm:"-" json:"exceptions,omitempty"`
+
+	// Facility of the schedule's floor plan or station, when it is on a floor
+	FacilityID   *uint  `gorm:"-" json:"facility_id,omitempty"`
+	FacilityName string `gorm:"-" json:"facility_name,omitempty"`
+}
+
+func (is *InspectionSchedule) Validate() error {
+	return validate.Struct(is)
+}
+
+// ScheduleException skips a single occurrence of a schedule, or moves it to
+// another date when MovedTo is set. OccurrenceAt is the original occurrence.
+type ScheduleException struct {
+	ScheduleID   uint       `gorm:"primaryKey" json:"schedule_id"`
+	OccurrenceAt time.Time  `gorm:"primaryKey" json:"occurrence_at" validate:"required"`
+	MovedTo      *time.Time `json:"moved_to" validate:"omitempty"`
+	Reason       string     `gorm:"type:text" json:"reason" validate:"omitempty"`
+	CreatedBy    *uint      `json:"created_by" validate:"omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (se *ScheduleException) Validate() error {
+	return validate.Struct(se)
+}
+
+type OccurrenceStatus string
+
+const (
+	OccurrenceScheduled OccurrenceStatus = "scheduled"
+	OccurrenceSkipped   OccurrenceStatus = "skipped"
+	OccurrenceMoved     OccurrenceStatus = "moved"
+)
+
+// ScheduleOccurrence is a single occurrence of a schedule. Date is when it
+// is due, which differs from OccurrenceAt when the occurrence was moved.
+type ScheduleOccurrence struct {
+	OccurrenceAt time.Time `json:"occurrence_at"`
+	Date         time.Time `json:"date"`
+	Status       string    `json:"status"`
+	Reason       string    `json:"reason,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobDead      JobStatus = "dead"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Job is a unit of background work stored in the jobs table. A failed job goes
+// back to pending with a later RunAt until it runs out of attempts, at which
+// point it is dead-lettered.
+type Job struct {
+	ID          int64           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Kind        string          `gorm:"size:100;not null;index" json:"kind"`
+	Payload     json.RawMessage `gorm:"type:jsonb" json:"payload"`
+	Status      string          `gorm:"size:20;not null;default:'pending'" json:"status"`
+	Attempts    int             `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int             `gorm:"not null;default:5" json:"max_attempts"`
+	RunAt       time.Time       `gorm:"not null" json:"run_at"`
+	UniqueKey   *string         `gorm:"size:200" json:"unique_key"`
+	LockedBy    *string         `gorm:"size:200" json:"locked_by"`
+	LockedAt    *time.Time      `json:"locked_at"`
+	LastError   string          `gorm:"type:text" json:"last_error"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// JobSchedule enqueues a job of Kind every time its cron expression fires.
+type JobSchedule struct {
+	Name      string          `gorm:"primaryKey;size:100" json:"name"`
+	Cron      string          `gorm:"size:100;not null" json:"cron"`
+	Kind      string          `gorm:"size:100;not null" json:"kind"`
+	Payload   json.RawMessage `gorm:"type:jsonb" json:"payload"`
+	NextRunAt time.Time       `gorm:"not null" json:"next_run_at"`
+	LastRunAt *time.Time      `json:"last_run_at"`
+	CreatedAt time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,339 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aakash-tyagi/linmed/geo"
+)
+
+// LayoutSchemaVersion is the layout schema version this server understands.
+const LayoutSchemaVersion = 1
+
+const (
+	LayoutRoom = "room"
+	LayoutZone = "zone"
+
+	// LayoutStation is the kind of point marking where a station goes
+	LayoutStation = "station"
+)
+
+// Layout is the structured content of FloorPlan.Layout. Width and Height are
+// the size of the floor in metres and Scale is how many floor plan units make
+// a metre; every position in the layout, like station positions, is in floor
+// plan units from the top-left corner.
+type Layout struct {
+	Version int           `json:"version"`
+	Width   float64       `json:"width"`
+	Height  float64       `json:"height"`
+	Scale   float64       `json:"scale"`
+	Rooms   []LayoutArea  `json:"rooms"`
+	Zones   []LayoutArea  `json:"zones"`
+	Walls   []LayoutWall  `json:"walls"`
+	Doors   []LayoutDoor  `json:"doors"`
+	Points  []LayoutPoint `json:"points"`
+}
+
+// LayoutArea is a room or zone. Rooms should not overlap each other; zones,
+// such as a fire compartment, may span rooms.
+type LayoutArea struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Polygon geo.Polygon `json:"polygon"`
+}
+
+// LayoutWall is a straight wall; thickness is in metres.
+type LayoutWall struct {
+	From      geo.Point `json:"from"`
+	To        geo.Point `json:"to"`
+	Thickness float64   `json:"thickness,omitempty"`
+}
+
+// LayoutDoor is an opening in a wall, width metres wide, connecting the rooms
+// listed by id.
+type LayoutDoor struct {
+	ID       string    `json:"id,omitempty"`
+	Position geo.Point `json:"position"`
+	Width    float64   `json:"width"`
+	Rooms    []string  `json:"rooms,omitempty"`
+}
+
+// LayoutPoint is a labelled position on the floor, such as an exit or where
+// a station is meant to go. A station point may name the template its
+// station is provisioned from.
+type LayoutPoint struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label"`
+	Kind       string    `json:"kind,omitempty"`
+	Position   geo.Point `json:"position"`
+	TemplateID *uint     `json:"template_id,omitempty"`
+}
+
+// LayoutError is a problem with one part of a layout. Path points at it, as
+// in "rooms[2].polygon[0].x".
+type LayoutError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// LayoutErrors lists everything wrong with a layout.
+type LayoutErrors []LayoutError
+
+func (e LayoutErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Path + ": " + err.Message
+		if err.Path == "" {
+			messages[i] = err.Message
+		}
+	}
+	return "invalid layout: " + strings.Join(messages, "; ")
+}
+
+// ParseLayout reads and validates a layout.
+func ParseLayout(s string) (*Layout, error) {
+	var layout Layout
+	if err := json.Unmarshal([]byte(s), &layout); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, LayoutErrors{{Path: layoutPath(typeErr.Field), Message: "must be " + jsonTypeName(typeErr.Type)}}
+		}
+		return nil, LayoutErrors{{Message: err.Error()}}
+	}
+
+	if errs := layout.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return &layout, nil
+}
+
+// layoutPath turns a field path from encoding/json, like "rooms.2.polygon",
+// into "rooms[2].polygon".
+func layoutPath(field string) string {
+	parts := strings.Split(field, ".")
+	path := ""
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			path += "[" + part + "]"
+			continue
+		}
+		if path != "" {
+			path += "."
+		}
+		path += part
+	}
+	return path
+}
+
+// jsonTypeName names the JSON type a Go type is read from.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Bool:
+		return "a boolean"
+	default:
+		return "an object"
+	}
+}
+
+// Extent is the size of the floor in floor plan units.
+func (l *Layout) Extent() (float64, float64) {
+	return l.Width * l.Scale, l.Height * l.Scale
+}
+
+// Area returns the room or zone with an id.
+func (l *Layout) Area(kind, id string) *LayoutArea {
+	areas := l.Rooms
+	if kind == LayoutZone {
+		areas = l.Zones
+	}
+	for i := range areas {
+		if areas[i].ID == id {
+			return &areas[i]
+		}
+	}
+	return nil
+}
+
+// FindArea returns the room or zone with an id or, failing that, a name,
+// ignoring case.
+func (l *Layout) FindArea(kind, key string) *LayoutArea {
+	if area := l.Area(kind, key); area != nil {
+		return area
+	}
+
+	areas := l.Rooms
+	if kind == LayoutZone {
+		areas = l.Zones
+	}
+	for i := range areas {
+		if strings.EqualFold(strings.TrimSpace(areas[i].Name), strings.TrimSpace(key)) {
+			return &areas[i]
+		}
+	}
+	return nil
+}
+
+// AreasAt returns the rooms or zones a position lies in.
+func (l *Layout) AreasAt(kind string, p geo.Point) []LayoutArea {
+	areas := l.Rooms
+	if kind == LayoutZone {
+		areas = l.Zones
+	}
+
+	var found []LayoutArea
+	for _, area := range areas {
+		if area.Polygon.Contains(p) {
+			found = append(found, area)
+		}
+	}
+	return found
+}
+
+// StationMarkers returns the points marking where stations go.
+func (l *Layout) StationMarkers() []LayoutPoint {
+	var markers []LayoutPoint
+	for _, point := range l.Points {
+		if point.Kind == LayoutStation {
+			markers = append(markers, point)
+		}
+	}
+	return markers
+}
+
+// Validate checks a layout against the schema.
+func (l *Layout) Validate() LayoutErrors {
+	var errs LayoutErrors
+	fail := func(path, format string, args ...interface{}) {
+		errs = append(errs, LayoutError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if l.Version != LayoutSchemaVersion {
+		fail("version", "unsupported layout version %d, expected %d", l.Version, LayoutSchemaVersion)
+		return errs
+	}
+	if l.Width <= 0 {
+		fail("width", "must be greater than 0")
+	}
+	if l.Height <= 0 {
+		fail("height", "must be greater than 0")
+	}
+	if l.Scale <= 0 {
+		fail("scale", "must be greater than 0")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	width, height := l.Extent()
+	checkPoint := func(path string, p geo.Point) {
+		if p.X < 0 || p.X > width {
+			fail(path+".x", "must be between 0 and %g", width)
+		}
+		if p.Y < 0 || p.Y > height {
+			fail(path+".y", "must be between 0 and %g", height)
+		}
+	}
+
+	checkAreas := func(kind string, areas []LayoutArea) {
+		ids := map[string]bool{}
+		for i, area := range areas {
+			path := fmt.Sprintf("%ss[%d]", kind, i)
+
+			switch {
+			case area.ID == "":
+				fail(path+".id", "is required")
+			case len(area.ID) > 50:
+				fail(path+".id", "must be at most 50 characters")
+			case ids[area.ID]:
+				fail(path+".id", "duplicate %s id %q", kind, area.ID)
+			}
+			ids[area.ID] = true
+
+			if area.Name == "" {
+				fail(path+".name", "is required")
+			} else if len(area.Name) > 100 {
+				fail(path+".name", "must be at most 100 characters")
+			}
+
+			if len(area.Polygon) < 3 {
+				fail(path+".polygon", "needs at least 3 points")
+				continue
+			}
+			for j, p := range area.Polygon {
+				checkPoint(fmt.Sprintf("%s.polygon[%d]", path, j), p)
+			}
+			if area.Polygon.SelfIntersects() {
+				fail(path+".polygon", "must not cross itself")
+			} else if area.Polygon.Area() == 0 {
+				fail(path+".polygon", "must enclose an area")
+			}
+		}
+	}
+	checkAreas(LayoutRoom, l.Rooms)
+	checkAreas(LayoutZone, l.Zones)
+
+	for i, wall := range l.Walls {
+		path := fmt.Sprintf("walls[%d]", i)
+		checkPoint(path+".from", wall.From)
+		checkPoint(path+".to", wall.To)
+		if wall.From == wall.To {
+			fail(path, "from and to must differ")
+		}
+		if wall.Thickness < 0 {
+			fail(path+".thickness", "must not be negative")
+		}
+	}
+
+	for i, door := range l.Doors {
+		path := fmt.Sprintf("doors[%d]", i)
+		checkPoint(path+".position", door.Position)
+		if door.Width <= 0 {
+			fail(path+".width", "must be greater than 0")
+		}
+		for j, room := range door.Rooms {
+			if l.Area(LayoutRoom, room) == nil {
+				fail(fmt.Sprintf("%s.rooms[%d]", path, j), "unknown room %q", room)
+			}
+		}
+	}
+
+	ids := map[string]bool{}
+	for i, point := range l.Points {
+		path := fmt.Sprintf("points[%d]", i)
+		switch {
+		case point.ID == "":
+			fail(path+".id", "is required")
+		case len(point.ID) > 50:
+			fail(path+".id", "must be at most 50 characters")
+		case ids[point.ID]:
+			fail(path+".id", "duplicate point id %q", point.ID)
+		}
+		ids[point.ID] = true
+
+		if point.Label == "" {
+			fail(path+".label", "is required")
+		} else if len(point.Label) > 100 {
+			fail(path+".label", "must be at most 100 characters")
+		}
+		if len(point.Kind) > 50 {
+			fail(path+".kind", "must be at most 50 characters")
+		}
+		if point.TemplateID != nil && point.Kind != LayoutStation {
+			fail(path+".template_id", "only %s points take a template", LayoutStation)
+		}
+		checkPoint(path+".position", point.Position)
+	}
+
+	return errs
+}
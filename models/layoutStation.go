@@ -0,0 +1,185 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/geo"
+)
+
+// Changes made to a station to match its layout marker.
+const (
+	MarkerLinked  = "linked"
+	MarkerMoved   = "moved"
+	MarkerRenamed = "renamed"
+)
+
+// Reasons a station of a floor plan has no marker on its layout.
+const (
+	OrphanMarkerRemoved = "marker_removed"
+	OrphanNoMarker      = "no_marker"
+)
+
+// ReconcileLayout brings a floor plan's stations in line with the station
+// markers of its layout. With DryRun nothing is changed and the planned
+// changes are returned. Stations created from a marker naming a template
+// have their devices installed on InstalledDate, by default today.
+type ReconcileLayout struct {
+	DryRun          bool       `json:"dry_run"`
+	InstalledDate   *time.Time `json:"installed_date" validate:"omitempty"`
+	StockLocationID *uint      `json:"stock_location_id" validate:"omitempty"`
+}
+
+func (r *ReconcileLayout) Validate() error {
+	return validate.Struct(r)
+}
+
+// MarkerStation is a station created or changed to match a layout marker.
+// StationID and Code are empty for a station not yet created. From is where
+// a moved station was; Room and Zone are those of its new position.
+type MarkerStation struct {
+	MarkerID   string     `json:"marker_id"`
+	StationID  uint       `json:"station_id,omitempty"`
+	Code       string     `json:"code,omitempty"`
+	Name       string     `json:"name"`
+	OldName    string     `json:"old_name,omitempty"`
+	TemplateID *uint      `json:"template_id,omitempty"`
+	Position   geo.Point  `json:"position"`
+	From       *geo.Point `json:"from,omitempty"`
+	Room       string     `json:"room,omitempty"`
+	Zone       string     `json:"zone,omitempty"`
+	Changes    []string   `json:"changes,omitempty"`
+	DeviceIDs  []uint     `json:"device_ids,omitempty"`
+}
+
+// OrphanStation is a station of the floor plan no layout marker stands for.
+// Orphans are reported, never removed.
+type OrphanStation struct {
+	StationID uint   `json:"station_id"`
+	Name      string `json:"name"`
+	MarkerID  string `json:"marker_id,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// LayoutReconciliation is what reconciling a layout did, or would do on a
+// dry run. Revision is the floor plan revision recorded for the change.
+type LayoutReconciliation struct {
+	FloorPlanID uint            `json:"floor_plan_id"`
+	DryRun      bool            `json:"dry_run"`
+	Revision    *int            `json:"revision,omitempty"`
+	Created     []MarkerStation `json:"created"`
+	Updated     []MarkerStation `json:"updated"`
+	Unchanged   int             `json:"unchanged"`
+	Orphans     []OrphanStation `json:"orphans"`
+}
+
+// PlanLayoutStations matches a layout's station markers to the floor plan's
+// stations. A marker goes with the station placed from it, or else with the
+// nearest station of the same name not placed from any marker. Markers
+// without a station are to be created; matched stations that are elsewhere
+// or named otherwise are to be updated.
+func PlanLayoutStations(floorPlanID uint, layout *Layout, stations []Station) LayoutReconciliation {
+	plan := LayoutReconciliation{
+		FloorPlanID: floorPlanID,
+		Created:     []MarkerStation{},
+		Updated:     []MarkerStation{},
+		Orphans:     []OrphanStation{},
+	}
+
+	byMarker := map[string]int{}
+	byName := map[string][]int{}
+	for i, station := range stations {
+		if station.LayoutPointID != "" {
+			byMarker[station.LayoutPointID] = i
+		} else {
+			name := strings.ToLower(strings.TrimSpace(station.Name))
+			byName[name] = append(byName[name], i)
+		}
+	}
+
+	matched := make([]bool, len(stations))
+	for _, marker := range layout.StationMarkers() {
+		change := MarkerStation{
+			MarkerID:   marker.ID,
+			Name:       marker.Label,
+			TemplateID: marker.TemplateID,
+			Position:   marker.Position,
+		}
+		if rooms := layout.AreasAt(LayoutRoom, marker.Position); len(rooms) > 0 {
+			change.Room = rooms[0].Name
+		}
+		if zones := layout.AreasAt(LayoutZone, marker.Position); len(zones) > 0 {
+			change.Zone = zones[0].Name
+		}
+
+		i, ok := byMarker[marker.ID]
+		if !ok {
+			i, ok = nearestByName(stations, byName[strings.ToLower(strings.TrimSpace(marker.Label))], matched, marker.Position)
+			if ok {
+				change.Changes = append(change.Changes, MarkerLinked)
+			}
+		}
+		if !ok {
+			plan.Created = append(plan.Created, change)
+			continue
+		}
+
+		matched[i] = true
+		station := stations[i]
+		change.StationID = station.ID
+		change.Code = station.Code
+		change.TemplateID = station.TemplateID
+
+		if station.LocationX == nil || station.LocationY == nil ||
+			*station.LocationX != marker.Position.X || *station.LocationY != marker.Position.Y {
+			change.Changes = append(change.Changes, MarkerMoved)
+			if station.LocationX != nil && station.LocationY != nil {
+				change.From = &geo.Point{X: *station.LocationX, Y: *station.LocationY}
+			}
+		}
+		if station.Name != marker.Label {
+			change.Changes = append(change.Changes, MarkerRenamed)
+			change.OldName = station.Name
+		}
+
+		if len(change.Changes) == 0 {
+			plan.Unchanged++
+			continue
+		}
+		plan.Updated = append(plan.Updated, change)
+	}
+
+	for i, station := range stations {
+		if matched[i] {
+			continue
+		}
+		orphan := OrphanStation{StationID: station.ID, Name: station.Name, Reason: OrphanNoMarker}
+		if station.LayoutPointID != "" {
+			orphan.MarkerID = station.LayoutPointID
+			orphan.Reason = OrphanMarkerRemoved
+		}
+		plan.Orphans = append(plan.Orphans, orphan)
+	}
+
+	return plan
+}
+
+// nearestByName picks, of the stations at candidates not yet matched, the
+// one closest to p; unplaced stations come last.
+func nearestByName(stations []Station, candidates []int, matched []bool, p geo.Point) (int, bool) {
+	best, bestDistance := -1, math.Inf(1)
+	for _, i := range candidates {
+		if matched[i] {
+			continue
+		}
+		distance := math.MaxFloat64
+		if stations[i].LocationX != nil && stations[i].LocationY != nil {
+			distance = geo.Distance(p, geo.Point{X: *stations[i].LocationX, Y: *stations[i].LocationY})
+		}
+		if distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return best, best >= 0
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+type OrderStatus string
+
+const (
+	OrderDraft     OrderStatus = "draft"
+	OrderSubmitted OrderStatus = "submitted"
+	OrderFulfilled OrderStatus = "fulfilled"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+// orderTransitions lists the statuses an order can move to from each status.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderDraft:     {OrderSubmitted, OrderCancelled},
+	OrderSubmitted: {OrderFulfilled, OrderCancelled},
+}
+
+// CanTransition reports whether an order may move from one status to another.
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Order is a purchase or replenishment order raised for a customer. When
+// StockLocationID is set, fulfilling the order receives its items into that
+// stock location.
+type Order struct {
+	ID              uint        `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID      uint        `gorm:"index;not null" json:"customer_id" validate:"required"`
+	CustomerName    string      `gorm:"-" json:"customer_name,omitempty"`
+	OrderedBy       *uint       `json:"ordered_by" validate:"omitempty"`
+	Status          string      `gorm:"size:20;not null;default:'draft'" json:"status"`
+	TotalAmount     float64     `gorm:"not null;default:0" json:"total_amount"`
+	StockLocationID *uint       `json:"stock_location_id" validate:"omitempty"`
+	Notes           string      `gorm:"type:text" json:"notes" validate:"omitempty"`
+	SubmittedAt     *time.Time  `json:"submitted_at"`
+	FulfilledAt     *time.Time  `json:"fulfilled_at"`
+	CancelledAt     *time.Time  `json:"cancelled_at"`
+	CreatedAt       time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
+	Items           []OrderItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items" validate:"dive"`
+}
+
+func (o *Order) Validate() error {
+	return validate.Struct(o)
+}
+
+// OrderItem is a line on an order. UnitPrice is copied from the product when
+// the line is added, so later price changes do not alter existing orders.
+// StationProductID links the line to the device it replaces or refills.
+type OrderItem struct {
+	ID               uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID          uint    `gorm:"index;not null" json:"order_id"`
+	ProductID        uint    `gorm:"index;not null" json:"product_id" validate:"required"`
+	ProductName      string  `gorm:"-" json:"product_name,omitempty"`
+	Quantity         int     `gorm:"not null" json:"quantity" validate:"required,gt=0"`
+	UnitPrice        float64 `gorm:"not null" json:"unit_price"`
+	LineTotal        float64 `gorm:"not null" json:"line_total"`
+	StationProductID *uint   `gorm:"index" json:"station_product_id" validate:"omitempty"`
+	Purpose          string  `gorm:"size:20" json:"purpose" validate:"omitempty,oneof=replace refill"`
+}
+
+func (i *OrderItem) Validate() error {
+	return validate.Struct(i)
+}
+
+// OrderStatusUpdate is the body used to move an order through its workflow.
+type OrderStatusUpdate struct {
+	Status    string `json:"status" validate:"required,oneof=submitted fulfilled cancelled"`
+	UpdatedBy *uint  `json:"updated_by" validate:"omitempty"`
+}
+
+func (u *OrderStatusUpdate) Validate() error {
+	return validate.Struct(u)
+}
@@ -24,6 +24,11 @@ type Product struct {
 	Children       []Product `gorm:"foreignKey:ParentID" json:"children" validate:"omitempty"`
 	CategoryID     *uint     `gorm:"index" json:"category_id" validate:"required"`
 	CategoryName   string    `gorm:"-" json:"category_name"`
+
+	// Days between inspections and expected lifetime in months, used to
+	// advance device dates when a work order is completed
+	ServiceIntervalDays *int `json:"service_interval_days" validate:"omitempty,gt=0"`
+	LifetimeMonths      *int `json:"lifetime_months" validate:"omitempty,gt=0"`
 }
 
 func (p *Product) Validate() error {
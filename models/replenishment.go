@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ReplenishmentSuggestion is the suggested purchase quantity of one product.
+// StockOnHand is nil when no stock is tracked for the product.
+type ReplenishmentSuggestion struct {
+	ProductID          uint    `json:"product_id"`
+	ProductName        string  `json:"product_name"`
+	ExpiringDevices    int     `json:"expiring_devices"`
+	ComponentsToRefill int     `json:"components_to_refill"`
+	RequiredQuantity   int     `json:"required_quantity"`
+	StockOnHand        *int    `json:"stock_on_hand"`
+	SuggestedQuantity  int     `json:"suggested_quantity"`
+	UnitPrice          float64 `json:"unit_price"`
+	EstimatedCost      float64 `json:"estimated_cost"`
+}
+
+type ReplenishmentReport struct {
+	HorizonDays        int                       `json:"horizon_days"`
+	CustomerID         *uint                     `json:"customer_id"`
+	LocationID         *uint                     `json:"location_id"`
+	FacilityID         *uint                     `json:"facility_id"`
+	GeneratedAt        time.Time                 `json:"generated_at"`
+	TotalEstimatedCost float64                   `json:"total_estimated_cost"`
+	Suggestions        []ReplenishmentSuggestion `json:"suggestions"`
+}
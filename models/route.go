@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// RouteRequest asks for a walking route through a customer's devices. When
+// DeviceIDs is empty every device due for inspection or replacement within
+// DueWithinDays is visited. FacilityID keeps the route to the stations of
+// one facility.
+type RouteRequest struct {
+	DeviceIDs     []uint `json:"device_ids" validate:"omitempty"`
+	DueWithinDays int    `json:"due_within_days" validate:"gte=0"`
+	FacilityID    *uint  `json:"facility_id" validate:"omitempty"`
+}
+
+func (rr *RouteRequest) Validate() error {
+	return validate.Struct(rr)
+}
+
+// Units route distances are given in: metres on a floor plan whose layout
+// has a scale, floor plan units on any other.
+const (
+	RouteMetres         = "m"
+	RouteFloorPlanUnits = "floor_plan_units"
+)
+
+// RouteItinerary is a walking route through a customer's stations, one floor
+// at a time. TotalDistance adds up the floors measured in metres and
+// UnscaledDistance those that can only be measured in floor plan units.
+type RouteItinerary struct {
+	CustomerID       uint         `json:"customer_id"`
+	TotalDistance    float64      `json:"total_distance"`
+	UnscaledDistance float64      `json:"unscaled_distance,omitempty"`
+	Floors           []FloorRoute `json:"floors"`
+}
+
+// FloorRoute is the ordered visit of the stations on one floor plan.
+// Stations without coordinates cannot be routed and are listed in Unplaced.
+// Floors come grouped by the facility they are in. Units is what Distance
+// and the leg distances are in; Scale is that of the floor plan's layout,
+// if it has one.
+type FloorRoute struct {
+	FloorPlanID   *uint       `json:"floor_plan_id"`
+	FloorPlanName string      `json:"floor_plan_name"`
+	Distance      float64     `json:"distance"`
+	Units         string      `json:"units"`
+	Scale         float64     `json:"-"`
+	Stops         []RouteStop `json:"stops"`
+	Unplaced      []RouteStop `json:"unplaced,omitempty"`
+
+	// Facility of the floor plan, when it is on a floor
+	FacilityID   *uint  `json:"facility_id,omitempty"`
+	FacilityName string `json:"facility_name,omitempty"`
+}
+
+// RouteStop is a station on the route. LegDistance is the walk from the
+// previous stop.
+type RouteStop struct {
+	Sequence    int           `json:"sequence"`
+	StationID   uint          `json:"station_id"`
+	StationName string        `json:"station_name"`
+	LocationX   *float64      `json:"location_x"`
+	LocationY   *float64      `json:"location_y"`
+	LegDistance float64       `json:"leg_distance"`
+	Devices     []RouteDevice `json:"devices"`
+}
+
+// RouteDevice is a device to service at a stop.
+type RouteDevice struct {
+	StationProductID uint      `json:"station_product_id"`
+	ProductName      string    `json:"product_name"`
+	Task             string    `json:"task"`
+	DueDate          time.Time `json:"due_date"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Kinds of date a device falls due on.
+const (
+	DueInspection = "inspection"
+	DueExpiry     = "expiry"
+)
+
+// Outcomes of a due date under an SLA target.
+const (
+	SLAMet      = "met"
+	SLABreached = "breached"
+	SLAPending  = "pending"
+)
+
+// SLATarget is a customer's service level for one kind of due date: the work
+// is to be done within WithinDays of the date, for at least TargetPercent of
+// the dates falling due.
+type SLATarget struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID    uint      `gorm:"uniqueIndex:idx_sla_customer_kind;not null" json:"customer_id"`
+	Kind          string    `gorm:"uniqueIndex:idx_sla_customer_kind;size:20;not null" json:"kind" validate:"required,oneof=inspection expiry"`
+	WithinDays    int       `gorm:"not null" json:"within_days" validate:"gte=0,lte=365"`
+	TargetPercent float64   `gorm:"not null" json:"target_percent" validate:"gt=0,lte=100"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (t *SLATarget) Validate() error {
+	return validate.Struct(t)
+}
+
+// OverdueTask is a device whose inspection or expiry date has passed without
+// the service that satisfies it.
+type OverdueTask struct {
+	Kind             string    `json:"kind"`
+	DueDate          time.Time `json:"due_date"`
+	DaysOverdue      int       `json:"days_overdue"`
+	StationProductID uint      `json:"station_product_id"`
+	ProductName      string    `json:"product_name"`
+	StationID        uint      `json:"station_id"`
+	StationName      string    `json:"station_name"`
+	FloorPlanName    string    `json:"floor_plan_name"`
+	CustomerID       uint      `json:"customer_id"`
+	CustomerName     string    `json:"customer_name"`
+	FacilityID       *uint     `json:"facility_id"`
+	FacilityName     string    `json:"facility_name,omitempty"`
+}
+
+// SLABreach is a due date whose service was late, or is already late and
+// still outstanding when ServicedAt is empty.
+type SLABreach struct {
+	Kind             string     `json:"kind"`
+	DueDate          time.Time  `json:"due_date"`
+	Deadline         time.Time  `json:"deadline"`
+	ServicedAt       *time.Time `json:"serviced_at"`
+	DaysLate         int        `json:"days_late"`
+	WithinDays       int        `json:"within_days"`
+	StationProductID uint       `json:"station_product_id"`
+	ProductName      string     `json:"product_name"`
+	StationID        uint       `json:"station_id"`
+	StationName      string     `json:"station_name"`
+	CustomerID       uint       `json:"customer_id"`
+	CustomerName     string     `json:"customer_name"`
+	FacilityID       *uint      `json:"facility_id"`
+	FacilityName     string     `json:"facility_name,omitempty"`
+}
+
+// SLAPeriod counts the dates that fell due in a period by outcome.
+// CompliancePercent is the share met of those already decided, and is empty
+// while none are.
+type SLAPeriod struct {
+	Start             time.Time `json:"start"`
+	End               time.Time `json:"end"`
+	Due               int       `json:"due"`
+	Met               int       `json:"met"`
+	Breached          int       `json:"breached"`
+	Pending           int       `json:"pending"`
+	CompliancePercent *float64  `json:"compliance_percent"`
+	MeetsTarget       *bool     `json:"meets_target"`
+}
+
+// SLACompliance is a customer's compliance with one SLA target over time.
+type SLACompliance struct {
+	Target  SLATarget   `json:"target"`
+	Periods []SLAPeriod `json:"periods"`
+	Overall SLAPeriod   `json:"overall"`
+}
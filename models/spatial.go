@@ -0,0 +1,120 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/aakash-tyagi/linmed/geo"
+)
+
+// SpatialStation is a placed station found by a spatial query. Distance is
+// in metres from where the query measured, and omitted where nothing is
+// measured; Room and Zones are the layout areas the station is in.
+type SpatialStation struct {
+	ID        uint     `json:"id"`
+	Name      string   `json:"name"`
+	Code      string   `json:"code"`
+	LocationX float64  `json:"location_x"`
+	LocationY float64  `json:"location_y"`
+	Room      string   `json:"room,omitempty"`
+	Zones     []string `json:"zones,omitempty"`
+	Distance  *float64 `json:"distance,omitempty"`
+}
+
+// Position is where the station is on the floor plan.
+func (s SpatialStation) Position() geo.Point {
+	return geo.Point{X: s.LocationX, Y: s.LocationY}
+}
+
+// NearestStations is the stations closest to a position on a floor plan,
+// nearest first. Room is set when the position is the centre of a room.
+type NearestStations struct {
+	FloorPlanID uint             `json:"floor_plan_id"`
+	From        geo.Point        `json:"from"`
+	Room        *LayoutArea      `json:"room,omitempty"`
+	Stations    []SpatialStation `json:"stations"`
+}
+
+// ZoneStations is the stations standing within a zone of a floor plan.
+type ZoneStations struct {
+	FloorPlanID uint             `json:"floor_plan_id"`
+	Zone        LayoutArea       `json:"zone"`
+	Stations    []SpatialStation `json:"stations"`
+}
+
+// StationDistance is the straight-line distance between two stations, in
+// metres and in floor plan units.
+type StationDistance struct {
+	FloorPlanID   uint    `json:"floor_plan_id"`
+	FromStationID uint    `json:"from_station_id"`
+	ToStationID   uint    `json:"to_station_id"`
+	Distance      float64 `json:"distance"`
+	Units         float64 `json:"units"`
+}
+
+// LocateStations sets the room and zones of each station from the layout.
+func (l *Layout) LocateStations(stations []SpatialStation) {
+	for i := range stations {
+		position := stations[i].Position()
+		if rooms := l.AreasAt(LayoutRoom, position); len(rooms) > 0 {
+			stations[i].Room = rooms[0].Name
+		}
+		for _, zone := range l.AreasAt(LayoutZone, position) {
+			stations[i].Zones = append(stations[i].Zones, zone.Name)
+		}
+	}
+}
+
+// NearestTo returns at most n of the stations, nearest to p first, with
+// their distance from p in metres. Stations equally far keep their order.
+func (l *Layout) NearestTo(p geo.Point, stations []SpatialStation, n int) []SpatialStation {
+	nearest := make([]SpatialStation, len(stations))
+	copy(nearest, stations)
+
+	units := make([]float64, len(nearest))
+	for i := range nearest {
+		units[i] = geo.Distance(p, nearest[i].Position())
+		distance := units[i] / l.Scale
+		nearest[i].Distance = &distance
+	}
+	sort.Stable(byDistance{nearest, units})
+
+	if len(nearest) > n {
+		nearest = nearest[:n]
+	}
+	return nearest
+}
+
+// Within returns the stations inside or on the edge of an area.
+func (a LayoutArea) Within(stations []SpatialStation) []SpatialStation {
+	within := []SpatialStation{}
+	for _, station := range stations {
+		if a.Polygon.Contains(station.Position()) {
+			within = append(within, station)
+		}
+	}
+	return within
+}
+
+// Distance measures between two stations using the layout's scale.
+func (l *Layout) Distance(from, to SpatialStation) StationDistance {
+	units := geo.Distance(from.Position(), to.Position())
+	return StationDistance{
+		FromStationID: from.ID,
+		ToStationID:   to.ID,
+		Distance:      units / l.Scale,
+		Units:         units,
+	}
+}
+
+// byDistance sorts stations by their distance in floor plan units.
+type byDistance struct {
+	stations []SpatialStation
+	units    []float64
+}
+
+func (d byDistance) Len() int           { return len(d.stations) }
+func (d byDistance) Less(i, j int) bool { return d.units[i] < d.units[j] }
+func (d byDistance) Swap(i, j int) {
+	d.stations[i], d.stations[j] = d.stations[j], d.stations[i]
+	d.units[i], d.units[j] = d.units[j], d.units[i]
+}
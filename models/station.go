@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Station Model
 type Station struct {
@@ -12,8 +15,86 @@ type Station struct {
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 	Products    []Product `gorm:"foreignKey:StationID;constraint:OnDelete:CASCADE;OnUpdate:CASCADE" json:"products"`
+
+	// Position on the floor plan, in floor plan units from the top-left corner
+	LocationX *float64 `json:"location_x" validate:"omitempty,gte=0"`
+	LocationY *float64 `json:"location_y" validate:"omitempty,gte=0"`
+
+	// Incremented on every change; used to detect sync conflicts
+	Version int `gorm:"not null;default:1" json:"version,omitempty"`
+
+	// Orientation on the floor plan in degrees clockwise, and the zone and
+	// room the station is in
+	Rotation *float64 `json:"rotation" validate:"omitempty,gte=0,lt=360"`
+	Zone     string   `gorm:"size:100" json:"zone" validate:"omitempty,max=100"`
+	Room     string   `gorm:"size:100" json:"room" validate:"omitempty,max=100"`
+
+	// Short code printed on the station's QR label; assigned on creation
+	// and never changed
+	Code string `gorm:"size:16;uniqueIndex" json:"code"`
+
+	// Template the station was provisioned from
+	TemplateID *uint `gorm:"index" json:"template_id,omitempty"`
+
+	// Id of the layout point the station was placed from
+	LayoutPointID string `gorm:"size:50" json:"layout_point_id,omitempty"`
 }
 
 func (s *Station) Validate() error {
 	return validate.Struct(s)
 }
+
+// StationPosition places a station on its floor plan. Rotation, zone and
+// room keep their value when left out.
+type StationPosition struct {
+	StationID uint     `json:"station_id" validate:"required"`
+	LocationX *float64 `json:"location_x" validate:"required,gte=0"`
+	LocationY *float64 `json:"location_y" validate:"required,gte=0"`
+	Rotation  *float64 `json:"rotation" validate:"omitempty,gte=0,lt=360"`
+	Zone      *string  `json:"zone" validate:"omitempty,max=100"`
+	Room      *string  `json:"room" validate:"omitempty,max=100"`
+}
+
+// RepositionStations moves stations of a floor plan at once, after its
+// layout was edited. Either every position is applied or none is.
+type RepositionStations struct {
+	Positions []StationPosition `json:"positions" validate:"required,min=1,max=1000,dive"`
+}
+
+func (r *RepositionStations) Validate() error {
+	if err := validate.Struct(r); err != nil {
+		return err
+	}
+
+	seen := map[uint]bool{}
+	for _, position := range r.Positions {
+		if seen[position.StationID] {
+			return fmt.Errorf("station %d is positioned twice", position.StationID)
+		}
+		seen[position.StationID] = true
+	}
+	return nil
+}
+
+// StationLabel is what a station's printed label shows.
+type StationLabel struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Code string `json:"code"`
+	Room string `json:"room,omitempty"`
+	Zone string `json:"zone,omitempty"`
+}
+
+// StationScan is what a technician sees on scanning a station's label: the
+// station and where it is, its devices, and its open work orders and
+// overdue inspections and expiries.
+type StationScan struct {
+	Station       Station          `json:"station"`
+	CustomerName  string           `json:"customer_name"`
+	FloorPlanName string           `json:"floor_plan_name,omitempty"`
+	FacilityID    *uint            `json:"facility_id,omitempty"`
+	FacilityName  string           `json:"facility_name,omitempty"`
+	Devices       []StationProduct `json:"devices"`
+	WorkOrders    []WorkOrder      `json:"work_orders"`
+	OverdueTasks  []OverdueTask    `json:"overdue_tasks"`
+}
@@ -21,6 +21,10 @@ type StationProduct struct {
 	ChildProduct2ID  *uint `gorm:"index" json:"child_product_2_id" validate:"omitempty"`
 	ChildProduct2Qty *int  `gorm:"not null;default:0" json:"child_product_2_qty" validate:"omitempty,gte=0"`
 
+	// Minimum component quantities; a component below its minimum is running low
+	ChildProduct1MinQty int `gorm:"not null;default:0" json:"child_product_1_min_qty" validate:"gte=0"`
+	ChildProduct2MinQty int `gorm:"not null;default:0" json:"child_product_2_min_qty" validate:"gte=0"`
+
 	// Relations
 	Station  *Station  `gorm:"foreignKey:StationID" json:"-"`
 	Product  *Product  `gorm:"foreignKey:ProductID" json:"-"`
@@ -31,6 +35,21 @@ type StationProduct struct {
 
 	ProductName  string `json:"product_name,omitempty"`
 	CustomerName string `json:"customer_name,omitempty"`
+
+	// Stock location the components are issued from when the device is installed
+	StockLocationID *uint `gorm:"-" json:"stock_location_id,omitempty" validate:"omitempty"`
+
+	// Set when the device fails a checklist item; cleared by a passing
+	// checklist or a completed follow-up work order
+	NeedsAttention  bool   `gorm:"not null;default:false" json:"needs_attention"`
+	AttentionReason string `gorm:"type:text" json:"attention_reason,omitempty"`
+
+	// Incremented on every change; used to detect sync conflicts
+	Version int `gorm:"not null;default:1" json:"version,omitempty"`
+
+	// Facility of the device's station, when its floor plan is on a floor
+	FacilityID   *uint  `gorm:"-" json:"facility_id,omitempty"`
+	FacilityName string `gorm:"-" json:"facility_name,omitempty"`
 }
 
 func (sp *StationProduct) Validate() error {
@@ -49,3 +68,33 @@ type ExpiringProductResponse struct {
 	CustomerName   string    `json:"customer_name"`
 	ProductName    string    `json:"product_name"`
 }
+
+// StationProductMove records a device being reassigned from one station to
+// another. The device keeps its id, so everything keyed on it stays attached.
+type StationProductMove struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	StationProductID uint      `gorm:"index;not null" json:"station_product_id"`
+	FromStationID    uint      `gorm:"not null" json:"from_station_id"`
+	ToStationID      uint      `gorm:"not null" json:"to_station_id"`
+	FromFloorPlanID  *uint     `json:"from_floor_plan_id"`
+	ToFloorPlanID    *uint     `json:"to_floor_plan_id"`
+	FromCustomerID   uint      `gorm:"not null" json:"from_customer_id"`
+	ToCustomerID     uint      `gorm:"not null" json:"to_customer_id"`
+	MovedBy          uint      `gorm:"not null" json:"moved_by"`
+	Reason           string    `gorm:"type:text;not null" json:"reason"`
+	MovedAt          time.Time `gorm:"autoCreateTime" json:"moved_at"`
+}
+
+// MoveStationProductRequest is the body of a device move. Moves to a station
+// of another customer are rejected unless AllowCrossCustomer is set and the
+// user performing the move is an admin.
+type MoveStationProductRequest struct {
+	ToStationID        uint   `json:"to_station_id" validate:"required"`
+	MovedBy            uint   `json:"moved_by" validate:"required"`
+	Reason             string `json:"reason" validate:"required"`
+	AllowCrossCustomer bool   `json:"allow_cross_customer"`
+}
+
+func (m *MoveStationProductRequest) Validate() error {
+	return validate.Struct(m)
+}
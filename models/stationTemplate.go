@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// StationTemplate is a standard station configuration, such as a first-aid
+// point with a kit, an eyewash and refill packs, that stations are
+// provisioned from. A template without a customer is offered to every
+// customer.
+type StationTemplate struct {
+	ID          uint                    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string                  `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	StationType string                  `gorm:"size:50;not null" json:"station_type" validate:"required,max=50"`
+	Description string                  `gorm:"type:text" json:"description" validate:"omitempty"`
+	CustomerID  *uint                   `gorm:"index" json:"customer_id" validate:"omitempty"`
+	CreatedAt   time.Time               `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time               `gorm:"autoUpdateTime" json:"updated_at"`
+	Devices     []StationTemplateDevice `gorm:"-" json:"devices,omitempty" validate:"required,min=1,max=50,dive"`
+}
+
+// Validate checks the template, counting a device left without a quantity
+// once.
+func (t *StationTemplate) Validate() error {
+	for i := range t.Devices {
+		if t.Devices[i].Quantity == 0 {
+			t.Devices[i].Quantity = 1
+		}
+	}
+	if err := validate.Struct(t); err != nil {
+		return err
+	}
+
+	for _, device := range t.Devices {
+		if device.ChildProduct1ID == nil && (device.ChildProduct1Qty > 0 || device.ChildProduct1MinQty > 0) ||
+			device.ChildProduct2ID == nil && (device.ChildProduct2Qty > 0 || device.ChildProduct2MinQty > 0) {
+			return errors.New("component quantities need the component's product")
+		}
+	}
+	return nil
+}
+
+// StationTemplateDevice is a device a template installs Quantity times,
+// with the components it is filled with.
+type StationTemplateDevice struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID  uint   `gorm:"index;not null" json:"template_id"`
+	ProductID   uint   `gorm:"not null" json:"product_id" validate:"required"`
+	ProductName string `gorm:"-" json:"product_name,omitempty"`
+	Quantity    int    `gorm:"not null;default:1" json:"quantity" validate:"gte=1,lte=20"`
+
+	ChildProduct1ID     *uint `json:"child_product_1_id" validate:"omitempty"`
+	ChildProduct1Qty    int   `gorm:"not null;default:0" json:"child_product_1_qty" validate:"gte=0"`
+	ChildProduct1MinQty int   `gorm:"not null;default:0" json:"child_product_1_min_qty" validate:"gte=0"`
+	ChildProduct2ID     *uint `json:"child_product_2_id" validate:"omitempty"`
+	ChildProduct2Qty    int   `gorm:"not null;default:0" json:"child_product_2_qty" validate:"gte=0"`
+	ChildProduct2MinQty int   `gorm:"not null;default:0" json:"child_product_2_min_qty" validate:"gte=0"`
+}
+
+// ProvisionStation creates a station on a floor plan from a template, with
+// the template's devices installed on InstalledDate. Description defaults
+// to the template's.
+type ProvisionStation struct {
+	TemplateID    uint      `json:"template_id" validate:"required"`
+	Name          string    `json:"name" validate:"required,max=100"`
+	Description   string    `json:"description" validate:"omitempty"`
+	InstalledDate time.Time `json:"installed_date" validate:"required"`
+	LocationX     *float64  `json:"location_x" validate:"omitempty,gte=0"`
+	LocationY     *float64  `json:"location_y" validate:"omitempty,gte=0"`
+	Rotation      *float64  `json:"rotation" validate:"omitempty,gte=0,lt=360"`
+	Zone          string    `json:"zone" validate:"omitempty,max=100"`
+	Room          string    `json:"room" validate:"omitempty,max=100"`
+
+	// Stock location the components are issued from
+	StockLocationID *uint `json:"stock_location_id" validate:"omitempty"`
+}
+
+func (p *ProvisionStation) Validate() error {
+	return validate.Struct(p)
+}
+
+// ProvisionedStation is the station provisioning created and its devices.
+type ProvisionedStation struct {
+	StationID uint   `json:"station_id"`
+	Code      string `json:"code"`
+	DeviceIDs []uint `json:"device_ids"`
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type StockLocationType string
+
+const (
+	WarehouseLocation StockLocationType = "warehouse"
+	VanLocation       StockLocationType = "van"
+)
+
+type StockMovementType string
+
+const (
+	StockReceipt     StockMovementType = "receipt"
+	StockIssue       StockMovementType = "issue"
+	StockTransfer    StockMovementType = "transfer"
+	StockTransferIn  StockMovementType = "transfer_in"
+	StockTransferOut StockMovementType = "transfer_out"
+	StockAdjustment  StockMovementType = "adjustment"
+)
+
+// StockLocation is a place consumables are held, e.g. a warehouse or a
+// technician's van.
+type StockLocation struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name" validate:"required"`
+	Type      string    `gorm:"size:20;not null" json:"type" validate:"required,oneof=warehouse van"`
+	UserID    *uint     `gorm:"index" json:"user_id" validate:"omitempty"` // technician the van belongs to
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (l *StockLocation) Validate() error {
+	return validate.Struct(l)
+}
+
+// StockLevel is the running balance of a product at a location, kept in step
+// with the ledger in stock_movements.
+type StockLevel struct {
+	ProductID        uint      `gorm:"primaryKey" json:"product_id"`
+	ProductName      string    `gorm:"-" json:"product_name"`
+	LocationID       uint      `gorm:"primaryKey" json:"location_id"`
+	LocationName     string    `gorm:"-" json:"location_name"`
+	Quantity         int       `gorm:"not null;default:0" json:"quantity"`
+	ReorderThreshold int       `gorm:"not null;default:0" json:"reorder_threshold"`
+	ReorderQuantity  int       `gorm:"not null;default:0" json:"reorder_quantity"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// StockMovement is a single ledger entry. Quantity is signed: receipts and
+// transfers in are positive, issues and transfers out are negative.
+type StockMovement struct {
+	ID                    uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID             uint      `gorm:"index;not null" json:"product_id"`
+	LocationID            uint      `gorm:"index;not null" json:"location_id"`
+	Quantity              int       `gorm:"not null" json:"quantity"`
+	MovementType          string    `gorm:"size:20;not null" json:"movement_type"`
+	CounterpartLocationID *uint     `json:"counterpart_location_id"`
+	StationProductID      *uint     `gorm:"index" json:"station_product_id"`
+	Note                  string    `gorm:"type:text" json:"note"`
+	CreatedBy             *uint     `json:"created_by"`
+	CreatedAt             time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// StockMovementRequest is the body used to post receipts, issues, transfers
+// and adjustments. Adjustments take a signed delta; every other type takes a
+// positive quantity.
+type StockMovementRequest struct {
+	Type             string `json:"type" validate:"required,oneof=receipt issue transfer adjustment"`
+	ProductID        uint   `json:"product_id" validate:"required"`
+	LocationID       uint   `json:"location_id" validate:"required"`
+	ToLocationID     *uint  `json:"to_location_id" validate:"omitempty"`
+	Quantity         int    `json:"quantity" validate:"required"`
+	StationProductID *uint  `json:"station_product_id" validate:"omitempty"`
+	Note             string `json:"note" validate:"omitempty"`
+	CreatedBy        *uint  `json:"created_by" validate:"omitempty"`
+}
+
+func (m *StockMovementRequest) Validate() error {
+	if err := validate.Struct(m); err != nil {
+		return err
+	}
+
+	if m.Type != string(StockAdjustment) && m.Quantity < 0 {
+		return errors.New("quantity must be positive")
+	}
+
+	if m.Type == string(StockTransfer) {
+		if m.ToLocationID == nil {
+			return errors.New("to_location_id is required for transfers")
+		}
+		if *m.ToLocationID == m.LocationID {
+			return errors.New("cannot transfer stock to the same location")
+		}
+	}
+
+	return nil
+}
+
+// StockThreshold sets when a product at a location should be reordered.
+type StockThreshold struct {
+	ReorderThreshold int `json:"reorder_threshold" validate:"gte=0"`
+	ReorderQuantity  int `json:"reorder_quantity" validate:"gte=0"`
+}
+
+func (t *StockThreshold) Validate() error {
+	return validate.Struct(t)
+}
+
+// LowStockItem is a stock level at or below its reorder threshold.
+type LowStockItem struct {
+	StockLevel
+	Shortfall         int `json:"shortfall"`
+	SuggestedQuantity int `json:"suggested_quantity"`
+}
+
+// RefillRequest tops up the components of a device. When StockLocationID is
+// set the quantities are issued from that location.
+type RefillRequest struct {
+	ChildProduct1Qty int    `json:"child_product_1_qty" validate:"gte=0"`
+	ChildProduct2Qty int    `json:"child_product_2_qty" validate:"gte=0"`
+	StockLocationID  *uint  `json:"stock_location_id" validate:"omitempty"`
+	PerformedBy      *uint  `json:"performed_by" validate:"omitempty"`
+	Note             string `json:"note" validate:"omitempty"`
+}
+
+func (r *RefillRequest) Validate() error {
+	if err := validate.Struct(r); err != nil {
+		return err
+	}
+
+	if r.ChildProduct1Qty == 0 && r.ChildProduct2Qty == 0 {
+		return errors.New("at least one component quantity is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entities exchanged by the offline sync protocol.
+const (
+	SyncFloorPlan = "floor_plan"
+	SyncStation   = "station"
+	SyncDevice    = "device"
+	SyncWorkOrder = "work_order"
+)
+
+// Resolutions of a pushed mutation.
+const (
+	// SyncApplied means the mutation was applied; ID and Version are the
+	// entity's new server id and version.
+	SyncApplied = "applied"
+
+	// SyncServerWins means the entity changed on the server since the
+	// client's base version. The mutation was not applied; Server carries
+	// the current server copy to rebase onto.
+	SyncServerWins = "server_wins"
+
+	// SyncTombstoned means the entity no longer exists for this customer.
+	// The client should drop its local copy.
+	SyncTombstoned = "tombstone"
+
+	// SyncRejected means the mutation is invalid; Error says why.
+	SyncRejected = "rejected"
+)
+
+// SyncPull is a batch of changes for the technician app. Without a token it
+// is a full snapshot of the customer's floor plans, stations, devices and
+// open work orders. With a token it holds what changed since then: entities
+// to upsert and tombstones for the ones to drop, including work orders that
+// are no longer open. While HasMore is set the client pulls again with
+// Token straight away; otherwise it keeps Token for the next sync.
+type SyncPull struct {
+	Token      string           `json:"token"`
+	Full       bool             `json:"full"`
+	HasMore    bool             `json:"has_more"`
+	FloorPlans []FloorPlan      `json:"floor_plans"`
+	Stations   []Station        `json:"stations"`
+	Devices    []StationProduct `json:"devices"`
+	WorkOrders []WorkOrder      `json:"work_orders"`
+	Tombstones []SyncTombstone  `json:"tombstones"`
+	ServerTime time.Time        `json:"server_time"`
+}
+
+// SyncTombstone marks an entity the client should delete.
+type SyncTombstone struct {
+	Entity string `json:"entity"`
+	ID     uint   `json:"id"`
+}
+
+// SyncPush is a batch of mutations made offline, applied in order. Each
+// mutation stands alone: one failing does not undo the others.
+type SyncPush struct {
+	UserID    uint           `json:"user_id" validate:"required"`
+	Mutations []SyncMutation `json:"mutations" validate:"required,min=1,max=500,dive"`
+}
+
+func (sp *SyncPush) Validate() error {
+	return validate.Struct(sp)
+}
+
+// SyncMutation is a single offline change. ClientID is generated by the app
+// and makes the mutation idempotent: pushing it again returns the original
+// result. ID and BaseVersion identify the server entity and the version the
+// change was made against; they are not used for creates. Data holds the
+// changed fields, see SyncStationData, SyncDeviceData and SyncWorkOrderData.
+//
+// Stations and devices can be created, updated and deleted. Work orders can
+// be updated or completed, with a CompleteWorkOrderRequest as Data.
+type SyncMutation struct {
+	ClientID    string          `json:"client_id" validate:"required,max=64"`
+	Entity      string          `json:"entity" validate:"required,oneof=station device work_order"`
+	Op          string          `json:"op" validate:"required,oneof=create update delete complete"`
+	ID          *uint           `json:"id" validate:"omitempty"`
+	BaseVersion int             `json:"base_version" validate:"gte=0"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// SyncMutationResult is the outcome of a pushed mutation.
+type SyncMutationResult struct {
+	ClientID   string      `json:"client_id"`
+	Entity     string      `json:"entity"`
+	ID         uint        `json:"id,omitempty"`
+	Version    int         `json:"version,omitempty"`
+	Resolution string      `json:"resolution"`
+	Replayed   bool        `json:"replayed,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Server     interface{} `json:"server,omitempty"`
+}
+
+// SyncPushResult holds a result per mutation, in the order pushed.
+type SyncPushResult struct {
+	Results []SyncMutationResult `json:"results"`
+}
+
+// SyncStationData is a station created or changed offline. Fields left out
+// keep their value.
+type SyncStationData struct {
+	Name        *string  `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string  `json:"description" validate:"omitempty"`
+	FloorPlanID *uint    `json:"floor_plan_id" validate:"omitempty"`
+	LocationX   *float64 `json:"location_x" validate:"omitempty,gte=0"`
+	LocationY   *float64 `json:"location_y" validate:"omitempty,gte=0"`
+	Rotation    *float64 `json:"rotation" validate:"omitempty,gte=0,lt=360"`
+	Zone        *string  `json:"zone" validate:"omitempty,max=100"`
+	Room        *string  `json:"room" validate:"omitempty,max=100"`
+}
+
+func (d *SyncStationData) Validate() error {
+	return validate.Struct(d)
+}
+
+// SyncDeviceData is a device installed or changed offline. Fields left out
+// keep their value. A device installed on a station that was itself created
+// offline refers to it by StationClientID. Devices are moved between
+// stations with the move endpoint, not through sync.
+type SyncDeviceData struct {
+	StationID           *uint      `json:"station_id" validate:"omitempty"`
+	StationClientID     string     `json:"station_client_id" validate:"omitempty,max=64"`
+	ProductID           *uint      `json:"product_id" validate:"omitempty"`
+	InstalledDate       *time.Time `json:"installed_date" validate:"omitempty"`
+	ExpiryDate          *time.Time `json:"expiry_date" validate:"omitempty"`
+	InspectionDate      *time.Time `json:"inspection_date" validate:"omitempty"`
+	ChildProduct1ID     *uint      `json:"child_product_1_id" validate:"omitempty"`
+	ChildProduct1Qty    *int       `json:"child_product_1_qty" validate:"omitempty,gte=0"`
+	ChildProduct2ID     *uint      `json:"child_product_2_id" validate:"omitempty"`
+	ChildProduct2Qty    *int       `json:"child_product_2_qty" validate:"omitempty,gte=0"`
+	ChildProduct1MinQty *int       `json:"child_product_1_min_qty" validate:"omitempty,gte=0"`
+	ChildProduct2MinQty *int       `json:"child_product_2_min_qty" validate:"omitempty,gte=0"`
+}
+
+func (d *SyncDeviceData) Validate() error {
+	return validate.Struct(d)
+}
+
+// SyncWorkOrderData is a work order changed offline.
+type SyncWorkOrderData struct {
+	Status *string `json:"status" validate:"omitempty,oneof=open assigned in_progress cancelled"`
+	Notes  *string `json:"notes" validate:"omitempty"`
+}
+
+func (d *SyncWorkOrderData) Validate() error {
+	return validate.Struct(d)
+}
@@ -10,8 +10,9 @@ import (
 type UserRole string
 
 const (
-	AdminUser    UserRole = "admin"
-	CustomerUser UserRole = "user"
+	AdminUser     UserRole = "admin"
+	CustomerUser  UserRole = "user"
+	ModeratorUser UserRole = "moderator"
 )
 
 type User struct {
@@ -0,0 +1,179 @@
+package models
+
+import "time"
+
+type WorkOrderStatus string
+
+const (
+	WorkOrderOpen       WorkOrderStatus = "open"
+	WorkOrderAssigned   WorkOrderStatus = "assigned"
+	WorkOrderInProgress WorkOrderStatus = "in_progress"
+	WorkOrderDone       WorkOrderStatus = "done"
+	WorkOrderCancelled  WorkOrderStatus = "cancelled"
+)
+
+// workOrderTransitions lists the statuses a work order can move to from each
+// status. A work order only becomes done by being completed.
+var workOrderTransitions = map[WorkOrderStatus][]WorkOrderStatus{
+	WorkOrderOpen:       {WorkOrderAssigned, WorkOrderCancelled},
+	WorkOrderAssigned:   {WorkOrderOpen, WorkOrderInProgress, WorkOrderCancelled},
+	WorkOrderInProgress: {WorkOrderAssigned, WorkOrderDone, WorkOrderCancelled},
+}
+
+// CanTransition reports whether a work order may move from one status to another.
+func (s WorkOrderStatus) CanTransition(to WorkOrderStatus) bool {
+	for _, next := range workOrderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type WorkOrderType string
+
+const (
+	WorkOrderInspection  WorkOrderType = "inspection"
+	WorkOrderReplacement WorkOrderType = "replacement"
+
+	// WorkOrderFollowUp fixes a device that failed a checklist. Completing it
+	// clears the device's needs-attention flag but does not move its dates.
+	WorkOrderFollowUp WorkOrderType = "follow_up"
+)
+
+type WorkOrderPriority string
+
+const (
+	PriorityLow    WorkOrderPriority = "low"
+	PriorityNormal WorkOrderPriority = "normal"
+	PriorityHigh   WorkOrderPriority = "high"
+	PriorityUrgent WorkOrderPriority = "urgent"
+)
+
+// WorkOrder is an inspection or replacement visit to a station, covering one
+// or more of its devices.
+type WorkOrder struct {
+	ID           uint              `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID   uint              `gorm:"index;not null" json:"customer_id"`
+	CustomerName string            `gorm:"-" json:"customer_name,omitempty"`
+	StationID    uint              `gorm:"index;not null" json:"station_id" validate:"required"`
+	StationName  string            `gorm:"-" json:"station_name,omitempty"`
+	Type         string            `gorm:"size:20;not null" json:"type" validate:"required,oneof=inspection replacement follow_up"`
+	Title        string            `gorm:"size:200;not null" json:"title" validate:"omitempty,max=200"`
+	Description  string            `gorm:"type:text" json:"description" validate:"omitempty"`
+	Priority     string            `gorm:"size:20;not null;default:'normal'" json:"priority" validate:"omitempty,oneof=low normal high urgent"`
+	Status       string            `gorm:"size:20;not null;default:'open'" json:"status"`
+	AssignedTo   *uint             `gorm:"index" json:"assigned_to" validate:"omitempty"`
+	DueDate      time.Time         `gorm:"not null" json:"due_date" validate:"required"`
+	CreatedBy    *uint             `json:"created_by" validate:"omitempty"`
+	StartedAt    *time.Time        `json:"started_at"`
+	CompletedAt  *time.Time        `json:"completed_at"`
+	CompletedBy  *uint             `json:"completed_by"`
+	CancelledAt  *time.Time        `json:"cancelled_at"`
+	Notes        string            `gorm:"type:text" json:"notes" validate:"omitempty"`
+	CreatedAt    time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+	DeviceIDs    []uint            `gorm:"-" json:"device_ids,omitempty" validate:"required,min=1"`
+	Devices      []WorkOrderDevice `gorm:"-" json:"devices,omitempty"`
+
+	Evidence []Evidence `gorm:"-" json:"evidence,omitempty"`
+
+	// Incremented on every change; used to detect sync conflicts
+	Version int `gorm:"not null;default:1" json:"version,omitempty"`
+
+	// Facility of the station, when its floor plan is on a floor
+	FacilityID   *uint  `gorm:"-" json:"facility_id,omitempty"`
+	FacilityName string `gorm:"-" json:"facility_name,omitempty"`
+}
+
+func (wo *WorkOrder) Validate() error {
+	return validate.Struct(wo)
+}
+
+// WorkOrderDevice is a device covered by a work order.
+type WorkOrderDevice struct {
+	StationProductID uint      `json:"station_product_id"`
+	ProductID        uint      `json:"product_id"`
+	ProductName      string    `json:"product_name"`
+	ExpiryDate       time.Time `json:"expiry_date"`
+	InspectionDate   time.Time `json:"inspection_date"`
+}
+
+// GenerateWorkOrdersRequest creates work orders for devices falling due in
+// the next DueWithinDays days. Devices are grouped into one work order per
+// station and type; devices already on an open work order are skipped.
+type GenerateWorkOrdersRequest struct {
+	CustomerID    *uint  `json:"customer_id" validate:"omitempty"`
+	DueWithinDays int    `json:"due_within_days" validate:"gte=0"`
+	Type          string `json:"type" validate:"omitempty,oneof=inspection replacement"`
+	CreatedBy     *uint  `json:"created_by" validate:"omitempty"`
+}
+
+func (g *GenerateWorkOrdersRequest) Validate() error {
+	return validate.Struct(g)
+}
+
+type WorkOrderAssignment struct {
+	AssignedTo uint `json:"assigned_to" validate:"required"`
+}
+
+func (a *WorkOrderAssignment) Validate() error {
+	return validate.Struct(a)
+}
+
+type WorkOrderStatusUpdate struct {
+	Status string `json:"status" validate:"required,oneof=open assigned in_progress cancelled"`
+}
+
+func (u *WorkOrderStatusUpdate) Validate() error {
+	return validate.Struct(u)
+}
+
+// CompleteWorkOrderRequest closes a work order. A service record is written
+// for every device on the work order and the device dates are advanced.
+// Devices lists per-device overrides and is optional.
+type CompleteWorkOrderRequest struct {
+	CompletedBy uint                      `json:"completed_by" validate:"required"`
+	ServiceDate *time.Time                `json:"service_date" validate:"omitempty"`
+	Notes       string                    `json:"notes" validate:"omitempty"`
+	Devices     []CompleteWorkOrderDevice `json:"devices" validate:"omitempty,dive"`
+}
+
+func (c *CompleteWorkOrderRequest) Validate() error {
+	return validate.Struct(c)
+}
+
+// CompleteWorkOrderDevice overrides how a single device is closed out. When
+// NextInspectionDate or ExpiryDate is not given it is computed from the
+// product's service interval or lifetime. StockLocationID issues the
+// replacement device from stock.
+type CompleteWorkOrderDevice struct {
+	StationProductID   uint       `json:"station_product_id" validate:"required"`
+	Notes              string     `json:"notes" validate:"omitempty"`
+	NextInspectionDate *time.Time `json:"next_inspection_date" validate:"omitempty"`
+	ExpiryDate         *time.Time `json:"expiry_date" validate:"omitempty"`
+	StockLocationID    *uint      `json:"stock_location_id" validate:"omitempty"`
+}
+
+// ServiceRecord is a service performed on a device: an installation,
+// inspection, maintenance or replacement.
+type ServiceRecord struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	StationProductID uint       `gorm:"index;not null" json:"station_product_id"`
+	WorkOrderID      *uint      `gorm:"index" json:"work_order_id"`
+	ServiceType      string     `gorm:"size:50;not null" json:"service_type"`
+	ServiceDate      time.Time  `gorm:"not null" json:"service_date"`
+	PerformedBy      *uint      `json:"performed_by"`
+	Description      string     `gorm:"type:text" json:"description"`
+	NextServiceDate  *time.Time `json:"next_service_date"`
+	Status           string     `gorm:"size:20;not null;default:'completed'" json:"status"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	// Evidence from the work order, for the device or the whole visit
+	Evidence []Evidence `gorm:"-" json:"evidence,omitempty"`
+
+	// The inspection or expiry date this service satisfied, for SLA
+	// compliance; empty when the service did not move the device's dates
+	DueKind string     `gorm:"size:20" json:"due_kind,omitempty"`
+	DueDate *time.Time `json:"due_date,omitempty"`
+}
@@ -0,0 +1,141 @@
+// Package recurrence expands RFC 5545 recurrence rules into schedule
+// occurrences.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/teambition/rrule-go"
+)
+
+// ErrUnsupportedFrequency is returned for rules recurring more often than daily.
+var ErrUnsupportedFrequency = errors.New("recurrence must be daily, weekly, monthly or yearly")
+
+// Parse parses a recurrence rule starting at start. The rule may carry an
+// "RRULE:" prefix but not its own DTSTART.
+func Parse(rule string, start time.Time) (*rrule.RRule, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rrule: %w", err)
+	}
+
+	switch option.Freq {
+	case rrule.DAILY, rrule.WEEKLY, rrule.MONTHLY, rrule.YEARLY:
+	default:
+		return nil, ErrUnsupportedFrequency
+	}
+
+	option.Dtstart = start.UTC()
+
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rrule: %w", err)
+	}
+
+	return r, nil
+}
+
+// Validate reports whether rule is a supported recurrence rule.
+func Validate(rule string) error {
+	_, err := Parse(rule, time.Now())
+	return err
+}
+
+// IsOccurrence reports whether at is an occurrence of the rule.
+func IsOccurrence(rule string, start, at time.Time) (bool, error) {
+	r, err := Parse(rule, start)
+	if err != nil {
+		return false, err
+	}
+
+	return isOccurrence(r, at.UTC()), nil
+}
+
+func isOccurrence(r *rrule.RRule, at time.Time) bool {
+	for _, t := range r.Between(at, at, true) {
+		if t.Equal(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// Occurrences lists the occurrences of a rule falling between from and to,
+// with the exceptions applied. Skipped occurrences are included with status
+// skipped so callers can show them; moved occurrences keep their original
+// time in OccurrenceAt and carry the new date in Date. A moved occurrence
+// falls in the window by its new date, so one moved in from outside it is
+// listed and one moved out of it is not. Occurrences are ordered by Date.
+func Occurrences(rule string, start, from, to time.Time, exceptions []models.ScheduleException) ([]models.ScheduleOccurrence, error) {
+	r, err := Parse(rule, start)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to = from.UTC(), to.UTC()
+	inWindow := func(t time.Time) bool {
+		return !t.Before(from) && !t.After(to)
+	}
+
+	byTime := make(map[time.Time]models.ScheduleException, len(exceptions))
+	for _, exception := range exceptions {
+		byTime[exception.OccurrenceAt.UTC()] = exception
+	}
+
+	times := r.Between(from, to, true)
+	occurrences := make([]models.ScheduleOccurrence, 0, len(times))
+	for _, t := range times {
+		occurrence := models.ScheduleOccurrence{
+			OccurrenceAt: t,
+			Date:         t,
+			Status:       string(models.OccurrenceScheduled),
+		}
+
+		if exception, ok := byTime[t]; ok {
+			occurrence.Reason = exception.Reason
+			if exception.MovedTo != nil {
+				occurrence.Date = exception.MovedTo.UTC()
+				occurrence.Status = string(models.OccurrenceMoved)
+			} else {
+				occurrence.Status = string(models.OccurrenceSkipped)
+			}
+		}
+
+		if occurrence.Status == string(models.OccurrenceMoved) && !inWindow(occurrence.Date) {
+			continue
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	// occurrences moved into the window from outside it
+	for at, exception := range byTime {
+		if exception.MovedTo == nil || inWindow(at) || !inWindow(exception.MovedTo.UTC()) {
+			continue
+		}
+		if !isOccurrence(r, at) {
+			continue
+		}
+		occurrences = append(occurrences, models.ScheduleOccurrence{
+			OccurrenceAt: at,
+			Date:         exception.MovedTo.UTC(),
+			Status:       string(models.OccurrenceMoved),
+			Reason:       exception.Reason,
+		})
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		if !occurrences[i].Date.Equal(occurrences[j].Date) {
+			return occurrences[i].Date.Before(occurrences[j].Date)
+		}
+		return occurrences[i].OccurrenceAt.Before(occurrences[j].OccurrenceAt)
+	})
+
+	return occurrences, nil
+}
@@ -0,0 +1,324 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// pointsPerMM converts millimetres to PDF points.
+const pointsPerMM = 72 / 25.4
+
+// labelPadding is the space kept clear inside a label's edge, in millimetres.
+const labelPadding = 2.0
+
+// LabelLayout is a sheet of equal labels in a grid. Sizes are in
+// millimetres; the pitch is the distance from one label's corner to the
+// next.
+type LabelLayout struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	LabelWidth  float64 `json:"label_width"`
+	LabelHeight float64 `json:"label_height"`
+	MarginLeft  float64 `json:"margin_left"`
+	MarginTop   float64 `json:"margin_top"`
+	PitchX      float64 `json:"pitch_x"`
+	PitchY      float64 `json:"pitch_y"`
+}
+
+// PerSheet is the number of labels on a sheet.
+func (l LabelLayout) PerSheet() int {
+	return l.Columns * l.Rows
+}
+
+// DefaultLabelLayout is used when no layout is asked for.
+const DefaultLabelLayout = "L7160"
+
+// labelLayouts are the Avery sheets labels can be printed on, by product
+// code.
+var labelLayouts = map[string]LabelLayout{
+	"L7160": {Description: "A4, 21 labels 63.5 x 38.1 mm", PageWidth: 210, PageHeight: 297, Columns: 3, Rows: 7,
+		LabelWidth: 63.5, LabelHeight: 38.1, MarginLeft: 7.2, MarginTop: 15.15, PitchX: 66, PitchY: 38.1},
+	"L7163": {Description: "A4, 14 labels 99.1 x 38.1 mm", PageWidth: 210, PageHeight: 297, Columns: 2, Rows: 7,
+		LabelWidth: 99.1, LabelHeight: 38.1, MarginLeft: 4.65, MarginTop: 15.15, PitchX: 101.6, PitchY: 38.1},
+	"L7651": {Description: "A4, 65 labels 38.1 x 21.2 mm", PageWidth: 210, PageHeight: 297, Columns: 5, Rows: 13,
+		LabelWidth: 38.1, LabelHeight: 21.2, MarginLeft: 4.65, MarginTop: 10.7, PitchX: 40.6, PitchY: 21.2},
+	"5160": {Description: "Letter, 30 labels 1 x 2 5/8 in", PageWidth: 215.9, PageHeight: 279.4, Columns: 3, Rows: 10,
+		LabelWidth: 66.675, LabelHeight: 25.4, MarginLeft: 4.7625, MarginTop: 12.7, PitchX: 69.85, PitchY: 25.4},
+	"5163": {Description: "Letter, 10 labels 2 x 4 in", PageWidth: 215.9, PageHeight: 279.4, Columns: 2, Rows: 5,
+		LabelWidth: 101.6, LabelHeight: 50.8, MarginLeft: 3.96875, MarginTop: 12.7, PitchX: 104.775, PitchY: 50.8},
+}
+
+// LookupLabelLayout returns the layout of an Avery product code.
+func LookupLabelLayout(name string) (LabelLayout, bool) {
+	layout, ok := labelLayouts[strings.ToUpper(name)]
+	layout.Name = strings.ToUpper(name)
+	return layout, ok
+}
+
+// LabelLayouts lists the layouts labels can be printed on, by name.
+func LabelLayouts() []LabelLayout {
+	layouts := make([]LabelLayout, 0, len(labelLayouts))
+	for name, layout := range labelLayouts {
+		layout.Name = name
+		layouts = append(layouts, layout)
+	}
+	sort.Slice(layouts, func(i, j int) bool { return layouts[i].Name < layouts[j].Name })
+	return layouts
+}
+
+// StationLabel is what a station's label shows: the QR code of Code, the
+// title and code beside it and a smaller note under them.
+type StationLabel struct {
+	Title string
+	Code  string
+	Note  string
+}
+
+// QRCode encodes text as a square PNG QR code of size pixels, with the
+// quiet zone scanners need around it.
+func QRCode(text string, size int) ([]byte, error) {
+	return qrcode.Encode(text, qrcode.Medium, size)
+}
+
+// WriteLabelSheet prints labels as a PDF on sheets of the layout, leaving
+// the first skip positions empty so that a partly used sheet can be fed
+// again.
+func WriteLabelSheet(w io.Writer, layout LabelLayout, labels []StationLabel, skip int) error {
+	perSheet := layout.PerSheet()
+	if perSheet == 0 {
+		return fmt.Errorf("label layout %s has no labels", layout.Name)
+	}
+	if skip < 0 || skip >= perSheet {
+		return fmt.Errorf("skip must be between 0 and %d", perSheet-1)
+	}
+
+	var pages []string
+	var page strings.Builder
+	for i, label := range labels {
+		position := (skip + i) % perSheet
+		if position == 0 && page.Len() > 0 {
+			pages = append(pages, page.String())
+			page.Reset()
+		}
+
+		column, row := position%layout.Columns, position/layout.Columns
+		x := layout.MarginLeft + float64(column)*layout.PitchX
+		y := layout.MarginTop + float64(row)*layout.PitchY
+		if err := drawLabel(&page, layout, x, y, label); err != nil {
+			return err
+		}
+	}
+	if page.Len() > 0 || len(pages) == 0 {
+		pages = append(pages, page.String())
+	}
+
+	return writePDF(w, layout.PageWidth*pointsPerMM, layout.PageHeight*pointsPerMM, pages)
+}
+
+// drawLabel adds the drawing of a label whose top-left corner is at x, y
+// millimetres from the page's top-left corner.
+func drawLabel(page *strings.Builder, layout LabelLayout, x, y float64, label StationLabel) error {
+	q, err := qrcode.New(label.Code, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	q.DisableBorder = true
+	modules := q.Bitmap()
+
+	side := layout.LabelHeight - 2*labelPadding
+	if side > layout.LabelWidth/2 {
+		side = layout.LabelWidth / 2
+	}
+	module := side / float64(len(modules))
+
+	// PDF measures from the bottom-left corner, in points
+	toX := func(mm float64) float64 { return mm * pointsPerMM }
+	toY := func(mm float64) float64 { return (layout.PageHeight - mm) * pointsPerMM }
+
+	left, top := x+labelPadding, y+(layout.LabelHeight-side)/2
+	page.WriteString("0 g\n")
+	for r, line := range modules {
+		for c := 0; c < len(line); {
+			if !line[c] {
+				c++
+				continue
+			}
+			run := c
+			for run < len(line) && line[run] {
+				run++
+			}
+			fmt.Fprintf(page, "%s %s %s %s re\n",
+				pdfNumber(toX(left+float64(c)*module)), pdfNumber(toY(top+float64(r+1)*module)),
+				pdfNumber(float64(run-c)*module*pointsPerMM), pdfNumber(module*pointsPerMM))
+			c = run
+		}
+	}
+	page.WriteString("f\n")
+
+	// The text fills the rest of the label, the title on up to two lines
+	textLeft := left + side + labelPadding
+	textWidth := x + layout.LabelWidth - labelPadding - textLeft
+	size := 10.0
+	switch {
+	case layout.LabelHeight < 30:
+		size = 6
+	case layout.LabelHeight < 45:
+		size = 8
+	}
+	lineHeight := size * 1.2 / pointsPerMM
+
+	var lines []textLine
+	for _, text := range wrapText(label.Title, textWidth, size, 2) {
+		lines = append(lines, textLine{"F2", size, text})
+	}
+
+	// The code is typed in when a label cannot be scanned, so it is never
+	// shortened but set smaller instead
+	codeSize := size
+	if !textFits(label.Code, textWidth, codeSize, courierWidth) {
+		codeSize = textWidth * pointsPerMM / (float64(len(label.Code)) * courierWidth)
+	}
+	lines = append(lines, textLine{"F3", codeSize, label.Code})
+	if label.Note != "" {
+		lines = append(lines, textLine{"F1", size * 0.8, fitText(label.Note, textWidth, size*0.8, helveticaWidth)})
+	}
+
+	baseline := y + (layout.LabelHeight-float64(len(lines))*lineHeight)/2 + lineHeight*0.8
+	for _, line := range lines {
+		fmt.Fprintf(page, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", line.font, pdfNumber(line.size),
+			pdfNumber(toX(textLeft)), pdfNumber(toY(baseline)), pdfString(line.text))
+		baseline += lineHeight
+	}
+
+	return nil
+}
+
+type textLine struct {
+	font string
+	size float64
+	text string
+}
+
+// helveticaWidth and courierWidth estimate the width of a character as a
+// share of the font size; close enough to keep text inside a label.
+const (
+	helveticaWidth = 0.56
+	courierWidth   = 0.6
+)
+
+// textFits reports whether text set at size points fits in width millimetres.
+func textFits(text string, width, size, charWidth float64) bool {
+	return float64(len([]rune(text)))*size*charWidth <= width*pointsPerMM
+}
+
+// fitText shortens text with an ellipsis until it fits in width.
+func fitText(text string, width, size, charWidth float64) string {
+	if textFits(text, width, size, charWidth) {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && !textFits(string(runes)+"...", width, size, charWidth) {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "..."
+}
+
+// wrapText breaks bold text into at most maxLines lines that fit in width,
+// shortening the last.
+func wrapText(text string, width, size float64, maxLines int) []string {
+	const charWidth = helveticaWidth + 0.04
+
+	var lines []string
+	words := strings.Fields(text)
+	for len(words) > 0 && len(lines) < maxLines-1 && textFits(words[0], width, size, charWidth) {
+		n := 1
+		for n < len(words) && textFits(strings.Join(words[:n+1], " "), width, size, charWidth) {
+			n++
+		}
+		lines = append(lines, strings.Join(words[:n], " "))
+		words = words[n:]
+	}
+	if len(words) > 0 {
+		lines = append(lines, fitText(strings.Join(words, " "), width, size, charWidth))
+	}
+	return lines
+}
+
+// pdfNumber formats a number the way PDF content streams take it.
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// pdfString escapes text for a PDF string in WinAnsi encoding. Characters
+// outside Latin-1 become question marks.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= ' ' && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// writePDF writes a PDF of pages of the given size in points, each drawn
+// by its content stream, with Helvetica as F1, Helvetica-Bold as F2 and
+// Courier as F3.
+func writePDF(w io.Writer, width, height float64, pages []string) error {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1 to 5 are fixed; each page then takes two, itself and its
+	// content
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfNumber(width), pdfNumber(height), 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,207 @@
+// Package render draws floor plans as SVG, and station labels as QR codes
+// and PDF label sheets.
+package render
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/aakash-tyagi/linmed/geo"
+)
+
+// pixelWidth is the width the drawing is shown at; the height follows the
+// plan's proportions.
+const pixelWidth = 1200
+
+// Background is an image laid under the plan, stretched to its size so that
+// floor plan units line up with it.
+type Background struct {
+	ContentType string
+	Data        []byte
+}
+
+// Area is a room or zone outline.
+type Area struct {
+	Name    string
+	Polygon geo.Polygon
+}
+
+// Wall is a wall of the given thickness in floor plan units.
+type Wall struct {
+	From, To  geo.Point
+	Thickness float64
+}
+
+// Label is a named position, such as a door or an exit.
+type Label struct {
+	Text     string
+	Position geo.Point
+}
+
+// Marker is a station drawn as a dot in its status colour, with an arrow
+// pointing along its rotation, in degrees clockwise, when it has one.
+type Marker struct {
+	Label    string
+	Position geo.Point
+	Rotation *float64
+	Color    string
+}
+
+// LegendEntry explains a marker colour.
+type LegendEntry struct {
+	Label string
+	Color string
+	Count int
+}
+
+// Map is everything drawn for a floor plan. Width and Height are in floor
+// plan units.
+type Map struct {
+	Title      string
+	Width      float64
+	Height     float64
+	Background *Background
+	Rooms      []Area
+	Zones      []Area
+	Walls      []Wall
+	Doors      []Label
+	Points     []Label
+	Markers    []Marker
+	Legend     []LegendEntry
+	Notes      []string
+}
+
+// Write draws a map as a standalone SVG document, with the legend below the
+// plan.
+func Write(w io.Writer, m Map) error {
+	bw := bufio.NewWriter(w)
+
+	// sizes of markers and text follow the size of the plan
+	unit := math.Max(m.Width, m.Height) / 100
+	lineHeight := unit * 2.5
+	legendHeight := lineHeight * float64(len(m.Legend)+len(m.Notes)+2)
+	totalHeight := m.Height + legendHeight
+
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %s %s" width="%d" height="%d" font-family="sans-serif">`+"\n",
+		num(m.Width), num(totalHeight), pixelWidth, int(math.Round(pixelWidth*totalHeight/m.Width)))
+	fmt.Fprintf(bw, "<title>%s</title>\n", esc(m.Title))
+	fmt.Fprintf(bw, `<rect x="0" y="0" width="%s" height="%s" fill="#ffffff"/>`+"\n", num(m.Width), num(totalHeight))
+
+	if m.Background != nil {
+		fmt.Fprintf(bw, `<image x="0" y="0" width="%s" height="%s" preserveAspectRatio="none" href="data:%s;base64,%s"/>`+"\n",
+			num(m.Width), num(m.Height), esc(m.Background.ContentType), base64.StdEncoding.EncodeToString(m.Background.Data))
+	}
+	fmt.Fprintf(bw, `<rect x="0" y="0" width="%s" height="%s" fill="none" stroke="#444444" stroke-width="%s"/>`+"\n",
+		num(m.Width), num(m.Height), num(unit/5))
+
+	bw.WriteString(`<g id="rooms">` + "\n")
+	for _, room := range m.Rooms {
+		writeArea(bw, room, unit, `fill="#e8eef5" fill-opacity="0.5" stroke="#7a8fa6"`, "")
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString(`<g id="zones">` + "\n")
+	for _, zone := range m.Zones {
+		writeArea(bw, zone, unit, `fill="none" stroke="#b36b00"`, fmt.Sprintf(` stroke-dasharray="%s %s"`, num(unit), num(unit/2)))
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString(`<g id="walls" stroke="#222222" stroke-linecap="square">` + "\n")
+	for _, wall := range m.Walls {
+		fmt.Fprintf(bw, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke-width="%s"/>`+"\n",
+			num(wall.From.X), num(wall.From.Y), num(wall.To.X), num(wall.To.Y), num(math.Max(wall.Thickness, unit/4)))
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString(`<g id="doors">` + "\n")
+	for _, door := range m.Doors {
+		fmt.Fprintf(bw, `<rect x="%s" y="%s" width="%s" height="%s" fill="#8b5a2b"><title>%s</title></rect>`+"\n",
+			num(door.Position.X-unit/2), num(door.Position.Y-unit/2), num(unit), num(unit), esc(door.Text))
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString(`<g id="points">` + "\n")
+	for _, point := range m.Points {
+		p := point.Position
+		fmt.Fprintf(bw, `<path d="M %s %s L %s %s L %s %s L %s %s Z" fill="#555555"/>`+"\n",
+			num(p.X), num(p.Y-unit*0.6), num(p.X+unit*0.6), num(p.Y), num(p.X), num(p.Y+unit*0.6), num(p.X-unit*0.6), num(p.Y))
+		writeText(bw, point.Text, p.X+unit, p.Y+unit*0.4, unit*1.2, "#555555", "start")
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString(`<g id="stations">` + "\n")
+	for _, marker := range m.Markers {
+		p := marker.Position
+		if marker.Rotation != nil {
+			angle := *marker.Rotation * math.Pi / 180
+			fmt.Fprintf(bw, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"/>`+"\n",
+				num(p.X), num(p.Y), num(p.X+math.Sin(angle)*unit*2), num(p.Y-math.Cos(angle)*unit*2),
+				esc(marker.Color), num(unit/3))
+		}
+		fmt.Fprintf(bw, `<circle cx="%s" cy="%s" r="%s" fill="%s" stroke="#000000" stroke-width="%s"><title>%s</title></circle>`+"\n",
+			num(p.X), num(p.Y), num(unit), esc(marker.Color), num(unit/8), esc(marker.Label))
+		writeText(bw, marker.Label, p.X+unit*1.4, p.Y+unit*0.4, unit*1.2, "#000000", "start")
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString(`<g id="legend">` + "\n")
+	y := m.Height + lineHeight*1.5
+	writeText(bw, m.Title, unit, y, unit*1.6, "#000000", "start")
+	for _, entry := range m.Legend {
+		y += lineHeight
+		fmt.Fprintf(bw, `<circle cx="%s" cy="%s" r="%s" fill="%s" stroke="#000000" stroke-width="%s"/>`+"\n",
+			num(unit*2), num(y-unit*0.4), num(unit*0.8), esc(entry.Color), num(unit/8))
+		writeText(bw, fmt.Sprintf("%s (%d)", entry.Label, entry.Count), unit*3.5, y, unit*1.2, "#000000", "start")
+	}
+	for _, note := range m.Notes {
+		y += lineHeight
+		writeText(bw, note, unit, y, unit*1.1, "#555555", "start")
+	}
+	bw.WriteString("</g>\n")
+
+	bw.WriteString("</svg>\n")
+
+	return bw.Flush()
+}
+
+// writeArea draws an outline with its name at the centre of its corners.
+func writeArea(w *bufio.Writer, area Area, unit float64, style, extra string) {
+	fmt.Fprintf(w, `<polygon points="`)
+	var cx, cy float64
+	for i, p := range area.Polygon {
+		if i > 0 {
+			w.WriteString(" ")
+		}
+		fmt.Fprintf(w, "%s,%s", num(p.X), num(p.Y))
+		cx += p.X
+		cy += p.Y
+	}
+	fmt.Fprintf(w, `" %s stroke-width="%s"%s/>`+"\n", style, num(unit/6), extra)
+
+	if n := float64(len(area.Polygon)); n > 0 {
+		writeText(w, area.Name, cx/n, cy/n, unit*1.3, "#33475b", "middle")
+	}
+}
+
+func writeText(w *bufio.Writer, text string, x, y, size float64, color, anchor string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(w, `<text x="%s" y="%s" font-size="%s" fill="%s" text-anchor="%s">%s</text>`+"\n",
+		num(x), num(y), num(size), color, anchor, esc(text))
+}
+
+// num formats a coordinate without needless digits.
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
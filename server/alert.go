@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// defaultAlertInterval is how often alerts are generated when ALERT_INTERVAL is not set.
+const defaultAlertInterval = 15 * time.Minute
+
+// alertSchedule returns the job schedule that evaluates the alert rules.
+func (s *Server) alertSchedule() string {
+	interval := defaultAlertInterval
+	if s.Config.AlertInterval != "" {
+		d, err := time.ParseDuration(s.Config.AlertInterval)
+		if err != nil || d <= 0 {
+			s.Logger.Warn("Invalid ALERT_INTERVAL, using default: ", s.Config.AlertInterval)
+		} else {
+			interval = d
+		}
+	}
+
+	return "@every " + interval.String()
+}
+
+// generateAlertsJob evaluates the alert rules. It runs as the alerts.generate job.
+func (s *Server) generateAlertsJob(ctx context.Context, job models.Job) error {
+	run, err := s.db.GenerateAlerts(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.WithField("raised", run.Raised).
+		WithField("updated", run.Updated).
+		WithField("resolved", run.Resolved).
+		Info("Alerts generated")
+
+	return nil
+}
+
+func (s *Server) GenerateAlerts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	run, err := s.db.GenerateAlerts(ctx)
+	if err != nil {
+		s.Logger.WithError(err).Error("Failed to generate alerts")
+		errorResposne(w, http.StatusInternalServerError, "Failed to generate alerts")
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, run)
+}
+
+func (s *Server) GetAlertTypes(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	alertTypes, err := s.db.GetAlertTypes(ctx)
+	if err != nil {
+		s.Logger.Error("Failed to get alert types from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, alertTypes)
+}
+
+func (s *Server) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	status := r.URL.Query().Get("status")
+	severity := r.URL.Query().Get("severity")
+	customerId := r.URL.Query().Get("customer_id")
+	facilityId := r.URL.Query().Get("facility_id")
+
+	alerts, total, err := s.db.GetAlerts(ctx, status, severity, customerId, facilityId, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get alerts from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  alerts,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	s.alertAction(w, r, s.db.AcknowledgeAlert, "Alert acknowledged successfully")
+}
+
+func (s *Server) ResolveAlert(w http.ResponseWriter, r *http.Request) {
+	s.alertAction(w, r, s.db.ResolveAlert, "Alert resolved successfully")
+}
+
+// alertAction decodes an AlertAction and applies it to the alert in the path.
+func (s *Server) alertAction(
+	w http.ResponseWriter,
+	r *http.Request,
+	apply func(context.Context, uint, models.AlertAction) (models.Alert, error),
+	message string,
+) {
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert alert id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Alert id is required")
+		return
+	}
+
+	action := models.AlertAction{}
+	if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := action.Validate(); err != nil {
+		s.Logger.Error("Failed to validate alert action: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	alert, err := apply(ctx, id, action)
+	if err != nil {
+		s.Logger.Error("Failed to update alert: ", err)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			errorResposne(w, http.StatusNotFound, "Alert not found")
+		case errors.Is(err, database.ErrAlertResolved):
+			errorResposne(w, http.StatusConflict, err.Error())
+		default:
+			errorResposne(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	res := map[string]interface{}{
+		"alert":   alert,
+		"message": message,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
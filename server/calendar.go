@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/ical"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// Calendar feeds cover overdue dates from the last month and everything due
+// in the coming year.
+const (
+	calendarPastDays   = 30
+	calendarFutureDays = 365
+)
+
+func (s *Server) SetCustomerCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	s.setCalendarFeed(w, r, "customer")
+}
+
+func (s *Server) GetCustomerCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	s.getCalendarFeed(w, r, "customer")
+}
+
+func (s *Server) DeleteCustomerCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	s.deleteCalendarFeed(w, r, "customer")
+}
+
+func (s *Server) SetUserCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	s.setCalendarFeed(w, r, "user")
+}
+
+func (s *Server) GetUserCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	s.getCalendarFeed(w, r, "user")
+}
+
+func (s *Server) DeleteUserCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	s.deleteCalendarFeed(w, r, "user")
+}
+
+// calendarFeedOwner reads the customer or user id a feed belongs to.
+func (s *Server) calendarFeedOwner(r *http.Request, owner string) (*uint, *uint, error) {
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if owner == "customer" {
+		return &id, nil, nil
+	}
+	return nil, &id, nil
+}
+
+// setCalendarFeed creates a feed, or rotates the token of an existing one.
+func (s *Server) setCalendarFeed(w http.ResponseWriter, r *http.Request, owner string) {
+
+	ctx := context.TODO()
+
+	customerId, userId, err := s.calendarFeedOwner(r, owner)
+	if err != nil {
+		s.Logger.Error("Failed to convert "+owner+" id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Id is required")
+		return
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		s.Logger.Error("Failed to generate calendar token: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	feed, err := s.db.SetCalendarFeed(ctx, models.CalendarFeed{Token: token, CustomerID: customerId, UserID: userId})
+	if err != nil {
+		s.Logger.Error("Failed to save calendar feed: ", err)
+		s.calendarError(w, err)
+		return
+	}
+	feed.URL = calendarFeedURL(r, feed.Token)
+
+	res := map[string]interface{}{
+		"id":      feed.ID,
+		"feed":    feed,
+		"message": "Calendar feed created successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) getCalendarFeed(w http.ResponseWriter, r *http.Request, owner string) {
+
+	ctx := context.TODO()
+
+	customerId, userId, err := s.calendarFeedOwner(r, owner)
+	if err != nil {
+		s.Logger.Error("Failed to convert "+owner+" id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Id is required")
+		return
+	}
+
+	feed, err := s.db.GetOwnerCalendarFeed(ctx, customerId, userId)
+	if err != nil {
+		s.Logger.Error("Failed to get calendar feed from db: ", err)
+		s.calendarError(w, err)
+		return
+	}
+	feed.URL = calendarFeedURL(r, feed.Token)
+
+	writeJSONResponse(w, http.StatusOK, feed)
+}
+
+func (s *Server) deleteCalendarFeed(w http.ResponseWriter, r *http.Request, owner string) {
+
+	ctx := context.TODO()
+
+	customerId, userId, err := s.calendarFeedOwner(r, owner)
+	if err != nil {
+		s.Logger.Error("Failed to convert "+owner+" id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Id is required")
+		return
+	}
+
+	if err := s.db.DeleteCalendarFeed(ctx, customerId, userId); err != nil {
+		s.Logger.Error("Failed to delete calendar feed: ", err)
+		s.calendarError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"message": "Calendar feed deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetCalendar serves the iCalendar feed behind a secret token. It is what
+// calendar apps subscribe to, so it needs nothing but the token; facility_id
+// narrows it to the devices of one facility.
+func (s *Server) GetCalendar(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	feed, err := s.db.GetCalendarFeed(ctx, mux.Vars(r)["token"])
+	if err != nil {
+		s.Logger.Error("Failed to get calendar feed from db: ", err)
+		s.calendarError(w, err)
+		return
+	}
+
+	facilityId := r.URL.Query().Get("facility_id")
+	if _, err := s.stringToUint(facilityId); facilityId != "" && err != nil {
+		errorResposne(w, http.StatusBadRequest, "facility_id must be a number")
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	tasks, err := s.db.GetCalendarTasks(ctx, feed.CustomerID, feed.UserID, facilityId,
+		today.AddDate(0, 0, -calendarPastDays), today.AddDate(0, 0, calendarFutureDays))
+	if err != nil {
+		s.Logger.Error("Failed to get calendar tasks from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cal := ical.Calendar{Name: feed.Name + " inspections and expiries"}
+	for _, task := range tasks {
+		cal.Events = append(cal.Events, calendarEvent(task))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	w.WriteHeader(http.StatusOK)
+
+	if err := ical.Write(w, cal); err != nil {
+		s.Logger.Error("unable to write calendar to response", err.Error())
+	}
+}
+
+// calendarEvent turns a task into an event. The UID only depends on the
+// device and the kind of date, so a device that is serviced moves its event
+// rather than leaving the old one behind.
+func calendarEvent(task models.CalendarTask) ical.Event {
+	summary := fmt.Sprintf("Inspection due: %s at %s", task.ProductName, task.StationName)
+	if task.Kind == models.CalendarExpiry {
+		summary = fmt.Sprintf("Expires: %s at %s", task.ProductName, task.StationName)
+	}
+
+	floorPlan := task.FloorPlanName
+	if floorPlan == "" {
+		floorPlan = "none"
+	}
+
+	lines := []string{"Customer: " + task.CustomerName}
+	if task.FacilityName != "" {
+		lines = append(lines, "Facility: "+task.FacilityName)
+	}
+	lines = append(lines,
+		"Station: "+task.StationName,
+		"Floor plan: "+floorPlan,
+		fmt.Sprintf("Device: #%d %s", task.StationProductID, task.ProductName),
+	)
+	description := strings.Join(lines, "\n")
+
+	location := task.StationName
+	if task.FloorPlanName != "" {
+		location += ", " + task.FloorPlanName
+	}
+	if task.FacilityName != "" {
+		location += ", " + task.FacilityName
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("device-%d-%s@linmed", task.StationProductID, task.Kind),
+		Date:        task.Date,
+		Summary:     summary,
+		Description: description,
+		Location:    location,
+		Categories:  []string{task.Kind},
+		Sequence:    task.Version,
+		Modified:    task.UpdatedAt,
+	}
+}
+
+// calendarFeedURL is the absolute URL calendar apps subscribe to.
+func calendarFeedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return fmt.Sprintf("%s://%s/api/v1/calendar/%s.ics", scheme, r.Host, token)
+}
+
+func (s *Server) calendarError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Calendar feed not found")
+	case errors.Is(err, database.ErrCustomerNotFound):
+		errorResposne(w, http.StatusNotFound, "Customer not found")
+	case errors.Is(err, database.ErrUserNotFound):
+		errorResposne(w, http.StatusNotFound, "User not found")
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) AddChecklistTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	template := models.ChecklistTemplate{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := template.Validate(); err != nil {
+		s.Logger.Error("Failed to validate checklist template: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.db.AddChecklistTemplate(ctx, template)
+	if err != nil {
+		s.Logger.Error("Failed to save checklist template to db: ", err)
+		s.checklistError(w, err, "Checklist template not found")
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Checklist template added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetChecklistTemplates lists active templates, narrowed by the category_id
+// and product_id query parameters. inactive=true lists inactive ones too.
+func (s *Server) GetChecklistTemplates(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	categoryId := r.URL.Query().Get("category_id")
+	productId := r.URL.Query().Get("product_id")
+	includeInactive := r.URL.Query().Get("inactive") == "true"
+
+	templates, err := s.db.GetChecklistTemplates(ctx, categoryId, productId, includeInactive)
+	if err != nil {
+		s.Logger.Error("Failed to get checklist templates from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(templates),
+		Data:  templates,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetChecklistTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert checklist template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Checklist template id is required")
+		return
+	}
+
+	template, err := s.db.GetChecklistTemplate(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get checklist template from db: ", err)
+		s.checklistError(w, err, "Checklist template not found")
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, template)
+}
+
+func (s *Server) UpdateChecklistTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert checklist template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Checklist template id is required")
+		return
+	}
+
+	template := models.ChecklistTemplate{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := template.Validate(); err != nil {
+		s.Logger.Error("Failed to validate checklist template: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.UpdateChecklistTemplate(ctx, id, template); err != nil {
+		s.Logger.Error("Failed to update checklist template: ", err)
+		s.checklistError(w, err, "Checklist template not found")
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Checklist template updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) DeleteChecklistTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert checklist template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Checklist template id is required")
+		return
+	}
+
+	if err := s.db.DeleteChecklistTemplate(ctx, id); err != nil {
+		s.Logger.Error("Failed to delete checklist template: ", err)
+		s.checklistError(w, err, "Checklist template not found")
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Checklist template deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetChecklistReport summarises a template's results, narrowed by the
+// customer_id, facility_id, from and to query parameters.
+func (s *Server) GetChecklistReport(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert checklist template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Checklist template id is required")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		s.Logger.Error("Failed to parse date range: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := s.db.GetChecklistReport(ctx, id, r.URL.Query().Get("customer_id"), r.URL.Query().Get("facility_id"),
+		from, to)
+	if err != nil {
+		s.Logger.Error("Failed to get checklist report from db: ", err)
+		s.checklistError(w, err, "Checklist template not found")
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, report)
+}
+
+// GetDeviceChecklist returns the checklist a technician fills in for a device.
+func (s *Server) GetDeviceChecklist(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	template, err := s.db.GetDeviceChecklist(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get device checklist from db: ", err)
+		s.checklistError(w, err, "Device not found")
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, template)
+}
+
+func (s *Server) SubmitChecklist(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	submission := models.ChecklistSubmission{}
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := submission.Validate(); err != nil {
+		s.Logger.Error("Failed to validate checklist submission: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := s.db.SubmitChecklist(ctx, id, submission)
+	if err != nil {
+		s.Logger.Error("Failed to submit checklist: ", err)
+		s.checklistError(w, err, "Device not found")
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      result.ID,
+		"result":  result,
+		"message": "Checklist submitted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetChecklistResults lists submitted checklists, narrowed by the
+// customer_id, device_id, template_id, facility_id, passed, from and to query
+// parameters.
+func (s *Server) GetChecklistResults(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	customerId := r.URL.Query().Get("customer_id")
+	deviceId := r.URL.Query().Get("device_id")
+	templateId := r.URL.Query().Get("template_id")
+	facilityId := r.URL.Query().Get("facility_id")
+
+	var passed *bool
+	if value := r.URL.Query().Get("passed"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			s.Logger.Error("Failed to parse passed: ", err)
+			errorResposne(w, http.StatusBadRequest, "passed must be true or false")
+			return
+		}
+		passed = &b
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		s.Logger.Error("Failed to parse date range: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, total, err := s.db.GetChecklistResults(ctx, customerId, deviceId, templateId, facilityId, passed, from, to, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get checklist results from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  results,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetChecklistResult(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert checklist result id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Checklist result id is required")
+		return
+	}
+
+	result, err := s.db.GetChecklistResult(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get checklist result from db: ", err)
+		s.checklistError(w, err, "Checklist result not found")
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, result)
+}
+
+func (s *Server) checklistError(w http.ResponseWriter, err error, notFound string) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, notFound)
+	case errors.Is(err, database.ErrNoChecklist):
+		errorResposne(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrProductNotFound), errors.Is(err, database.ErrCategoryNotFound),
+		errors.Is(err, database.ErrUserNotFound), errors.Is(err, database.ErrChecklistNotApplicable),
+		errors.Is(err, database.ErrInvalidChecklistResponse), errors.Is(err, database.ErrDeviceNotOnWorkOrder):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/aakash-tyagi/linmed/coverage"
+	"github.com/aakash-tyagi/linmed/geo"
+	"github.com/aakash-tyagi/linmed/models"
+)
+
+const (
+	// defaultCoverageSuggestions is how many extra stations are suggested
+	// unless asked otherwise, and maxCoverageSuggestions the most allowed.
+	defaultCoverageSuggestions = 5
+	maxCoverageSuggestions     = 20
+
+	// the floor is divided into at most maxCoverageCells cells along its
+	// longer side, defaultCoverageCells unless a resolution is asked for,
+	// and cells are never smaller than minCoverageResolution metres
+	defaultCoverageCells  = 200
+	maxCoverageCells      = 400
+	minCoverageResolution = 0.25
+)
+
+// GetFloorPlanCoverage analyses which rooms of a floor plan, or which parts
+// of the floor when its layout has no rooms, are out of reach of its
+// stations. Each station reaches as far as the largest coverage amount, in
+// metres, of its devices, or distance when given. Distances are walked around
+// the layout's walls, through its doors, when it has walls; mode=straight
+// measures them in a straight line instead.
+//
+// Query parameters: distance and resolution in metres, mode (straight or
+// walking), suggestions (how many extra stations to suggest), and
+// product_id or category_id to count only some devices.
+func (s *Server) GetFloorPlanCoverage(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, layout, ok := s.customerLayout(ctx, w, r)
+	if !ok {
+		return
+	}
+	if layout == nil {
+		errorResposne(w, http.StatusUnprocessableEntity, "Floor plan needs a layout with a scale for coverage analysis")
+		return
+	}
+
+	distance, err := parseFloatParam(r, "distance")
+	if err != nil || (distance != nil && *distance <= 0) {
+		errorResposne(w, http.StatusBadRequest, "distance must be a positive number of metres")
+		return
+	}
+
+	resolution, err := parseFloatParam(r, "resolution")
+	if err != nil || (resolution != nil && *resolution <= 0) {
+		errorResposne(w, http.StatusBadRequest, "resolution must be a positive number of metres")
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.CoverageStraight
+		if len(layout.Walls) > 0 {
+			mode = models.CoverageWalking
+		}
+	}
+	if mode != models.CoverageStraight && mode != models.CoverageWalking {
+		errorResposne(w, http.StatusBadRequest, "mode must be straight or walking")
+		return
+	}
+
+	suggestions := defaultCoverageSuggestions
+	if value := r.URL.Query().Get("suggestions"); value != "" {
+		suggestions, err = strconv.Atoi(value)
+		if err != nil || suggestions < 0 || suggestions > maxCoverageSuggestions {
+			errorResposne(w, http.StatusBadRequest, "suggestions must be between 0 and 20")
+			return
+		}
+	}
+
+	stations, err := s.db.GetCoverageStations(ctx, floorPlan.ID, r.URL.Query().Get("product_id"),
+		r.URL.Query().Get("category_id"))
+	if err != nil {
+		s.Logger.Error("Failed to get coverage stations from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	analysis := analyseCoverage(layout, stations, mode, distance, resolution, suggestions)
+	analysis.FloorPlanID = floorPlan.ID
+
+	writeJSONResponse(w, http.StatusOK, analysis)
+}
+
+// analyseCoverage runs the analysis in floor plan units and reports it in
+// metres.
+func analyseCoverage(layout *models.Layout, stations []models.CoverageStation, mode string, distance, resolution *float64, suggestions int) models.CoverageAnalysis {
+	longest := math.Max(layout.Width, layout.Height)
+
+	cellSize := math.Max(longest/defaultCoverageCells, minCoverageResolution)
+	if resolution != nil {
+		cellSize = *resolution
+	}
+	cellSize = math.Max(cellSize, longest/maxCoverageCells)
+
+	width, height := layout.Extent()
+	plan := coverage.Plan{
+		Width:    width,
+		Height:   height,
+		CellSize: cellSize * layout.Scale,
+		Walking:  mode == models.CoverageWalking,
+	}
+	for _, room := range layout.Rooms {
+		plan.Areas = append(plan.Areas, room.Polygon)
+	}
+	if plan.Walking {
+		for _, wall := range layout.Walls {
+			plan.Walls = append(plan.Walls, coverage.Wall{From: wall.From, To: wall.To})
+		}
+		for _, door := range layout.Doors {
+			plan.Doors = append(plan.Doors, coverage.Door{Position: door.Position, Width: door.Width * layout.Scale})
+		}
+	}
+
+	// suggested stations reach as far as the required distance, or the
+	// furthest reaching station already there
+	var sources []coverage.Source
+	suggestRadius := 0.0
+	for _, station := range stations {
+		radius := station.Radius
+		if distance != nil {
+			radius = distance
+		}
+		if radius == nil {
+			continue
+		}
+		sources = append(sources, coverage.Source{
+			Position: geo.Point{X: station.LocationX, Y: station.LocationY},
+			Radius:   *radius * layout.Scale,
+		})
+		suggestRadius = math.Max(suggestRadius, *radius*layout.Scale)
+	}
+	if distance != nil {
+		suggestRadius = *distance * layout.Scale
+	}
+
+	result := coverage.Analyse(plan, sources, suggestions, suggestRadius)
+
+	cellArea := cellSize * cellSize
+	analysis := models.CoverageAnalysis{
+		Mode:        mode,
+		Resolution:  roundTo(cellSize, 3),
+		Distance:    distance,
+		Rooms:       []models.CoverageArea{},
+		Suggestions: []models.CoverageSuggestion{},
+		Stations:    stations,
+	}
+	if analysis.Stations == nil {
+		analysis.Stations = []models.CoverageStation{}
+	}
+
+	cells, covered := 0, 0
+	for i := range result.Cells {
+		area := models.CoverageArea{
+			Name:            "Floor",
+			Area:            roundTo(float64(result.Cells[i])*cellArea, 2),
+			Covered:         roundTo(float64(result.Covered[i])*cellArea, 2),
+			CoveragePercent: coveragePercent(result.Covered[i], result.Cells[i]),
+			Uncovered:       result.Uncovered[i],
+		}
+		if len(layout.Rooms) > 0 {
+			area.RoomID, area.Name = layout.Rooms[i].ID, layout.Rooms[i].Name
+		}
+		if area.Uncovered == nil {
+			area.Uncovered = []geo.Polygon{}
+		}
+		analysis.Rooms = append(analysis.Rooms, area)
+
+		cells += result.Cells[i]
+		covered += result.Covered[i]
+	}
+	analysis.Area = roundTo(float64(cells)*cellArea, 2)
+	analysis.Covered = roundTo(float64(covered)*cellArea, 2)
+	analysis.CoveragePercent = coveragePercent(covered, cells)
+
+	for _, suggestion := range result.Suggestions {
+		s := models.CoverageSuggestion{
+			Position: suggestion.Position,
+			Gain:     roundTo(float64(suggestion.Cells)*cellArea, 2),
+		}
+		if rooms := layout.AreasAt(models.LayoutRoom, suggestion.Position); len(rooms) > 0 {
+			s.RoomID = rooms[0].ID
+		}
+		analysis.Suggestions = append(analysis.Suggestions, s)
+	}
+
+	return analysis
+}
+
+func coveragePercent(covered, cells int) float64 {
+	if cells == 0 {
+		return 100
+	}
+	return roundTo(float64(covered)/float64(cells)*100, 2)
+}
+
+func roundTo(f float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p
+}
@@ -5,10 +5,12 @@ import (
 	"net/http"
 )
 
+// GetAllNumbers returns the overall counts, or those of a facility when
+// facility_id is given.
 func (s *Server) GetAllNumbers(w http.ResponseWriter, r *http.Request) {
 	ctx := context.TODO()
 
-	numbers, err := s.db.GetAllNumbers(ctx)
+	numbers, err := s.db.GetAllNumbers(ctx, r.URL.Query().Get("facility_id"))
 	if err != nil {
 		s.Logger.Error("Failed to get numbers from db: ", err)
 		errorResposne(w, http.StatusInternalServerError, err.Error())
@@ -34,11 +36,12 @@ func (s *Server) GetExpiryTasks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	customerId := r.URL.Query().Get("customerId")
+	facilityId := r.URL.Query().Get("facility_id")
 
 	// Get pagination parameters
 	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
 
-	tasks, total, err := s.db.GetExpiringProducts(ctx, startDate, endDate, customerId, page, limit)
+	tasks, total, err := s.db.GetExpiringProducts(ctx, startDate, endDate, customerId, facilityId, page, limit)
 	if err != nil {
 		s.Logger.WithError(err).Error("Failed to fetch expiring products")
 		errorResposne(w, http.StatusInternalServerError, "Failed to fetch expiring products")
@@ -68,10 +71,12 @@ func (s *Server) GetInspectionTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	facilityId := r.URL.Query().Get("facility_id")
+
 	// Get pagination parameters
 	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
 
-	tasks, total, err := s.db.GetInspectionTasks(ctx, startDate, endDate, page, limit)
+	tasks, total, err := s.db.GetInspectionTasks(ctx, startDate, endDate, facilityId, page, limit)
 	if err != nil {
 		s.Logger.WithError(err).Error("Failed to fetch inspection tasks")
 		errorResposne(w, http.StatusInternalServerError, "Failed to fetch inspection tasks")
@@ -85,3 +90,23 @@ func (s *Server) GetInspectionTasks(w http.ResponseWriter, r *http.Request) {
 
 	writeJSONResponse(w, http.StatusOK, res)
 }
+
+// GetFacilityDashboard returns the counts of each facility, narrowed by the
+// customer_id and facility_id query parameters.
+func (s *Server) GetFacilityDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	summaries, err := s.db.GetFacilitySummaries(ctx, r.URL.Query().Get("customer_id"), r.URL.Query().Get("facility_id"))
+	if err != nil {
+		s.Logger.Error("Failed to get facility summaries from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(summaries),
+		Data:  summaries,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
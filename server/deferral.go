@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// RequestDeferral asks for a device's inspection or expiry date to be moved.
+func (s *Server) RequestDeferral(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	deviceId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	deferral := models.Deferral{}
+	if err := json.NewDecoder(r.Body).Decode(&deferral); err != nil {
+		s.Logger.Error("Failed to decode deferral: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	deferral.StationProductID = deviceId
+
+	if err := deferral.Validate(); err != nil {
+		s.Logger.Error("Failed to validate deferral: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.db.RequestDeferral(ctx, deferral)
+	if err != nil {
+		s.Logger.Error("Failed to save deferral to db: ", err)
+		s.deferralError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Deferral requested successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetDeferral(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert deferral id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Deferral id is required")
+		return
+	}
+
+	deferral, err := s.db.GetDeferral(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get deferral from db: ", err)
+		s.deferralError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, deferral)
+}
+
+// GetCustomerDeferrals lists a customer's deferrals, optionally by status,
+// kind and facility.
+func (s *Server) GetCustomerDeferrals(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	status := r.URL.Query().Get("status")
+	kind := r.URL.Query().Get("kind")
+	facilityId := r.URL.Query().Get("facility_id")
+
+	deferrals, total, err := s.db.GetDeferrals(ctx, customerId, status, kind, facilityId, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get deferrals from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  deferrals,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) ApproveDeferral(w http.ResponseWriter, r *http.Request) {
+	s.decideDeferral(w, r, true)
+}
+
+func (s *Server) RejectDeferral(w http.ResponseWriter, r *http.Request) {
+	s.decideDeferral(w, r, false)
+}
+
+func (s *Server) decideDeferral(w http.ResponseWriter, r *http.Request, approve bool) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert deferral id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Deferral id is required")
+		return
+	}
+
+	decision := models.DeferralDecision{}
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		s.Logger.Error("Failed to decode deferral decision: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := decision.Validate(); err != nil {
+		s.Logger.Error("Failed to validate deferral decision: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deferral, err := s.db.DecideDeferral(ctx, id, approve, decision)
+	if err != nil {
+		s.Logger.Error("Failed to decide deferral: ", err)
+		s.deferralError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":       id,
+		"deferral": deferral,
+		"message":  "Deferral " + string(deferral.Status) + " successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) deferralError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Deferral or device not found")
+	case errors.Is(err, database.ErrUserNotFound), errors.Is(err, database.ErrInvalidDeferralDate):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrNotSupervisor):
+		errorResposne(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, database.ErrDeferralPending), errors.Is(err, database.ErrDeferralDecided),
+		errors.Is(err, database.ErrDeferralOutdated):
+		errorResposne(w, http.StatusConflict, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/media"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// maxEvidenceSize is the largest photo or signature accepted.
+const maxEvidenceSize = 10 << 20
+
+// AddEvidence uploads a photo or signature to a work order. The multipart
+// form carries the image plus type, uploaded_by and, for signatures,
+// signer_name. station_product_id, caption, captured_at (RFC 3339),
+// latitude and longitude are optional; the capture time and position found
+// in the image's EXIF data take precedence over the ones sent.
+func (s *Server) AddEvidence(w http.ResponseWriter, r *http.Request) {
+
+	workOrderId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert work order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Work order id is required")
+		return
+	}
+
+	s.uploadEvidence(w, r, &workOrderId, nil, fmt.Sprintf("evidence/workorders/%d", workOrderId))
+}
+
+// AddDeviceEvidence uploads a photo of a device taken outside any work
+// order, to be answered in the device's next checklist. It takes the same
+// form as AddEvidence, without station_product_id.
+func (s *Server) AddDeviceEvidence(w http.ResponseWriter, r *http.Request) {
+
+	deviceId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	s.uploadEvidence(w, r, nil, &deviceId, fmt.Sprintf("evidence/devices/%d", deviceId))
+}
+
+// uploadEvidence stores the image of an evidence upload under prefix and
+// records it against the work order or, without one, the device.
+func (s *Server) uploadEvidence(w http.ResponseWriter, r *http.Request, workOrderId, deviceId *uint, prefix string) {
+
+	ctx := context.TODO()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEvidenceSize+1<<20)
+	if err := r.ParseMultipartForm(maxEvidenceSize); err != nil {
+		s.Logger.Error("Failed to parse evidence upload: ", err)
+		errorResposne(w, http.StatusBadRequest, "file size exceeding 10 MB")
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		s.Logger.Error("image not found")
+		errorResposne(w, http.StatusBadRequest, "image not found")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxEvidenceSize+1))
+	if err != nil {
+		s.Logger.Error("Failed to read evidence image: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxEvidenceSize {
+		errorResposne(w, http.StatusBadRequest, "file size exceeding 10 MB")
+		return
+	}
+
+	contentType, ext, err := media.DetectImage(data)
+	if err != nil {
+		s.Logger.Error("Failed to detect evidence image type: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	evidence, err := evidenceFromForm(r)
+	if err != nil {
+		s.Logger.Error("Failed to read evidence form: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	evidence.WorkOrderID = workOrderId
+	if workOrderId == nil {
+		evidence.StationProductID = deviceId
+	}
+	evidence.ContentType = contentType
+	evidence.Size = int64(len(data))
+
+	sum := sha256.Sum256(data)
+	evidence.SHA256 = hex.EncodeToString(sum[:])
+
+	applyImageMetadata(&evidence, media.ImageMetadata(data))
+
+	if err := evidence.Validate(); err != nil {
+		s.Logger.Error("Failed to validate evidence: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// every upload gets its own key so stored evidence is never overwritten
+	name, err := randomToken(16)
+	if err != nil {
+		s.Logger.Error("Failed to generate evidence key: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	evidence.ImageKey = fmt.Sprintf("%s/%s.%s", prefix, name, ext)
+
+	if err := s.S3Client.UploadImage(s.Config.BucketName, bytes.NewReader(data), evidence.ImageKey); err != nil {
+		s.Logger.Error("unable to upload", err.Error())
+		errorResposne(w, http.StatusInternalServerError, "unable to upload to s3")
+		return
+	}
+
+	id, err := s.db.AddEvidence(ctx, evidence)
+	if err != nil {
+		s.Logger.Error("Failed to save evidence to db: ", err)
+		if err := s.S3Client.DeleteImage(s.Config.BucketName, evidence.ImageKey); err != nil {
+			s.Logger.Error("Failed to remove unsaved evidence image: ", err)
+		}
+		s.evidenceError(w, err)
+		return
+	}
+	evidence.ID = id
+
+	res := map[string]interface{}{
+		"id":       id,
+		"evidence": evidence,
+		"message":  "Evidence added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// evidenceFromForm reads the evidence fields sent alongside the image.
+func evidenceFromForm(r *http.Request) (models.Evidence, error) {
+	evidence := models.Evidence{
+		Type:       r.FormValue("type"),
+		SignerName: r.FormValue("signer_name"),
+		Caption:    r.FormValue("caption"),
+	}
+
+	if value := r.FormValue("uploaded_by"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return evidence, errors.New("invalid uploaded_by")
+		}
+		evidence.UploadedBy = uint(id)
+	}
+
+	if value := r.FormValue("station_product_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return evidence, errors.New("invalid station_product_id")
+		}
+		deviceId := uint(id)
+		evidence.StationProductID = &deviceId
+	}
+
+	if value := r.FormValue("captured_at"); value != "" {
+		capturedAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return evidence, errors.New("invalid captured_at")
+		}
+		evidence.CapturedAt = &capturedAt
+	}
+
+	latitude, longitude := r.FormValue("latitude"), r.FormValue("longitude")
+	if (latitude == "") != (longitude == "") {
+		return evidence, errors.New("latitude and longitude must be sent together")
+	}
+	if latitude != "" {
+		lat, err := strconv.ParseFloat(latitude, 64)
+		if err != nil {
+			return evidence, errors.New("invalid latitude")
+		}
+		long, err := strconv.ParseFloat(longitude, 64)
+		if err != nil {
+			return evidence, errors.New("invalid longitude")
+		}
+		evidence.Latitude, evidence.Longitude = &lat, &long
+	}
+
+	if evidence.CapturedAt != nil || evidence.Latitude != nil {
+		evidence.MetadataSource = "client"
+	}
+
+	return evidence, nil
+}
+
+// applyImageMetadata prefers what the image says over what the app sent.
+func applyImageMetadata(evidence *models.Evidence, meta media.Metadata) {
+	if meta.TakenAt == nil && meta.Latitude == nil {
+		return
+	}
+
+	if meta.TakenAt != nil {
+		evidence.CapturedAt = meta.TakenAt
+	}
+	if meta.Latitude != nil {
+		evidence.Latitude, evidence.Longitude = meta.Latitude, meta.Longitude
+	}
+	evidence.MetadataSource = "exif"
+}
+
+func (s *Server) GetWorkOrderEvidence(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	workOrderId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert work order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Work order id is required")
+		return
+	}
+
+	evidence, err := s.db.GetWorkOrderEvidence(ctx, workOrderId)
+	if err != nil {
+		s.Logger.Error("Failed to get evidence from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(evidence),
+		Data:  evidence,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetEvidence(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert evidence id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Evidence id is required")
+		return
+	}
+
+	evidence, err := s.db.GetEvidence(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get evidence from db: ", err)
+		s.evidenceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, evidence)
+}
+
+// GetEvidenceImage streams the stored photo or signature.
+func (s *Server) GetEvidenceImage(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert evidence id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Evidence id is required")
+		return
+	}
+
+	evidence, err := s.db.GetEvidence(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get evidence from db: ", err)
+		s.evidenceError(w, err)
+		return
+	}
+
+	imageBody, err := s.S3Client.GetImage(s.Config.BucketName, evidence.ImageKey)
+	if err != nil {
+		s.Logger.Error("unable to retrieve image", err.Error())
+		errorResposne(w, http.StatusInternalServerError, "unable to retrieve image")
+		return
+	}
+	defer imageBody.Close()
+
+	w.Header().Set("Content-Type", evidence.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, imageBody); err != nil {
+		s.Logger.Error("unable to write image to response", err.Error())
+	}
+}
+
+// DeleteEvidence removes evidence uploaded by mistake. Evidence of a closed
+// work order or a submitted checklist cannot be removed.
+func (s *Server) DeleteEvidence(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert evidence id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Evidence id is required")
+		return
+	}
+
+	evidence, err := s.db.DeleteEvidence(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to delete evidence: ", err)
+		s.evidenceError(w, err)
+		return
+	}
+
+	if err := s.S3Client.DeleteImage(s.Config.BucketName, evidence.ImageKey); err != nil {
+		s.Logger.Error("Failed to remove evidence image: ", err)
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Evidence deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) evidenceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Evidence, work order or device not found")
+	case errors.Is(err, database.ErrUserNotFound), errors.Is(err, database.ErrDeviceNotOnWorkOrder):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrEvidenceLocked):
+		errorResposne(w, http.StatusConflict, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
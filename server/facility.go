@@ -0,0 +1,399 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+)
+
+// facilityPathNames names the ids of the facility routes for their error
+// messages.
+var facilityPathNames = map[string]string{
+	"id":         "Customer",
+	"facilityID": "Facility",
+	"buildingID": "Building",
+	"floorID":    "Floor",
+}
+
+// facilityPath reads the named ids of a facility route, in order, writing
+// the error response when one is missing.
+func (s *Server) facilityPath(w http.ResponseWriter, r *http.Request, keys ...string) ([]uint, bool) {
+	ids := make([]uint, len(keys))
+	for i, key := range keys {
+		id, err := s.stringToUint(mux.Vars(r)[key])
+		if err != nil {
+			s.Logger.Error("Failed to convert "+key+" to int: ", err)
+			errorResposne(w, http.StatusBadRequest, facilityPathNames[key]+" id is required")
+			return nil, false
+		}
+		ids[i] = id
+	}
+
+	return ids, true
+}
+
+func (s *Server) AddFacility(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id")
+	if !ok {
+		return
+	}
+
+	facility := models.Facility{}
+	if err := json.NewDecoder(r.Body).Decode(&facility); err != nil {
+		s.Logger.Error("Failed to decode facility: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	facility.CustomerID = ids[0]
+
+	if err := facility.Validate(); err != nil {
+		s.Logger.Error("Failed to validate facility: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.db.AddFacility(ctx, facility)
+	if err != nil {
+		s.Logger.Error("Failed to save facility to db: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Facility added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetFacilities(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id")
+	if !ok {
+		return
+	}
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	facilities, total, err := s.db.GetFacilities(ctx, ids[0], page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get facilities from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  facilities,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetFacility returns a customer's facility with its buildings and floors.
+func (s *Server) GetFacility(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID")
+	if !ok {
+		return
+	}
+
+	facility, err := s.db.GetFacility(ctx, ids[0], ids[1])
+	if err != nil {
+		s.Logger.Error("Failed to get facility from db: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, facility)
+}
+
+func (s *Server) UpdateFacility(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID")
+	if !ok {
+		return
+	}
+
+	facility := models.Facility{}
+	if err := json.NewDecoder(r.Body).Decode(&facility); err != nil {
+		s.Logger.Error("Failed to decode facility: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	facility.CustomerID = ids[0]
+
+	if err := facility.Validate(); err != nil {
+		s.Logger.Error("Failed to validate facility: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.UpdateFacility(ctx, ids[0], ids[1], facility); err != nil {
+		s.Logger.Error("Failed to update facility: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      ids[1],
+		"message": "Facility updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// DeleteFacility removes a facility with its buildings and floors. Its floor
+// plans are kept, no longer on a floor.
+func (s *Server) DeleteFacility(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID")
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteFacility(ctx, ids[0], ids[1]); err != nil {
+		s.Logger.Error("Failed to delete facility: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"message": "Facility deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) AddBuilding(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID")
+	if !ok {
+		return
+	}
+
+	building := models.Building{}
+	if err := json.NewDecoder(r.Body).Decode(&building); err != nil {
+		s.Logger.Error("Failed to decode building: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	building.FacilityID = ids[1]
+
+	if err := building.Validate(); err != nil {
+		s.Logger.Error("Failed to validate building: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	id, err := s.db.AddBuilding(ctx, ids[0], building)
+	if err != nil {
+		s.Logger.Error("Failed to save building to db: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Building added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) UpdateBuilding(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID", "buildingID")
+	if !ok {
+		return
+	}
+
+	building := models.Building{}
+	if err := json.NewDecoder(r.Body).Decode(&building); err != nil {
+		s.Logger.Error("Failed to decode building: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	building.FacilityID = ids[1]
+	building.ID = ids[2]
+
+	if err := building.Validate(); err != nil {
+		s.Logger.Error("Failed to validate building: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	if err := s.db.UpdateBuilding(ctx, ids[0], building); err != nil {
+		s.Logger.Error("Failed to update building: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      building.ID,
+		"message": "Building updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) DeleteBuilding(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID", "buildingID")
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteBuilding(ctx, ids[0], ids[1], ids[2]); err != nil {
+		s.Logger.Error("Failed to delete building: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"message": "Building deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) AddFloor(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID", "buildingID")
+	if !ok {
+		return
+	}
+
+	floor := models.Floor{}
+	if err := json.NewDecoder(r.Body).Decode(&floor); err != nil {
+		s.Logger.Error("Failed to decode floor: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	floor.BuildingID = ids[2]
+
+	if err := floor.Validate(); err != nil {
+		s.Logger.Error("Failed to validate floor: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	id, err := s.db.AddFloor(ctx, ids[0], ids[1], floor)
+	if err != nil {
+		s.Logger.Error("Failed to save floor to db: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Floor added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) UpdateFloor(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID", "buildingID", "floorID")
+	if !ok {
+		return
+	}
+
+	floor := models.Floor{}
+	if err := json.NewDecoder(r.Body).Decode(&floor); err != nil {
+		s.Logger.Error("Failed to decode floor: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	floor.BuildingID = ids[2]
+	floor.ID = ids[3]
+
+	if err := floor.Validate(); err != nil {
+		s.Logger.Error("Failed to validate floor: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	if err := s.db.UpdateFloor(ctx, ids[0], ids[1], floor); err != nil {
+		s.Logger.Error("Failed to update floor: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      floor.ID,
+		"message": "Floor updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// DeleteFloor removes a floor. Its floor plans are kept, no longer on a
+// floor.
+func (s *Server) DeleteFloor(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	ids, ok := s.facilityPath(w, r, "id", "facilityID", "buildingID", "floorID")
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteFloor(ctx, ids[0], ids[1], ids[2], ids[3]); err != nil {
+		s.Logger.Error("Failed to delete floor: ", err)
+		s.facilityError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"message": "Floor deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) facilityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrCustomerNotFound):
+		errorResposne(w, http.StatusNotFound, "Customer not found")
+	case errors.Is(err, database.ErrFacilityNotFound):
+		errorResposne(w, http.StatusNotFound, "Facility not found")
+	case errors.Is(err, database.ErrBuildingNotFound):
+		errorResposne(w, http.StatusNotFound, "Building not found")
+	case errors.Is(err, database.ErrFloorNotFound):
+		errorResposne(w, http.StatusNotFound, "Floor not found")
+	case errors.As(err, new(validator.ValidationErrors)):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
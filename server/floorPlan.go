@@ -3,9 +3,13 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/geo"
 	"github.com/aakash-tyagi/linmed/models"
+	"github.com/go-playground/validator"
 	"github.com/gorilla/mux"
 )
 
@@ -44,7 +48,7 @@ func (s *Server) AddFloorPlan(w http.ResponseWriter, r *http.Request) {
 	// validate floorPlan
 	if err := floorPlan.Validate(); err != nil {
 		s.Logger.Error("Failed to validate floorPlan: ", err)
-		errorResposne(w, http.StatusBadRequest, err.Error())
+		s.floorPlanError(w, err)
 		return
 	}
 
@@ -52,7 +56,7 @@ func (s *Server) AddFloorPlan(w http.ResponseWriter, r *http.Request) {
 	id, err := s.db.AddFloorPlan(ctx, floorPlan)
 	if err != nil {
 		s.Logger.Error("Failed to save floorPlan to db: ", err)
-		errorResposne(w, http.StatusInternalServerError, err.Error())
+		s.floorPlanError(w, err)
 		return
 	}
 
@@ -94,8 +98,12 @@ func (s *Server) GetFloorPlans(w http.ResponseWriter, r *http.Request) {
 	// validate page and limit
 	pageInt, limitInt := s.validatePageLimit(page, limit)
 
+	// narrow to a facility or floor
+	facilityID := r.URL.Query().Get("facility_id")
+	floorID := r.URL.Query().Get("floor_id")
+
 	// Get the floorPlans from the db
-	floorPlans, total, err := s.db.GetFloorPlans(ctx, customerIDUint, pageInt, limitInt)
+	floorPlans, total, err := s.db.GetFloorPlans(ctx, customerIDUint, facilityID, floorID, pageInt, limitInt)
 	if err != nil {
 		s.Logger.Error("Failed to get floorPlans from db: ", err)
 		errorResposne(w, http.StatusInternalServerError, err.Error())
@@ -142,13 +150,18 @@ func (s *Server) UpdateFloorPlan(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.TODO()
 
-	// Get the floorPlan id from the request
-	id := mux.Vars(r)["id"]
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
 
-	// validate id
-	if id == "" {
-		s.Logger.Error("FloorPlan id is required")
-		writeJSONResponse(w, http.StatusBadRequest, "FloorPlan id is required")
+	// Get the floorPlan id from the request
+	id, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "FloorPlan id is required")
 		return
 	}
 
@@ -161,28 +174,31 @@ func (s *Server) UpdateFloorPlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	floorPlan.CustomerID = customerId
+
 	// validate floorPlan
 	if err := floorPlan.Validate(); err != nil {
 		s.Logger.Error("Failed to validate floorPlan: ", err)
-		errorResposne(w, http.StatusBadRequest, err.Error())
+		s.floorPlanError(w, err)
 		return
 	}
 
 	// update floorPlan in db
-	if err := s.db.UpdateFloorPlan(ctx, id, floorPlan); err != nil {
+	revision, err := s.db.UpdateFloorPlan(ctx, customerId, id, floorPlan)
+	if err != nil {
 		s.Logger.Error("Failed to update floorPlan in db: ", err)
-		errorResposne(w, http.StatusInternalServerError, err.Error())
+		s.floorPlanError(w, err)
 		return
 	}
 
-	ID, _ := s.stringToUint(id)
-
 	res := struct {
-		Id      uint   `json:"id"`
-		Message string `json:"message"`
+		Id       uint   `json:"id"`
+		Revision int    `json:"revision"`
+		Message  string `json:"message"`
 	}{
-		Id:      ID,
-		Message: "FloorPlan updated successfully",
+		Id:       id,
+		Revision: revision,
+		Message:  "FloorPlan updated successfully",
 	}
 
 	// return success
@@ -218,3 +234,152 @@ func (s *Server) DeleteFloorPlan(w http.ResponseWriter, r *http.Request) {
 	// return success
 	writeJSONResponse(w, http.StatusOK, res)
 }
+
+func (s *Server) GetFloorPlanRooms(w http.ResponseWriter, r *http.Request) {
+	s.getFloorPlanAreas(w, r, models.LayoutRoom)
+}
+
+func (s *Server) GetFloorPlanZones(w http.ResponseWriter, r *http.Request) {
+	s.getFloorPlanAreas(w, r, models.LayoutZone)
+}
+
+// getFloorPlanAreas lists the rooms or zones of a floor plan's layout.
+func (s *Server) getFloorPlanAreas(w http.ResponseWriter, r *http.Request, kind string) {
+
+	ctx := context.TODO()
+
+	_, layout, ok := s.customerLayout(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	areas := []models.LayoutArea{}
+	if layout != nil && kind == models.LayoutRoom {
+		areas = append(areas, layout.Rooms...)
+	}
+	if layout != nil && kind == models.LayoutZone {
+		areas = append(areas, layout.Zones...)
+	}
+
+	res := paginatedResponse{
+		Total: len(areas),
+		Data:  areas,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetStationRoom says which room, and which zones, of the floor plan's layout
+// a station sits in. Room is null when the station is in none, or has no
+// position.
+func (s *Server) GetStationRoom(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, layout, ok := s.customerLayout(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	station, err := s.db.GetStation(ctx, mux.Vars(r)["stationID"])
+	if err != nil || station.FloorPlanID == nil || *station.FloorPlanID != floorPlan.ID {
+		s.Logger.Error("Failed to get station from db: ", err)
+		errorResposne(w, http.StatusNotFound, "Station not found on this floor plan")
+		return
+	}
+
+	var (
+		room  *models.LayoutArea
+		zones = []models.LayoutArea{}
+	)
+	if layout != nil && station.LocationX != nil && station.LocationY != nil {
+		position := geo.Point{X: *station.LocationX, Y: *station.LocationY}
+		if rooms := layout.AreasAt(models.LayoutRoom, position); len(rooms) > 0 {
+			room = &rooms[0]
+		}
+		zones = append(zones, layout.AreasAt(models.LayoutZone, position)...)
+	}
+
+	res := map[string]interface{}{
+		"station_id": station.ID,
+		"room":       room,
+		"zones":      zones,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// requestFloorPlan loads the customer's floor plan named in the request,
+// writing the error response when it cannot.
+func (s *Server) requestFloorPlan(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.FloorPlan, bool) {
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return models.FloorPlan{}, false
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Floor id is required")
+		return models.FloorPlan{}, false
+	}
+
+	floorPlan, err := s.db.GetCustomerFloorPlan(ctx, customerId, floorPlanId)
+	if err != nil {
+		s.Logger.Error("Failed to get floorPlan from db: ", err)
+		s.floorPlanError(w, err)
+		return floorPlan, false
+	}
+
+	return floorPlan, true
+}
+
+// customerLayout loads the layout of the customer's floor plan named in the
+// request, writing the error response when it cannot. A floor plan without a
+// layout gives nil.
+func (s *Server) customerLayout(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.FloorPlan, *models.Layout, bool) {
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return floorPlan, nil, false
+	}
+	if floorPlan.Layout == "" {
+		return floorPlan, nil, true
+	}
+
+	layout, err := models.ParseLayout(floorPlan.Layout)
+	if err != nil {
+		s.Logger.Error("Failed to parse floor plan layout: ", err)
+		errorResposne(w, http.StatusUnprocessableEntity, "Floor plan layout does not match the layout schema, update it first")
+		return floorPlan, nil, false
+	}
+
+	return floorPlan, layout, true
+}
+
+// floorPlanError maps floor plan errors; an invalid layout lists every
+// problem with its path.
+func (s *Server) floorPlanError(w http.ResponseWriter, err error) {
+	var layoutErrs models.LayoutErrors
+	switch {
+	case errors.As(err, &layoutErrs):
+		writeJSONResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"status": "error",
+			"error":  err.Error(),
+			"errors": layoutErrs,
+		})
+	case errors.Is(err, database.ErrFloorPlanNotFound):
+		errorResposne(w, http.StatusNotFound, "Floor plan not found")
+	case errors.Is(err, database.ErrRevisionNotFound):
+		errorResposne(w, http.StatusNotFound, "Floor plan revision not found")
+	case errors.Is(err, database.ErrFloorNotFound):
+		errorResposne(w, http.StatusBadRequest, "Floor not found")
+	case errors.Is(err, database.ErrPositionOutOfBounds):
+		errorResposne(w, http.StatusConflict, err.Error())
+	case errors.As(err, new(validator.ValidationErrors)):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/geo"
+	"github.com/aakash-tyagi/linmed/media"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/aakash-tyagi/linmed/render"
+	"github.com/gorilla/mux"
+)
+
+// maxBackgroundSize is the largest floor plan background accepted.
+const maxBackgroundSize = 20 << 20
+
+// defaultPlanSize is the size a floor plan without dimensions is drawn at
+// when none of its stations is placed either.
+const defaultPlanSize = 100
+
+// stationStatusStyles gives each station status its marker colour and legend
+// label, worst first.
+var stationStatusStyles = []struct {
+	status models.StationStatus
+	color  string
+	label  string
+}{
+	{models.StationExpired, "#d32f2f", "Expired device"},
+	{models.StationOverdue, "#f57c00", "Inspection overdue"},
+	{models.StationAttention, "#fbc02d", "Needs attention"},
+	{models.StationExpiring, "#1976d2", fmt.Sprintf("Expiring within %d days", models.StationExpiringDays)},
+	{models.StationOK, "#388e3c", "In date"},
+	{models.StationEmpty, "#9e9e9e", "No devices"},
+}
+
+// UploadFloorPlanBackground stores the image a floor plan is drawn on. The
+// multipart form carries the file as image, a PNG, JPEG, SVG or PDF, and for
+// a PDF optionally the page showing the floor, the first unless given. The
+// page is rendered to a PNG once here and stored in place of the PDF.
+func (s *Server) UploadFloorPlanBackground(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Floor id is required")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackgroundSize+1<<20)
+	if err := r.ParseMultipartForm(maxBackgroundSize); err != nil {
+		s.Logger.Error("Failed to parse background upload: ", err)
+		errorResposne(w, http.StatusBadRequest, "file size exceeding 20 MB")
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		s.Logger.Error("image not found")
+		errorResposne(w, http.StatusBadRequest, "image not found")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBackgroundSize+1))
+	if err != nil {
+		s.Logger.Error("Failed to read background: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxBackgroundSize {
+		errorResposne(w, http.StatusBadRequest, "file size exceeding 20 MB")
+		return
+	}
+
+	contentType, ext, err := media.DetectBackground(data)
+	if err != nil {
+		s.Logger.Error("Failed to detect background type: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var page *int
+	if value := r.FormValue("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			errorResposne(w, http.StatusBadRequest, "page must be a positive number")
+			return
+		}
+		if ext != "pdf" {
+			errorResposne(w, http.StatusBadRequest, "page is only used for PDF backgrounds")
+			return
+		}
+		page = &n
+	}
+
+	if ext == "pdf" {
+		if page == nil {
+			first := 1
+			page = &first
+		}
+		data, err = media.RenderPDFPage(r.Context(), s.pdfRenderer(), data, *page)
+		if errors.Is(err, media.ErrPDFPage) {
+			s.Logger.Error("Failed to render PDF background: ", err)
+			errorResposne(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.Logger.Error("Failed to render PDF background: ", err)
+			errorResposne(w, http.StatusInternalServerError, media.ErrPDFRenderer.Error())
+			return
+		}
+		contentType, ext = "image/png", "png"
+	}
+
+	// every upload gets its own key, which is also the ETag it is cached by
+	name, err := randomToken(16)
+	if err != nil {
+		s.Logger.Error("Failed to generate background key: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	key := fmt.Sprintf("floorplans/%d/%s.%s", floorPlanId, name, ext)
+
+	if err := s.S3Client.UploadImage(s.Config.BucketName, bytes.NewReader(data), key); err != nil {
+		s.Logger.Error("unable to upload", err.Error())
+		errorResposne(w, http.StatusInternalServerError, "unable to upload to s3")
+		return
+	}
+
+	oldKey, err := s.db.SetFloorPlanBackground(ctx, customerId, floorPlanId, key, contentType, page)
+	if err != nil {
+		s.Logger.Error("Failed to save floor plan background: ", err)
+		if err := s.S3Client.DeleteImage(s.Config.BucketName, key); err != nil {
+			s.Logger.Error("Failed to remove unsaved background: ", err)
+		}
+		s.floorPlanError(w, err)
+		return
+	}
+	s.removeBackground(oldKey)
+
+	res := map[string]interface{}{
+		"id":              floorPlanId,
+		"background_type": contentType,
+		"background_page": page,
+		"message":         "Background uploaded successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetFloorPlanBackground returns the uploaded background as it was stored.
+func (s *Server) GetFloorPlanBackground(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+	if floorPlan.BackgroundKey == "" {
+		errorResposne(w, http.StatusNotFound, "Floor plan has no background")
+		return
+	}
+
+	// the URL stays the same when the background is replaced, but every
+	// upload has its own key, so the key tells the versions apart
+	etag := `"` + strings.TrimSuffix(path.Base(floorPlan.BackgroundKey), path.Ext(floorPlan.BackgroundKey)) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err := s.S3Client.GetImage(s.Config.BucketName, floorPlan.BackgroundKey)
+	if err != nil {
+		s.Logger.Error("unable to retrieve background", err.Error())
+		errorResposne(w, http.StatusInternalServerError, "unable to retrieve background")
+		return
+	}
+	defer body.Close()
+
+	// an uploaded SVG may carry scripts; it must never run as a document on
+	// this origin, so it is only ever sandboxed and offered as a download
+	w.Header().Set("Content-Type", floorPlan.BackgroundType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+	if floorPlan.BackgroundType == "image/svg+xml" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=floorplan-%d-background.svg", floorPlan.ID))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, body); err != nil {
+		s.Logger.Error("unable to write background to response", err.Error())
+	}
+}
+
+func (s *Server) DeleteFloorPlanBackground(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Floor id is required")
+		return
+	}
+
+	oldKey, err := s.db.SetFloorPlanBackground(ctx, customerId, floorPlanId, "", "", nil)
+	if err != nil {
+		s.Logger.Error("Failed to remove floor plan background: ", err)
+		s.floorPlanError(w, err)
+		return
+	}
+	s.removeBackground(oldKey)
+
+	res := map[string]interface{}{
+		"id":      floorPlanId,
+		"message": "Background deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// etagMatches reports whether an If-None-Match header names etag.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// removeBackground deletes a background that is no longer used. Failing to
+// only leaves an orphaned object behind, so it is logged and not reported.
+func (s *Server) removeBackground(key string) {
+	if key == "" {
+		return
+	}
+	if err := s.S3Client.DeleteImage(s.Config.BucketName, key); err != nil {
+		s.Logger.Error("Failed to remove replaced background: ", err)
+	}
+}
+
+// RenderFloorPlan draws a floor plan as a printable SVG: its background, the
+// rooms, zones, walls, doors and points of its layout, and every placed
+// station coloured by the worst status of its devices, with a legend.
+func (s *Server) RenderFloorPlan(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	markers, err := s.db.GetStationMarkers(ctx, floorPlan.ID)
+	if err != nil {
+		s.Logger.Error("Failed to get station markers from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	m := render.Map{Title: floorPlan.Name}
+
+	if floorPlan.Layout != "" {
+		layout, err := models.ParseLayout(floorPlan.Layout)
+		if err != nil {
+			m.Notes = append(m.Notes, "The layout does not match the layout schema and is not drawn.")
+		} else {
+			addLayout(&m, layout)
+		}
+	}
+
+	counts := map[models.StationStatus]int{}
+	unplaced := 0
+	for _, marker := range markers {
+		if marker.LocationX == nil || marker.LocationY == nil {
+			unplaced++
+			continue
+		}
+		counts[marker.Status]++
+
+		m.Markers = append(m.Markers, render.Marker{
+			Label:    marker.Name,
+			Position: geo.Point{X: *marker.LocationX, Y: *marker.LocationY},
+			Rotation: marker.Rotation,
+			Color:    stationStatusColor(marker.Status),
+		})
+	}
+
+	for _, style := range stationStatusStyles {
+		m.Legend = append(m.Legend, render.LegendEntry{Label: style.label, Color: style.color, Count: counts[style.status]})
+	}
+	if unplaced > 0 {
+		m.Notes = append(m.Notes, fmt.Sprintf("%d stations have no position and are not shown.", unplaced))
+	}
+
+	m.Width, m.Height = planSize(floorPlan, m.Markers)
+
+	if floorPlan.BackgroundKey != "" {
+		background, err := s.loadBackground(floorPlan)
+		if err != nil {
+			s.Logger.Error("unable to retrieve background", err.Error())
+			errorResposne(w, http.StatusInternalServerError, "unable to retrieve background")
+			return
+		}
+		m.Background = background
+	}
+
+	m.Notes = append(m.Notes, "Generated "+time.Now().UTC().Format("2006-01-02 15:04 MST"))
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	if err := render.Write(w, m); err != nil {
+		s.Logger.Error("Failed to write floor plan render: ", err)
+	}
+}
+
+// pdfRenderer is the command PDF backgrounds are rendered with.
+func (s *Server) pdfRenderer() string {
+	if s.Config.PDFRenderer != "" {
+		return s.Config.PDFRenderer
+	}
+	return "pdftoppm"
+}
+
+func (s *Server) loadBackground(floorPlan models.FloorPlan) (*render.Background, error) {
+	body, err := s.S3Client.GetImage(s.Config.BucketName, floorPlan.BackgroundKey)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBackgroundSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &render.Background{ContentType: floorPlan.BackgroundType, Data: data}, nil
+}
+
+// addLayout adds what a layout draws to a map.
+func addLayout(m *render.Map, layout *models.Layout) {
+	for _, room := range layout.Rooms {
+		m.Rooms = append(m.Rooms, render.Area{Name: room.Name, Polygon: room.Polygon})
+	}
+	for _, zone := range layout.Zones {
+		m.Zones = append(m.Zones, render.Area{Name: zone.Name, Polygon: zone.Polygon})
+	}
+	for _, wall := range layout.Walls {
+		m.Walls = append(m.Walls, render.Wall{From: wall.From, To: wall.To, Thickness: wall.Thickness * layout.Scale})
+	}
+	for _, door := range layout.Doors {
+		m.Doors = append(m.Doors, render.Label{Text: door.ID, Position: door.Position})
+	}
+	for _, point := range layout.Points {
+		m.Points = append(m.Points, render.Label{Text: point.Label, Position: point.Position})
+	}
+}
+
+// planSize is the size a floor plan is drawn at: its own when it has one,
+// otherwise enough to show all its stations.
+func planSize(floorPlan models.FloorPlan, markers []render.Marker) (float64, float64) {
+	if floorPlan.Width != nil && floorPlan.Height != nil {
+		return *floorPlan.Width, *floorPlan.Height
+	}
+
+	width, height := 0.0, 0.0
+	for _, marker := range markers {
+		width = math.Max(width, marker.Position.X)
+		height = math.Max(height, marker.Position.Y)
+	}
+	if width == 0 || height == 0 {
+		return defaultPlanSize, defaultPlanSize
+	}
+
+	// leave room around the outermost stations
+	return width * 1.1, height * 1.1
+}
+
+func stationStatusColor(status models.StationStatus) string {
+	for _, style := range stationStatusStyles {
+		if style.status == status {
+			return style.color
+		}
+	}
+	return "#000000"
+}
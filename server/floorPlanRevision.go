@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// GetFloorPlanRevisions lists the revisions of a customer's floor plan,
+// newest first.
+func (s *Server) GetFloorPlanRevisions(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	revisions, total, err := s.db.GetFloorPlanRevisions(ctx, floorPlan.ID, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get floor plan revisions from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  revisions,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetFloorPlanRevision returns a revision of a customer's floor plan with
+// its layout and station positions.
+func (s *Server) GetFloorPlanRevision(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		s.Logger.Error("Failed to convert revision to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Revision is required")
+		return
+	}
+
+	revision, err := s.db.GetFloorPlanRevision(ctx, floorPlan.ID, number)
+	if err != nil {
+		s.Logger.Error("Failed to get floor plan revision from db: ", err)
+		s.floorPlanError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, revision)
+}
+
+// DiffFloorPlanRevisions compares two revisions of a customer's floor plan,
+// given as the from and to query parameters, listing the rooms, zones and
+// stations added, removed, changed or moved.
+func (s *Server) DiffFloorPlanRevisions(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var revisions [2]models.FloorPlanRevision
+	for i, param := range []string{"from", "to"} {
+		number, err := strconv.Atoi(r.URL.Query().Get(param))
+		if err != nil || number < 1 {
+			errorResposne(w, http.StatusBadRequest, param+" must be a revision number")
+			return
+		}
+
+		revisions[i], err = s.db.GetFloorPlanRevision(ctx, floorPlan.ID, number)
+		if err != nil {
+			s.Logger.Error("Failed to get floor plan revision from db: ", err)
+			s.floorPlanError(w, err)
+			return
+		}
+	}
+
+	writeJSONResponse(w, http.StatusOK, models.DiffRevisions(revisions[0], revisions[1]))
+}
+
+// RollbackFloorPlan restores a customer's floor plan, and the positions of
+// its stations, to an earlier revision. The rollback becomes the newest
+// revision.
+func (s *Server) RollbackFloorPlan(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "FloorPlan id is required")
+		return
+	}
+
+	number, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		s.Logger.Error("Failed to convert revision to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Revision is required")
+		return
+	}
+
+	revision, err := s.db.RollbackFloorPlan(ctx, customerId, floorPlanId, number)
+	if err != nil {
+		s.Logger.Error("Failed to roll back floor plan in db: ", err)
+		s.floorPlanError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"id":               floorPlanId,
+		"revision":         revision,
+		"rolled_back_from": number,
+		"message":          "FloorPlan rolled back successfully",
+	})
+}
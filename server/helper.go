@@ -1,9 +1,14 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 // paginated respose struct
@@ -67,3 +72,63 @@ func (s *Server) stringToUint(str string) (uint, error) {
 	}
 	return uint(i), nil
 }
+
+// parseDateRange reads the optional from and to query parameters, given as
+// dates (2006-01-02) or RFC 3339 times. A date in to includes that whole day.
+func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
+	from, err := parseTimeParam(r.URL.Query().Get("from"), false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid from: %w", err)
+	}
+
+	to, err := parseTimeParam(r.URL.Query().Get("to"), true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid to: %w", err)
+	}
+
+	return from, to, nil
+}
+
+func parseTimeParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseFloatParam reads an optional number from the query string; nil when
+// it is not given.
+func parseFloatParam(r *http.Request, name string) (*float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &f, nil
+}
+
+// randomToken returns n random bytes, hex encoded, for keys and tokens that
+// must not be guessable.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
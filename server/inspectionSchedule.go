@@ -0,0 +1,457 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/jobs"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/aakash-tyagi/linmed/recurrence"
+	"github.com/gorilla/mux"
+)
+
+// defaultOccurrenceDays is how far ahead occurrences are listed by default.
+const defaultOccurrenceDays = 90
+
+// materialiseInspectionsPayload limits a materialisation run to one schedule.
+type materialiseInspectionsPayload struct {
+	ScheduleID *uint `json:"schedule_id,omitempty"`
+}
+
+// materialiseInspectionsJob creates the work orders for the upcoming
+// occurrences of every active inspection schedule. It runs as the
+// inspections.materialise job.
+func (s *Server) materialiseInspectionsJob(ctx context.Context, job models.Job) error {
+	payload := materialiseInspectionsPayload{}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	schedules, err := s.db.GetActiveInspectionSchedules(ctx, payload.ScheduleID)
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	created := 0
+	now := time.Now()
+	for _, schedule := range schedules {
+		occurrences, err := recurrence.Occurrences(schedule.RRule, schedule.StartsAt, now,
+			now.AddDate(0, 0, schedule.HorizonDays), schedule.Exceptions)
+		if err != nil {
+			s.Logger.WithField("schedule", schedule.ID).WithError(err).Error("Failed to expand inspection schedule")
+			failed = err
+			continue
+		}
+
+		n, err := s.db.MaterialiseInspectionSchedule(ctx, schedule, occurrences)
+		if err != nil {
+			s.Logger.WithField("schedule", schedule.ID).WithError(err).Error("Failed to materialise inspection schedule")
+			failed = err
+			continue
+		}
+		created += n
+	}
+
+	s.Logger.WithField("schedules", len(schedules)).WithField("created", created).Info("Inspection schedules materialised")
+
+	return failed
+}
+
+// queueMaterialisation materialises a schedule in the background after it changed.
+func (s *Server) queueMaterialisation(ctx context.Context, scheduleID uint) {
+	_, err := s.jobs.Enqueue(ctx, "inspections.materialise", materialiseInspectionsPayload{ScheduleID: &scheduleID},
+		jobs.EnqueueOptions{UniqueKey: fmt.Sprintf("inspections.materialise:%d", scheduleID)})
+	if err != nil {
+		s.Logger.Error("Failed to queue inspection schedule materialisation: ", err)
+	}
+}
+
+func (s *Server) AddInspectionSchedule(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	schedule := models.InspectionSchedule{}
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedule.CustomerID = customerId
+
+	if err := schedule.Validate(); err != nil {
+		s.Logger.Error("Failed to validate inspection schedule: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := recurrence.Validate(schedule.RRule); err != nil {
+		s.Logger.Error("Failed to validate inspection schedule rrule: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.db.AddInspectionSchedule(ctx, schedule)
+	if err != nil {
+		s.Logger.Error("Failed to save inspection schedule to db: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	s.queueMaterialisation(ctx, id)
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Inspection schedule added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetInspectionSchedules(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId := mux.Vars(r)["id"]
+	if _, err := s.stringToUint(customerId); err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	schedules, total, err := s.db.GetInspectionSchedules(ctx, customerId, r.URL.Query().Get("facility_id"), page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get inspection schedules from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  schedules,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetInspectionSchedule(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	schedule, err := s.db.GetInspectionSchedule(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get inspection schedule from db: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, schedule)
+}
+
+func (s *Server) UpdateInspectionSchedule(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	schedule := models.InspectionSchedule{}
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := schedule.Validate(); err != nil {
+		s.Logger.Error("Failed to validate inspection schedule: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := recurrence.Validate(schedule.RRule); err != nil {
+		s.Logger.Error("Failed to validate inspection schedule rrule: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.UpdateInspectionSchedule(ctx, id, schedule); err != nil {
+		s.Logger.Error("Failed to update inspection schedule: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	s.queueMaterialisation(ctx, id)
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Inspection schedule updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) DeleteInspectionSchedule(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	if err := s.db.DeleteInspectionSchedule(ctx, id); err != nil {
+		s.Logger.Error("Failed to delete inspection schedule: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Inspection schedule deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) PauseInspectionSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setInspectionSchedulePaused(w, r, true)
+}
+
+func (s *Server) ResumeInspectionSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setInspectionSchedulePaused(w, r, false)
+}
+
+func (s *Server) setInspectionSchedulePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	if err := s.db.SetInspectionSchedulePaused(ctx, id, paused); err != nil {
+		s.Logger.Error("Failed to pause or resume inspection schedule: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	message := "Inspection schedule paused successfully"
+	if !paused {
+		s.queueMaterialisation(ctx, id)
+		message = "Inspection schedule resumed successfully"
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"paused":  paused,
+		"message": message,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// AddScheduleException skips an occurrence, or moves it when moved_to is set.
+// occurrence_at must be an occurrence of the schedule.
+func (s *Server) AddScheduleException(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	exception := models.ScheduleException{}
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exception.ScheduleID = id
+
+	if err := exception.Validate(); err != nil {
+		s.Logger.Error("Failed to validate schedule exception: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedule, err := s.db.GetInspectionSchedule(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get inspection schedule from db: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	ok, err := recurrence.IsOccurrence(schedule.RRule, schedule.StartsAt, exception.OccurrenceAt)
+	if err != nil {
+		s.Logger.Error("Failed to expand inspection schedule: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		errorResposne(w, http.StatusBadRequest, "occurrence_at is not an occurrence of this schedule")
+		return
+	}
+
+	if err := s.db.AddScheduleException(ctx, exception); err != nil {
+		s.Logger.Error("Failed to save schedule exception: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":            id,
+		"occurrence_at": exception.OccurrenceAt,
+		"message":       "Schedule exception added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// DeleteScheduleException restores the occurrence given by the occurrence_at
+// query parameter (RFC 3339).
+func (s *Server) DeleteScheduleException(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	occurrenceAt, err := time.Parse(time.RFC3339, r.URL.Query().Get("occurrence_at"))
+	if err != nil {
+		s.Logger.Error("Failed to parse occurrence_at: ", err)
+		errorResposne(w, http.StatusBadRequest, "occurrence_at must be an RFC 3339 timestamp")
+		return
+	}
+
+	if err := s.db.DeleteScheduleException(ctx, id, occurrenceAt); err != nil {
+		s.Logger.Error("Failed to delete schedule exception: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	s.queueMaterialisation(ctx, id)
+
+	res := map[string]interface{}{
+		"id":            id,
+		"occurrence_at": occurrenceAt,
+		"message":       "Schedule exception deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetScheduleOccurrences lists the occurrences of a schedule over the next
+// days (default 90, at most 366), including skipped and moved ones. With
+// facility_id a schedule of another facility has none; customer-wide
+// schedules cover every facility.
+func (s *Server) GetScheduleOccurrences(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert inspection schedule id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Inspection schedule id is required")
+		return
+	}
+
+	days := defaultOccurrenceDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days <= 0 || days > 366 {
+			errorResposne(w, http.StatusBadRequest, "days must be between 1 and 366")
+			return
+		}
+	}
+
+	schedule, err := s.db.GetInspectionSchedule(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get inspection schedule from db: ", err)
+		s.inspectionScheduleError(w, err)
+		return
+	}
+
+	now := time.Now()
+	occurrences, err := recurrence.Occurrences(schedule.RRule, schedule.StartsAt, now, now.AddDate(0, 0, days), schedule.Exceptions)
+	if err != nil {
+		s.Logger.Error("Failed to expand inspection schedule: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if facilityId := r.URL.Query().Get("facility_id"); facilityId != "" {
+		fid, err := s.stringToUint(facilityId)
+		if err != nil {
+			errorResposne(w, http.StatusBadRequest, "facility_id must be a number")
+			return
+		}
+		customerWide := schedule.FloorPlanID == nil && schedule.StationID == nil
+		if !customerWide && (schedule.FacilityID == nil || *schedule.FacilityID != fid) {
+			occurrences = occurrences[:0]
+		}
+	}
+
+	res := map[string]interface{}{
+		"schedule_id":   id,
+		"facility_id":   schedule.FacilityID,
+		"facility_name": schedule.FacilityName,
+		"paused":        schedule.Paused,
+		"total":         len(occurrences),
+		"data":          occurrences,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// inspectionScheduleError maps inspection schedule errors from the db layer to a response status.
+func (s *Server) inspectionScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Inspection schedule not found")
+	case errors.Is(err, database.ErrCustomerNotFound), errors.Is(err, database.ErrFloorPlanNotFound),
+		errors.Is(err, database.ErrStationNotFound):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) GetJobs(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	status := r.URL.Query().Get("status")
+	kind := r.URL.Query().Get("kind")
+
+	jobs, total, err := s.db.GetJobs(ctx, status, kind, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get jobs from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  jobs,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetJob(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert job id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Job id is required")
+		return
+	}
+
+	job, err := s.db.GetJob(ctx, int64(id))
+	if err != nil {
+		s.Logger.Error("Failed to get job from db: ", err)
+		s.jobError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, job)
+}
+
+func (s *Server) RetryJob(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert job id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Job id is required")
+		return
+	}
+
+	if err := s.db.RetryJob(ctx, int64(id)); err != nil {
+		s.Logger.Error("Failed to retry job: ", err)
+		s.jobError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Job queued for retry",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) CancelJob(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert job id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Job id is required")
+		return
+	}
+
+	if err := s.db.CancelJob(ctx, int64(id)); err != nil {
+		s.Logger.Error("Failed to cancel job: ", err)
+		s.jobError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Job cancelled successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetJobSchedules(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	schedules, err := s.db.GetJobSchedules(ctx)
+	if err != nil {
+		s.Logger.Error("Failed to get job schedules from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, schedules)
+}
+
+func (s *Server) jobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Job not found")
+	case errors.Is(err, database.ErrJobNotRetryable), errors.Is(err, database.ErrJobNotCancellable),
+		errors.Is(err, database.ErrJobQueued):
+		errorResposne(w, http.StatusConflict, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
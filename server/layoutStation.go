@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// ReconcileLayoutStations creates and updates the stations of a floor plan
+// from the station markers of its layout and reports stations no marker
+// stands for. Unless the body sets "dry_run" to false nothing is changed and
+// the planned changes are returned.
+func (s *Server) ReconcileLayoutStations(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Floor id is required")
+		return
+	}
+
+	req := models.ReconcileLayout{DryRun: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate layout reconciliation: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := s.db.ReconcileLayout(ctx, customerId, floorPlanId, req)
+	if err != nil {
+		s.Logger.Error("Failed to reconcile layout stations: ", err)
+		s.layoutStationError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, plan)
+}
+
+func (s *Server) layoutStationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNoLayout):
+		errorResposne(w, http.StatusUnprocessableEntity, "Floor plan has no layout")
+	case errors.Is(err, database.ErrStationTemplateNotFound), errors.Is(err, database.ErrProductNotFound):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrInsufficientStock):
+		errorResposne(w, http.StatusConflict, err.Error())
+	default:
+		s.floorPlanError(w, err)
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) AddOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	order := models.Order{}
+
+	// Unmarshal the request body into the order struct
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// validate order
+	if err := order.Validate(); err != nil {
+		s.Logger.Error("Failed to validate order: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// save to db
+	id, err := s.db.AddOrder(ctx, order)
+	if err != nil {
+		s.Logger.Error("Failed to save order to db: ", err)
+		s.orderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Order added successfully",
+	}
+
+	// return success
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Order id is required")
+		return
+	}
+
+	order, err := s.db.GetOrder(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get order from db: ", err)
+		s.orderError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, order)
+}
+
+func (s *Server) GetOrders(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	customerId := r.URL.Query().Get("customer_id")
+	status := r.URL.Query().Get("status")
+
+	orders, total, err := s.db.GetOrders(ctx, customerId, status, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get orders from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  orders,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) AddOrderItem(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	orderId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Order id is required")
+		return
+	}
+
+	item := models.OrderItem{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := item.Validate(); err != nil {
+		s.Logger.Error("Failed to validate order item: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.db.AddOrderItem(ctx, orderId, item)
+	if err != nil {
+		s.Logger.Error("Failed to add order item: ", err)
+		s.orderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Order item added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	orderId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Order id is required")
+		return
+	}
+
+	itemId, err := s.stringToUint(mux.Vars(r)["itemID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert order item id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Order item id is required")
+		return
+	}
+
+	if err := s.db.DeleteOrderItem(ctx, orderId, itemId); err != nil {
+		s.Logger.Error("Failed to delete order item: ", err)
+		s.orderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      itemId,
+		"message": "Order item deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	orderId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Order id is required")
+		return
+	}
+
+	update := models.OrderStatusUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := update.Validate(); err != nil {
+		s.Logger.Error("Failed to validate order status: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.UpdateOrderStatus(ctx, orderId, update); err != nil {
+		s.Logger.Error("Failed to update order status: ", err)
+		s.orderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      orderId,
+		"status":  update.Status,
+		"message": "Order status updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// orderError maps order errors from the db layer to a response status.
+func (s *Server) orderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Order not found")
+	case errors.Is(err, database.ErrProductNotFound), errors.Is(err, database.ErrDeviceNotForCustomer),
+		errors.Is(err, database.ErrEmptyOrder):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrOrderNotEditable), errors.Is(err, database.ErrInvalidTransition):
+		errorResposne(w, http.StatusConflict, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
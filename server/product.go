@@ -3,8 +3,10 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	database "github.com/aakash-tyagi/linmed/db"
 	"github.com/aakash-tyagi/linmed/models"
 	"github.com/gorilla/mux"
 )
@@ -291,7 +293,12 @@ func (s *Server) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// delete product from db
-	if err := s.db.DeleteProduct(ctx, id); err != nil {
+	err := s.db.DeleteProduct(ctx, id)
+	if errors.Is(err, database.ErrEvidenceKept) {
+		errorResposne(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
 		s.Logger.Error("Failed to delete product from db: ", err)
 		errorResposne(w, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aakash-tyagi/linmed/models"
+)
+
+// defaultReplenishmentHorizon is used when no horizon_days is given.
+const defaultReplenishmentHorizon = 60
+
+func (s *Server) GetReplenishmentSuggestions(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	horizon := defaultReplenishmentHorizon
+	if h := r.URL.Query().Get("horizon_days"); h != "" {
+		var err error
+		horizon, err = strconv.Atoi(h)
+		if err != nil || horizon < 0 {
+			errorResposne(w, http.StatusBadRequest, "horizon_days must be a positive number")
+			return
+		}
+	}
+
+	report := models.ReplenishmentReport{
+		HorizonDays: horizon,
+		GeneratedAt: time.Now(),
+	}
+
+	customerId := r.URL.Query().Get("customer_id")
+	if customerId != "" {
+		id, err := s.stringToUint(customerId)
+		if err != nil {
+			errorResposne(w, http.StatusBadRequest, "customer_id must be a number")
+			return
+		}
+		report.CustomerID = &id
+	}
+
+	locationId := r.URL.Query().Get("location_id")
+	if locationId != "" {
+		id, err := s.stringToUint(locationId)
+		if err != nil {
+			errorResposne(w, http.StatusBadRequest, "location_id must be a number")
+			return
+		}
+		report.LocationID = &id
+	}
+
+	facilityId := r.URL.Query().Get("facility_id")
+	if facilityId != "" {
+		id, err := s.stringToUint(facilityId)
+		if err != nil {
+			errorResposne(w, http.StatusBadRequest, "facility_id must be a number")
+			return
+		}
+		report.FacilityID = &id
+	}
+
+	suggestions, err := s.db.GetReplenishmentSuggestions(ctx, horizon, customerId, locationId, facilityId)
+	if err != nil {
+		s.Logger.WithError(err).Error("Failed to build replenishment suggestions")
+		errorResposne(w, http.StatusInternalServerError, "Failed to build replenishment suggestions")
+		return
+	}
+
+	for _, suggestion := range suggestions {
+		report.TotalEstimatedCost += suggestion.EstimatedCost
+	}
+	report.TotalEstimatedCost = math.Round(report.TotalEstimatedCost*100) / 100
+	report.Suggestions = suggestions
+
+	writeJSONResponse(w, http.StatusOK, report)
+}
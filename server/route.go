@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/geo"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// GetRoute orders a customer's due devices into a walking route per floor
+// plan using the station coordinates.
+func (s *Server) GetRoute(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	req := models.RouteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate route request: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	floors, err := s.db.GetRouteStops(ctx, customerId, req.DeviceIDs, req.DueWithinDays, req.FacilityID)
+	if err != nil {
+		s.Logger.Error("Failed to get route stops from db: ", err)
+		if errors.Is(err, database.ErrDeviceNotForCustomer) {
+			errorResposne(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	itinerary := models.RouteItinerary{
+		CustomerID: customerId,
+		Floors:     make([]models.FloorRoute, 0, len(floors)),
+	}
+	for _, floor := range floors {
+		floor = orderFloorRoute(floor)
+		if floor.Units == models.RouteMetres {
+			itinerary.TotalDistance += floor.Distance
+		} else {
+			itinerary.UnscaledDistance += floor.Distance
+		}
+		itinerary.Floors = append(itinerary.Floors, floor)
+	}
+	itinerary.TotalDistance = roundTo(itinerary.TotalDistance, 2)
+
+	writeJSONResponse(w, http.StatusOK, itinerary)
+}
+
+// orderFloorRoute orders the stops of a floor into a walking route. Stops
+// without coordinates are moved to Unplaced. A floor with a scale is
+// measured in metres, like spatial queries, and any other in floor plan
+// units.
+func orderFloorRoute(floor models.FloorRoute) models.FloorRoute {
+	var (
+		placed []models.RouteStop
+		points []geo.Point
+	)
+	for _, stop := range floor.Stops {
+		if stop.LocationX == nil || stop.LocationY == nil {
+			floor.Unplaced = append(floor.Unplaced, stop)
+			continue
+		}
+		placed = append(placed, stop)
+		points = append(points, geo.Point{X: *stop.LocationX, Y: *stop.LocationY})
+	}
+
+	order, distance := geo.Route(nil, points)
+
+	floor.Stops = make([]models.RouteStop, 0, len(order))
+	for i, idx := range order {
+		stop := placed[idx]
+		stop.Sequence = i + 1
+		if i > 0 {
+			stop.LegDistance = geo.Distance(points[order[i-1]], points[idx])
+		}
+		floor.Stops = append(floor.Stops, stop)
+	}
+	floor.Distance = distance
+
+	floor.Units = models.RouteFloorPlanUnits
+	if floor.Scale > 0 {
+		floor.Units = models.RouteMetres
+		for i := range floor.Stops {
+			floor.Stops[i].LegDistance = roundTo(floor.Stops[i].LegDistance/floor.Scale, 2)
+		}
+		floor.Distance = roundTo(floor.Distance/floor.Scale, 2)
+	}
+
+	return floor
+}
@@ -1,11 +1,19 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/aakash-tyagi/linmed/aws"
 	"github.com/aakash-tyagi/linmed/config"
 	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/jobs"
+	"github.com/aakash-tyagi/linmed/models"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -16,6 +24,7 @@ type Server struct {
 	Logger   *log.Logger
 	db       *database.Database
 	S3Client *aws.S3Client
+	jobs     *jobs.Runner
 }
 
 func New(
@@ -29,9 +38,33 @@ func New(
 		Logger:   log,
 		db:       db,
 		S3Client: s3Client,
+		jobs:     jobs.NewRunner(db, log),
 	}
 }
 
+// registerJobs sets up the background job handlers and schedules.
+func (s *Server) registerJobs() error {
+	s.jobs.Register("alerts.generate", s.generateAlertsJob)
+	s.jobs.Register("workorders.generate", s.generateWorkOrdersJob)
+	s.jobs.Register("inspections.materialise", s.materialiseInspectionsJob)
+	s.jobs.Register("sync.prune", s.pruneSyncJob)
+
+	if err := s.jobs.Schedule("alerts.generate", s.alertSchedule(), "alerts.generate", nil); err != nil {
+		return err
+	}
+
+	if err := s.jobs.Schedule("inspections.materialise", "@hourly", "inspections.materialise", nil); err != nil {
+		return err
+	}
+
+	if err := s.jobs.Schedule("sync.prune", "@daily", "sync.prune", nil); err != nil {
+		return err
+	}
+
+	return s.jobs.Schedule("workorders.generate", "@daily", "workorders.generate",
+		models.GenerateWorkOrdersRequest{DueWithinDays: defaultWorkOrderHorizonDays})
+}
+
 func (s *Server) RegisterRoutes(r *mux.Router) {
 	r.Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -61,17 +94,51 @@ func (s *Server) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/v1/customer/{id}", s.UpdateCustomer).Methods("PUT")
 	r.HandleFunc("/api/v1/customers", s.GetCustomers).Methods("GET")
 
+	r.HandleFunc("/api/v1/customer/{id}/facility", s.AddFacility).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/facilities", s.GetFacilities).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}", s.GetFacility).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}", s.UpdateFacility).Methods("PUT")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}", s.DeleteFacility).Methods("DELETE")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}/building", s.AddBuilding).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}/building/{buildingID}", s.UpdateBuilding).Methods("PUT")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}/building/{buildingID}", s.DeleteBuilding).Methods("DELETE")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}/building/{buildingID}/floor", s.AddFloor).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}/building/{buildingID}/floor/{floorID}", s.UpdateFloor).Methods("PUT")
+	r.HandleFunc("/api/v1/customer/{id}/facility/{facilityID}/building/{buildingID}/floor/{floorID}", s.DeleteFloor).Methods("DELETE")
+
 	r.HandleFunc("/api/v1/customer/{id}/floorplan", s.AddFloorPlan).Methods("POST")
 	r.HandleFunc("/api/v1/customer/{id}/floorplans", s.GetFloorPlans).Methods("GET")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}", s.GetFloorPlan).Methods("GET")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}", s.UpdateFloorPlan).Methods("PUT")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}", s.DeleteFloorPlan).Methods("DELETE")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/rooms", s.GetFloorPlanRooms).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/zones", s.GetFloorPlanZones).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/background", s.UploadFloorPlanBackground).Methods("PUT")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/background", s.GetFloorPlanBackground).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/background", s.DeleteFloorPlanBackground).Methods("DELETE")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/render.svg", s.RenderFloorPlan).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/coverage", s.GetFloorPlanCoverage).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/revisions", s.GetFloorPlanRevisions).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/revisions/diff", s.DiffFloorPlanRevisions).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/revisions/{revision:[0-9]+}", s.GetFloorPlanRevision).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/revisions/{revision:[0-9]+}/rollback", s.RollbackFloorPlan).Methods("POST")
 
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station", s.AddStation).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station/provision", s.ProvisionStation).Methods("POST")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/stations", s.GetStations).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/stations/positions", s.RepositionStations).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/stations/reconcile", s.ReconcileLayoutStations).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/stations/nearest", s.GetNearestStations).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/stations/zone/{zone}", s.GetZoneStations).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/stations/distance", s.GetStationDistance).Methods("GET")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station/{stationID}", s.GetStationById).Methods("GET")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station/{stationID}", s.UpdateStation).Methods("PUT")
 	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station/{stationID}", s.DeleteStation).Methods("DELETE")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station/{stationID}/room", s.GetStationRoom).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/station/{stationID}/label.png", s.GetStationLabel).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/floorplan/{floorPlanID}/labels.pdf", s.GetFloorPlanLabels).Methods("GET")
+	r.HandleFunc("/api/v1/labels/layouts", s.GetLabelLayouts).Methods("GET")
+	r.HandleFunc("/api/v1/scan/{code}", s.ScanStation).Methods("GET")
 
 	r.HandleFunc("/api/v1/device", s.AddStationProduct).Methods("POST")           // Add a new device
 	r.HandleFunc("/api/v1/device", s.GetStationProducts).Methods("GET")           // Get all devices
@@ -79,9 +146,114 @@ func (s *Server) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/v1/device/{id}", s.UpdateStationProduct).Methods("PUT")    // Update a device by id
 	r.HandleFunc("/api/v1/device/{id}", s.DeleteStationProduct).Methods("DELETE") // Delete a device by id
 
+	r.HandleFunc("/api/v1/device/{id}/move", s.MoveStationProduct).Methods("POST")     // Move a device to another station
+	r.HandleFunc("/api/v1/device/{id}/moves", s.GetStationProductMoves).Methods("GET") // Get the move history of a device
+	r.HandleFunc("/api/v1/device/{id}/refill", s.RefillStationProduct).Methods("POST") // Refill the components of a device
+
+	r.HandleFunc("/api/v1/device/{id}/services", s.GetServiceRecords).Methods("GET") // Get the service history of a device
+
+	r.HandleFunc("/api/v1/stock/location", s.AddStockLocation).Methods("POST")
+	r.HandleFunc("/api/v1/stock/locations", s.GetStockLocations).Methods("GET")
+	r.HandleFunc("/api/v1/stock/location/{id}/product/{productID}/threshold", s.SetStockThreshold).Methods("PUT")
+	r.HandleFunc("/api/v1/stock", s.GetStockLevels).Methods("GET")
+	r.HandleFunc("/api/v1/stock/movement", s.AddStockMovement).Methods("POST")
+	r.HandleFunc("/api/v1/stock/movements", s.GetStockMovements).Methods("GET")
+	r.HandleFunc("/api/v1/stock/low", s.GetLowStock).Methods("GET")
+
+	r.HandleFunc("/api/v1/order", s.AddOrder).Methods("POST")
+	r.HandleFunc("/api/v1/orders", s.GetOrders).Methods("GET")
+	r.HandleFunc("/api/v1/order/{id}", s.GetOrder).Methods("GET")
+	r.HandleFunc("/api/v1/order/{id}/status", s.UpdateOrderStatus).Methods("PUT")
+	r.HandleFunc("/api/v1/order/{id}/item", s.AddOrderItem).Methods("POST")
+	r.HandleFunc("/api/v1/order/{id}/item/{itemID}", s.DeleteOrderItem).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/replenishment/suggestions", s.GetReplenishmentSuggestions).Methods("GET")
+
+	r.HandleFunc("/api/v1/alerts", s.GetAlerts).Methods("GET")
+	r.HandleFunc("/api/v1/alerts/generate", s.GenerateAlerts).Methods("POST")
+	r.HandleFunc("/api/v1/alert/types", s.GetAlertTypes).Methods("GET")
+	r.HandleFunc("/api/v1/alert/{id}/acknowledge", s.AcknowledgeAlert).Methods("POST")
+	r.HandleFunc("/api/v1/alert/{id}/resolve", s.ResolveAlert).Methods("POST")
+
+	r.HandleFunc("/api/v1/workorder", s.AddWorkOrder).Methods("POST")
+	r.HandleFunc("/api/v1/workorders", s.GetWorkOrders).Methods("GET")
+	r.HandleFunc("/api/v1/workorders/generate", s.GenerateWorkOrders).Methods("POST")
+	r.HandleFunc("/api/v1/workorder/{id}", s.GetWorkOrder).Methods("GET")
+	r.HandleFunc("/api/v1/workorder/{id}/assign", s.AssignWorkOrder).Methods("PUT")
+	r.HandleFunc("/api/v1/workorder/{id}/status", s.UpdateWorkOrderStatus).Methods("PUT")
+	r.HandleFunc("/api/v1/workorder/{id}/complete", s.CompleteWorkOrder).Methods("POST")
+	r.HandleFunc("/api/v1/workorder/{id}/evidence", s.AddEvidence).Methods("POST")
+	r.HandleFunc("/api/v1/workorder/{id}/evidence", s.GetWorkOrderEvidence).Methods("GET")
+	r.HandleFunc("/api/v1/device/{id}/evidence", s.AddDeviceEvidence).Methods("POST")
+	r.HandleFunc("/api/v1/evidence/{id}", s.GetEvidence).Methods("GET")
+	r.HandleFunc("/api/v1/evidence/{id}", s.DeleteEvidence).Methods("DELETE")
+	r.HandleFunc("/api/v1/evidence/{id}/image", s.GetEvidenceImage).Methods("GET")
+	r.HandleFunc("/api/v1/user/{id}/workorders", s.GetUserWorkOrders).Methods("GET")
+
+	r.HandleFunc("/api/v1/customer/{id}/route", s.GetRoute).Methods("POST")
+
+	r.HandleFunc("/api/v1/customer/{id}/inspectionschedule", s.AddInspectionSchedule).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/inspectionschedules", s.GetInspectionSchedules).Methods("GET")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}", s.GetInspectionSchedule).Methods("GET")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}", s.UpdateInspectionSchedule).Methods("PUT")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}", s.DeleteInspectionSchedule).Methods("DELETE")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}/pause", s.PauseInspectionSchedule).Methods("POST")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}/resume", s.ResumeInspectionSchedule).Methods("POST")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}/exception", s.AddScheduleException).Methods("POST")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}/exception", s.DeleteScheduleException).Methods("DELETE")
+	r.HandleFunc("/api/v1/inspectionschedule/{id}/occurrences", s.GetScheduleOccurrences).Methods("GET")
+
+	r.HandleFunc("/api/v1/checklist/template", s.AddChecklistTemplate).Methods("POST")
+	r.HandleFunc("/api/v1/checklist/templates", s.GetChecklistTemplates).Methods("GET")
+	r.HandleFunc("/api/v1/checklist/template/{id}", s.GetChecklistTemplate).Methods("GET")
+	r.HandleFunc("/api/v1/checklist/template/{id}", s.UpdateChecklistTemplate).Methods("PUT")
+	r.HandleFunc("/api/v1/checklist/template/{id}", s.DeleteChecklistTemplate).Methods("DELETE")
+	r.HandleFunc("/api/v1/checklist/template/{id}/report", s.GetChecklistReport).Methods("GET")
+	r.HandleFunc("/api/v1/checklist/results", s.GetChecklistResults).Methods("GET")
+	r.HandleFunc("/api/v1/checklist/result/{id}", s.GetChecklistResult).Methods("GET")
+	r.HandleFunc("/api/v1/device/{id}/checklist", s.GetDeviceChecklist).Methods("GET")
+	r.HandleFunc("/api/v1/device/{id}/checklist", s.SubmitChecklist).Methods("POST")
+
+	r.HandleFunc("/api/v1/station/template", s.AddStationTemplate).Methods("POST")
+	r.HandleFunc("/api/v1/station/templates", s.GetStationTemplates).Methods("GET")
+	r.HandleFunc("/api/v1/station/template/{id}", s.GetStationTemplate).Methods("GET")
+	r.HandleFunc("/api/v1/station/template/{id}", s.UpdateStationTemplate).Methods("PUT")
+	r.HandleFunc("/api/v1/station/template/{id}", s.DeleteStationTemplate).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/customer/{id}/sync", s.PullChanges).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/sync", s.PushChanges).Methods("POST")
+
+	r.HandleFunc("/api/v1/customer/{id}/calendar", s.SetCustomerCalendarFeed).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/calendar", s.GetCustomerCalendarFeed).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/calendar", s.DeleteCustomerCalendarFeed).Methods("DELETE")
+	r.HandleFunc("/api/v1/user/{id}/calendar", s.SetUserCalendarFeed).Methods("POST")
+	r.HandleFunc("/api/v1/user/{id}/calendar", s.GetUserCalendarFeed).Methods("GET")
+	r.HandleFunc("/api/v1/user/{id}/calendar", s.DeleteUserCalendarFeed).Methods("DELETE")
+	r.HandleFunc("/api/v1/calendar/{token:[0-9a-f]+}.ics", s.GetCalendar).Methods("GET")
+
+	r.HandleFunc("/api/v1/customer/{id}/sla", s.SetSLATarget).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/sla", s.GetSLATargets).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/sla/compliance", s.GetSLACompliance).Methods("GET")
+	r.HandleFunc("/api/v1/customer/{id}/sla/{kind}", s.DeleteSLATarget).Methods("DELETE")
+	r.HandleFunc("/api/v1/sla/breaches", s.GetSLABreaches).Methods("GET")
+
+	r.HandleFunc("/api/v1/device/{id}/deferral", s.RequestDeferral).Methods("POST")
+	r.HandleFunc("/api/v1/deferral/{id}", s.GetDeferral).Methods("GET")
+	r.HandleFunc("/api/v1/deferral/{id}/approve", s.ApproveDeferral).Methods("POST")
+	r.HandleFunc("/api/v1/deferral/{id}/reject", s.RejectDeferral).Methods("POST")
+	r.HandleFunc("/api/v1/customer/{id}/deferrals", s.GetCustomerDeferrals).Methods("GET")
+
+	r.HandleFunc("/api/v1/admin/jobs", s.GetJobs).Methods("GET")
+	r.HandleFunc("/api/v1/admin/job/schedules", s.GetJobSchedules).Methods("GET")
+	r.HandleFunc("/api/v1/admin/job/{id}", s.GetJob).Methods("GET")
+	r.HandleFunc("/api/v1/admin/job/{id}/retry", s.RetryJob).Methods("POST")
+	r.HandleFunc("/api/v1/admin/job/{id}/cancel", s.CancelJob).Methods("POST")
+
 	r.HandleFunc("/api/v1/dashboard", s.GetAllNumbers).Methods("GET")
 	r.HandleFunc("/api/v1/dashboard/tasks/expiry", s.GetExpiryTasks).Methods("GET")
 	r.HandleFunc("/api/v1/dashbaord/tasks/inspection", s.GetInspectionTasks).Methods("GET")
+	r.HandleFunc("/api/v1/dashboard/tasks/overdue", s.GetOverdueTasks).Methods("GET")
+	r.HandleFunc("/api/v1/dashboard/facilities", s.GetFacilityDashboard).Methods("GET")
 
 	r.HandleFunc("/api/v1/image", s.UploadImage).Methods("POST")
 	r.HandleFunc("/api/v1/image", s.GetImage).Methods("GET")
@@ -93,13 +265,40 @@ func (s *Server) Start() {
 
 	s.RegisterRoutes(r)
 
+	// stop on SIGINT/SIGTERM so running jobs can finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.registerJobs(); err != nil {
+		s.Logger.Fatal(err)
+	}
+	if err := s.jobs.Start(ctx); err != nil {
+		s.Logger.Fatal(err)
+	}
+	defer s.jobs.Stop()
+
 	// Apply CORS middleware
 	allowedOrigins := handlers.AllowedOrigins([]string{"*"})
 	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "PUT", "DELETE"})
 	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization"})
 
+	srv := &http.Server{
+		Addr:    ":" + s.Config.ServerPort,
+		Handler: handlers.CORS(allowedHeaders, allowedMethods, allowedOrigins)(r),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			s.Logger.Error("Failed to shut down server: ", err)
+		}
+	}()
+
 	s.Logger.Info("Starting server on port: ", s.Config.ServerPort)
-	if err := http.ListenAndServe(":"+s.Config.ServerPort, handlers.CORS(allowedHeaders, allowedMethods, allowedOrigins)(r)); err != nil {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.Logger.Fatal(err)
 	}
 
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// defaultCompliancePeriods is how many periods a compliance report covers
+// when no from is given.
+const defaultCompliancePeriods = 12
+
+// GetOverdueTasks lists the inspections and expiries that have passed without
+// being serviced, optionally for one customer, facility or kind.
+func (s *Server) GetOverdueTasks(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	customerId := r.URL.Query().Get("customer_id")
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != models.DueInspection && kind != models.DueExpiry {
+		errorResposne(w, http.StatusBadRequest, "kind must be inspection or expiry")
+		return
+	}
+
+	facilityId := r.URL.Query().Get("facility_id")
+
+	tasks, total, err := s.db.GetOverdueTasks(ctx, customerId, kind, facilityId, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get overdue tasks from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  tasks,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// SetSLATarget sets a customer's SLA target for inspections or expiries,
+// replacing the one it had.
+func (s *Server) SetSLATarget(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	target := models.SLATarget{}
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		s.Logger.Error("Failed to decode sla target: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	target.CustomerID = customerId
+
+	if err := target.Validate(); err != nil {
+		s.Logger.Error("Failed to validate sla target: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target, err = s.db.SetSLATarget(ctx, target)
+	if err != nil {
+		s.Logger.Error("Failed to save sla target: ", err)
+		s.slaError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      target.ID,
+		"target":  target,
+		"message": "SLA target saved successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetSLATargets(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	targets, err := s.db.GetSLATargets(ctx, customerId)
+	if err != nil {
+		s.Logger.Error("Failed to get sla targets from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(targets),
+		Data:  targets,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) DeleteSLATarget(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	if err := s.db.DeleteSLATarget(ctx, customerId, mux.Vars(r)["kind"]); err != nil {
+		s.Logger.Error("Failed to delete sla target: ", err)
+		s.slaError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"message": "SLA target deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetSLACompliance reports a customer's compliance with each SLA target per
+// week or month (interval, default month) for the dates falling due between
+// from and to. Without from it covers the last 12 periods. facility_id
+// narrows it to one facility; group_by=facility reports each facility apart.
+func (s *Server) GetSLACompliance(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if interval != "week" && interval != "month" {
+		errorResposne(w, http.StatusBadRequest, "interval must be week or month")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+	start := end.AddDate(-1, 0, 0)
+	if interval == "week" {
+		start = end.AddDate(0, 0, -7*defaultCompliancePeriods)
+	}
+	if from != nil {
+		start = *from
+	}
+	if !start.Before(end) {
+		errorResposne(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "facility" {
+		errorResposne(w, http.StatusBadRequest, "group_by must be facility")
+		return
+	}
+	if groupBy == "facility" {
+		compliance, err := s.db.GetFacilitySLACompliance(ctx, customerId, start, end, interval)
+		if err != nil {
+			s.Logger.Error("Failed to get facility sla compliance from db: ", err)
+			s.slaError(w, err)
+			return
+		}
+
+		res := paginatedResponse{
+			Total: len(compliance),
+			Data:  compliance,
+		}
+
+		writeJSONResponse(w, http.StatusOK, res)
+		return
+	}
+
+	var facilityId *uint
+	if value := r.URL.Query().Get("facility_id"); value != "" {
+		id, err := s.stringToUint(value)
+		if err != nil {
+			s.Logger.Error("Failed to convert facility id to int: ", err)
+			errorResposne(w, http.StatusBadRequest, "facility_id must be a facility id")
+			return
+		}
+		facilityId = &id
+	}
+
+	compliance, err := s.db.GetSLACompliance(ctx, customerId, facilityId, start, end, interval)
+	if err != nil {
+		s.Logger.Error("Failed to get sla compliance from db: ", err)
+		s.slaError(w, err)
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(compliance),
+		Data:  compliance,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetSLABreaches lists the due dates that missed their customer's SLA,
+// optionally for one customer, facility or kind and for dates due between
+// from and to.
+func (s *Server) GetSLABreaches(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	customerId := r.URL.Query().Get("customer_id")
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != models.DueInspection && kind != models.DueExpiry {
+		errorResposne(w, http.StatusBadRequest, "kind must be inspection or expiry")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	facilityId := r.URL.Query().Get("facility_id")
+
+	breaches, total, err := s.db.GetSLABreaches(ctx, customerId, kind, facilityId, from, to, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get sla breaches from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  breaches,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) slaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrCustomerNotFound):
+		errorResposne(w, http.StatusNotFound, "Customer not found")
+	case errors.Is(err, database.ErrFacilityNotFound):
+		errorResposne(w, http.StatusNotFound, "Facility not found")
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "SLA target not found")
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/aakash-tyagi/linmed/geo"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultNearestStations is how many stations a nearest query returns
+	// unless asked otherwise, and maxNearestStations the most allowed.
+	defaultNearestStations = 5
+	maxNearestStations     = 50
+)
+
+// GetNearestStations lists the placed stations of a floor plan nearest to a
+// position, given by x and y in floor plan units, or to the centre of a room
+// given by id or name, with their straight-line distance in metres.
+//
+// Query parameters: x and y or room, limit (how many stations, 5 unless
+// given), and product_id or category_id to count only stations with such a
+// device.
+func (s *Server) GetNearestStations(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, layout, ok := s.spatialLayout(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	x, errX := parseFloatParam(r, "x")
+	y, errY := parseFloatParam(r, "y")
+	if errX != nil || errY != nil || (x == nil) != (y == nil) {
+		errorResposne(w, http.StatusBadRequest, "x and y must both be numbers in floor plan units")
+		return
+	}
+
+	roomKey := r.URL.Query().Get("room")
+	if (x == nil) == (roomKey == "") {
+		errorResposne(w, http.StatusBadRequest, "Either x and y or room is required")
+		return
+	}
+
+	limit := defaultNearestStations
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxNearestStations {
+			errorResposne(w, http.StatusBadRequest, "limit must be between 1 and 50")
+			return
+		}
+	}
+
+	res := models.NearestStations{FloorPlanID: floorPlan.ID}
+	if roomKey != "" {
+		res.Room = layout.FindArea(models.LayoutRoom, roomKey)
+		if res.Room == nil {
+			errorResposne(w, http.StatusNotFound, "Room not found on this floor plan")
+			return
+		}
+		res.From = res.Room.Polygon.Centroid()
+	} else {
+		res.From = geo.Point{X: *x, Y: *y}
+	}
+
+	stations, err := s.db.GetSpatialStations(ctx, floorPlan.ID, r.URL.Query().Get("product_id"),
+		r.URL.Query().Get("category_id"))
+	if err != nil {
+		s.Logger.Error("Failed to get stations from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res.Stations = layout.NearestTo(res.From, stations, limit)
+	layout.LocateStations(res.Stations)
+	for i := range res.Stations {
+		*res.Stations[i].Distance = roundTo(*res.Stations[i].Distance, 2)
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetZoneStations lists the placed stations of a floor plan standing within
+// a zone of its layout, given by id or name. product_id or category_id count
+// only stations with such a device.
+func (s *Server) GetZoneStations(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, layout, ok := s.spatialLayout(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	zone := layout.FindArea(models.LayoutZone, mux.Vars(r)["zone"])
+	if zone == nil {
+		errorResposne(w, http.StatusNotFound, "Zone not found on this floor plan")
+		return
+	}
+
+	stations, err := s.db.GetSpatialStations(ctx, floorPlan.ID, r.URL.Query().Get("product_id"),
+		r.URL.Query().Get("category_id"))
+	if err != nil {
+		s.Logger.Error("Failed to get stations from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := models.ZoneStations{
+		FloorPlanID: floorPlan.ID,
+		Zone:        *zone,
+		Stations:    zone.Within(stations),
+	}
+	layout.LocateStations(res.Stations)
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetStationDistance measures the straight-line distance between two placed
+// stations of a floor plan, given by the from and to query parameters.
+func (s *Server) GetStationDistance(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	fromId, err := s.stringToUint(r.URL.Query().Get("from"))
+	if err != nil {
+		s.Logger.Error("Failed to convert station id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "From station id is required")
+		return
+	}
+
+	toId, err := s.stringToUint(r.URL.Query().Get("to"))
+	if err != nil {
+		s.Logger.Error("Failed to convert station id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "To station id is required")
+		return
+	}
+
+	floorPlan, layout, ok := s.spatialLayout(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	stations, err := s.db.GetSpatialStations(ctx, floorPlan.ID, "", "")
+	if err != nil {
+		s.Logger.Error("Failed to get stations from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var from, to *models.SpatialStation
+	for i := range stations {
+		if stations[i].ID == fromId {
+			from = &stations[i]
+		}
+		if stations[i].ID == toId {
+			to = &stations[i]
+		}
+	}
+	if from == nil || to == nil {
+		errorResposne(w, http.StatusNotFound, "Station not placed on this floor plan")
+		return
+	}
+
+	res := layout.Distance(*from, *to)
+	res.FloorPlanID = floorPlan.ID
+	res.Distance = roundTo(res.Distance, 2)
+	res.Units = roundTo(res.Units, 2)
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// spatialLayout loads the layout of the floor plan named in the request,
+// which spatial queries need for its scale, writing the error response when
+// there is none.
+func (s *Server) spatialLayout(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.FloorPlan, *models.Layout, bool) {
+	floorPlan, layout, ok := s.customerLayout(ctx, w, r)
+	if !ok {
+		return floorPlan, nil, false
+	}
+	if layout == nil {
+		errorResposne(w, http.StatusUnprocessableEntity, "Floor plan needs a layout with a scale for spatial queries")
+		return floorPlan, nil, false
+	}
+	return floorPlan, layout, true
+}
@@ -3,8 +3,10 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	database "github.com/aakash-tyagi/linmed/db"
 	"github.com/aakash-tyagi/linmed/models"
 	"github.com/gorilla/mux"
 )
@@ -62,10 +64,15 @@ func (s *Server) AddStation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if (station.LocationX == nil) != (station.LocationY == nil) {
+		errorResposne(w, http.StatusBadRequest, "location_x and location_y must be given together")
+		return
+	}
+
 	id, err := s.db.AddStation(ctx, station)
 	if err != nil {
 		s.Logger.Error("Failed to save station to db: ", err)
-		errorResposne(w, http.StatusInternalServerError, err.Error())
+		s.stationError(w, err)
 		return
 	}
 
@@ -152,7 +159,7 @@ func (s *Server) UpdateStation(w http.ResponseWriter, r *http.Request) {
 	err := s.db.UpdateStation(ctx, stationId, station)
 	if err != nil {
 		s.Logger.Error("Failed to save station to db: ", err)
-		errorResposne(w, http.StatusInternalServerError, err.Error())
+		s.stationError(w, err)
 		return
 	}
 
@@ -174,6 +181,10 @@ func (s *Server) DeleteStation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := s.db.DeleteStation(ctx, stationId)
+	if errors.Is(err, database.ErrEvidenceKept) {
+		errorResposne(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		s.Logger.Error("Failed to delete station from db: ", err)
 		errorResposne(w, http.StatusInternalServerError, err.Error())
@@ -228,3 +239,63 @@ func (s *Server) GetStations(w http.ResponseWriter, r *http.Request) {
 
 	writeJSONResponse(w, http.StatusOK, res)
 }
+
+// RepositionStations moves several stations of a floor plan at once. Either
+// all positions are applied or, when one is invalid, none.
+func (s *Server) RepositionStations(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Floor id is required")
+		return
+	}
+
+	req := models.RepositionStations{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode station positions: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate station positions: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.RepositionStations(ctx, customerId, floorPlanId, req.Positions); err != nil {
+		s.Logger.Error("Failed to reposition stations: ", err)
+		s.stationError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"total":   len(req.Positions),
+		"message": "Stations repositioned successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) stationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrFloorPlanNotFound):
+		errorResposne(w, http.StatusNotFound, "Floor plan not found")
+	case errors.Is(err, database.ErrStationNotFound):
+		errorResposne(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrPositionOutOfBounds):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aakash-tyagi/linmed/render"
+	"github.com/gorilla/mux"
+)
+
+// Sizes of a station's QR code PNG, in pixels.
+const (
+	defaultLabelSize = 512
+	minLabelSize     = 64
+	maxLabelSize     = 2048
+)
+
+// GetStationLabel returns the QR code of a station's code as a PNG, size
+// pixels square (default 512).
+func (s *Server) GetStationLabel(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	size := defaultLabelSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < minLabelSize || n > maxLabelSize {
+			errorResposne(w, http.StatusBadRequest, fmt.Sprintf("size must be between %d and %d", minLabelSize, maxLabelSize))
+			return
+		}
+		size = n
+	}
+
+	station, err := s.db.GetStation(ctx, mux.Vars(r)["stationID"])
+	if err != nil || station.FloorPlanID == nil || *station.FloorPlanID != floorPlan.ID {
+		s.Logger.Error("Failed to get station from db: ", err)
+		errorResposne(w, http.StatusNotFound, "Station not found on this floor plan")
+		return
+	}
+
+	png, err := render.QRCode(station.Code, size)
+	if err != nil {
+		s.Logger.Error("Failed to encode station qr code: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=station-%s.png", station.Code))
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+// GetFloorPlanLabels prints the labels of a floor plan's stations as a PDF
+// on Avery sheets of the layout query parameter (default L7160). start is
+// the position, counted from 1, of the first free label on the first sheet.
+func (s *Server) GetFloorPlanLabels(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	floorPlan, ok := s.requestFloorPlan(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	name := r.URL.Query().Get("layout")
+	if name == "" {
+		name = render.DefaultLabelLayout
+	}
+	layout, ok := render.LookupLabelLayout(name)
+	if !ok {
+		errorResposne(w, http.StatusBadRequest, "Unknown label layout "+name)
+		return
+	}
+
+	start := 1
+	if value := r.URL.Query().Get("start"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > layout.PerSheet() {
+			errorResposne(w, http.StatusBadRequest, fmt.Sprintf("start must be between 1 and %d", layout.PerSheet()))
+			return
+		}
+		start = n
+	}
+
+	stations, err := s.db.GetStationLabels(ctx, floorPlan.ID)
+	if err != nil {
+		s.Logger.Error("Failed to get station labels from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	labels := make([]render.StationLabel, len(stations))
+	for i, station := range stations {
+		note := floorPlan.Name
+		if station.Room != "" {
+			note = station.Room + ", " + note
+		}
+		labels[i] = render.StationLabel{Title: station.Name, Code: station.Code, Note: note}
+	}
+
+	var pdf bytes.Buffer
+	if err := render.WriteLabelSheet(&pdf, layout, labels, start-1); err != nil {
+		s.Logger.Error("Failed to write label sheet: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=floorplan-%d-labels.pdf", floorPlan.ID))
+	w.WriteHeader(http.StatusOK)
+	pdf.WriteTo(w)
+}
+
+// GetLabelLayouts lists the label sheets station labels can be printed on.
+func (s *Server) GetLabelLayouts(w http.ResponseWriter, r *http.Request) {
+	layouts := render.LabelLayouts()
+
+	res := paginatedResponse{
+		Total: len(layouts),
+		Data:  layouts,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// ScanStation resolves the code on a scanned station label to the station,
+// its devices and its open tasks.
+func (s *Server) ScanStation(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	code := mux.Vars(r)["code"]
+	if code == "" {
+		errorResposne(w, http.StatusBadRequest, "Station code is required")
+		return
+	}
+
+	scan, err := s.db.GetStationScan(ctx, code)
+	if err != nil {
+		s.Logger.Error("Failed to get scanned station from db: ", err)
+		s.stationError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, scan)
+}
@@ -3,8 +3,10 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	database "github.com/aakash-tyagi/linmed/db"
 	"github.com/aakash-tyagi/linmed/models"
 	"github.com/gorilla/mux"
 )
@@ -118,6 +120,10 @@ func (s *Server) DeleteStationProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := s.db.DeleteStationProduct(ctx, stationProductId)
+	if errors.Is(err, database.ErrEvidenceKept) {
+		errorResposne(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		s.Logger.Error("Failed to delete device: ", err)
 		errorResposne(w, http.StatusInternalServerError, err.Error())
@@ -172,3 +178,78 @@ func (s *Server) GetStationProducts(w http.ResponseWriter, r *http.Request) {
 
 	writeJSONResponse(w, http.StatusOK, res)
 }
+
+func (s *Server) MoveStationProduct(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	stationProductId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	req := models.MoveStationProductRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate device move: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	move, err := s.db.MoveStationProduct(ctx, stationProductId, req)
+	if err != nil {
+		s.Logger.Error("Failed to move device: ", err)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			errorResposne(w, http.StatusNotFound, "Device not found")
+		case errors.Is(err, database.ErrStationNotFound), errors.Is(err, database.ErrSameStation):
+			errorResposne(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, database.ErrCrossCustomerMove):
+			errorResposne(w, http.StatusForbidden, err.Error())
+		default:
+			errorResposne(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      stationProductId,
+		"move":    move,
+		"message": "Device moved successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetStationProductMoves(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	stationProductId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	moves, err := s.db.GetStationProductMoves(ctx, stationProductId)
+	if err != nil {
+		s.Logger.Error("Failed to get device moves from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(moves),
+		Data:  moves,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) AddStationTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	template := models.StationTemplate{}
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := template.Validate(); err != nil {
+		s.Logger.Error("Failed to validate station template: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.db.AddStationTemplate(ctx, template)
+	if err != nil {
+		s.Logger.Error("Failed to save station template to db: ", err)
+		s.stationTemplateError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Station template added successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetStationTemplates lists the station templates, narrowed by the
+// customer_id and station_type query parameters. A customer is offered its
+// own templates and the shared ones.
+func (s *Server) GetStationTemplates(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId := r.URL.Query().Get("customer_id")
+	stationType := r.URL.Query().Get("station_type")
+
+	templates, err := s.db.GetStationTemplates(ctx, customerId, stationType)
+	if err != nil {
+		s.Logger.Error("Failed to get station templates from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(templates),
+		Data:  templates,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetStationTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert station template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Station template id is required")
+		return
+	}
+
+	template, err := s.db.GetStationTemplate(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get station template from db: ", err)
+		s.stationTemplateError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, template)
+}
+
+func (s *Server) UpdateStationTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert station template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Station template id is required")
+		return
+	}
+
+	template := models.StationTemplate{}
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := template.Validate(); err != nil {
+		s.Logger.Error("Failed to validate station template: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.UpdateStationTemplate(ctx, id, template); err != nil {
+		s.Logger.Error("Failed to update station template: ", err)
+		s.stationTemplateError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Station template updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) DeleteStationTemplate(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert station template id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Station template id is required")
+		return
+	}
+
+	if err := s.db.DeleteStationTemplate(ctx, id); err != nil {
+		s.Logger.Error("Failed to delete station template: ", err)
+		s.stationTemplateError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"message": "Station template deleted successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// ProvisionStation creates a station on a floor plan from a template, with
+// all of the template's devices installed.
+func (s *Server) ProvisionStation(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	floorPlanId, err := s.stringToUint(mux.Vars(r)["floorPlanID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert floor plan id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Floor id is required")
+		return
+	}
+
+	req := models.ProvisionStation{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate station provisioning: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	station, err := s.db.ProvisionStation(ctx, customerId, floorPlanId, req)
+	if err != nil {
+		s.Logger.Error("Failed to provision station: ", err)
+		s.stationTemplateError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":         station.StationID,
+		"code":       station.Code,
+		"device_ids": station.DeviceIDs,
+		"message":    "Station provisioned successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) stationTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrStationTemplateNotFound):
+		errorResposne(w, http.StatusNotFound, "Station template not found")
+	case errors.Is(err, database.ErrFloorPlanNotFound):
+		errorResposne(w, http.StatusNotFound, "Floor plan not found")
+	case errors.Is(err, database.ErrCustomerNotFound), errors.Is(err, database.ErrProductNotFound),
+		errors.Is(err, database.ErrPositionOutOfBounds):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrInsufficientStock):
+		errorResposne(w, http.StatusConflict, err.Error())
+	case errors.As(err, new(validator.ValidationErrors)):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
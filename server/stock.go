@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) AddStockLocation(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	location := models.StockLocation{}
+
+	// Unmarshal the request body into the location struct
+	if err := json.NewDecoder(r.Body).Decode(&location); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// validate location
+	if err := location.Validate(); err != nil {
+		s.Logger.Error("Failed to validate stock location: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// save to db
+	id, err := s.db.AddStockLocation(ctx, location)
+	if err != nil {
+		s.Logger.Error("Failed to save stock location to db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Stock location added successfully",
+	}
+
+	// return success
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetStockLocations(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	locations, err := s.db.GetStockLocations(ctx)
+	if err != nil {
+		s.Logger.Error("Failed to get stock locations from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(locations),
+		Data:  locations,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetStockLevels(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	locationId := r.URL.Query().Get("location_id")
+	productId := r.URL.Query().Get("product_id")
+
+	levels, total, err := s.db.GetStockLevels(ctx, locationId, productId, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get stock levels from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  levels,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) AddStockMovement(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	req := models.StockMovementRequest{}
+
+	// Unmarshal the request body into the movement struct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// validate movement
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate stock movement: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	movements, err := s.db.RecordStockMovement(ctx, req)
+	if err != nil {
+		s.Logger.Error("Failed to record stock movement: ", err)
+		if errors.Is(err, database.ErrInsufficientStock) {
+			errorResposne(w, http.StatusConflict, err.Error())
+			return
+		}
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := map[string]interface{}{
+		"movements": movements,
+		"message":   "Stock movement recorded successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetStockMovements(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	locationId := r.URL.Query().Get("location_id")
+	productId := r.URL.Query().Get("product_id")
+
+	movements, total, err := s.db.GetStockMovements(ctx, locationId, productId, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get stock movements from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  movements,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) SetStockThreshold(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	locationId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert location id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Location id is required")
+		return
+	}
+
+	productId, err := s.stringToUint(mux.Vars(r)["productID"])
+	if err != nil {
+		s.Logger.Error("Failed to convert product id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Product id is required")
+		return
+	}
+
+	threshold := models.StockThreshold{}
+	if err := json.NewDecoder(r.Body).Decode(&threshold); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := threshold.Validate(); err != nil {
+		s.Logger.Error("Failed to validate stock threshold: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.SetStockThreshold(ctx, locationId, productId, threshold); err != nil {
+		s.Logger.Error("Failed to save stock threshold: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := map[string]interface{}{
+		"location_id": locationId,
+		"product_id":  productId,
+		"message":     "Reorder threshold updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetLowStock(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	locationId := r.URL.Query().Get("location_id")
+
+	items, err := s.db.GetLowStock(ctx, locationId)
+	if err != nil {
+		s.Logger.Error("Failed to get low stock report: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(items),
+		Data:  items,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) RefillStationProduct(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	stationProductId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	req := models.RefillRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate refill: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	device, err := s.db.RefillStationProduct(ctx, stationProductId, req)
+	if err != nil {
+		s.Logger.Error("Failed to refill device: ", err)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			errorResposne(w, http.StatusNotFound, "Device not found")
+		case errors.Is(err, database.ErrInsufficientStock):
+			errorResposne(w, http.StatusConflict, err.Error())
+		default:
+			errorResposne(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      stationProductId,
+		"device":  device,
+		"message": "Device refilled successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
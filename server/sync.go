@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 2000
+)
+
+// pruneSyncJob drops sync changes past the retention period. It runs as the
+// sync.prune job.
+func (s *Server) pruneSyncJob(ctx context.Context, job models.Job) error {
+	pruned, err := s.db.PruneSyncChanges(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info("Pruned sync changes: ", pruned)
+	return nil
+}
+
+// PullChanges returns the customer's data for offline use. Without a token it
+// is a full snapshot; with the token of the previous pull, what changed since.
+// limit caps the number of changed entities per response.
+func (s *Server) PullChanges(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	limit := defaultSyncLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit = convertToInt(value)
+		if limit <= 0 || limit > maxSyncLimit {
+			errorResposne(w, http.StatusBadRequest, "limit must be between 1 and 2000")
+			return
+		}
+	}
+
+	pull, err := s.db.PullChanges(ctx, customerId, r.URL.Query().Get("token"), limit)
+	if err != nil {
+		s.Logger.Error("Failed to pull changes: ", err)
+		s.syncError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, pull)
+}
+
+// PushChanges applies mutations made offline and returns how each one was
+// resolved.
+func (s *Server) PushChanges(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	customerId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert customer id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Customer id is required")
+		return
+	}
+
+	push := models.SyncPush{}
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		s.Logger.Error("Failed to decode sync push: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := push.Validate(); err != nil {
+		s.Logger.Error("Failed to validate sync push: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := s.db.PushChanges(ctx, customerId, push)
+	if err != nil {
+		s.Logger.Error("Failed to push changes: ", err)
+		s.syncError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, result)
+}
+
+func (s *Server) syncError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrCustomerNotFound):
+		errorResposne(w, http.StatusNotFound, "Customer not found")
+	case errors.Is(err, database.ErrInvalidSyncToken), errors.Is(err, database.ErrUserNotFound):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrSyncTokenExpired):
+		errorResposne(w, http.StatusGone, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	database "github.com/aakash-tyagi/linmed/db"
+	"github.com/aakash-tyagi/linmed/models"
+	"github.com/gorilla/mux"
+)
+
+// defaultWorkOrderHorizonDays is how far ahead the nightly job creates work orders.
+const defaultWorkOrderHorizonDays = 14
+
+// generateWorkOrdersJob creates work orders for due devices. It runs as the
+// workorders.generate job.
+func (s *Server) generateWorkOrdersJob(ctx context.Context, job models.Job) error {
+	req := models.GenerateWorkOrdersRequest{DueWithinDays: defaultWorkOrderHorizonDays}
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		return err
+	}
+
+	ids, err := s.db.GenerateWorkOrders(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.WithField("created", len(ids)).Info("Work orders generated")
+
+	return nil
+}
+
+func (s *Server) AddWorkOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	workOrder := models.WorkOrder{}
+
+	// Unmarshal the request body into the work order struct
+	if err := json.NewDecoder(r.Body).Decode(&workOrder); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// validate work order
+	if err := workOrder.Validate(); err != nil {
+		s.Logger.Error("Failed to validate work order: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// save to db
+	id, err := s.db.AddWorkOrder(ctx, workOrder)
+	if err != nil {
+		s.Logger.Error("Failed to save work order to db: ", err)
+		s.workOrderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"message": "Work order added successfully",
+	}
+
+	// return success
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GenerateWorkOrders(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	req := models.GenerateWorkOrdersRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate work order generation request: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ids, err := s.db.GenerateWorkOrders(ctx, req)
+	if err != nil {
+		s.Logger.Error("Failed to generate work orders: ", err)
+		s.workOrderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"ids":     ids,
+		"created": len(ids),
+		"message": "Work orders generated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetWorkOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert work order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Work order id is required")
+		return
+	}
+
+	workOrder, err := s.db.GetWorkOrder(ctx, id)
+	if err != nil {
+		s.Logger.Error("Failed to get work order from db: ", err)
+		s.workOrderError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, workOrder)
+}
+
+// GetWorkOrders lists work orders. Without a status only the work orders that
+// are still to be done are listed; status=all lists every work order.
+// customer_id, station_id, assigned_to and facility_id narrow the list.
+func (s *Server) GetWorkOrders(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	customerId := r.URL.Query().Get("customer_id")
+	stationId := r.URL.Query().Get("station_id")
+	assignedTo := r.URL.Query().Get("assigned_to")
+	status := r.URL.Query().Get("status")
+	facilityId := r.URL.Query().Get("facility_id")
+
+	workOrders, total, err := s.db.GetWorkOrders(ctx, customerId, stationId, assignedTo, status, facilityId, page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get work orders from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  workOrders,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// GetUserWorkOrders lists the work orders assigned to a technician.
+func (s *Server) GetUserWorkOrders(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	userId := mux.Vars(r)["id"]
+	if _, err := s.stringToUint(userId); err != nil {
+		s.Logger.Error("Failed to convert user id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "User id is required")
+		return
+	}
+
+	page, limit := s.validatePageLimit(r.URL.Query().Get("page"), r.URL.Query().Get("limit"))
+
+	status := r.URL.Query().Get("status")
+
+	workOrders, total, err := s.db.GetWorkOrders(ctx, "", "", userId, status, r.URL.Query().Get("facility_id"), page, limit)
+	if err != nil {
+		s.Logger.Error("Failed to get user work orders from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: total,
+		Data:  workOrders,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) AssignWorkOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert work order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Work order id is required")
+		return
+	}
+
+	assignment := models.WorkOrderAssignment{}
+	if err := json.NewDecoder(r.Body).Decode(&assignment); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := assignment.Validate(); err != nil {
+		s.Logger.Error("Failed to validate work order assignment: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.AssignWorkOrder(ctx, id, assignment.AssignedTo); err != nil {
+		s.Logger.Error("Failed to assign work order: ", err)
+		s.workOrderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":          id,
+		"assigned_to": assignment.AssignedTo,
+		"message":     "Work order assigned successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) UpdateWorkOrderStatus(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert work order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Work order id is required")
+		return
+	}
+
+	update := models.WorkOrderStatusUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := update.Validate(); err != nil {
+		s.Logger.Error("Failed to validate work order status: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.db.UpdateWorkOrderStatus(ctx, id, models.WorkOrderStatus(update.Status)); err != nil {
+		s.Logger.Error("Failed to update work order status: ", err)
+		s.workOrderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":      id,
+		"status":  update.Status,
+		"message": "Work order status updated successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) CompleteWorkOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	id, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert work order id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Work order id is required")
+		return
+	}
+
+	req := models.CompleteWorkOrderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Error("Failed to decode request body: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.Logger.Error("Failed to validate work order completion: ", err)
+		errorResposne(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := s.db.CompleteWorkOrder(ctx, id, req)
+	if err != nil {
+		s.Logger.Error("Failed to complete work order: ", err)
+		s.workOrderError(w, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"id":              id,
+		"service_records": records,
+		"message":         "Work order completed successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) GetServiceRecords(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.TODO()
+
+	stationProductId, err := s.stringToUint(mux.Vars(r)["id"])
+	if err != nil {
+		s.Logger.Error("Failed to convert device id to int: ", err)
+		errorResposne(w, http.StatusBadRequest, "Device id is required")
+		return
+	}
+
+	records, err := s.db.GetServiceRecords(ctx, stationProductId)
+	if err != nil {
+		s.Logger.Error("Failed to get service records from db: ", err)
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := paginatedResponse{
+		Total: len(records),
+		Data:  records,
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// workOrderError maps work order errors from the db layer to a response status.
+func (s *Server) workOrderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		errorResposne(w, http.StatusNotFound, "Work order not found")
+	case errors.Is(err, database.ErrStationNotFound), errors.Is(err, database.ErrUserNotFound),
+		errors.Is(err, database.ErrDeviceNotOnStation), errors.Is(err, database.ErrDeviceNotOnWorkOrder),
+		errors.Is(err, database.ErrInsufficientStock):
+		errorResposne(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrInvalidTransition), errors.Is(err, database.ErrWorkOrderUnassigned):
+		errorResposne(w, http.StatusConflict, err.Error())
+	default:
+		errorResposne(w, http.StatusInternalServerError, err.Error())
+	}
+}